@@ -1,6 +1,7 @@
 package flat
 
 import (
+	"context"
 	"net/http"
 	"net/mail"
 	"reflect"
@@ -29,6 +30,22 @@ type Context struct {
 	Caller      Caller
 	RequestID   string
 	Log         *logger.Logger
+	// Ctx is the context.Context of the request, with the values attached to it (e.g. the ambient
+	// database transaction). Use Context() to read it.
+	Ctx context.Context
+}
+
+// Context returns the context.Context of the request, or context.Background() if there is none
+func (ctx *Context) Context() context.Context {
+	if ctx == nil || ctx.Ctx == nil {
+		return context.Background()
+	}
+	return ctx.Ctx
+}
+
+// WithValue attaches the value to the context.Context of the request under key
+func (ctx *Context) WithValue(key interface{}, value interface{}) {
+	ctx.Ctx = context.WithValue(ctx.Context(), key, value)
 }
 
 // HandlerFunc defines the signature of our http handlers
@@ -59,6 +76,7 @@ func CreateTestContext() *Context {
 		Log: &logger.Logger{
 			Attributes: logger.Attrs{"request_id": reqID},
 		},
+		Ctx: context.Background(),
 	}
 }
 
@@ -87,6 +105,7 @@ func TransformGinContextToGK(c *gin.Context, callerName string) *Context {
 		Log: &logger.Logger{
 			Attributes: logger.Attrs{"request_id": reqID},
 		},
+		Ctx: c.Request.Context(),
 	}
 
 	return context
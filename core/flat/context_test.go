@@ -42,3 +42,13 @@ func TestCreateTestContext(t *testing.T) {
 	// This test is really unnecessary, but we do it as to not to penalize our code coverage
 	flat.CreateTestContext()
 }
+
+func TestContext_WithValue(t *testing.T) {
+	type key struct{}
+	ctx := flat.CreateTestContext()
+
+	ctx.WithValue(key{}, "value")
+
+	assert.EqualValues(t, "value", ctx.Context().Value(key{}))
+	assert.NotNil(t, (*flat.Context)(nil).Context())
+}
@@ -42,7 +42,8 @@ type Server struct {
 	*gin.Engine
 	Context ApplicationContext
 
-	settings settings
+	settings        settings
+	readinessChecks []namedReadinessCheck
 }
 
 // NewEngine configures the underlying gin.Engine struct of Server with a given scope, a
@@ -108,6 +109,11 @@ func NewEngine(scope string, routes RoutingGroup, opts ...Opt) (*Server, error)
 	// Setup health check handler
 	server.GET("/ping", HealthCheckHandler)
 
+	// Setup readiness handler, only when the application has dependencies to check
+	if len(server.readinessChecks) != 0 {
+		server.GET("/ready", readinessHandler(server.readinessChecks...))
+	}
+
 	// Using gintrace middleware for datadog tracing
 	if len(server.settings.AppName) != 0 {
 		server.Use(gintrace.Middleware(server.settings.AppName))
@@ -169,3 +175,11 @@ func WithAppName(name string) Opt {
 		s.settings.AppName = name
 	}
 }
+
+// WithReadinessCheck func adds a check to the /ready endpoint, which is mounted when at least one
+// check is given. For example WithReadinessCheck("database", db.Ready).
+func WithReadinessCheck(name string, check ReadinessCheck) Opt {
+	return func(s *Server) {
+		s.readinessChecks = append(s.readinessChecks, namedReadinessCheck{name: name, check: check})
+	}
+}
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
@@ -197,3 +200,33 @@ func TestValidEnvironment(t *testing.T) {
 	ass.Nil(err)
 	ass.Equal(logger.StatusInfo, env.LogLevel)
 }
+
+func TestWithReadinessCheck(t *testing.T) {
+	tt := []struct {
+		Name           string
+		Err            error
+		ExpectedStatus int
+	}{
+		{"Ready", nil, http.StatusOK},
+		{"Not ready", errors.New("service_shutdown"), http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ass := assert.New(t)
+			s, err := NewEngine("test-read", routes, WithReadinessCheck("database", func(ctx context.Context) error {
+				return tc.Err
+			}))
+			ass.Nil(err)
+			ass.Len(s.Engine.Routes(), 3)
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			ass.Equal(tc.ExpectedStatus, w.Code)
+			if tc.Err != nil {
+				ass.Contains(w.Body.String(), "Not ready: database.")
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/FlatDigital/core-go-toolkit/v2/core/libs/go/errors"
 	"github.com/gin-gonic/gin"
@@ -29,3 +32,45 @@ func NoRouteHandler() gin.HandlerFunc {
 func HealthCheckHandler(c *gin.Context) {
 	c.String(http.StatusOK, "pong")
 }
+
+// ReadinessCheckTimeout is the maximum time the readiness handler waits for its checks
+var ReadinessCheckTimeout = 2 * time.Second
+
+// ReadinessCheck returns an error when a dependency of the application can't serve requests
+type ReadinessCheck func(ctx context.Context) error
+
+type namedReadinessCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
+// readinessHandler is a handler that's used for checking if a given application instance is ready
+// to serve requests, which is when every check succeeds. Unlike HealthCheckHandler it fails while
+// the dependencies are unavailable or the application is shutting down.
+func readinessHandler(checks ...namedReadinessCheck) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), ReadinessCheckTimeout)
+		defer cancel()
+
+		failed := make([]string, 0)
+		values := make(map[string]string)
+		for _, readiness := range checks {
+			if err := readiness.check(ctx); err != nil {
+				failed = append(failed, readiness.name)
+				values[readiness.name] = err.Error()
+			}
+		}
+
+		if len(failed) != 0 {
+			errors.ReturnError(c, &errors.Error{
+				Code:    errors.ServiceUnavailableApiError,
+				Message: fmt.Sprintf("Not ready: %s.", strings.Join(failed, ", ")),
+				Values:  values,
+			})
+			c.Abort()
+			return
+		}
+
+		c.String(http.StatusOK, "ready")
+	}
+}
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/flat"
+	"github.com/FlatDigital/core-go-toolkit/v2/core/libs/go/errors"
+)
+
+// ambientKey is the key of the ambient DBContext in a context.Context
+type ambientKey struct{}
+
+// WithDBContext returns a copy of ctx carrying dbc as its ambient transaction. The Context variants
+// of the operations (SelectContext, ExecuteContext, WithTransactionContext, ...) called with ctx
+// and a nil DBContext join it while it's active. Once its transaction ended they fail with
+// ErrAmbientTransactionEnded instead of running outside of it.
+func WithDBContext(ctx context.Context, dbc *DBContext) context.Context {
+	return context.WithValue(ctx, ambientKey{}, dbc)
+}
+
+// DBContextFromContext returns the DBContext attached to ctx or nil
+func DBContextFromContext(ctx context.Context) *DBContext {
+	if ctx == nil {
+		return nil
+	}
+	dbc, _ := ctx.Value(ambientKey{}).(*DBContext)
+	return dbc
+}
+
+// AttachDBContext attaches dbc to the flat context as its ambient transaction
+func AttachDBContext(fctx *flat.Context, dbc *DBContext) {
+	fctx.WithValue(ambientKey{}, dbc)
+}
+
+// DBContextFromFlat returns the DBContext attached to the flat context or nil
+func DBContextFromFlat(fctx *flat.Context) *DBContext {
+	return DBContextFromContext(fctx.Context())
+}
+
+// ambientDBContext returns the DBContext attached to ctx if its transaction is still active
+func ambientDBContext(ctx context.Context) *DBContext {
+	dbc := DBContextFromContext(ctx)
+	if dbc == nil || dbc.tx == nil || dbc.nestingLevel <= 0 {
+		return nil
+	}
+	return dbc
+}
+
+// endedAmbient returns if dbc would run on the pool although its ctx carries an ambient DBContext,
+// which happens when the ambient transaction ended before the operation
+func endedAmbient(dbc *DBContext) bool {
+	if dbc != nil && (dbc.tx != nil || dbc.dbConn != nil) {
+		return false
+	}
+	return DBContextFromContext(dbc.context()) != nil
+}
+
+// TransactionMiddleware runs every request inside a transaction attached to the request context, so
+// handlers (and the flat.Context built by flat.Handler) join it. The transaction is committed if the
+// handlers didn't add errors to the gin context and the response status is lower than 400, otherwise
+// it's rolled back. If the transaction can't begin, can't commit or was already rolled back by a nested
+// transaction, it responds 500 unless the response was already written, which isn't changed. A handler
+// can't be re-run, so WithRetry is ignored.
+func TransactionMiddleware(db Database, opts ...TxOption) gin.HandlerFunc {
+	opts = append(opts, func(c *txConfig) {
+		c.retryPolicy = nil
+	})
+
+	return func(c *gin.Context) {
+		handled := false
+		var handlerErr error
+		err := db.WithTransactionContext(c.Request.Context(), func(dbc *DBContext) error {
+			c.Request = c.Request.WithContext(WithDBContext(c.Request.Context(), dbc))
+			nestingLevel := dbc.nestingLevel
+			c.Next()
+			handled = true
+
+			// A nested transaction without savepoints rolled back the whole transaction
+			if dbc.nestingLevel < nestingLevel {
+				return ErrAmbientTransactionEnded
+			}
+
+			if err := c.Errors.Last(); err != nil {
+				handlerErr = err
+			} else if status := c.Writer.Status(); status >= http.StatusBadRequest {
+				handlerErr = fmt.Errorf("response status %d", status)
+			}
+			return handlerErr
+		}, opts...)
+		if err == nil || err == handlerErr {
+			return
+		}
+
+		// The transaction couldn't begin or commit
+		_ = c.Error(fmt.Errorf("transaction failed: %w", err))
+		if !handled || !c.Writer.Written() {
+			errors.ReturnError(c, &errors.Error{
+				Code:    errors.InternalServerApiError,
+				Cause:   "database transaction",
+				Message: err.Error(),
+			})
+			c.Abort()
+		}
+	}
+}
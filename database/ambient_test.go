@@ -0,0 +1,228 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/flat"
+)
+
+func Test_DBContext_Attached_To_Context(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	dbc := &DBContext{}
+	fctx := flat.CreateTestContext()
+
+	// when
+	ctx := WithDBContext(context.Background(), dbc)
+	AttachDBContext(fctx, dbc)
+
+	// then
+	ass.Equal(dbc, DBContextFromContext(ctx))
+	ass.Equal(dbc, DBContextFromFlat(fctx))
+	ass.Nil(DBContextFromContext(context.Background()))
+	ass.Nil(DBContextFromFlat(flat.CreateTestContext()))
+}
+
+func Test_ExecuteContext_Joins_Ambient_Transaction(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	txMock := newDBTxMock()
+	ambient := &DBContext{tx: txMock, ctx: context.Background(), nestingLevel: 1}
+	ctx := WithDBContext(context.Background(), ambient)
+	params := []interface{}{"test@flat.mx"}
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+
+	// when
+	txMock.PatchPrepareContext(ctx, insertStmt, stmtMock, nil)
+	stmtMock.PatchExecContext(ctx, params, resultMock, nil)
+	resultMock.PatchRowsAffected(1, nil)
+	dbResult, err := service.ExecuteContext(ctx, nil, insertStmt, params...)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(int64(1), dbResult.AffectedRows())
+	txMock.AssertExpectations(t)
+}
+
+func Test_WithTransactionContext_Joins_Ambient_Transaction(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	txMock := newDBTxMock()
+	ambient := &DBContext{tx: txMock, ctx: context.Background(), nestingLevel: 1}
+	ctx := WithDBContext(context.Background(), ambient)
+
+	// when
+	var joined *DBContext
+	var nestingLevel int
+	err := service.WithTransactionContext(ctx, func(dbc *DBContext) error {
+		joined = dbc
+		nestingLevel = dbc.nestingLevel
+		return nil
+	})
+
+	// then
+	ass.Nil(err)
+	ass.Equal(ambient, joined)
+	ass.Equal(2, nestingLevel)
+	ass.Equal(1, ambient.nestingLevel)
+	txMock.AssertNotCalled(t, "Commit")
+}
+
+func Test_Context_Operations_Fail_On_Finished_Ambient_Transaction(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ambient := &DBContext{}
+	ctx := WithDBContext(context.Background(), ambient)
+
+	// when
+	_, selectErr := service.SelectContext(ctx, nil, selectStmt2, false)
+	_, executeErr := service.ExecuteContext(ctx, nil, insertStmt, "test@flat.mx")
+	_, bulkErr := service.BulkInsertContext(ctx, nil, "users", []string{"email"}, [][]interface{}{{"test@flat.mx"}})
+	txErr := service.WithTransactionContext(ctx, func(dbc *DBContext) error {
+		return nil
+	})
+
+	// then
+	ass.Nil(ambientDBContext(ctx))
+	ass.ErrorIs(selectErr, ErrAmbientTransactionEnded)
+	ass.ErrorIs(executeErr, ErrAmbientTransactionEnded)
+	ass.ErrorIs(bulkErr, ErrAmbientTransactionEnded)
+	ass.ErrorIs(txErr, ErrAmbientTransactionEnded)
+}
+
+func Test_WithTransactionContext_Joined_Ignores_Retry(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	sqlConn := newDBConnMock()
+	txMock := newDBTxMock()
+	ambient := &DBContext{tx: txMock, dbConn: sqlConn, ctx: context.Background(), nestingLevel: 1}
+	ctx := WithDBContext(context.Background(), ambient)
+
+	calls := 0
+	txFn := func(dbc *DBContext) error {
+		calls++
+		return &pq.Error{Code: "40001"}
+	}
+
+	// when
+	txMock.PatchRollback(nil)
+	sqlConn.PatchClose(nil)
+	retry := WithRetry(RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond})
+	err := service.WithTransactionContext(ctx, txFn, retry)
+	_, selectErr := service.SelectContext(ctx, nil, selectStmt2, false)
+
+	// then
+	ass.Equal(1, calls)
+	ass.Equal(&pq.Error{Code: "40001"}, err)
+	ass.ErrorIs(selectErr, ErrAmbientTransactionEnded)
+	txMock.AssertExpectations(t)
+}
+
+func Test_TransactionMiddleware(t *testing.T) {
+	tt := []struct {
+		Name       string
+		Status     int
+		HandlerErr error
+		Commit     bool
+	}{
+		{"Commit on success", http.StatusOK, nil, true},
+		{"Rollback on error status", http.StatusConflict, nil, false},
+		{"Rollback on handler error", http.StatusOK, errors.New("handler failed"), false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// given
+			ass := assert.New(t)
+			dbMock := NewMock()
+			dbc := &DBContext{}
+			dbMock.PatchBegin(nil, dbc, nil)
+			if tc.Commit {
+				dbMock.PatchCommit(dbc, nil)
+			} else {
+				dbMock.PatchRollback(dbc, nil)
+			}
+
+			router := gin.New()
+			router.Use(TransactionMiddleware(dbMock))
+			var ambient *DBContext
+			router.GET("/", flat.Handler(func(c *gin.Context, fctx *flat.Context) {
+				ambient = DBContextFromFlat(fctx)
+				if tc.HandlerErr != nil {
+					_ = c.Error(tc.HandlerErr)
+				}
+				c.Status(tc.Status)
+			}))
+
+			// when
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			// then
+			ass.Equal(tc.Status, rr.Code)
+			ass.Equal(dbc, ambient)
+		})
+	}
+}
+
+func Test_TransactionMiddleware_Begin_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	dbMock := NewMock()
+	dbMock.PatchBegin(nil, nil, errors.New("too many connections"))
+	router := gin.New()
+	router.Use(TransactionMiddleware(dbMock))
+	called := false
+	router.GET("/", func(c *gin.Context) {
+		called = true
+	})
+
+	// when
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// then
+	ass.False(called)
+	ass.Equal(http.StatusInternalServerError, rr.Code)
+}
+
+func Test_TransactionMiddleware_Nested_Rollback(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := NewFake()
+	router := gin.New()
+	router.Use(TransactionMiddleware(fake))
+	var nestedErr, executeErr error
+	router.GET("/", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		nestedErr = fake.WithTransactionContext(ctx, func(dbc *DBContext) error {
+			return errors.New("nested failed")
+		})
+		_, executeErr = fake.ExecuteContext(ctx, nil, insertStmt, "test@flat.mx")
+	})
+
+	// when
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// then
+	ass.EqualError(nestedErr, "nested failed")
+	ass.ErrorIs(executeErr, ErrAmbientTransactionEnded)
+	ass.Equal(http.StatusInternalServerError, rr.Code)
+	ass.Len(fake.Transactions(), 1)
+	ass.Equal(FakeTxRolledBack, fake.Transactions()[0].State)
+}
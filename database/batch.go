@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+var (
+	returningRegexp = regexp.MustCompile(`(?i)\b` + ReturningClause + `\b`)
+)
+
+type (
+	// Statement is a statement of ExecuteBatch
+	Statement struct {
+		Query  string
+		Params []interface{}
+	}
+
+	// BatchError is returned by ExecuteBatch when a statement fails
+	BatchError struct {
+		// Index is the position of the failed statement in the batch
+		Index int
+		Query string
+		Err   error
+	}
+)
+
+// Error returns the index of the failed statement and its error
+func (batchErr *BatchError) Error() string {
+	return fmt.Sprintf("statement %d of the batch failed: %v", batchErr.Index, batchErr.Err)
+}
+
+// Unwrap returns the error of the failed statement
+func (batchErr *BatchError) Unwrap() error {
+	return batchErr.Err
+}
+
+// ExecuteBatchContext works like ExecuteBatch, but the statements are executed using the given ctx
+func (service *service) ExecuteBatchContext(ctx context.Context, dbc *DBContext,
+	statements []Statement) ([]*DBResult, error) {
+	return service.ExecuteBatch(dbc.withContext(ctx), statements)
+}
+
+// ExecuteBatch executes the statements in order inside the transaction of dbc if it has one, otherwise
+// inside a new transaction, so either all of them are applied or none is. It returns a DBResult per
+// statement: the statements with a RETURNING clause run through Select, so their result has the
+// returned rows and as many affected rows. It stops at the first statement that fails and returns a
+// *BatchError with its index, along with the results of the statements before it.
+func (service *service) ExecuteBatch(dbc *DBContext, statements []Statement) ([]*DBResult, error) {
+	return executeBatch(service, dbc, statements)
+}
+
+// executeBatch runs ExecuteBatch on db, inside a new transaction if dbc doesn't have one
+func executeBatch(db Database, dbc *DBContext, statements []Statement) ([]*DBResult, error) {
+	// Nothing to execute
+	if len(statements) == 0 {
+		return []*DBResult{}, nil
+	}
+
+	// We have a transaction?
+	if dbc != nil && dbc.tx != nil {
+		return runBatch(db, dbc, statements)
+	}
+
+	var results []*DBResult
+	err := db.WithTransactionContext(dbc.context(), func(txDbc *DBContext) (err error) {
+		results, err = runBatch(db, txDbc, statements)
+		return err
+	})
+
+	// done
+	return results, err
+}
+
+// runBatch executes the statements in order with dbc and stops at the first one that fails
+func runBatch(db Database, dbc *DBContext, statements []Statement) ([]*DBResult, error) {
+	results := make([]*DBResult, 0, len(statements))
+	for i, statement := range statements {
+		var dbr *DBResult
+		var err error
+		if returningRegexp.MatchString(statement.Query) {
+			dbr, err = db.Select(dbc, statement.Query, false, statement.Params...)
+			if err == nil {
+				dbr = &DBResult{
+					affectedRows: int64(len(dbr.rows.DBRowArray)),
+					rows:         dbr.rows,
+					columns:      dbr.columns,
+				}
+			}
+		} else {
+			dbr, err = db.Execute(dbc, statement.Query, statement.Params...)
+		}
+		if err != nil {
+			return results, &BatchError{Index: i, Query: statement.Query, Err: err}
+		}
+		results = append(results, dbr)
+	}
+
+	// done
+	return results, nil
+}
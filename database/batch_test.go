@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ExecuteBatch_In_Tx(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{tx: txMock, ctx: ctx, nestingLevel: 1}
+	updateQuery := "UPDATE users SET active = false WHERE id = $1"
+	insertQuery := "INSERT INTO users (email) VALUES ($1) returning id"
+	updateStmt := newDBStmtMock()
+	insertStmt := newDBStmtMock()
+	resultMock := newDBResultMock()
+	rowsMock := newDBRowsMock()
+	cols := []string{"id"}
+
+	// when
+	txMock.PatchPrepareContext(ctx, updateQuery, updateStmt, nil)
+	updateStmt.PatchExecContext(ctx, []interface{}{1}, resultMock, nil)
+	resultMock.PatchRowsAffected(1, nil)
+	txMock.PatchPrepareContext(ctx, insertQuery, insertStmt, nil)
+	insertStmt.PatchQueryContext(ctx, []interface{}{"a@flat.mx"}, rowsMock, nil)
+	insertStmt.PatchClose(nil)
+	rowsMock.PatchColumns(cols, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
+	rowsMock.PatchNext(true)
+	rowsMock.PatchScan(newScanDest(cols), nil)
+	rowsMock.PatchNext(false)
+	rowsMock.PatchClose(nil)
+	results, err := service.ExecuteBatch(dbc, []Statement{
+		{Query: updateQuery, Params: []interface{}{1}},
+		{Query: insertQuery, Params: []interface{}{"a@flat.mx"}},
+	})
+
+	// then
+	ass.Nil(err)
+	ass.Len(results, 2)
+	ass.Equal(int64(1), results[0].AffectedRows())
+	ass.Equal(int64(1), results[1].AffectedRows())
+	ass.Len(results[1].GetRows(), 1)
+	txMock.AssertExpectations(t)
+}
+
+func Test_ExecuteBatch_Without_Tx_Stops_At_First_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx := context.Background()
+	connMock := newDBConnMock()
+	txMock := newDBTxMock()
+	firstStmt := newDBStmtMock()
+	secondStmt := newDBStmtMock()
+	resultMock := newDBResultMock()
+	execErr := errors.New("relation \"orders\" does not exist")
+
+	// when
+	sqlMock.PatchConn(ctx, connMock, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+	txMock.PatchPrepareContext(ctx, "DELETE FROM carts", firstStmt, nil)
+	firstStmt.PatchExecContext(ctx, nil, resultMock, nil)
+	resultMock.PatchRowsAffected(4, nil)
+	txMock.PatchPrepareContext(ctx, "DELETE FROM orders", secondStmt, nil)
+	secondStmt.PatchExecContext(ctx, nil, nil, execErr)
+	txMock.PatchRollback(nil)
+	connMock.PatchClose(nil)
+	results, err := service.ExecuteBatch(nil, []Statement{
+		{Query: "DELETE FROM carts"},
+		{Query: "DELETE FROM orders"},
+		{Query: "DELETE FROM users"},
+	})
+
+	// then
+	var batchErr *BatchError
+	ass.ErrorAs(err, &batchErr)
+	ass.Equal(1, batchErr.Index)
+	ass.Equal("DELETE FROM orders", batchErr.Query)
+	ass.ErrorIs(err, execErr)
+	ass.EqualError(err, "statement 1 of the batch failed: relation \"orders\" does not exist")
+	ass.Len(results, 1)
+	ass.Equal(int64(4), results[0].AffectedRows())
+	txMock.AssertExpectations(t)
+}
+
+func Test_ExecuteBatch_Empty(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+
+	// when
+	results, err := service.ExecuteBatch(nil, nil)
+
+	// then
+	ass.Nil(err)
+	ass.Empty(results)
+}
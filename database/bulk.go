@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// defaultBulkCopyThreshold is the amount of rows from which BulkInsert uses COPY instead of VALUES
+	defaultBulkCopyThreshold = 1000
+	// bulkValuesBatchSize is the max amount of rows inserted by each INSERT ... VALUES statement
+	bulkValuesBatchSize = 500
+	// maxBindParams is the max amount of parameters Postgres accepts in a statement
+	maxBindParams = 65535
+)
+
+var (
+	errBulkInsertNoColumns = errors.New("bulk_insert_no_columns")
+)
+
+// BulkInsertContext works like BulkInsert, but the statements are executed using the given ctx
+func (service *service) BulkInsertContext(ctx context.Context, dbc *DBContext, table string, columns []string,
+	rows [][]interface{}) (*DBResult, error) {
+	return service.BulkInsert(dbc.withContext(ctx), table, columns, rows)
+}
+
+// BulkInsert inserts rows into table. Sets smaller than the BulkCopyThreshold of the config are
+// inserted with multi-row INSERT ... VALUES statements and bigger ones with COPY FROM STDIN. It runs
+// inside the transaction of dbc if it has one, otherwise inside a new transaction (on the connection
+// of dbc if it's pinned, keeping its search_path), so either every row is inserted or none is.
+func (service *service) BulkInsert(dbc *DBContext, table string, columns []string,
+	rows [][]interface{}) (*DBResult, error) {
+	if len(columns) == 0 {
+		return nil, errBulkInsertNoColumns
+	}
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("row %d has %d values but %d columns were given", i, len(row), len(columns))
+		}
+	}
+
+	// Nothing to insert
+	if len(rows) == 0 {
+		return &DBResult{}, nil
+	}
+
+	copyThreshold := service.bulkCopyThreshold
+	if copyThreshold <= 0 {
+		copyThreshold = defaultBulkCopyThreshold
+	}
+
+	insert := service.bulkInsertValues
+	if len(rows) >= copyThreshold {
+		insert = service.bulkInsertCopy
+	}
+
+	// We have a transaction?
+	if dbc != nil && dbc.tx != nil {
+		return insert(dbc, table, columns, rows)
+	}
+
+	var result *DBResult
+	err := service.withTransactionOf(dbc, "bulk_insert", func(txDbc *DBContext) (err error) {
+		result, err = insert(txDbc, table, columns, rows)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// done
+	return result, nil
+}
+
+// bulkInsertValues inserts the rows in batches of INSERT ... VALUES statements
+func (service *service) bulkInsertValues(dbc *DBContext, table string, columns []string,
+	rows [][]interface{}) (*DBResult, error) {
+	batchSize := bulkValuesBatchSize
+	if maxRows := maxBindParams / len(columns); maxRows < batchSize {
+		batchSize = maxRows
+	}
+
+	var affectedRows int64
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		query, params := bulkInsertQuery(table, columns, rows[start:end])
+		dbr, err := service.Execute(dbc, query, params...)
+		if err != nil {
+			service.logMetric(logError, "bulk_insert", "service.Execute(dbc, query, params...)", err)
+			return nil, err
+		}
+		affectedRows += dbr.affectedRows
+	}
+
+	// done
+	return &DBResult{
+		affectedRows: affectedRows,
+	}, nil
+}
+
+// bulkInsertCopy streams the rows using COPY FROM STDIN, it must run inside a transaction
+func (service *service) bulkInsertCopy(dbc *DBContext, table string, columns []string,
+	rows [][]interface{}) (*DBResult, error) {
+	query := bulkCopyQuery(table, columns)
+	run := service.startQuery(dbc, QueryOperationExecute, query, nil)
+	dbResult, err := service.doBulkInsertCopy(dbc, query, rows)
+	run.finish(dbResult, err)
+	return dbResult, err
+}
+
+// doBulkInsertCopy runs bulkInsertCopy without the hooks
+func (service *service) doBulkInsertCopy(dbc *DBContext, query string, rows [][]interface{}) (*DBResult, error) {
+	// The COPY statement is never cached, each one is a different stream
+	stmt, err := dbc.tx.PrepareContext(dbc.ctx, query)
+	if err != nil {
+		service.logMetric(logError, "bulk_insert", "dbc.tx.PrepareContext(dbc.ctx, copy)", err)
+		return nil, err
+	}
+	defer stmt.Close()
+
+	// Buffer every row
+	for _, row := range rows {
+		_, err = stmt.ExecContext(dbc.ctx, row...)
+		if err != nil {
+			service.logMetric(logError, "bulk_insert", "stmt.ExecContext(dbc.ctx, row...)", err)
+			return nil, err
+		}
+	}
+
+	// Flush the rows
+	res, err := stmt.ExecContext(dbc.ctx)
+	if err != nil {
+		service.logMetric(logError, "bulk_insert", "stmt.ExecContext(dbc.ctx)", err)
+		return nil, err
+	}
+
+	// Get affected rows
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	// done
+	return &DBResult{
+		affectedRows: affectedRows,
+	}, nil
+}
+
+// bulkInsertQuery returns a multi-row INSERT ... VALUES statement and its params
+func bulkInsertQuery(table string, columns []string, rows [][]interface{}) (string, []interface{}) {
+	var query strings.Builder
+	params := make([]interface{}, 0, len(rows)*len(columns))
+
+	query.WriteString("INSERT INTO ")
+	query.WriteString(QuoteTable(table))
+	query.WriteString(" (")
+	query.WriteString(quoteColumns(columns))
+	query.WriteString(") VALUES ")
+	for i, row := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for j, value := range row {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			params = append(params, value)
+			fmt.Fprintf(&query, "$%d", len(params))
+		}
+		query.WriteString(")")
+	}
+
+	return query.String(), params
+}
+
+// bulkCopyQuery returns the COPY FROM STDIN statement for the table and columns
+func bulkCopyQuery(table string, columns []string) string {
+	return fmt.Sprintf("COPY %s (%s) FROM STDIN", QuoteTable(table), quoteColumns(columns))
+}
+
+// QuoteTable quotes a table name, which can be qualified with its schema, to build a query with it
+func QuoteTable(table string) string {
+	parts := strings.Split(table, ".")
+	for i, part := range parts {
+		parts[i] = pq.QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteColumns quotes and joins the column names
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = pq.QuoteIdentifier(column)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	sqlmock "github.com/FlatDigital/core-go-toolkit/v2/database/mock"
+)
+
+const (
+	bulkValuesStmt string = `INSERT INTO "public"."users" ("id", "email") VALUES ($1, $2), ($3, $4)`
+	bulkCopyStmt   string = `COPY "public"."users" ("id", "email") FROM STDIN`
+)
+
+func Test_BulkInsertQuery(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	rows := [][]interface{}{{1, "a@flat.mx"}, {2, "b@flat.mx"}}
+
+	// when
+	query, params := bulkInsertQuery("public.users", []string{"id", "email"}, rows)
+
+	// then
+	ass.Equal(bulkValuesStmt, query)
+	ass.Equal([]interface{}{1, "a@flat.mx", 2, "b@flat.mx"}, params)
+}
+
+func Test_BulkCopyQuery(t *testing.T) {
+	ass := assert.New(t)
+	ass.Equal(bulkCopyStmt, bulkCopyQuery("public.users", []string{"id", "email"}))
+	ass.Equal(`COPY "weird""name" ("id") FROM STDIN`, bulkCopyQuery(`weird"name`, []string{"id"}))
+}
+
+func Test_BulkInsert_Invalid_Row(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+
+	// when
+	dbResult, err := service.BulkInsert(nil, "users", []string{"id", "email"}, [][]interface{}{{1}})
+
+	// then
+	ass.Nil(dbResult)
+	ass.EqualError(err, "row 0 has 1 values but 2 columns were given")
+}
+
+func Test_BulkInsert_No_Columns(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+
+	// when
+	dbResult, err := service.BulkInsert(nil, "users", nil, [][]interface{}{{1}})
+
+	// then
+	ass.Nil(dbResult)
+	ass.Equal(errBulkInsertNoColumns, err)
+}
+
+func Test_BulkInsert_Values_In_Tx(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:           txMock,
+		ctx:          ctx,
+		nestingLevel: 1,
+	}
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+	rows := [][]interface{}{{1, "a@flat.mx"}, {2, "b@flat.mx"}}
+
+	// when
+	txMock.PatchPrepareContext(ctx, bulkValuesStmt, stmtMock, nil)
+	stmtMock.PatchExecContext(ctx, []interface{}{1, "a@flat.mx", 2, "b@flat.mx"}, resultMock, nil)
+	resultMock.PatchRowsAffected(2, nil)
+	dbResult, err := service.BulkInsert(dbc, "public.users", []string{"id", "email"}, rows)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(int64(2), dbResult.AffectedRows())
+	txMock.AssertExpectations(t)
+}
+
+func Test_BulkInsert_Copy_In_Tx(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.bulkCopyThreshold = 3
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:           txMock,
+		ctx:          ctx,
+		nestingLevel: 1,
+	}
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+	rows := make([][]interface{}, 3)
+	for i := range rows {
+		rows[i] = []interface{}{i, "a@flat.mx"}
+	}
+
+	// when
+	txMock.PatchPrepareContext(ctx, bulkCopyStmt, stmtMock, nil)
+	for _, row := range rows {
+		stmtMock.PatchExecContext(ctx, row, nil, nil)
+	}
+	stmtMock.PatchExecContext(ctx, nil, resultMock, nil)
+	stmtMock.PatchClose(nil)
+	resultMock.PatchRowsAffected(3, nil)
+	dbResult, err := service.BulkInsert(dbc, "public.users", []string{"id", "email"}, rows)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(int64(3), dbResult.AffectedRows())
+	stmtMock.AssertExpectations(t)
+}
+
+func Test_BulkInsert_Without_Tx_Rollback(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx := context.Background()
+	sqlConn := newDBConnMock()
+	txMock := sqlmock.NewTxMockService()
+	stmtMock := newDBStmtMock()
+	rows := [][]interface{}{{1, "a@flat.mx"}, {2, "b@flat.mx"}}
+	insertErr := errors.New("duplicate key")
+
+	// when
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+	txMock.PatchPrepareContext(ctx, bulkValuesStmt, stmtMock, nil)
+	stmtMock.PatchExecContext(ctx, []interface{}{1, "a@flat.mx", 2, "b@flat.mx"}, nil, insertErr)
+	txMock.PatchRollback(nil)
+	sqlConn.PatchClose(nil)
+	dbResult, err := service.BulkInsert(nil, "public.users", []string{"id", "email"}, rows)
+
+	// then
+	ass.Nil(dbResult)
+	ass.Equal(insertErr, err)
+	txMock.AssertExpectations(t)
+}
+
+func Test_BulkInsert_Empty(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+
+	// when
+	dbResult, err := service.BulkInsert(nil, "users", []string{"id"}, nil)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(int64(0), dbResult.AffectedRows())
+}
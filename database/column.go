@@ -2,7 +2,24 @@ package database
 
 import (
 	"fmt"
+	"math/big"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
+
+	optional "github.com/FlatDigital/core-go-toolkit/v2/core/libs/go/optional"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	// timeLayouts are the layouts accepted when a time comes as text (e.g. from a mocked DBResult)
+	timeLayouts = []string{time.RFC3339Nano, optional.YYYYMMDDHHMMSS, optional.YYYYMMDD}
+
+	// isoIntervalRegexp matches an interval in the iso_8601 IntervalStyle, e.g. P1DT2H3M4.5S
+	isoIntervalRegexp = regexp.MustCompile(
+		`^P(?:(-?\d+)Y)?(?:(-?\d+)M)?(?:(-?\d+)W)?(?:(-?\d+)D)?(?:T(?:(-?\d+)H)?(?:(-?\d+)M)?(?:(-?\d+(?:\.\d+)?)S)?)?$`)
 )
 
 // DBColumn it's a column
@@ -153,3 +170,256 @@ func (dbc *DBColumn) GetBool() (*bool, error) {
 	}
 	return &boolValue, nil
 }
+
+// GetTime returns the value of the field in time type. Text values in RFC3339 or in the
+// optional.YYYYMMDDHHMMSS and optional.YYYYMMDD layouts are parsed.
+func (dbc *DBColumn) GetTime() (*time.Time, error) {
+	if dbc.field == nil {
+		return nil, nil
+	}
+	if timeValue, ok := dbc.field.(time.Time); ok {
+		return &timeValue, nil
+	}
+
+	strValue, err := dbc.GetString()
+	if err != nil {
+		return nil, err
+	}
+	for _, layout := range timeLayouts {
+		if timeValue, err := time.Parse(layout, *strValue); err == nil {
+			return &timeValue, nil
+		}
+	}
+	return nil, fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+}
+
+// GetUUID returns the value of the field in uuid type
+func (dbc *DBColumn) GetUUID() (*uuid.UUID, error) {
+	if dbc.field == nil {
+		return nil, nil
+	}
+	if bytesValue, ok := dbc.field.([]byte); ok && len(bytesValue) == uuid.Size {
+		uuidValue, err := uuid.FromBytes(bytesValue)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+		}
+		return &uuidValue, nil
+	}
+
+	strValue, err := dbc.GetString()
+	if err != nil {
+		return nil, err
+	}
+	uuidValue, err := uuid.FromString(*strValue)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+	}
+	return &uuidValue, nil
+}
+
+// GetDecimal returns the exact value of a numeric field. NaN and infinite values are not supported.
+func (dbc *DBColumn) GetDecimal() (*big.Rat, error) {
+	if dbc.field == nil {
+		return nil, nil
+	}
+
+	var strValue string
+	switch value := dbc.field.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(value), nil
+	case float64:
+		// the shortest representation is the decimal the float came from (e.g. in a mocked DBResult)
+		strValue = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		strPtr, err := dbc.GetString()
+		if err != nil {
+			return nil, err
+		}
+		strValue = *strPtr
+	}
+
+	ratValue, ok := new(big.Rat).SetString(strValue)
+	if !ok {
+		return nil, fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+	}
+	return ratValue, nil
+}
+
+// GetJSON decodes the JSON value of the field into the given pointer, into is left untouched if the
+// field is NULL
+func (dbc *DBColumn) GetJSON(into interface{}) error {
+	if dbc.field == nil {
+		return nil
+	}
+	return jsonValue(dbc, into)
+}
+
+// GetStringArray returns the value of a text[] field, or of a JSON array of strings
+func (dbc *DBColumn) GetStringArray() ([]string, error) {
+	if dbc.field == nil {
+		return nil, nil
+	}
+	if isJSONArray(dbc.field) {
+		var arrayValue []string
+		if err := jsonValue(dbc, &arrayValue); err != nil {
+			return nil, err
+		}
+		return arrayValue, nil
+	}
+
+	var arrayValue pq.StringArray
+	if err := arrayValue.Scan(dbc.field); err != nil {
+		return nil, fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+	}
+	return arrayValue, nil
+}
+
+// GetInt64Array returns the value of an int[] field, or of a JSON array of integers
+func (dbc *DBColumn) GetInt64Array() ([]int64, error) {
+	if dbc.field == nil {
+		return nil, nil
+	}
+	if isJSONArray(dbc.field) {
+		var arrayValue []int64
+		if err := jsonValue(dbc, &arrayValue); err != nil {
+			return nil, err
+		}
+		return arrayValue, nil
+	}
+
+	var arrayValue pq.Int64Array
+	if err := arrayValue.Scan(dbc.field); err != nil {
+		return nil, fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+	}
+	return arrayValue, nil
+}
+
+// GetDuration returns the value of an interval field in the postgres or iso_8601 IntervalStyle.
+// A day is 24 hours, and intervals with months or years are an error because their duration is not
+// fixed. Numbers are taken as seconds, like the result of EXTRACT(EPOCH FROM interval).
+func (dbc *DBColumn) GetDuration() (*time.Duration, error) {
+	if dbc.field == nil {
+		return nil, nil
+	}
+
+	var durationValue time.Duration
+	switch value := dbc.field.(type) {
+	case int64:
+		durationValue = time.Duration(value) * time.Second
+	case float64:
+		durationValue = time.Duration(value * float64(time.Second))
+	default:
+		strValue, err := dbc.GetString()
+		if err != nil {
+			return nil, err
+		}
+		durationValue, err = parseInterval(*strValue)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' invalid type, value '%v': %v", dbc.name, dbc.field, err)
+		}
+	}
+	return &durationValue, nil
+}
+
+// isJSONArray returns if the raw value is a JSON array instead of a postgres array
+func isJSONArray(raw interface{}) bool {
+	switch value := raw.(type) {
+	case []byte:
+		return strings.HasPrefix(strings.TrimSpace(string(value)), "[")
+	case string:
+		return strings.HasPrefix(strings.TrimSpace(value), "[")
+	case []interface{}:
+		return true
+	}
+	return false
+}
+
+// parseInterval parses an interval like 1 day 02:03:04.5 (postgres IntervalStyle) or P1DT2H3M4.5S
+// (iso_8601 IntervalStyle)
+func parseInterval(interval string) (time.Duration, error) {
+	if strings.HasPrefix(interval, "P") {
+		return parseISOInterval(interval)
+	}
+
+	var duration time.Duration
+	fields := strings.Fields(interval)
+	for i := 0; i < len(fields); i++ {
+		// the time part, e.g. -02:03:04.5
+		if strings.Contains(fields[i], ":") {
+			clock, err := parseIntervalClock(fields[i])
+			if err != nil {
+				return 0, err
+			}
+			duration += clock
+			continue
+		}
+
+		// a quantity followed by its unit, e.g. 3 days
+		if i+1 == len(fields) {
+			return 0, fmt.Errorf("missing unit of %s", fields[i])
+		}
+		quantity, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		i++
+		switch strings.TrimSuffix(fields[i], "s") {
+		case "day":
+			duration += time.Duration(quantity) * 24 * time.Hour
+		case "mon", "year":
+			return 0, fmt.Errorf("months and years have no fixed duration")
+		default:
+			return 0, fmt.Errorf("unknown unit %s", fields[i])
+		}
+	}
+	return duration, nil
+}
+
+// parseIntervalClock parses the time part of an interval, [-]HH:MM:SS[.ffffff]
+func parseIntervalClock(clock string) (time.Duration, error) {
+	sign := ""
+	if strings.HasPrefix(clock, "-") {
+		sign = "-"
+	}
+	clock = strings.TrimLeft(clock, "+-")
+	parts := strings.Split(clock, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %s", clock)
+	}
+	return time.ParseDuration(fmt.Sprintf("%s%sh%sm%ss", sign, parts[0], parts[1], parts[2]))
+}
+
+// parseISOInterval parses an interval in the iso_8601 IntervalStyle
+func parseISOInterval(interval string) (time.Duration, error) {
+	match := isoIntervalRegexp.FindStringSubmatch(interval)
+	if match == nil || interval == "P" || strings.HasSuffix(interval, "T") {
+		return 0, fmt.Errorf("invalid interval %s", interval)
+	}
+	if match[1] != "" || match[2] != "" {
+		return 0, fmt.Errorf("months and years have no fixed duration")
+	}
+
+	var duration time.Duration
+	units := []struct {
+		value string
+		unit  string
+		scale time.Duration
+	}{
+		{match[3], "h", 7 * 24},
+		{match[4], "h", 24},
+		{match[5], "h", 1},
+		{match[6], "m", 1},
+		{match[7], "s", 1},
+	}
+	for _, part := range units {
+		if part.value == "" {
+			continue
+		}
+		partDuration, err := time.ParseDuration(part.value + part.unit)
+		if err != nil {
+			return 0, err
+		}
+		duration += partDuration * part.scale
+	}
+	return duration, nil
+}
@@ -1,8 +1,10 @@
 package database_test
 
 import (
+	"math/big"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/FlatDigital/core-go-toolkit/v2/database"
 	"github.com/stretchr/testify/assert"
@@ -390,3 +392,158 @@ func Test_GetBool_Error(t *testing.T) {
 	ass.Nil(result)
 	ass.NotNil(err)
 }
+
+func Test_GetTime_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	value := time.Date(2023, 5, 17, 10, 30, 0, 0, time.UTC)
+
+	// when
+	native, err1 := database.NewColumn(col1, value).GetTime()
+	text, err2 := database.NewColumn(col1, []byte("2023-05-17T10:30:00Z")).GetTime()
+	date, err3 := database.NewColumn(col1, "2023-05-17").GetTime()
+
+	// then
+	ass.Nil(err1)
+	ass.Nil(err2)
+	ass.Nil(err3)
+	ass.Equal(value, *native)
+	ass.True(value.Equal(*text))
+	ass.Equal("2023-05-17", date.Format("2006-01-02"))
+}
+
+func Test_GetTime_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	column := database.NewColumn(col1, valueString)
+
+	// when
+	result, err := column.GetTime()
+
+	// then
+	ass.Nil(result)
+	ass.NotNil(err)
+}
+
+func Test_GetUUID_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	value := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+	// when
+	text, err1 := database.NewColumn(col1, []byte(value)).GetUUID()
+	binary, err2 := database.NewColumn(col1, text.Bytes()).GetUUID()
+	null, err3 := (&database.DBColumn{}).GetUUID()
+	_, err4 := database.NewColumn(col1, valueString).GetUUID()
+
+	// then
+	ass.Nil(err1)
+	ass.Nil(err2)
+	ass.Nil(err3)
+	ass.NotNil(err4)
+	ass.Equal(value, text.String())
+	ass.Equal(*text, *binary)
+	ass.Nil(null)
+}
+
+func Test_GetDecimal_Is_Exact(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	// when
+	numeric, err1 := database.NewColumn(col1, []byte("12345678901234567890.123456789")).GetDecimal()
+	float, err2 := database.NewColumn(col1, 0.1).GetDecimal()
+	integer, err3 := database.NewColumn(col1, int64(7)).GetDecimal()
+	_, err4 := database.NewColumn(col1, []byte("NaN")).GetDecimal()
+
+	// then
+	ass.Nil(err1)
+	ass.Nil(err2)
+	ass.Nil(err3)
+	ass.NotNil(err4)
+	ass.Equal("12345678901234567890.123456789", numeric.FloatString(9))
+	ass.Equal(0, float.Cmp(big.NewRat(1, 10)))
+	ass.Equal(0, integer.Cmp(big.NewRat(7, 1)))
+}
+
+func Test_GetJSON(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	into := struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}{Name: "untouched"}
+
+	// when
+	errNull := (&database.DBColumn{}).GetJSON(&into)
+	nameAfterNull := into.Name
+	err := database.NewColumn(col1, []byte(`{"id": 1, "name": "flat"}`)).GetJSON(&into)
+	errInvalid := database.NewColumn(col1, []byte(`{`)).GetJSON(&into)
+
+	// then
+	ass.Nil(errNull)
+	ass.Equal("untouched", nameAfterNull)
+	ass.Nil(err)
+	ass.Equal(int64(1), into.ID)
+	ass.Equal("flat", into.Name)
+	ass.NotNil(errInvalid)
+}
+
+func Test_GetArrays(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	// when
+	strings, err1 := database.NewColumn(col1, []byte(`{a,"b c"}`)).GetStringArray()
+	jsonStrings, err2 := database.NewColumn(col1, []interface{}{"a", "b"}).GetStringArray()
+	ints, err3 := database.NewColumn(col1, []byte(`{1,-2,3}`)).GetInt64Array()
+	_, err4 := database.NewColumn(col1, []byte(`{a}`)).GetInt64Array()
+
+	// then
+	ass.Nil(err1)
+	ass.Nil(err2)
+	ass.Nil(err3)
+	ass.NotNil(err4)
+	ass.Equal([]string{"a", "b c"}, strings)
+	ass.Equal([]string{"a", "b"}, jsonStrings)
+	ass.Equal([]int64{1, -2, 3}, ints)
+}
+
+func Test_GetDuration(t *testing.T) {
+	tt := []struct {
+		Name     string
+		Value    interface{}
+		Expected time.Duration
+		Error    bool
+	}{
+		{"Time", []byte("02:03:04.5"), 2*time.Hour + 3*time.Minute + 4500*time.Millisecond, false},
+		{"Days and time", []byte("1 day -00:00:01"), 24*time.Hour - time.Second, false},
+		{"Days", "-3 days", -72 * time.Hour, false},
+		{"ISO 8601", "P1DT2H3M4.5S", 26*time.Hour + 3*time.Minute + 4500*time.Millisecond, false},
+		{"ISO 8601 weeks", "P2W", 14 * 24 * time.Hour, false},
+		{"Seconds", 1.5, 1500 * time.Millisecond, false},
+		{"Months", []byte("1 mon 2 days"), 0, true},
+		{"ISO 8601 years", "P1Y", 0, true},
+		{"Invalid", valueString, 0, true},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// given
+			ass := assert.New(t)
+			column := database.NewColumn(col1, tc.Value)
+
+			// when
+			result, err := column.GetDuration()
+
+			// then
+			if tc.Error {
+				ass.Nil(result)
+				ass.NotNil(err)
+				return
+			}
+			ass.Nil(err)
+			ass.Equal(tc.Expected, *result)
+		})
+	}
+}
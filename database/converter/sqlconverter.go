@@ -211,6 +211,15 @@ func (c *sqlConverter) QueryRow(query string, args ...interface{}) (*sql.Row, er
 	return row, nil
 }
 
+// QueryRowContext convert the real implementation from QueryRowContext in database/sql in DBer.QueryRowContext
+func (c *sqlConverter) QueryRowContext(ctx context.Context, query string, args ...interface{}) (*sql.Row, error) {
+	row := c.db.QueryRowContext(ctx, query, args...)
+	if row.Err() != nil {
+		return nil, row.Err()
+	}
+	return row, nil
+}
+
 // Exec convert the real implementation from Exec in database/sql/stmt in DBStmter.Exec
 func (c *sqlStmtConverter) Exec(args ...interface{}) (sql.Result, error) {
 	return c.stmt.Exec(args...)
@@ -238,6 +247,47 @@ func (c *sqlConnConverter) Close() error {
 	return c.conn.Close()
 }
 
+// BeginTx convert the real implementation from BeginTx in database/sql/conn in DBConner.BeginTx
+func (c *sqlConnConverter) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return c.conn.BeginTx(ctx, opts)
+}
+
+// ExecContext convert the real implementation from ExecContext in database/sql/conn in DBConner.ExecContext
+func (c *sqlConnConverter) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.conn.ExecContext(ctx, query, args...)
+}
+
+// PingContext convert the real implementation from PingContext in database/sql/conn in DBConner.PingContext
+func (c *sqlConnConverter) PingContext(ctx context.Context) error {
+	return c.conn.PingContext(ctx)
+}
+
+// PrepareContext convert the real implementation from PrepareContext in database/sql/conn in DBConner.PrepareContext
+func (c *sqlConnConverter) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return c.conn.PrepareContext(ctx, query)
+}
+
+// QueryContext convert the real implementation from QueryContext in database/sql/conn in DBConner.QueryContext
+func (c *sqlConnConverter) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.conn.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext convert the real implementation from QueryRowContext in database/sql/conn in
+// DBConner.QueryRowContext
+func (c *sqlConnConverter) QueryRowContext(ctx context.Context, query string, args ...interface{}) (*sql.Row, error) {
+	return c.conn.QueryRowContext(ctx, query, args...), nil
+}
+
+// Raw convert the real implementation from Raw in database/sql/conn in DBConner.Raw
+func (c *sqlConnConverter) Raw(f func(driverConn interface{}) error) (err error) {
+	return c.conn.Raw(f)
+}
+
+// ExecContext convert the real implementation from ExecContext in database/sql/tx in DBTxer.ExecContext
+func (c *sqlTxConverter) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.tx.ExecContext(ctx, query, args...)
+}
+
 func (c *sqlTxConverter) Commit() error {
 	return c.tx.Commit()
 }
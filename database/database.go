@@ -8,6 +8,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/FlatDigital/core-go-toolkit/v2/database/converter"
@@ -20,6 +21,11 @@ var (
 	errTransactionNil          = errors.New("trx_nil")
 	errNoLestingLevel          = errors.New("no_lesting_level")
 	errPanicOnBeginTransaction = errors.New("panic_on_begin_trx")
+
+	// ErrAmbientTransactionEnded is returned when ctx carries an ambient DBContext whose transaction
+	// already ended (e.g. a nested transaction without savepoints rolled it back), instead of running
+	// the operation on the pool outside of it
+	ErrAmbientTransactionEnded = errors.New("ambient_transaction_ended")
 )
 
 const (
@@ -31,6 +37,7 @@ type (
 	// Database service interface
 	Database interface {
 		PoolStats() sql.DBStats
+		PoolStatsByNode() map[string]sql.DBStats
 		TestConnection(dbc *DBContext) error
 		Execute(dbc *DBContext, query string, params ...interface{}) (*DBResult, error)
 		ExecuteEnsuringOneAffectedRow(dbc *DBContext, query string, params ...interface{}) error
@@ -43,8 +50,51 @@ type (
 		Commit(dbc *DBContext) error
 		Rollback(dbc *DBContext) error
 		Close(dbc *DBContext) error
-		WithTransaction(txFn func(dbc *DBContext) error) error
+		WithTransaction(txFn func(dbc *DBContext) error, opts ...TxOption) error
+
+		ExecuteContext(ctx context.Context, dbc *DBContext, query string, params ...interface{}) (*DBResult, error)
+		ExecuteEnsuringOneAffectedRowContext(ctx context.Context, dbc *DBContext, query string,
+			params ...interface{}) error
+		QueryRowContext(ctx context.Context, query string, params ...interface{}) (*sql.Row, error)
+		SelectContext(ctx context.Context, dbc *DBContext, query string, forUpdate bool,
+			params ...interface{}) (*DBResult, error)
+		SelectUniqueValueContext(ctx context.Context, dbc *DBContext, query string, forUpdate bool,
+			params ...interface{}) (*DBRow, error)
+		SelectUniqueValueNonEmptyContext(ctx context.Context, dbc *DBContext, query string, forUpdate bool,
+			params ...interface{}) (*DBRow, error)
+		ConnectionContext(ctx context.Context) (*DBContext, error)
+		BeginContext(ctx context.Context, dbc *DBContext) (*DBContext, error)
+		WithTransactionContext(ctx context.Context, txFn func(dbc *DBContext) error, opts ...TxOption) error
 		SelectOnDbLinkView(dbLink *DbLink, dbc *DBContext, query string, params ...interface{}) (*DBResult, error)
+
+		SelectStream(dbc *DBContext, query string, params ...interface{}) (RowIterator, error)
+		SelectStreamContext(ctx context.Context, dbc *DBContext, query string, params ...interface{}) (RowIterator, error)
+		SelectCursor(dbc *DBContext, query string, fetchSize int, params ...interface{}) (RowIterator, error)
+		SelectCursorContext(ctx context.Context, dbc *DBContext, query string, fetchSize int,
+			params ...interface{}) (RowIterator, error)
+
+		BulkInsert(dbc *DBContext, table string, columns []string, rows [][]interface{}) (*DBResult, error)
+		BulkInsertContext(ctx context.Context, dbc *DBContext, table string, columns []string,
+			rows [][]interface{}) (*DBResult, error)
+
+		ExecuteBatch(dbc *DBContext, statements []Statement) ([]*DBResult, error)
+		ExecuteBatchContext(ctx context.Context, dbc *DBContext, statements []Statement) ([]*DBResult, error)
+
+		Paginate(dbc *DBContext, query string, params []interface{}, request PageRequest) (*Page, error)
+
+		Ready(ctx context.Context) error
+		Shutdown(ctx context.Context) error
+
+		Notify(dbc *DBContext, channel string, payload string) error
+		NotifyContext(ctx context.Context, dbc *DBContext, channel string, payload string) error
+
+		TryLock(dbc *DBContext, key LockKey) (bool, error)
+		Lock(dbc *DBContext, key LockKey) error
+		Unlock(dbc *DBContext, key LockKey) error
+		TryLockXact(dbc *DBContext, key LockKey) (bool, error)
+		LockXact(dbc *DBContext, key LockKey) error
+		WithLock(key LockKey, fn func(dbc *DBContext) error) error
+		WithLockContext(ctx context.Context, key LockKey, fn func(dbc *DBContext) error) error
 	}
 
 	// ServiceConfig database service config
@@ -52,17 +102,70 @@ type (
 		MaxConnectionRetries int
 		DatadogMetricPrefix  string
 
-		DBHost           string
-		DBName           string
-		DBPassword       string
-		DBUsername       string
-		DBPort           int
-		MaxIdleConns     int
-		MaxOpenConns     int
-		ConnMaxLifetime  time.Duration
+		DBHost          string
+		DBName          string
+		DBPassword      string
+		DBUsername      string
+		DBPort          int
+		MaxIdleConns    int
+		MaxOpenConns    int
+		ConnMaxLifetime time.Duration
+
+		// ConnReadTimeout and ConnWriteTimeout fail a connection whose socket blocks longer than
+		// them on a single read or write. A query that takes longer than ConnReadTimeout to send
+		// its first row fails too, so they must be higher than StatementTimeout.
 		ConnReadTimeout  *time.Duration
 		ConnWriteTimeout *time.Duration
 		ConnTimeout      *time.Duration
+
+		// SSLMode is one of SSLModeDisable (default), SSLModeRequire, SSLModeVerifyCA or
+		// SSLModeVerifyFull. SSLRootCert, SSLCert and SSLKey are paths to PEM files.
+		SSLMode     string
+		SSLRootCert string
+		SSLCert     string
+		SSLKey      string
+
+		// Session settings of every connection of the pool
+		ApplicationName                 string
+		SearchPath                      []string
+		StatementTimeout                *time.Duration
+		LockTimeout                     *time.Duration
+		IdleInTransactionSessionTimeout *time.Duration
+
+		// UseSavepoints makes nested calls to Begin create a savepoint, so a nested Rollback only
+		// discards the work done since the matching Begin instead of the whole transaction
+		UseSavepoints bool
+
+		// ReadReplicas receive the selects that run without a DBContext and without forUpdate,
+		// everything else goes to the primary. Replicas that fail the health check are ejected
+		// until they recover.
+		ReadReplicas               []ReplicaConfig
+		ReplicaBalancer            ReplicaBalancer
+		ReplicaHealthCheckInterval time.Duration
+
+		// StmtCacheSize is how many prepared statements are kept per pool and per transaction,
+		// so the hottest queries are not prepared on every call. Zero disables the cache.
+		StmtCacheSize int
+
+		// BulkCopyThreshold is the amount of rows from which BulkInsert uses COPY instead of
+		// INSERT ... VALUES, 1000 by default
+		BulkCopyThreshold int
+
+		// QueryHooks are called before and after every Select and Execute, in order. See
+		// NewMetricsQueryHook, NewSlowQueryHook and NewTraceQueryHook.
+		QueryHooks []QueryHook
+
+		// PoolStatsInterval is how often the open, in use and idle connections of the pools, and the
+		// waits for a connection, are recorded as application.<prefix>.db.pool.* gauges. Zero disables it.
+		PoolStatsInterval time.Duration
+
+		// PaginationSecret signs the cursors of Paginate, which fails without it. It must be the same
+		// in every instance of the application, so the cursors issued by one are valid in the others.
+		PaginationSecret string
+
+		// TenantSchemas returns the search_path of a tenant (see WithTenant). By default it's the
+		// schema named like the tenant.
+		TenantSchemas func(tenant string) ([]string, error)
 	}
 
 	// DBContext database transaction token
@@ -78,6 +181,18 @@ type (
 		db                   converter.DBer
 		maxConnectionRetries int
 		datadogMetricPrefix  string
+		useSavepoints        bool
+		replicas             *replicaSet
+		stmts                *stmtCache
+		stmtCacheSize        int
+		txStmts              *sync.Map
+		bulkCopyThreshold    int
+		hooks                []QueryHook
+		lifecycle            *lifecycle
+		paginationSecret     []byte
+		tenantSchemas        func(tenant string) ([]string, error)
+		tenants              *sync.Map
+		sessionLocks         *sync.Map
 	}
 
 	logType string
@@ -92,6 +207,35 @@ const (
 	logSuccess logType = "success"
 )
 
+// context returns the context carried by the DBContext, or context.Background() if there is none
+func (dbc *DBContext) context() context.Context {
+	if dbc == nil || dbc.ctx == nil {
+		return context.Background()
+	}
+	return dbc.ctx
+}
+
+// InTransaction returns if the DBContext has an active transaction
+func (dbc *DBContext) InTransaction() bool {
+	return dbc != nil && dbc.tx != nil && dbc.nestingLevel > 0
+}
+
+// withContext returns a copy of the DBContext that runs its queries using the given ctx.
+// A nil DBContext joins the ambient transaction of ctx if there is one, otherwise it becomes
+// one without tx or dbConn, so the query runs on the pool unless ctx carries an ambient
+// DBContext that already ended (see endedAmbient).
+func (dbc *DBContext) withContext(ctx context.Context) *DBContext {
+	if dbc == nil {
+		if ambient := ambientDBContext(ctx); ambient != nil {
+			return ambient.withContext(ctx)
+		}
+		return &DBContext{ctx: ctx}
+	}
+	dbcCopy := *dbc
+	dbcCopy.ctx = ctx
+	return &dbcCopy
+}
+
 // NewService returns a database service interface
 func NewService(config ServiceConfig) (Database, error) {
 	// connection for MySQL
@@ -102,32 +246,7 @@ func NewService(config ServiceConfig) (Database, error) {
 	if config.DBPort == 0 {
 		config.DBPort = defaultDbPort
 	}
-	connectionString := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		config.DBHost, config.DBPort, config.DBUsername, config.DBPassword, config.DBName)
-
-	// DOC: https://www.postgresql.org/docs/current/libpq-connect.html#LIBPQ-CONNSTRING
-	// pq dsn not support read_timeout & write_timeout
-
-	// if config has ConnReadTimeout set, appends readTimeout param
-	// if config.ConnReadTimeout != nil {
-	// 	connectionString = fmt.Sprintf("%s read_timeout=%v", connectionString, config.ConnReadTimeout.Seconds())
-	// }
-
-	// // // if config has ConnWriteTimeout set, appends writeTimeout param
-	// if config.ConnWriteTimeout != nil {
-	// 	connectionString = fmt.Sprintf("%s write_timeout=%v", connectionString, config.ConnWriteTimeout.Seconds())
-	// }
-
-	// // if config has ConnTimeout set, appends timeout param
-	if config.ConnTimeout != nil {
-		connectionString = fmt.Sprintf("%s connect_timeout=%v", connectionString, config.ConnTimeout.Seconds())
-	}
-	db, err := sql.Open("postgres", connectionString)
-	db.SetMaxIdleConns(config.MaxIdleConns)
-	db.SetMaxOpenConns(config.MaxOpenConns)
-	connMaxLifetime := config.ConnMaxLifetime * time.Second
-	db.SetConnMaxLifetime(connMaxLifetime)
+	db, err := openDB(config, config.DBHost, config.DBPort)
 	if err != nil {
 		return nil, err
 	}
@@ -151,6 +270,53 @@ func NewService(config ServiceConfig) (Database, error) {
 		db:                   sqllib,
 		maxConnectionRetries: retries,
 		datadogMetricPrefix:  metricPrefix,
+		useSavepoints:        config.UseSavepoints,
+		stmts:                newStmtCache(config.StmtCacheSize),
+		stmtCacheSize:        config.StmtCacheSize,
+		txStmts:              &sync.Map{},
+		bulkCopyThreshold:    config.BulkCopyThreshold,
+		hooks:                config.QueryHooks,
+		lifecycle:            newLifecycle(),
+		paginationSecret:     []byte(config.PaginationSecret),
+		tenantSchemas:        config.TenantSchemas,
+		tenants:              &sync.Map{},
+		sessionLocks:         &sync.Map{},
+	}
+
+	// open the read replicas
+	if len(config.ReadReplicas) > 0 {
+		replicas := &replicaSet{
+			balancer: config.ReplicaBalancer,
+		}
+		for _, replica := range config.ReadReplicas {
+			if replica.DBPort == 0 {
+				replica.DBPort = defaultDbPort
+			}
+			replicaDB, err := openDB(config, replica.DBHost, replica.DBPort)
+			if err != nil {
+				return nil, err
+			}
+			name := fmt.Sprintf("%s:%d", replica.DBHost, replica.DBPort)
+			node := newReplicaNode(name, converter.SQLToDBer(replicaDB))
+			node.stmts = newStmtCache(config.StmtCacheSize)
+			replicas.nodes = append(replicas.nodes, node)
+		}
+		service.replicas = replicas
+
+		interval := config.ReplicaHealthCheckInterval
+		if interval <= 0 {
+			interval = defaultReplicaHealthCheckInterval
+		}
+		service.lifecycle.run(func(stop <-chan struct{}) {
+			service.watchReplicas(interval, stop)
+		})
+	}
+
+	// report the pool stats
+	if config.PoolStatsInterval > 0 {
+		service.lifecycle.run(func(stop <-chan struct{}) {
+			service.reportPoolStats(config.PoolStatsInterval, stop)
+		})
 	}
 
 	// done
@@ -159,11 +325,37 @@ func NewService(config ServiceConfig) (Database, error) {
 
 // Connection returns a new connection that can be used to execute queries always in the same connection
 func (service *service) Connection() (*DBContext, error) {
+	return service.ConnectionContext(context.Background())
+}
+
+// ConnectionContext returns a new connection bound to the given ctx. Every query executed with
+// the returned DBContext is cancelled when ctx is done. If ctx carries a tenant, its search_path
+// is set in the session until Close.
+func (service *service) ConnectionContext(ctx context.Context) (*DBContext, error) {
+	dbc, err := service.connection(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tenant := TenantFromContext(ctx); tenant != "" {
+		if err := service.setSessionTenant(dbc, tenant); err != nil {
+			_ = service.Close(dbc)
+			return nil, err
+		}
+	}
+
+	// done
+	return dbc, nil
+}
+
+// connection returns a new connection bound to the given ctx, retrying up to maxConnectionRetries
+func (service *service) connection(ctx context.Context) (*DBContext, error) {
+	if err := service.checkAccepting(nil); err != nil {
+		return nil, err
+	}
 	var dbctx *DBContext
 	var err error
 
-	// Obtain the ctx
-	ctx := context.Background()
 	for retry := 0; retry < service.maxConnectionRetries; retry++ {
 		// Obtain the connection
 		conn, err := service.db.Conn(ctx)
@@ -177,7 +369,7 @@ func (service *service) Connection() (*DBContext, error) {
 			tx:           nil,  // we don't have a tx
 			nestingLevel: 0,    // init with nestingLevel as 0
 			dbConn:       conn, // set the connection
-			ctx:          ctx,  // use the ctx obtained previously
+			ctx:          ctx,  // use the ctx received
 		}
 
 		err = service.TestConnection(dbctx)
@@ -219,6 +411,19 @@ func (service *service) Close(dbc *DBContext) error {
 		return fmt.Errorf("you are closing a connection with an active transaction")
 	}
 
+	// A session holding advisory locks can't go back to the pool, ending it releases them
+	if service.heldLocks(dbc.dbConn) > 0 {
+		service.removeTenant(dbc.dbConn)
+		service.discardConn(dbc)
+		return nil
+	}
+
+	// The connection goes back to the pool with its default search_path
+	if service.sessionTenant(dbc.dbConn) != "" && !service.resetSessionTenant(dbc) {
+		// The connection was discarded
+		return nil
+	}
+
 	// Close the connection
 	err := dbc.dbConn.Close()
 	if err != nil {
@@ -234,7 +439,19 @@ func (service *service) Close(dbc *DBContext) error {
 }
 
 // Begin starts a transaction in the database
-func (service *service) Begin(inDbc *DBContext) (outDbc *DBContext, err error) {
+func (service *service) Begin(inDbc *DBContext) (*DBContext, error) {
+	return service.BeginContext(inDbc.context(), inDbc)
+}
+
+// BeginContext starts a transaction in the database bound to the given ctx. If the transaction
+// was already started (nested Begin), the ctx of the outer transaction is kept.
+func (service *service) BeginContext(ctx context.Context, inDbc *DBContext) (*DBContext, error) {
+	return service.begin(ctx, inDbc, nil)
+}
+
+// begin starts a transaction with the given options, which are ignored if the transaction was already started
+func (service *service) begin(ctx context.Context, inDbc *DBContext,
+	txOptions *sql.TxOptions) (outDbc *DBContext, err error) {
 	// recover from any panic.
 	// Known issue in the following "if" block, dbc should be nill after the "or" operator
 	// It might be a race condition with multiple routines setting dbc to nil
@@ -249,15 +466,23 @@ func (service *service) Begin(inDbc *DBContext) (outDbc *DBContext, err error) {
 		}
 	}()
 
+	// Without a dbc we join the ambient transaction of ctx, if there is one
+	if inDbc == nil {
+		inDbc = ambientDBContext(ctx)
+		if inDbc == nil && DBContextFromContext(ctx) != nil {
+			return nil, ErrAmbientTransactionEnded
+		}
+	}
+
 	outDbc = inDbc
 	// If we don't have a dbc, we create one calling Connection()
 	// We also support the case in which both tx and dbConn are nil,
 	// in this case we threat everything like a nil dbc.
 	if outDbc == nil || (outDbc.tx == nil && outDbc.dbConn == nil) {
-		// Create a new connection
-		newDbc, err := service.Connection()
+		// Create a new connection, the tenant is set in the transaction
+		newDbc, err := service.connection(ctx)
 		if err != nil {
-			service.logMetric(logError, "begin", "service.Connection()", err)
+			service.logMetric(logError, "begin", "service.connection(ctx)", err)
 			return nil, err
 		}
 
@@ -274,15 +499,40 @@ func (service *service) Begin(inDbc *DBContext) (outDbc *DBContext, err error) {
 
 	// If the nesting level is 0, we start a real transaction
 	if outDbc.nestingLevel == 0 {
+		// The transaction runs with the ctx of the caller
+		outDbc.ctx = ctx
+
 		// We begin a real transaction
-		tx, err := service.db.BeginTx(outDbc.ctx, nil)
+		tx, err := service.db.BeginTx(outDbc.ctx, txOptions)
 		if err != nil {
-			service.logMetric(logError, "begin", "service.db.BeginTx(outDbc.ctx, nil)", err)
+			service.logMetric(logError, "begin", "service.db.BeginTx(outDbc.ctx, txOptions)", err)
 			return nil, err
 		}
 
 		// Set into the dbc
 		outDbc.tx = tx
+		service.addTxStmtCache(tx)
+
+		// The transaction runs with the search_path of the tenant of the connection or of ctx
+		tenant := service.sessionTenant(outDbc.dbConn)
+		if tenant == "" {
+			tenant = TenantFromContext(ctx)
+		}
+		if tenant != "" {
+			if err := service.setLocalTenant(outDbc, tenant); err != nil {
+				outDbc.nestingLevel = 1
+				_ = service.Rollback(outDbc)
+				return nil, err
+			}
+		}
+	} else if service.useSavepoints {
+		// We create a savepoint for the nested transaction
+		savepoint := savepointName(outDbc.nestingLevel)
+		_, err := outDbc.tx.ExecContext(outDbc.context(), "SAVEPOINT "+savepoint)
+		if err != nil {
+			service.logMetric(logError, "begin", "outDbc.tx.ExecContext(SAVEPOINT)", err)
+			return nil, err
+		}
 	}
 
 	// Increment the nesting level counter
@@ -315,8 +565,12 @@ func (service *service) Commit(dbc *DBContext) error {
 	// We only trigger a Commit() if we are reaching 0
 	if dbc.nestingLevel == 1 {
 		err := dbc.tx.Commit()
+		// The tx is finished even if the commit failed, so its tenant and statements are forgotten anyway
+		service.removeTenant(dbc.tx)
+		service.removeTxStmtCache(dbc.tx)
 		if err != nil {
 			service.logMetric(logError, "commit", "dbc.tx.Commit()", err)
+			service.closeFailedTx(dbc, "commit")
 			return err
 		}
 
@@ -330,6 +584,14 @@ func (service *service) Commit(dbc *DBContext) error {
 			service.logMetric(logError, "commit", "service.Close(dbc)", err)
 			return err
 		}
+	} else if service.useSavepoints {
+		// We release the savepoint of the nested transaction
+		savepoint := savepointName(dbc.nestingLevel - 1)
+		_, err := dbc.tx.ExecContext(dbc.context(), "RELEASE SAVEPOINT "+savepoint)
+		if err != nil {
+			service.logMetric(logError, "commit", "dbc.tx.ExecContext(RELEASE SAVEPOINT)", err)
+			return err
+		}
 	}
 
 	// We decrease the nesting level
@@ -360,10 +622,31 @@ func (service *service) Rollback(dbc *DBContext) error {
 		return fmt.Errorf("the dbc.tx was not set before call Rollback()")
 	}
 
+	// In a nested transaction we only rollback to its savepoint, keeping the outer transaction alive
+	if dbc.nestingLevel > 1 && service.useSavepoints {
+		savepoint := savepointName(dbc.nestingLevel - 1)
+		_, err := dbc.tx.ExecContext(dbc.context(),
+			fmt.Sprintf("ROLLBACK TO SAVEPOINT %s; RELEASE SAVEPOINT %s", savepoint, savepoint))
+		if err != nil {
+			service.logMetric(logError, "rollback", "dbc.tx.ExecContext(ROLLBACK TO SAVEPOINT)", err)
+			return err
+		}
+
+		// We only leave the nested transaction
+		dbc.nestingLevel--
+
+		// done
+		return nil
+	}
+
 	// We do the rollback
 	err := dbc.tx.Rollback()
+	// The tx is finished even if the rollback failed, so its tenant and statements are forgotten anyway
+	service.removeTenant(dbc.tx)
+	service.removeTxStmtCache(dbc.tx)
 	if err != nil {
 		service.logMetric(logError, "rollback", "dbc.tx.Rollback()", err)
+		service.closeFailedTx(dbc, "rollback")
 		return err
 	}
 
@@ -385,11 +668,47 @@ func (service *service) Rollback(dbc *DBContext) error {
 	return nil
 }
 
+// closeFailedTx releases the connection of a transaction whose commit or rollback failed. The
+// transaction is over anyway, and keeping the connection would leak it on every retry.
+func (service *service) closeFailedTx(dbc *DBContext, scope string) {
+	dbc.tx = nil
+	dbc.nestingLevel = 0
+	if err := service.Close(dbc); err != nil {
+		service.logMetric(logError, scope, "service.Close(dbc)", err)
+	}
+}
+
+// savepointName returns the name of the savepoint created by a Begin at the given nesting level
+func savepointName(nestingLevel int) string {
+	return fmt.Sprintf("sp_%d", nestingLevel)
+}
+
 // WithTransaction is a high order function that manages the beginning, rollback and commit of a transaction so the
 // developer doesn't have to worry about rollback in every error or catching panics.
-func (service *service) WithTransaction(txFn func(dbc *DBContext) error) (err error) {
+// The opts allow to set the isolation level, read-only mode and a retry policy for serialization failures.
+func (service *service) WithTransaction(txFn func(dbc *DBContext) error, opts ...TxOption) error {
+	return service.WithTransactionContext(context.Background(), txFn, opts...)
+}
+
+// WithTransactionContext works like WithTransaction, but the transaction is bound to the given ctx.
+// If ctx is cancelled the in-flight query is aborted and the transaction is rolled back.
+// WithRetry is ignored when it joins the ambient transaction of ctx, as a retry would run outside of it.
+func (service *service) WithTransactionContext(ctx context.Context, txFn func(dbc *DBContext) error,
+	opts ...TxOption) error {
+	config := newTxConfig(opts...)
+	if ambientDBContext(ctx) != nil {
+		config.retryPolicy = nil
+	}
+	return service.withRetry(ctx, config, func() error {
+		return service.runTransaction(ctx, txFn, config.txOptions())
+	})
+}
+
+// runTransaction runs txFn inside a new transaction, committing or rolling it back depending on the result
+func (service *service) runTransaction(ctx context.Context, txFn func(dbc *DBContext) error,
+	txOptions *sql.TxOptions) (err error) {
 	// Starts a new transaction
-	txContext, err := service.Begin(nil)
+	txContext, err := service.begin(ctx, nil, txOptions)
 	if err != nil {
 		return err
 	}
@@ -403,7 +722,7 @@ func (service *service) WithTransaction(txFn func(dbc *DBContext) error) (err er
 			// Rollbacks the transaction if the txFn returns an error
 			rollbackErr := service.Rollback(txContext)
 			if rollbackErr != nil {
-				err = fmt.Errorf("error rollbacking transaction: %s, %s", rollbackErr, err)
+				err = fmt.Errorf("error rollbacking transaction: %s, %w", rollbackErr, err)
 			}
 		} else {
 			// Commits the transaction
@@ -416,15 +735,64 @@ func (service *service) WithTransaction(txFn func(dbc *DBContext) error) (err er
 	return err
 }
 
+// withTransactionOf runs txFn in a new transaction for an operation on dbc, which has none. If dbc has
+// a pinned connection the transaction is begun on it, so it runs in the same session (search_path,
+// dblink connections, ...) and the connection stays open, otherwise WithTransactionContext is used.
+func (service *service) withTransactionOf(dbc *DBContext, scope string, txFn func(txDbc *DBContext) error) error {
+	if dbc == nil || dbc.dbConn == nil {
+		return service.WithTransactionContext(dbc.context(), txFn)
+	}
+
+	tx, err := dbc.dbConn.BeginTx(dbc.context(), nil)
+	if err != nil {
+		service.logMetric(logError, scope, "dbc.dbConn.BeginTx(dbc.context(), nil)", err)
+		return err
+	}
+	txDbc := &DBContext{tx: converter.SQLTxToDBTxer(tx), dbConn: dbc.dbConn, ctx: dbc.ctx, nestingLevel: 1}
+	service.addTxStmtCache(txDbc.tx)
+	defer service.removeTxStmtCache(txDbc.tx)
+
+	if err := txFn(txDbc); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			service.logMetric(logError, scope, "tx.Rollback()", rollbackErr)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		service.logMetric(logError, scope, "tx.Commit()", err)
+		return err
+	}
+
+	// done
+	return nil
+}
+
+// SelectContext works like Select, but the query is executed using the given ctx
+func (service *service) SelectContext(ctx context.Context, dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) (*DBResult, error) {
+	return service.Select(dbc.withContext(ctx), query, forUpdate, params...)
+}
+
 // Select does a select in the database and process results returning a Map
 func (service *service) Select(dbc *DBContext, query string, forUpdate bool, params ...interface{}) (*DBResult, error) {
+	if err := service.checkAccepting(dbc); err != nil {
+		return nil, err
+	}
+	run := service.startQuery(dbc, QueryOperationSelect, query, params)
+	dbResult, err := service.doSelect(dbc, query, forUpdate, params...)
+	run.finish(dbResult, err)
+	return dbResult, err
+}
+
+// doSelect runs Select without the hooks
+func (service *service) doSelect(dbc *DBContext, query string, forUpdate bool, params ...interface{}) (*DBResult, error) {
 	// Add a "FOR UPDATE" at the end of the query if we have a true forUpdate flag.
 	if forUpdate {
 		query = regexp.MustCompile(`(?i)(FOR UPDATE|)(;|)$`).ReplaceAllString(strings.Trim(query, " "), " FOR UPDATE")
 	}
 
 	// Do the query and interpret results
-	rows, err := service.doQuery(service.db, dbc, query, params...)
+	rows, err := service.doQuery(service.readDB(dbc, query, forUpdate), dbc, query, params...)
 	if err != nil {
 		return nil, err
 	}
@@ -435,6 +803,11 @@ func (service *service) Select(dbc *DBContext, query string, forUpdate bool, par
 	if err != nil {
 		return nil, err
 	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	duplicates := duplicateColumns(cols)
 
 	isInsertQueryOperation, err := regexp.MatchString("\\b"+InsertOperation+"\\b", strings.ToUpper(query))
 	if err != nil {
@@ -449,28 +822,13 @@ func (service *service) Select(dbc *DBContext, query string, forUpdate bool, par
 	// Build the DbRows
 	dbRowArray := make(DBRowArray, 0)
 	for rows.Next() {
-		// Builds columnPointers as an array with pointers
-		columns := make([]interface{}, len(cols))
-		columnPointers := make([]interface{}, len(cols))
-		for i := range columns {
-			columnPointers[i] = &columns[i]
-		}
-		if err := rows.Scan(columnPointers...); err != nil {
+		dbRow, err := scanDBRow(rows, cols, duplicates)
+		if err != nil {
 			return nil, err
 		}
 
-		// Create a DBColumns
-		dbColumns := make(DBColumns)
-		for i, colName := range cols {
-			val := *columnPointers[i].(*interface{})
-			dbColumns[colName] = DBColumn{
-				name:  colName,
-				field: val,
-			}
-		}
-
 		// 23-09-2022 - Add retrocompatibility for INSERT querys with RETURNING clause without tx
-		if isQueryWithReturningClause && isInsertQueryOperation && dbc == nil {
+		if isQueryWithReturningClause && isInsertQueryOperation && (dbc == nil || (dbc.tx == nil && dbc.dbConn == nil)) {
 			// Check error
 			err = rows.Close()
 			if err != nil {
@@ -479,16 +837,47 @@ func (service *service) Select(dbc *DBContext, query string, forUpdate bool, par
 		}
 
 		// Append column into DBRowArray
-		dbRowArray = append(dbRowArray, DBRow{columns: dbColumns})
+		dbRowArray = append(dbRowArray, dbRow)
 	}
 
 	// done
 	return &DBResult{
 		affectedRows: 0,
 		rows:         DBRows{dbRowArray},
+		columns:      newColumnInfos(cols, colTypes, duplicates),
 	}, nil
 }
 
+// scanDBRow scans the current row of rows into a DBRow, duplicates are the names shared by more than
+// one of the cols
+func scanDBRow(rows converter.DBRowser, cols []string, duplicates map[string]struct{}) (DBRow, error) {
+	// Builds columnPointers as an array with pointers
+	columns := make([]interface{}, len(cols))
+	columnPointers := make([]interface{}, len(cols))
+	for i := range columns {
+		columnPointers[i] = &columns[i]
+	}
+	if err := rows.Scan(columnPointers...); err != nil {
+		return DBRow{}, err
+	}
+
+	// Create a DBColumns
+	dbColumns := make(DBColumns)
+	ordered := make([]DBColumn, len(cols))
+	for i, colName := range cols {
+		val := *columnPointers[i].(*interface{})
+		ordered[i] = DBColumn{
+			name:  colName,
+			field: val,
+		}
+		// As always, the last column with the name is the one read by name
+		dbColumns[colName] = ordered[i]
+	}
+
+	// done
+	return DBRow{columns: dbColumns, ordered: ordered, duplicates: duplicates}, nil
+}
+
 // SelectUniqueValue selects and returns the first row
 func (service *service) SelectUniqueValue(dbc *DBContext, query string,
 	forUpdate bool, params ...interface{}) (*DBRow, error) {
@@ -507,6 +896,12 @@ func (service *service) SelectUniqueValue(dbc *DBContext, query string,
 	return &dbResult.rows.DBRowArray[0], nil
 }
 
+// SelectUniqueValueContext works like SelectUniqueValue, but the query is executed using the given ctx
+func (service *service) SelectUniqueValueContext(ctx context.Context, dbc *DBContext, query string,
+	forUpdate bool, params ...interface{}) (*DBRow, error) {
+	return service.SelectUniqueValue(dbc.withContext(ctx), query, forUpdate, params...)
+}
+
 // SelectUniqueValueNonEmpty selects and returns the first row and error if it don't exists
 func (service *service) SelectUniqueValueNonEmpty(dbc *DBContext, query string,
 	forUpdate bool, params ...interface{}) (*DBRow, error) {
@@ -520,6 +915,12 @@ func (service *service) SelectUniqueValueNonEmpty(dbc *DBContext, query string,
 	return dbRow, nil
 }
 
+// SelectUniqueValueNonEmptyContext works like SelectUniqueValueNonEmpty, but the query is executed using the given ctx
+func (service *service) SelectUniqueValueNonEmptyContext(ctx context.Context, dbc *DBContext, query string,
+	forUpdate bool, params ...interface{}) (*DBRow, error) {
+	return service.SelectUniqueValueNonEmpty(dbc.withContext(ctx), query, forUpdate, params...)
+}
+
 // query executes a query inside a given transaction (if you have one)
 func (service *service) doQuery(db converter.DBer, dbc *DBContext, query string,
 	params ...interface{}) (converter.DBRowser, error) {
@@ -531,51 +932,71 @@ func (service *service) doQuery(db converter.DBer, dbc *DBContext, query string,
 	if dbc != nil && (dbc.tx != nil || dbc.dbConn != nil) {
 		// We have a transaction?
 		if dbc.tx != nil {
-			// Prepare the query
-			stmt, err := dbc.tx.PrepareContext(dbc.ctx, query)
+			// Prepare the query and execute inside the transaction
+			err := service.withStmt(service.txStmtCache(dbc.tx), stmtScopeTx, query, func() (converter.DBStmter, error) {
+				stmt, err := dbc.tx.PrepareContext(dbc.ctx, query)
+				if err != nil {
+					service.logMetric(logError, "do_query", "dbc.tx.PrepareContext(dbc.ctx, query)", err)
+				}
+				return stmt, err
+			}, func(stmt converter.DBStmter) (err error) {
+				rows, err = stmt.QueryContext(dbc.ctx, params...)
+				if err != nil {
+					service.logMetric(logError, "do_query", "txstmt.QueryContext(dbc.ctx, params...)", err)
+				}
+				return err
+			})
 			if err != nil {
-				service.logMetric(logError, "do_query", "dbc.tx.PrepareContext(dbc.ctx, query)", err)
 				return nil, err
 			}
-
-			// Execute inside the transaction
-			rows, err = stmt.QueryContext(dbc.ctx, params...)
+		} else if dbc.dbConn != nil {
+			// Execute in the pinned connection, so the query sees its session (search_path, locks, ...).
+			// It's not prepared, the statements of the pool can't run in a given connection.
+			connRows, err := dbc.dbConn.QueryContext(dbc.context(), query, params...)
 			if err != nil {
-				service.logMetric(logError, "do_query", "txstmt.QueryContext(dbc.ctx, params...)", err)
+				service.logMetric(logError, "do_query", "dbc.dbConn.QueryContext(dbc.ctx, query, params...)", err)
 				return nil, err
 			}
-		} else if dbc.dbConn != nil {
-			// Prepare the query
+			rows = connRows
+		} else {
+			// Not possible
+			return nil, fmt.Errorf("you have sent a dbc without tx or dbConn")
+		}
+	} else if dbc != nil && dbc.ctx != nil {
+		// We don't have a connection, but we have a context
+		err := service.withStmt(service.stmtCacheFor(db), stmtScopeDB, query, func() (converter.DBStmter, error) {
 			stmt, err := db.PrepareContext(dbc.ctx, query)
 			if err != nil {
 				service.logMetric(logError, "do_query", "db.PrepareContext(dbc.ctx, query)", err)
-				return nil, err
 			}
-			defer stmt.Close()
-
-			// Execute using the context
+			return stmt, err
+		}, func(stmt converter.DBStmter) (err error) {
 			rows, err = stmt.QueryContext(dbc.ctx, params...)
 			if err != nil {
 				service.logMetric(logError, "do_query", "stmt.QueryContext(dbc.ctx, params...)", err)
-				return nil, err
 			}
-		} else {
-			// Not possible
-			return nil, fmt.Errorf("you have sent a dbc without tx or dbConn")
-		}
-	} else {
-		// We don't have a connection
-		stmt, err := db.Prepare(query)
+			return err
+		})
 		if err != nil {
-			service.logMetric(logError, "do_query", "db.Prepare(query)", err)
 			return nil, err
 		}
-		defer stmt.Close()
-
-		// Execute without context
-		rows, err = stmt.Query(params...)
+	} else {
+		// We don't have a connection
+		err := service.withStmt(service.stmtCacheFor(db), stmtScopeDB, query, func() (converter.DBStmter, error) {
+			stmt, err := db.Prepare(query)
+			if err != nil {
+				service.logMetric(logError, "do_query", "db.Prepare(query)", err)
+			}
+			return stmt, err
+		}, func(stmt converter.DBStmter) (err error) {
+			// Execute without context
+			rows, err = stmt.Query(params...)
+			if err != nil {
+				service.logMetric(logError, "do_query", "stmt.Query(params...)", err)
+			}
+			return err
+		})
 		if err != nil {
-			service.logMetric(logError, "do_query", "stmt.Query(params...)", err)
 			return nil, err
 		}
 	}
@@ -596,9 +1017,21 @@ func (service *service) ExecuteEnsuringOneAffectedRow(dbc *DBContext, query stri
 	return nil
 }
 
+// ExecuteEnsuringOneAffectedRowContext works like ExecuteEnsuringOneAffectedRow, but the query is executed
+// using the given ctx
+func (service *service) ExecuteEnsuringOneAffectedRowContext(ctx context.Context, dbc *DBContext, query string,
+	params ...interface{}) error {
+	return service.ExecuteEnsuringOneAffectedRow(dbc.withContext(ctx), query, params...)
+}
+
 // QueryRow executes a query inside a given transaction (if you have one) and return to modify element
 func (service *service) QueryRow(query string, params ...interface{}) (*sql.Row, error) {
+	if err := service.checkAccepting(nil); err != nil {
+		return nil, err
+	}
+	run := service.startQuery(nil, QueryOperationSelect, query, params)
 	row, err := service.db.QueryRow(query, params...)
+	run.finish(nil, err)
 	if err != nil {
 		service.logMetric(logError, "query_row", "db.Query(query,params...)", err)
 		return nil, err
@@ -606,8 +1039,41 @@ func (service *service) QueryRow(query string, params ...interface{}) (*sql.Row,
 	return row, nil
 }
 
+// QueryRowContext works like QueryRow, but the query is executed using the given ctx
+func (service *service) QueryRowContext(ctx context.Context, query string, params ...interface{}) (*sql.Row, error) {
+	dbc := &DBContext{ctx: ctx}
+	if err := service.checkAccepting(dbc); err != nil {
+		return nil, err
+	}
+	run := service.startQuery(dbc, QueryOperationSelect, query, params)
+	row, err := service.db.QueryRowContext(ctx, query, params...)
+	run.finish(nil, err)
+	if err != nil {
+		service.logMetric(logError, "query_row", "db.QueryRowContext(ctx, query, params...)", err)
+		return nil, err
+	}
+	return row, nil
+}
+
+// ExecuteContext works like Execute, but the query is executed using the given ctx
+func (service *service) ExecuteContext(ctx context.Context, dbc *DBContext, query string,
+	params ...interface{}) (*DBResult, error) {
+	return service.Execute(dbc.withContext(ctx), query, params...)
+}
+
 // Execute executes a query inside a given transaction (if you have one)
 func (service *service) Execute(dbc *DBContext, query string, params ...interface{}) (*DBResult, error) {
+	if err := service.checkAccepting(dbc); err != nil {
+		return nil, err
+	}
+	run := service.startQuery(dbc, QueryOperationExecute, query, params)
+	dbResult, err := service.doExecute(dbc, query, params...)
+	run.finish(dbResult, err)
+	return dbResult, err
+}
+
+// doExecute runs Execute without the hooks
+func (service *service) doExecute(dbc *DBContext, query string, params ...interface{}) (*DBResult, error) {
 	// Result
 	var res sql.Result
 
@@ -617,51 +1083,70 @@ func (service *service) Execute(dbc *DBContext, query string, params ...interfac
 	if dbc != nil && (dbc.tx != nil || dbc.dbConn != nil) {
 		// We have a transaction?
 		if dbc.tx != nil {
-			// Prepare the query
-			stmt, err := dbc.tx.PrepareContext(dbc.ctx, query)
+			// Prepare the query and execute inside the transaction
+			err := service.withStmt(service.txStmtCache(dbc.tx), stmtScopeTx, query, func() (converter.DBStmter, error) {
+				stmt, err := dbc.tx.PrepareContext(dbc.ctx, query)
+				if err != nil {
+					service.logMetric(logError, "execute", "dbc.tx.PrepareContext(dbc.ctx, query)", err)
+				}
+				return stmt, err
+			}, func(stmt converter.DBStmter) (err error) {
+				res, err = stmt.ExecContext(dbc.ctx, params...)
+				if err != nil {
+					service.logMetric(logError, "execute", "txstmt.ExecContext(dbc.ctx, params...)", err)
+				}
+				return err
+			})
 			if err != nil {
-				service.logMetric(logError, "execute", "dbc.tx.PrepareContext(dbc.ctx, query)", err)
 				return nil, err
 			}
-
-			// Execute inside the transaction
-			res, err = stmt.ExecContext(dbc.ctx, params...)
+		} else if dbc.dbConn != nil {
+			// Execute in the pinned connection, so the query sees its session (search_path, locks, ...)
+			connRes, err := dbc.dbConn.ExecContext(dbc.context(), query, params...)
 			if err != nil {
-				service.logMetric(logError, "execute", "txstmt.ExecContext(dbc.ctx, params...)", err)
+				service.logMetric(logError, "execute", "dbc.dbConn.ExecContext(dbc.ctx, query, params...)", err)
 				return nil, err
 			}
-		} else if dbc.dbConn != nil {
-			// Prepare the query
+			res = connRes
+		} else {
+			// Not possible
+			return nil, fmt.Errorf("you have sent a dbc without tx or dbConn")
+		}
+	} else if dbc != nil && dbc.ctx != nil {
+		// We don't have a connection, but we have a context
+		err := service.withStmt(service.stmts, stmtScopeDB, query, func() (converter.DBStmter, error) {
 			stmt, err := service.db.PrepareContext(dbc.ctx, query)
 			if err != nil {
 				service.logMetric(logError, "execute", "service.db.PrepareContext(dbc.ctx, query)", err)
-				return nil, err
 			}
-			defer stmt.Close()
-
-			// Execute using the context
+			return stmt, err
+		}, func(stmt converter.DBStmter) (err error) {
 			res, err = stmt.ExecContext(dbc.ctx, params...)
 			if err != nil {
 				service.logMetric(logError, "execute", "stmt.ExecContext(dbc.ctx, params...)", err)
-				return nil, err
 			}
-		} else {
-			// Not possible
-			return nil, fmt.Errorf("you have sent a dbc without tx or dbConn")
-		}
-	} else {
-		// We don't have a connection
-		stmt, err := service.db.Prepare(query)
+			return err
+		})
 		if err != nil {
-			service.logMetric(logError, "execute", "service.db.Prepare(query)", err)
 			return nil, err
 		}
-		defer stmt.Close()
-
-		// Execute without context
-		res, err = stmt.Exec(params...)
+	} else {
+		// We don't have a connection
+		err := service.withStmt(service.stmts, stmtScopeDB, query, func() (converter.DBStmter, error) {
+			stmt, err := service.db.Prepare(query)
+			if err != nil {
+				service.logMetric(logError, "execute", "service.db.Prepare(query)", err)
+			}
+			return stmt, err
+		}, func(stmt converter.DBStmter) (err error) {
+			// Execute without context
+			res, err = stmt.Exec(params...)
+			if err != nil {
+				service.logMetric(logError, "execute", "stmt.Exec(params...)", err)
+			}
+			return err
+		})
 		if err != nil {
-			service.logMetric(logError, "execute", "stmt.Exec(params...)", err)
 			return nil, err
 		}
 	}
@@ -695,22 +1180,45 @@ func (service *service) logMetric(logType logType, operation string, detail stri
 		string(logType)), 1, tags.ToArray()...)
 }
 
+// SelectOnDbLinkView opens the dblink connection, runs the query and closes the connection, even
+// if the query fails, unless the DbLink reuses it. The dblink connection lives in the database
+// session, so everything runs in the transaction of dbc or in a new one if there is none, begun on
+// the connection of dbc if it's pinned.
 func (service *service) SelectOnDbLinkView(dbLink *DbLink, dbc *DBContext, query string, params ...interface{}) (*DBResult, error) {
+	// We have a transaction?
+	if dbc != nil && dbc.tx != nil {
+		return service.selectOnDbLinkView(dbLink, dbc, query, params...)
+	}
+
+	var result *DBResult
+	err := service.withTransactionOf(dbc, "dblink", func(txDbc *DBContext) (err error) {
+		result, err = service.selectOnDbLinkView(dbLink, txDbc, query, params...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// done
+	return result, nil
+}
+
+// selectOnDbLinkView runs SelectOnDbLinkView inside the transaction of dbc
+func (service *service) selectOnDbLinkView(dbLink *DbLink, dbc *DBContext, query string,
+	params ...interface{}) (*DBResult, error) {
 	_, err := service.Execute(dbc, dbLink.OpenConnection())
 	if err != nil {
 		return nil, err
 	}
-	var result *DBResult
-	if params != nil {
-		result, err = service.Select(dbc, query, false, params...)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		result, err = service.Select(dbc, query, false)
-		if err != nil {
-			return nil, err
-		}
+	if dbLink.Reuse {
+		return service.Select(dbc, query, false, params...)
+	}
+
+	// A failed query aborts the transaction, the savepoint lets us disconnect anyway
+	_, err = service.Execute(dbc, "SAVEPOINT "+dbLinkSavepoint)
+	if err != nil {
+		service.logMetric(logError, "execute", "dblink savepoint", err)
+		return nil, err
 	}
 	defer func() {
 		_, err := service.Execute(dbc, dbLink.CloseConnection())
@@ -718,6 +1226,23 @@ func (service *service) SelectOnDbLinkView(dbLink *DbLink, dbc *DBContext, query
 			service.logMetric(logError, "execute", "close dblink connection", err)
 		}
 	}()
-	return result, nil
 
+	result, err := service.Select(dbc, query, false, params...)
+	if err != nil {
+		_, rollbackErr := service.Execute(dbc, "ROLLBACK TO SAVEPOINT "+dbLinkSavepoint)
+		if rollbackErr != nil {
+			service.logMetric(logError, "execute", "dblink rollback to savepoint", rollbackErr)
+		}
+		return nil, err
+	}
+
+	// The savepoint is no longer needed
+	_, err = service.Execute(dbc, "RELEASE SAVEPOINT "+dbLinkSavepoint)
+	if err != nil {
+		service.logMetric(logError, "execute", "dblink release savepoint", err)
+		return nil, err
+	}
+
+	// done
+	return result, nil
 }
@@ -2,14 +2,17 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/FlatDigital/core-go-toolkit/v2/database/converter"
 	sqlmock "github.com/FlatDigital/core-go-toolkit/v2/database/mock"
 )
 
@@ -858,9 +861,8 @@ func Test_WithTransaction_Rollback_Error(t *testing.T) {
 	err := service.WithTransaction(txFn)
 
 	// then
-	expectedErr := errors.New("error rollbacking transaction: rollback error, txFn error")
-	ass.NotNil(err)
-	ass.EqualValues(expectedErr, err)
+	ass.EqualError(err, "error rollbacking transaction: rollback error, txFn error")
+	ass.ErrorIs(err, firstErr)
 }
 
 func Test_Select_Success(t *testing.T) {
@@ -887,6 +889,7 @@ func Test_Select_Success(t *testing.T) {
 
 	// when
 	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
 	rowsMock.PatchClose(nil)
 	rowsMock.PatchNext(true)
 	rowsMock.PatchScan(columnPointers, nil)
@@ -930,6 +933,7 @@ func Test_Select_Success_With_Tx(t *testing.T) {
 
 	// when
 	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
 	rowsMock.PatchClose(nil)
 	rowsMock.PatchNext(true)
 	rowsMock.PatchScan(columnPointers, nil)
@@ -959,77 +963,19 @@ func Test_Select_Success_With_Conn(t *testing.T) {
 		ctx:    ctx,
 		dbConn: connMock,
 	}
-	query := selectStmt2
-	queryForUpdate := selectStmt
-	stmtMock := newDBStmtMock()
-	rowsMock := newDBRowsMock()
-	params := make([]interface{}, 0)
-	params = append(params, 3)
-	columns := []string{"columnA", "columnB", "columnC"}
-	columnsAux := make([]interface{}, len(columns))
-	columnPointers := make([]interface{}, len(columns))
-	for i := range columnsAux {
-		columnPointers[i] = &columnsAux[i]
-	}
+	params := []interface{}{3}
 
 	// when
-	rowsMock.PatchColumns(columns, nil)
-	rowsMock.PatchClose(nil)
-	rowsMock.PatchNext(true)
-	rowsMock.PatchScan(columnPointers, nil)
-	rowsMock.PatchNext(false)
-	stmtMock.PatchQueryContext(ctx, params, rowsMock, nil)
-	stmtMock.PatchClose(nil)
-	sqlMock.PatchPrepareContext(ctx, queryForUpdate, stmtMock, nil)
-	dbResult, err := service.Select(dbc, query, true, params...)
+	connMock.PatchQueryContext(ctx, selectStmt, params, queryDriverRows(t), nil)
+	dbResult, err := service.Select(dbc, selectStmt2, true, params...)
 
 	// then
 	ass.NotNil(dbResult)
 	ass.Nil(err)
-}
-
-func Test_Select_Success_With_Conn_PrepareContext_Error(t *testing.T) {
-	// given
-	ass := assert.New(t)
-
-	ctx := context.Background()
-	config := ServiceConfig{
-		MaxConnectionRetries: 1,
-	}
-	service, sqlMock := newMockService(config)
-	connMock := newDBConnMock()
-	dbc := &DBContext{
-		tx:     nil,
-		ctx:    ctx,
-		dbConn: connMock,
-	}
-	query := selectStmt2
-	queryForUpdate := selectStmt
-	stmtMock := newDBStmtMock()
-	rowsMock := newDBRowsMock()
-	params := make([]interface{}, 0)
-	params = append(params, 3)
-	columns := []string{"columnA", "columnB", "columnC"}
-	columnsAux := make([]interface{}, len(columns))
-	columnPointers := make([]interface{}, len(columns))
-	for i := range columnsAux {
-		columnPointers[i] = &columnsAux[i]
-	}
-
-	// when
-	rowsMock.PatchColumns(columns, nil)
-	rowsMock.PatchClose(nil)
-	rowsMock.PatchNext(true)
-	rowsMock.PatchScan(columnPointers, nil)
-	rowsMock.PatchNext(false)
-	stmtMock.PatchQueryContext(ctx, params, rowsMock, nil)
-	stmtMock.PatchClose(nil)
-	sqlMock.PatchPrepareContext(ctx, queryForUpdate, stmtMock, errors.New("test_query_err"))
-	dbResult, err := service.Select(dbc, query, true, params...)
-
-	// then
-	ass.Nil(dbResult)
-	ass.NotNil(err)
+	ass.Len(dbResult.Columns(), 4)
+	// the query runs in the pinned connection, not in another one of the pool
+	ass.True(connMock.AssertExpectations(t))
+	sqlMock.AssertNotCalled(t, "PrepareContext", ctx, selectStmt)
 }
 
 func Test_Select_Success_With_Conn_QueryContext_Err(t *testing.T) {
@@ -1040,40 +986,22 @@ func Test_Select_Success_With_Conn_QueryContext_Err(t *testing.T) {
 	config := ServiceConfig{
 		MaxConnectionRetries: 1,
 	}
-	service, sqlMock := newMockService(config)
+	service, _ := newMockService(config)
 	connMock := newDBConnMock()
 	dbc := &DBContext{
 		tx:     nil,
 		ctx:    ctx,
 		dbConn: connMock,
 	}
-	query := selectStmt2
-	queryForUpdate := selectStmt
-	stmtMock := newDBStmtMock()
-	rowsMock := newDBRowsMock()
-	params := make([]interface{}, 0)
-	params = append(params, 3)
-	columns := []string{"columnA", "columnB", "columnC"}
-	columnsAux := make([]interface{}, len(columns))
-	columnPointers := make([]interface{}, len(columns))
-	for i := range columnsAux {
-		columnPointers[i] = &columnsAux[i]
-	}
+	params := []interface{}{3}
 
 	// when
-	rowsMock.PatchColumns(columns, nil)
-	rowsMock.PatchClose(nil)
-	rowsMock.PatchNext(true)
-	rowsMock.PatchScan(columnPointers, nil)
-	rowsMock.PatchNext(false)
-	stmtMock.PatchQueryContext(ctx, params, rowsMock, errors.New("test_query_err"))
-	stmtMock.PatchClose(nil)
-	sqlMock.PatchPrepareContext(ctx, queryForUpdate, stmtMock, nil)
-	dbResult, err := service.Select(dbc, query, true, params...)
+	connMock.PatchQueryContext(ctx, selectStmt, params, nil, errors.New("test_query_err"))
+	dbResult, err := service.Select(dbc, selectStmt2, true, params...)
 
 	// then
 	ass.Nil(dbResult)
-	ass.NotNil(err)
+	ass.EqualError(err, "test_query_err")
 }
 
 func Test_Select_Prepare_Error(t *testing.T) {
@@ -1146,6 +1074,7 @@ func Test_SelectUniqueValue_No_Result(t *testing.T) {
 
 	// when
 	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
 	rowsMock.PatchClose(nil)
 	rowsMock.PatchNext(false)
 	stmtMock.PatchQuery(params, rowsMock, nil)
@@ -1182,6 +1111,7 @@ func Test_SelectUniqueValue_Many_Result(t *testing.T) {
 
 	// when
 	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
 	rowsMock.PatchClose(nil)
 	rowsMock.PatchNext(true)
 	rowsMock.PatchScan(columnPointers, nil)
@@ -1222,6 +1152,7 @@ func Test_SelectUniqueValueNonEmpty_Success(t *testing.T) {
 
 	// when
 	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
 	rowsMock.PatchClose(nil)
 	rowsMock.PatchNext(true)
 	rowsMock.PatchScan(columnPointers, nil)
@@ -1258,6 +1189,7 @@ func Test_SelectUniqueValueNonEmptyWithInsertStmt_Error(t *testing.T) {
 
 	// when
 	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
 	rowsMock.PatchClose(errors.New("test error"))
 	// One more for defer()
 	rowsMock.PatchClose(errors.New("test error"))
@@ -1321,6 +1253,7 @@ func Test_SelectUniqueValueNonEmpty_No_Result(t *testing.T) {
 
 	// when
 	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
 	rowsMock.PatchClose(nil)
 	rowsMock.PatchNext(false)
 	stmtMock.PatchQuery(params, rowsMock, nil)
@@ -1532,59 +1465,23 @@ func Test_Execute_With_Conn(t *testing.T) {
 		dbConn: connMock,
 	}
 	query := selectStmt2
-	stmtMock := newDBStmtMock()
-	params := make([]interface{}, 0)
-	params = append(params, 3)
-
+	params := []interface{}{3}
 	resultMock := newDBResultMock()
 
 	// when
 	resultMock.PatchRowsAffected(3, nil)
-	stmtMock.PatchExecContext(ctx, params, resultMock, nil)
-	stmtMock.PatchClose(nil)
-	sqlMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+	connMock.PatchExecContext(ctx, query, params, resultMock, nil)
 	dbResult, err := service.Execute(dbc, query, params...)
 
 	// then
-	ass.NotNil(dbResult)
 	ass.Nil(err)
+	ass.Equal(int64(3), dbResult.AffectedRows())
+	// the query runs in the pinned connection, not in another one of the pool
+	ass.True(connMock.AssertExpectations(t))
+	sqlMock.AssertNotCalled(t, "PrepareContext", ctx, query)
 }
 
-func Test_Execute_With_Conn_PrepareContext_Error(t *testing.T) {
-	// given
-	ass := assert.New(t)
-
-	ctx := context.Background()
-	config := ServiceConfig{
-		MaxConnectionRetries: 1,
-	}
-	service, sqlMock := newMockService(config)
-	connMock := newDBConnMock()
-	dbc := &DBContext{
-		tx:     nil,
-		ctx:    ctx,
-		dbConn: connMock,
-	}
-	query := selectStmt2
-	stmtMock := newDBStmtMock()
-	params := make([]interface{}, 0)
-	params = append(params, 3)
-
-	resultMock := newDBResultMock()
-
-	// when
-	resultMock.PatchRowsAffected(3, nil)
-	stmtMock.PatchExecContext(ctx, params, resultMock, nil)
-	stmtMock.PatchClose(nil)
-	sqlMock.PatchPrepareContext(ctx, query, stmtMock, errors.New("test_execute_err"))
-	dbResult, err := service.Execute(dbc, query, params...)
-
-	// then
-	ass.Nil(dbResult)
-	ass.NotNil(err)
-}
-
-func Test_Execute_With_Conn_Stmt_ExecuteContext_Err(t *testing.T) {
+func Test_Execute_With_Conn_ExecContext_Err(t *testing.T) {
 	// given
 	ass := assert.New(t)
 
@@ -1592,7 +1489,7 @@ func Test_Execute_With_Conn_Stmt_ExecuteContext_Err(t *testing.T) {
 	config := ServiceConfig{
 		MaxConnectionRetries: 1,
 	}
-	service, sqlMock := newMockService(config)
+	service, _ := newMockService(config)
 	connMock := newDBConnMock()
 	dbc := &DBContext{
 		tx:     nil,
@@ -1600,22 +1497,15 @@ func Test_Execute_With_Conn_Stmt_ExecuteContext_Err(t *testing.T) {
 		dbConn: connMock,
 	}
 	query := selectStmt2
-	stmtMock := newDBStmtMock()
-	params := make([]interface{}, 0)
-	params = append(params, 3)
-
-	resultMock := newDBResultMock()
+	params := []interface{}{3}
 
 	// when
-	resultMock.PatchRowsAffected(3, nil)
-	stmtMock.PatchExecContext(ctx, params, resultMock, errors.New("test_execute_err"))
-	stmtMock.PatchClose(nil)
-	sqlMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+	connMock.PatchExecContext(ctx, query, params, nil, errors.New("test_execute_err"))
 	dbResult, err := service.Execute(dbc, query, params...)
 
 	// then
 	ass.Nil(dbResult)
-	ass.NotNil(err)
+	ass.EqualError(err, "test_execute_err")
 }
 
 func Test_Execute_RowsAffected_Error(t *testing.T) {
@@ -1674,15 +1564,25 @@ func TestService_SelectOnDbLinkView_Success(t *testing.T) {
 	service, sqlMock := newMockService(ServiceConfig{
 		MaxConnectionRetries: 1,
 	})
+	ctx := context.Background()
 	dblinkConnMock, _ := NewDbLinkConnection("test", "127.0.0.1", uint(1234), "usrtest", "pass123", "db_test")
-	//dblink open connection
+	//without dbc everything runs in a new transaction
+	sqlConn := newDBConnMock()
+	txMock := newDBTxMock()
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+	//dblink open connection, savepoint, release and close connection
 	stmtMock := newDBStmtMock()
-	resultDbLinkOpenConnMock := newDBResultMock()
-	resultDbLinkOpenConnMock.PatchRowsAffected(1, nil)
-	stmtMock.PatchExec(nil, resultDbLinkOpenConnMock, nil)
-	stmtMock.PatchClose(nil)
+	resultMock := newDBResultMock()
 	dbLinkOpenConn := "SELECT * FROM dblink_connect('test', 'host=127.0.0.1 port=1234 dbname=db_test user=usrtest password=pass123')"
-	sqlMock.PatchPrepare(dbLinkOpenConn, stmtMock, nil)
+	dbLinkCloseConn := "SELECT dblink_disconnect('test')"
+	for _, query := range []string{dbLinkOpenConn, "SAVEPOINT dblink_view", "RELEASE SAVEPOINT dblink_view",
+		dbLinkCloseConn} {
+		txMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+		stmtMock.PatchExecContext(ctx, nil, resultMock, nil)
+		resultMock.PatchRowsAffected(1, nil)
+	}
 	//dblink query
 	stDbLinkMock := newDBStmtMock()
 	rowsDblinkMock := newDBRowsMock()
@@ -1693,43 +1593,43 @@ func TestService_SelectOnDbLinkView_Success(t *testing.T) {
 		columnPointers[i] = &columnsAux[i]
 	}
 	rowsDblinkMock.PatchColumns(columns, nil)
+	rowsDblinkMock.PatchColumnTypes(nil, nil)
 	rowsDblinkMock.PatchClose(nil)
 	rowsDblinkMock.PatchNext(true)
 	rowsDblinkMock.PatchScan(columnPointers, nil)
 	rowsDblinkMock.PatchNext(false)
-	stDbLinkMock.PatchQuery(nil, rowsDblinkMock, nil)
-	stDbLinkMock.PatchClose(nil)
+	stDbLinkMock.PatchQueryContext(ctx, nil, rowsDblinkMock, nil)
 	queryDbLink := "SELECT * FROM test"
-	sqlMock.PatchPrepare(queryDbLink, stDbLinkMock, nil)
-
-	//dblink close connection
-	stmtCloseConnMock := newDBStmtMock()
-	resultDbLinkOpenConnMock2 := newDBResultMock()
-	resultDbLinkOpenConnMock2.PatchRowsAffected(1, nil)
-	stmtCloseConnMock.PatchExec(nil, resultDbLinkOpenConnMock2, nil)
-	stmtCloseConnMock.PatchClose(nil)
-	dbLinkCloseConn := "SELECT dblink_disconnect('test')"
-	sqlMock.PatchPrepare(dbLinkCloseConn, stmtCloseConnMock, nil)
+	txMock.PatchPrepareContext(ctx, queryDbLink, stDbLinkMock, nil)
+	txMock.PatchCommit(nil)
+	sqlConn.PatchClose(nil)
 
 	queryDbLinkMock := "SELECT * FROM test"
 	dbResult, err := service.SelectOnDbLinkView(dblinkConnMock, nil, queryDbLinkMock)
 	assert.NotNil(t, dbResult)
 	assert.NoError(t, err)
+	txMock.AssertExpectations(t)
 }
 
 func TestService_SelectOnDbLinkView_SuccessWithParams(t *testing.T) {
-	service, sqlMock := newMockService(ServiceConfig{
+	service, _ := newMockService(ServiceConfig{
 		MaxConnectionRetries: 1,
 	})
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{tx: txMock, ctx: ctx, nestingLevel: 1}
 	dblinkConnMock, _ := NewDbLinkConnection("test", "127.0.0.1", uint(1234), "usrtest", "pass123", "db_test")
-	//dblink open connection
+	//dblink open connection, savepoint, release and close connection
 	stmtMock := newDBStmtMock()
-	resultDbLinkOpenConnMock := newDBResultMock()
-	resultDbLinkOpenConnMock.PatchRowsAffected(1, nil)
-	stmtMock.PatchExec(nil, resultDbLinkOpenConnMock, nil)
-	stmtMock.PatchClose(nil)
+	resultMock := newDBResultMock()
 	dbLinkOpenConn := "SELECT * FROM dblink_connect('test', 'host=127.0.0.1 port=1234 dbname=db_test user=usrtest password=pass123')"
-	sqlMock.PatchPrepare(dbLinkOpenConn, stmtMock, nil)
+	dbLinkCloseConn := "SELECT dblink_disconnect('test')"
+	for _, query := range []string{dbLinkOpenConn, "SAVEPOINT dblink_view", "RELEASE SAVEPOINT dblink_view",
+		dbLinkCloseConn} {
+		txMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+		stmtMock.PatchExecContext(ctx, nil, resultMock, nil)
+		resultMock.PatchRowsAffected(1, nil)
+	}
 	//dblink query
 	stDbLinkMock := newDBStmtMock()
 	rowsDblinkMock := newDBRowsMock()
@@ -1740,125 +1640,609 @@ func TestService_SelectOnDbLinkView_SuccessWithParams(t *testing.T) {
 		columnPointers[i] = &columnsAux[i]
 	}
 	rowsDblinkMock.PatchColumns(columns, nil)
+	rowsDblinkMock.PatchColumnTypes(nil, nil)
 	rowsDblinkMock.PatchClose(nil)
 	rowsDblinkMock.PatchNext(true)
 	rowsDblinkMock.PatchScan(columnPointers, nil)
 	rowsDblinkMock.PatchNext(false)
 	queryParams := []interface{}{1}
-	stDbLinkMock.PatchQuery(queryParams, rowsDblinkMock, nil)
-	stDbLinkMock.PatchClose(nil)
+	stDbLinkMock.PatchQueryContext(ctx, queryParams, rowsDblinkMock, nil)
 	queryDbLink := "SELECT * FROM test where id=?"
-	sqlMock.PatchPrepare(queryDbLink, stDbLinkMock, nil)
-
-	//dblink close connection
-	stmtCloseConnMock := newDBStmtMock()
-	resultDbLinkOpenConnMock2 := newDBResultMock()
-	resultDbLinkOpenConnMock2.PatchRowsAffected(1, nil)
-	stmtCloseConnMock.PatchExec(nil, resultDbLinkOpenConnMock2, nil)
-	stmtCloseConnMock.PatchClose(nil)
-	dbLinkCloseConn := "SELECT dblink_disconnect('test')"
-	sqlMock.PatchPrepare(dbLinkCloseConn, stmtCloseConnMock, nil)
+	txMock.PatchPrepareContext(ctx, queryDbLink, stDbLinkMock, nil)
 
 	queryDbLinkMock := "SELECT * FROM test where id=?"
-	dbResult, err := service.SelectOnDbLinkView(dblinkConnMock, nil, queryDbLinkMock, queryParams...)
+	dbResult, err := service.SelectOnDbLinkView(dblinkConnMock, dbc, queryDbLinkMock, queryParams...)
 	assert.NotNil(t, dbResult)
 	assert.NoError(t, err)
+	txMock.AssertExpectations(t)
+}
+
+func TestService_SelectOnDbLinkView_Pinned_Connection(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	db, err := sql.Open("tenant_session_test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	service := service{db: converter.SQLToDBer(db), maxConnectionRetries: 1, tenants: &sync.Map{}}
+	dbLink, _ := NewDbLinkConnection("test", "127.0.0.1", uint(1234), "usrtest", "pass123", "db_test")
+	resetSessionQueries()
+
+	// when
+	dbc, err := service.ConnectionContext(WithTenant(context.Background(), "acme"))
+	_, selectErr := service.SelectOnDbLinkView(dbLink, dbc, "SELECT name FROM properties")
+	closeErr := service.Close(dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Nil(selectErr)
+	ass.Nil(closeErr)
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	// everything runs in the session of the pinned connection
+	queries := make([]string, 0, len(sessionQueries))
+	for _, query := range sessionQueries {
+		ass.Equal(sessionQueries[0].conn, query.conn)
+		ass.Equal(`"acme"`, query.searchPath)
+		queries = append(queries, query.query)
+	}
+	ass.Equal([]string{dbLink.OpenConnection(), "SAVEPOINT dblink_view", "SELECT name FROM properties",
+		"RELEASE SAVEPOINT dblink_view", dbLink.CloseConnection()}, queries)
 }
 
 func TestService_SelectOnDbLinkView_DblinkOpenConnError(t *testing.T) {
-	service, sqlMock := newMockService(ServiceConfig{
+	service, _ := newMockService(ServiceConfig{
 		MaxConnectionRetries: 1,
 	})
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{tx: txMock, ctx: ctx, nestingLevel: 1}
 	dblinkConnMock, _ := NewDbLinkConnection("test", "127.0.0.1", uint(1234), "usrtest", "pass123", "db_test")
 	//dblink open connection
 	stmtMock := newDBStmtMock()
-	resultDbLinkOpenConnMock := newDBResultMock()
-	resultDbLinkOpenConnMock.PatchRowsAffected(1, nil)
-	stmtMock.PatchExec(nil, resultDbLinkOpenConnMock, nil)
-	stmtMock.PatchClose(nil)
 	dbLinkOpenConn := "SELECT * FROM dblink_connect('test', 'host=127.0.0.1 port=1234 dbname=db_test user=usrtest password=pass123')"
-	sqlMock.PatchPrepare(dbLinkOpenConn, stmtMock, fmt.Errorf("error on dblink connect"))
-
-	//dblink close connection
-	stmtCloseConnMock := newDBStmtMock()
-	resultDbLinkOpenConnMock2 := newDBResultMock()
-	resultDbLinkOpenConnMock2.PatchRowsAffected(1, nil)
-	stmtCloseConnMock.PatchExec(nil, resultDbLinkOpenConnMock2, nil)
-	stmtCloseConnMock.PatchClose(nil)
-	dbLinkCloseConn := "SELECT dblink_disconnect('test')"
-	sqlMock.PatchPrepare(dbLinkCloseConn, stmtCloseConnMock, nil)
+	txMock.PatchPrepareContext(ctx, dbLinkOpenConn, stmtMock, fmt.Errorf("error on dblink connect"))
 
 	queryDbLinkMock := "SELECT * FROM test"
-	dbResult, err := service.SelectOnDbLinkView(dblinkConnMock, nil, queryDbLinkMock)
+	dbResult, err := service.SelectOnDbLinkView(dblinkConnMock, dbc, queryDbLinkMock)
 	assert.Nil(t, dbResult)
 	assert.Error(t, err)
+	txMock.AssertNotCalled(t, "PrepareContext", ctx, "SELECT dblink_disconnect('test')")
 }
 
 func TestService_SelectOnDbLinkView_ResultError(t *testing.T) {
-	service, sqlMock := newMockService(ServiceConfig{
+	service, _ := newMockService(ServiceConfig{
 		MaxConnectionRetries: 1,
 	})
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{tx: txMock, ctx: ctx, nestingLevel: 1}
 	dblinkConnMock, _ := NewDbLinkConnection("test", "127.0.0.1", uint(1234), "usrtest", "pass123", "db_test")
-	//dblink open connection
+	//dblink open connection and savepoint
 	stmtMock := newDBStmtMock()
-	resultDbLinkOpenConnMock := newDBResultMock()
-	resultDbLinkOpenConnMock.PatchRowsAffected(1, nil)
-	stmtMock.PatchExec(nil, resultDbLinkOpenConnMock, nil)
-	stmtMock.PatchClose(nil)
+	resultMock := newDBResultMock()
 	dbLinkOpenConn := "SELECT * FROM dblink_connect('test', 'host=127.0.0.1 port=1234 dbname=db_test user=usrtest password=pass123')"
-	sqlMock.PatchPrepare(dbLinkOpenConn, stmtMock, nil)
+	for _, query := range []string{dbLinkOpenConn, "SAVEPOINT dblink_view"} {
+		txMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+		stmtMock.PatchExecContext(ctx, nil, resultMock, nil)
+		resultMock.PatchRowsAffected(1, nil)
+	}
 	//dblink query
 	stDbLinkMock := newDBStmtMock()
 	queryDbLink := "SELECT * FROM test"
-	sqlMock.PatchPrepare(queryDbLink, stDbLinkMock, fmt.Errorf("error on query"))
-
-	//dblink close connection
-	stmtCloseConnMock := newDBStmtMock()
-	resultDbLinkOpenConnMock2 := newDBResultMock()
-	resultDbLinkOpenConnMock2.PatchRowsAffected(1, nil)
-	stmtCloseConnMock.PatchExec(nil, resultDbLinkOpenConnMock2, nil)
-	stmtCloseConnMock.PatchClose(nil)
-	dbLinkCloseConn := "SELECT dblink_disconnect('test')"
-	sqlMock.PatchPrepare(dbLinkCloseConn, stmtCloseConnMock, nil)
+	txMock.PatchPrepareContext(ctx, queryDbLink, stDbLinkMock, fmt.Errorf("error on query"))
+
+	//dblink rollback to savepoint and close connection
+	for _, query := range []string{"ROLLBACK TO SAVEPOINT dblink_view", "SELECT dblink_disconnect('test')"} {
+		txMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+		stmtMock.PatchExecContext(ctx, nil, resultMock, nil)
+		resultMock.PatchRowsAffected(1, nil)
+	}
 
 	queryDbLinkMock := "SELECT * FROM test"
-	dbResult, err := service.SelectOnDbLinkView(dblinkConnMock, nil, queryDbLinkMock)
+	dbResult, err := service.SelectOnDbLinkView(dblinkConnMock, dbc, queryDbLinkMock)
 	assert.Nil(t, dbResult)
 	assert.Error(t, err)
+	txMock.AssertExpectations(t)
 }
 
 func TestService_SelectOnDbLinkView_ErrorWithParams(t *testing.T) {
 	service, sqlMock := newMockService(ServiceConfig{
 		MaxConnectionRetries: 1,
 	})
+	ctx := context.Background()
 	dblinkConnMock, _ := NewDbLinkConnection("test", "127.0.0.1", uint(1234), "usrtest", "pass123", "db_test")
-	//dblink open connection
+	//without dbc everything runs in a new transaction
+	sqlConn := newDBConnMock()
+	txMock := newDBTxMock()
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+	//dblink open connection and savepoint
 	stmtMock := newDBStmtMock()
-	resultDbLinkOpenConnMock := newDBResultMock()
-	resultDbLinkOpenConnMock.PatchRowsAffected(1, nil)
-	stmtMock.PatchExec(nil, resultDbLinkOpenConnMock, nil)
-	stmtMock.PatchClose(nil)
+	resultMock := newDBResultMock()
 	dbLinkOpenConn := "SELECT * FROM dblink_connect('test', 'host=127.0.0.1 port=1234 dbname=db_test user=usrtest password=pass123')"
-	sqlMock.PatchPrepare(dbLinkOpenConn, stmtMock, nil)
+	for _, query := range []string{dbLinkOpenConn, "SAVEPOINT dblink_view"} {
+		txMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+		stmtMock.PatchExecContext(ctx, nil, resultMock, nil)
+		resultMock.PatchRowsAffected(1, nil)
+	}
 	//dblink query
 	stDbLinkMock := newDBStmtMock()
 	queryParams := []interface{}{1}
+	stDbLinkMock.PatchQueryContext(ctx, queryParams, nil, fmt.Errorf("error on database"))
 	queryDbLink := "SELECT * FROM test where id=?"
-	sqlMock.PatchPrepare(queryDbLink, stDbLinkMock, fmt.Errorf("error on database"))
-
-	//dblink close connection
-	stmtCloseConnMock := newDBStmtMock()
-	resultDbLinkOpenConnMock2 := newDBResultMock()
-	resultDbLinkOpenConnMock2.PatchRowsAffected(1, nil)
-	stmtCloseConnMock.PatchExec(nil, resultDbLinkOpenConnMock2, nil)
-	stmtCloseConnMock.PatchClose(nil)
-	dbLinkCloseConn := "SELECT dblink_disconnect('test')"
-	sqlMock.PatchPrepare(dbLinkCloseConn, stmtCloseConnMock, nil)
+	txMock.PatchPrepareContext(ctx, queryDbLink, stDbLinkMock, nil)
+
+	//dblink rollback to savepoint and close connection, then the transaction is rolled back
+	for _, query := range []string{"ROLLBACK TO SAVEPOINT dblink_view", "SELECT dblink_disconnect('test')"} {
+		txMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+		stmtMock.PatchExecContext(ctx, nil, resultMock, nil)
+		resultMock.PatchRowsAffected(1, nil)
+	}
+	txMock.PatchRollback(nil)
+	sqlConn.PatchClose(nil)
 
 	queryDbLinkMock := "SELECT * FROM test where id=?"
 	dbResult, err := service.SelectOnDbLinkView(dblinkConnMock, nil, queryDbLinkMock, queryParams...)
 	assert.Nil(t, dbResult)
 	assert.Error(t, err)
+	txMock.AssertExpectations(t)
+}
+
+func TestService_SelectOnDbLinkView_Reuse(t *testing.T) {
+	service, _ := newMockService(ServiceConfig{
+		MaxConnectionRetries: 1,
+	})
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{tx: txMock, ctx: ctx, nestingLevel: 1}
+	dblinkConnMock, _ := NewDbLinkConnection("test", "127.0.0.1", uint(1234), "usrtest", "pass123", "db_test",
+		WithDbLinkReuse())
+	//dblink open connection only if it isn't open
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+	txMock.PatchPrepareContext(ctx, dblinkConnMock.OpenConnection(), stmtMock, nil)
+	stmtMock.PatchExecContext(ctx, nil, resultMock, nil)
+	resultMock.PatchRowsAffected(0, nil)
+	//dblink query
+	stDbLinkMock := newDBStmtMock()
+	rowsDblinkMock := newDBRowsMock()
+	rowsDblinkMock.PatchColumns([]string{}, nil)
+	rowsDblinkMock.PatchColumnTypes(nil, nil)
+	rowsDblinkMock.PatchClose(nil)
+	rowsDblinkMock.PatchNext(false)
+	stDbLinkMock.PatchQueryContext(ctx, nil, rowsDblinkMock, nil)
+	txMock.PatchPrepareContext(ctx, "SELECT * FROM test", stDbLinkMock, nil)
+
+	dbResult, err := service.SelectOnDbLinkView(dblinkConnMock, dbc, "SELECT * FROM test")
+	assert.NotNil(t, dbResult)
+	assert.NoError(t, err)
+	txMock.AssertExpectations(t)
+}
+
+func Test_ConnectionContext_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sqlConn := newDBConnMock()
+
+	// when
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	dbCtx, err := service.ConnectionContext(ctx)
+
+	// then
+	ass.Nil(err)
+	ass.NotNil(dbCtx)
+	ass.Equal(ctx, dbCtx.ctx)
+}
+
+func Test_BeginContext_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sqlConn := newDBConnMock()
+	outputTx := sqlmock.NewTxMockService()
+
+	// when
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, outputTx, nil)
+	dbCtx, err := service.BeginContext(ctx, nil)
+
+	// then
+	ass.Nil(err)
+	ass.NotNil(dbCtx)
+	ass.Equal(ctx, dbCtx.ctx)
+	ass.Equal(1, dbCtx.nestingLevel)
+}
+
+func Test_BeginContext_Nested_Keeps_Outer_Context(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, _ := newMockService(config)
+
+	outerCtx := context.Background()
+	innerCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dbc := &DBContext{
+		tx:           newDBTxMock(),
+		dbConn:       newDBConnMock(),
+		nestingLevel: 1,
+		ctx:          outerCtx,
+	}
+
+	// when
+	dbCtx, err := service.BeginContext(innerCtx, dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(outerCtx, dbCtx.ctx)
+	ass.Equal(2, dbCtx.nestingLevel)
+}
+
+func Test_WithTransactionContext_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sqlConn := newDBConnMock()
+	txMock := sqlmock.NewTxMockService()
+
+	var txCtx context.Context
+	txFn := func(dbc *DBContext) error {
+		txCtx = dbc.ctx
+		return nil
+	}
+
+	// when
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+	txMock.PatchCommit(nil)
+	sqlConn.PatchClose(nil)
+	err := service.WithTransactionContext(ctx, txFn)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(ctx, txCtx)
+}
+
+func Test_SelectContext_Without_Dbc(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+	query := selectStmt2
+	stmtMock := newDBStmtMock()
+	rowsMock := newDBRowsMock()
+	params := []interface{}{3}
+	columns := []string{"columnA"}
+	columnsAux := make([]interface{}, len(columns))
+	columnPointers := make([]interface{}, len(columns))
+	for i := range columnsAux {
+		columnPointers[i] = &columnsAux[i]
+	}
+
+	// when
+	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
+	rowsMock.PatchClose(nil)
+	rowsMock.PatchNext(true)
+	rowsMock.PatchScan(columnPointers, nil)
+	rowsMock.PatchNext(false)
+	stmtMock.PatchQueryContext(ctx, params, rowsMock, nil)
+	stmtMock.PatchClose(nil)
+	sqlMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+	dbResult, err := service.SelectContext(ctx, nil, query, false, params...)
+
+	// then
+	ass.Nil(err)
+	ass.NotNil(dbResult)
+	ass.Len(dbResult.GetRows(), 1)
+}
+
+func Test_SelectContext_With_Tx_Uses_Given_Context(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, _ := newMockService(config)
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:  txMock,
+		ctx: context.Background(),
+	}
+	query := selectStmt2
+	params := []interface{}{3}
+
+	// when
+	txMock.PatchPrepareContext(ctx, query, nil, context.Canceled)
+	dbResult, err := service.SelectContext(ctx, dbc, query, false, params...)
+
+	// then
+	ass.Nil(dbResult)
+	ass.ErrorIs(err, context.Canceled)
+	ass.Equal(context.Background(), dbc.ctx)
+}
+
+func Test_ExecuteContext_Without_Dbc(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+	query := selectStmt2
+	stmtMock := newDBStmtMock()
+	params := []interface{}{3}
+	resultMock := newDBResultMock()
+
+	// when
+	resultMock.PatchRowsAffected(1, nil)
+	stmtMock.PatchExecContext(ctx, params, resultMock, nil)
+	stmtMock.PatchClose(nil)
+	sqlMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+	err := service.ExecuteEnsuringOneAffectedRowContext(ctx, nil, query, params...)
+
+	// then
+	ass.Nil(err)
+}
+
+func Test_ExecuteContext_Cancelled(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+	query := selectStmt2
+	stmtMock := newDBStmtMock()
+	params := []interface{}{3}
+
+	// when
+	stmtMock.PatchExecContext(ctx, params, nil, context.Canceled)
+	stmtMock.PatchClose(nil)
+	sqlMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+	dbResult, err := service.ExecuteContext(ctx, nil, query, params...)
+
+	// then
+	ass.Nil(dbResult)
+	ass.ErrorIs(err, context.Canceled)
+}
+
+func Test_QueryRowContext_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+	query := selectStmt2
+	params := []interface{}{3}
+
+	// when
+	sqlMock.PatchQueryRowContext(ctx, query, params, nil, context.Canceled)
+	row, err := service.QueryRowContext(ctx, query, params...)
+
+	// then
+	ass.Nil(row)
+	ass.ErrorIs(err, context.Canceled)
+}
+
+func Test_Begin_Nested_With_Savepoints(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	service, _ := newMockService(ServiceConfig{
+		MaxConnectionRetries: 1,
+		UseSavepoints:        true,
+	})
+
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:           txMock,
+		dbConn:       newDBConnMock(),
+		nestingLevel: 1,
+		ctx:          ctx,
+	}
+
+	// when
+	txMock.PatchExecContext(ctx, "SAVEPOINT sp_1", nil, newDBResultMock(), nil)
+	dbCtx, err := service.Begin(dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(2, dbCtx.nestingLevel)
+	txMock.AssertExpectations(t)
+}
+
+func Test_Begin_Nested_With_Savepoints_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	service, _ := newMockService(ServiceConfig{
+		MaxConnectionRetries: 1,
+		UseSavepoints:        true,
+	})
+
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:           txMock,
+		dbConn:       newDBConnMock(),
+		nestingLevel: 2,
+		ctx:          ctx,
+	}
+
+	// when
+	txMock.PatchExecContext(ctx, "SAVEPOINT sp_2", nil, nil, errors.New("savepoint error"))
+	dbCtx, err := service.Begin(dbc)
+
+	// then
+	ass.Nil(dbCtx)
+	ass.NotNil(err)
+	ass.Equal(2, dbc.nestingLevel)
+}
+
+func Test_Commit_Nested_With_Savepoints(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	service, _ := newMockService(ServiceConfig{
+		MaxConnectionRetries: 1,
+		UseSavepoints:        true,
+	})
+
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:           txMock,
+		dbConn:       newDBConnMock(),
+		nestingLevel: 2,
+		ctx:          ctx,
+	}
+
+	// when
+	txMock.PatchExecContext(ctx, "RELEASE SAVEPOINT sp_1", nil, newDBResultMock(), nil)
+	err := service.Commit(dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(1, dbc.nestingLevel)
+	ass.NotNil(dbc.tx)
+	txMock.AssertExpectations(t)
+}
+
+func Test_Rollback_Nested_With_Savepoints(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	service, _ := newMockService(ServiceConfig{
+		MaxConnectionRetries: 1,
+		UseSavepoints:        true,
+	})
+
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:           txMock,
+		dbConn:       newDBConnMock(),
+		nestingLevel: 2,
+		ctx:          ctx,
+	}
+
+	// when
+	txMock.PatchExecContext(ctx, "ROLLBACK TO SAVEPOINT sp_1; RELEASE SAVEPOINT sp_1", nil,
+		newDBResultMock(), nil)
+	err := service.Rollback(dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(1, dbc.nestingLevel)
+	ass.NotNil(dbc.tx)
+	txMock.AssertExpectations(t)
+}
+
+func Test_Rollback_Nested_With_Savepoints_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	service, _ := newMockService(ServiceConfig{
+		MaxConnectionRetries: 1,
+		UseSavepoints:        true,
+	})
+
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:           txMock,
+		dbConn:       newDBConnMock(),
+		nestingLevel: 3,
+		ctx:          ctx,
+	}
+
+	// when
+	txMock.PatchExecContext(ctx, "ROLLBACK TO SAVEPOINT sp_2; RELEASE SAVEPOINT sp_2", nil,
+		nil, errors.New("rollback error"))
+	err := service.Rollback(dbc)
+
+	// then
+	ass.NotNil(err)
+	ass.Equal(3, dbc.nestingLevel)
+}
+
+func Test_Rollback_Outer_With_Savepoints(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	service, _ := newMockService(ServiceConfig{
+		MaxConnectionRetries: 1,
+		UseSavepoints:        true,
+	})
+
+	txMock := newDBTxMock()
+	sqlConnMock := newDBConnMock()
+	dbc := &DBContext{
+		tx:           txMock,
+		dbConn:       sqlConnMock,
+		nestingLevel: 1,
+	}
+
+	// when
+	txMock.PatchRollback(nil)
+	sqlConnMock.PatchClose(nil)
+	err := service.Rollback(dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(0, dbc.nestingLevel)
+	ass.Nil(dbc.tx)
 }
 
 func newMockService(config ServiceConfig) (service, *sqlmock.SQLMock) {
@@ -1868,6 +2252,7 @@ func newMockService(config ServiceConfig) (service, *sqlmock.SQLMock) {
 		db:                   sqlMock,
 		maxConnectionRetries: config.MaxConnectionRetries,
 		datadogMetricPrefix:  config.DatadogMetricPrefix,
+		useSavepoints:        config.UseSavepoints,
 	}, sqlMock
 }
 
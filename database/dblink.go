@@ -2,7 +2,22 @@ package database
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
 	"github.com/go-playground/validator/v10"
+	"github.com/lib/pq"
+)
+
+const (
+	// dbLinkSavepoint is the savepoint taken before querying a dblink view
+	dbLinkSavepoint = "dblink_view"
+)
+
+var (
+	// dbLinkOptionKeyRegexp matches a valid libpq connection option keyword
+	dbLinkOptionKeyRegexp = regexp.MustCompile(`^[a-z_]+$`)
 )
 
 type DbLink struct {
@@ -12,9 +27,43 @@ type DbLink struct {
 	User           string `validate:"required"`
 	Password       string `validate:"required"`
 	DbName         string `validate:"required"`
+	// SSLMode is the sslmode of the remote connection, libpq's default (prefer) if empty
+	SSLMode string `validate:"omitempty,oneof=disable allow prefer require verify-ca verify-full"`
+	// Options are other libpq connection options, e.g. connect_timeout or application_name
+	Options map[string]string
+	// Reuse keeps the named connection open after each call and only connects if it isn't already
+	Reuse bool
+}
+
+// DbLinkOption configures a DbLink
+type DbLinkOption func(dbLink *DbLink)
+
+// WithDbLinkSSLMode sets the sslmode of the remote connection
+func WithDbLinkSSLMode(sslMode string) DbLinkOption {
+	return func(dbLink *DbLink) {
+		dbLink.SSLMode = sslMode
+	}
+}
+
+// WithDbLinkOption sets a libpq connection option of the remote connection
+func WithDbLinkOption(key string, value string) DbLinkOption {
+	return func(dbLink *DbLink) {
+		if dbLink.Options == nil {
+			dbLink.Options = make(map[string]string)
+		}
+		dbLink.Options[key] = value
+	}
+}
+
+// WithDbLinkReuse keeps the named connection open across calls. Close it with CloseConnection.
+func WithDbLinkReuse() DbLinkOption {
+	return func(dbLink *DbLink) {
+		dbLink.Reuse = true
+	}
 }
 
-func NewDbLinkConnection(connectionName string, host string, port uint, user string, password string, dbName string) (*DbLink, error) {
+func NewDbLinkConnection(connectionName string, host string, port uint, user string, password string, dbName string,
+	opts ...DbLinkOption) (*DbLink, error) {
 	dbLinkConn := &DbLink{
 		ConnectionName: connectionName,
 		Host:           host,
@@ -23,6 +72,9 @@ func NewDbLinkConnection(connectionName string, host string, port uint, user str
 		Password:       password,
 		DbName:         dbName,
 	}
+	for _, opt := range opts {
+		opt(dbLinkConn)
+	}
 	err := dbLinkConn.validate(dbLinkConn)
 	if err != nil {
 		return nil, err
@@ -30,19 +82,50 @@ func NewDbLinkConnection(connectionName string, host string, port uint, user str
 	return dbLinkConn, nil
 }
 
+// OpenConnection returns the statement that opens the named connection. If Reuse is set it only
+// connects when the connection isn't open in the session yet.
 func (service DbLink) OpenConnection() string {
-	return fmt.Sprintf("SELECT * FROM dblink_connect('%s', 'host=%s port=%d dbname=%s user=%s password=%s')",
-		service.ConnectionName,
-		service.Host,
-		service.Port,
-		service.DbName,
-		service.User,
-		service.Password,
+	query := fmt.Sprintf("SELECT * FROM dblink_connect(%s, %s)",
+		pq.QuoteLiteral(service.ConnectionName),
+		pq.QuoteLiteral(service.ConnectionString()),
 	)
+	if service.Reuse {
+		query = fmt.Sprintf("SELECT dblink_connect(%s, %s) WHERE NOT %s = ANY(COALESCE(dblink_get_connections(), '{}'))",
+			pq.QuoteLiteral(service.ConnectionName),
+			pq.QuoteLiteral(service.ConnectionString()),
+			pq.QuoteLiteral(service.ConnectionName),
+		)
+	}
+	return query
+}
+
+// ConnectionString returns the libpq connection string of the remote database
+func (service DbLink) ConnectionString() string {
+	options := []string{
+		"host=" + quoteConnValue(service.Host),
+		fmt.Sprintf("port=%d", service.Port),
+		"dbname=" + quoteConnValue(service.DbName),
+		"user=" + quoteConnValue(service.User),
+		"password=" + quoteConnValue(service.Password),
+	}
+	if service.SSLMode != "" {
+		options = append(options, "sslmode="+quoteConnValue(service.SSLMode))
+	}
+
+	keys := make([]string, 0, len(service.Options))
+	for key := range service.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		options = append(options, key+"="+quoteConnValue(service.Options[key]))
+	}
+
+	return strings.Join(options, " ")
 }
 
 func (service DbLink) CloseConnection() string {
-	return fmt.Sprintf("SELECT dblink_disconnect('%s')", service.ConnectionName)
+	return fmt.Sprintf("SELECT dblink_disconnect(%s)", pq.QuoteLiteral(service.ConnectionName))
 }
 
 func (service DbLink) validate(dbLinkConn *DbLink) error {
@@ -51,5 +134,10 @@ func (service DbLink) validate(dbLinkConn *DbLink) error {
 	if err != nil {
 		return err
 	}
+	for key := range dbLinkConn.Options {
+		if !dbLinkOptionKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid dblink connection option: %q", key)
+		}
+	}
 	return nil
 }
@@ -54,3 +54,44 @@ func TestNewDbLinkConnection_CloseConnection(t *testing.T) {
 	connExpected := "SELECT dblink_disconnect('test')"
 	assert.Equal(t, connExpected, closeConn)
 }
+
+func TestNewDbLinkConnection_OpenConnection_Quoted(t *testing.T) {
+	newDbLinkConn, _ := NewDbLinkConnection("o'conn", "127.0.0.1", uint(1123), "test", `it's a p\ss`, "dbtest")
+	conn := newDbLinkConn.OpenConnection()
+	connExpected := `SELECT * FROM dblink_connect('o''conn',  E'host=127.0.0.1 port=1123 dbname=dbtest user=test password=''it\\''s a p\\\\ss''')`
+	assert.Equal(t, connExpected, conn)
+	assert.Equal(t, "SELECT dblink_disconnect('o''conn')", newDbLinkConn.CloseConnection())
+}
+
+func TestNewDbLinkConnection_ConnectionString_Options(t *testing.T) {
+	newDbLinkConn, err := NewDbLinkConnection("test", "127.0.0.1", uint(1123), "test", "pass123", "dbtest",
+		WithDbLinkSSLMode("verify-full"),
+		WithDbLinkOption("connect_timeout", "5"),
+		WithDbLinkOption("application_name", "my app"),
+	)
+	connExpected := "host=127.0.0.1 port=1123 dbname=dbtest user=test password=pass123 sslmode=verify-full " +
+		"application_name='my app' connect_timeout=5"
+	assert.NoError(t, err)
+	assert.Equal(t, connExpected, newDbLinkConn.ConnectionString())
+}
+
+func TestNewDbLinkConnection_InvalidOptions(t *testing.T) {
+	newDbLinkConn, err := NewDbLinkConnection("test", "127.0.0.1", uint(1123), "test", "pass123", "dbtest",
+		WithDbLinkOption("user=admin password", "x"))
+	assert.Nil(t, newDbLinkConn)
+	assert.EqualError(t, err, `invalid dblink connection option: "user=admin password"`)
+
+	newDbLinkConn, err = NewDbLinkConnection("test", "127.0.0.1", uint(1123), "test", "pass123", "dbtest",
+		WithDbLinkSSLMode("always"))
+	assert.Nil(t, newDbLinkConn)
+	assert.Error(t, err)
+}
+
+func TestNewDbLinkConnection_OpenConnection_Reuse(t *testing.T) {
+	newDbLinkConn, _ := NewDbLinkConnection("test", "127.0.0.1", uint(1123), "test", "pass123", "dbtest",
+		WithDbLinkReuse())
+	conn := newDbLinkConn.OpenConnection()
+	connExpected := "SELECT dblink_connect('test', 'host=127.0.0.1 port=1123 dbname=dbtest user=test password=pass123') " +
+		"WHERE NOT 'test' = ANY(COALESCE(dblink_get_connections(), '{}'))"
+	assert.Equal(t, connExpected, conn)
+}
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// SSLModeDisable doesn't use TLS, it's the default
+	SSLModeDisable = "disable"
+	// SSLModeRequire uses TLS without verifying the server certificate
+	SSLModeRequire = "require"
+	// SSLModeVerifyCA uses TLS and verifies the server certificate was signed by SSLRootCert
+	SSLModeVerifyCA = "verify-ca"
+	// SSLModeVerifyFull works like SSLModeVerifyCA and also verifies the host name of the certificate
+	SSLModeVerifyFull = "verify-full"
+)
+
+// connectionString returns the libpq connection string for the host, with the options of the config.
+// Options that can't be expressed in a connection string or are out of range return an error.
+func connectionString(config ServiceConfig, host string, port int) (string, error) {
+	options := []string{
+		"host=" + quoteConnValue(host),
+		fmt.Sprintf("port=%d", port),
+		"user=" + quoteConnValue(config.DBUsername),
+		"password=" + quoteConnValue(config.DBPassword),
+		"dbname=" + quoteConnValue(config.DBName),
+	}
+
+	// TLS
+	sslMode := config.SSLMode
+	if sslMode == "" {
+		sslMode = SSLModeDisable
+	}
+	switch sslMode {
+	case SSLModeDisable, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull:
+	default:
+		return "", fmt.Errorf("unsupported sslmode: %q", sslMode)
+	}
+	options = append(options, "sslmode="+sslMode)
+	if sslMode != SSLModeDisable {
+		if config.SSLRootCert != "" {
+			options = append(options, "sslrootcert="+quoteConnValue(config.SSLRootCert))
+		}
+		if config.SSLCert != "" {
+			options = append(options, "sslcert="+quoteConnValue(config.SSLCert))
+		}
+		if config.SSLKey != "" {
+			options = append(options, "sslkey="+quoteConnValue(config.SSLKey))
+		}
+	} else if config.SSLRootCert != "" || config.SSLCert != "" || config.SSLKey != "" {
+		return "", fmt.Errorf("ssl certificates were given but sslmode is %s", sslMode)
+	}
+
+	// connect_timeout only accepts whole seconds
+	if config.ConnTimeout != nil {
+		if *config.ConnTimeout < 0 {
+			return "", fmt.Errorf("invalid ConnTimeout: %s", *config.ConnTimeout)
+		}
+		options = append(options, fmt.Sprintf("connect_timeout=%d", int64(math.Ceil(config.ConnTimeout.Seconds()))))
+	}
+
+	// Session settings, sent to the server when connecting
+	if config.ApplicationName != "" {
+		options = append(options, "application_name="+quoteConnValue(config.ApplicationName))
+	}
+	if len(config.SearchPath) > 0 {
+		schemas := make([]string, len(config.SearchPath))
+		for i, schema := range config.SearchPath {
+			schemas[i] = pq.QuoteIdentifier(schema)
+		}
+		options = append(options, "search_path="+quoteConnValue(strings.Join(schemas, ",")))
+	}
+	timeouts := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"statement_timeout", config.StatementTimeout},
+		{"lock_timeout", config.LockTimeout},
+		{"idle_in_transaction_session_timeout", config.IdleInTransactionSessionTimeout},
+	}
+	for _, timeout := range timeouts {
+		if timeout.value == nil {
+			continue
+		}
+		if *timeout.value < 0 {
+			return "", fmt.Errorf("invalid %s: %s", timeout.name, *timeout.value)
+		}
+		options = append(options, fmt.Sprintf("%s=%d", timeout.name, timeout.value.Milliseconds()))
+	}
+
+	// done
+	return strings.Join(options, " "), nil
+}
+
+// newConnector returns the pq connector for the host. pq can't express read and write timeouts in
+// the connection string, so they're enforced by the dialer on every read and write of the socket.
+func newConnector(config ServiceConfig, host string, port int) (*pq.Connector, error) {
+	dsn, err := connectionString(config, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &timeoutDialer{}
+	if config.ConnReadTimeout != nil {
+		if *config.ConnReadTimeout <= 0 {
+			return nil, fmt.Errorf("invalid ConnReadTimeout: %s", *config.ConnReadTimeout)
+		}
+		dialer.readTimeout = *config.ConnReadTimeout
+	}
+	if config.ConnWriteTimeout != nil {
+		if *config.ConnWriteTimeout <= 0 {
+			return nil, fmt.Errorf("invalid ConnWriteTimeout: %s", *config.ConnWriteTimeout)
+		}
+		dialer.writeTimeout = *config.ConnWriteTimeout
+	}
+	if dialer.readTimeout > 0 || dialer.writeTimeout > 0 {
+		connector.Dialer(dialer)
+	}
+
+	// done
+	return connector, nil
+}
+
+// openDB opens a pool to the given host using the credentials and pool settings of the config
+func openDB(config ServiceConfig, host string, port int) (*sql.DB, error) {
+	connector, err := newConnector(config, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(connector)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	connMaxLifetime := config.ConnMaxLifetime * time.Second
+	db.SetConnMaxLifetime(connMaxLifetime)
+
+	// done
+	return db, nil
+}
+
+// timeoutDialer dials connections that fail a read or a write that takes longer than its timeouts
+type timeoutDialer struct {
+	dialer       net.Dialer
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// Dial implements pq.Dialer
+func (dialer *timeoutDialer) Dial(network, address string) (net.Conn, error) {
+	return dialer.DialContext(context.Background(), network, address)
+}
+
+// DialTimeout implements pq.Dialer
+func (dialer *timeoutDialer) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return dialer.DialContext(ctx, network, address)
+}
+
+// DialContext implements pq.DialerContext
+func (dialer *timeoutDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := dialer.dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &timeoutConn{
+		Conn:         conn,
+		readTimeout:  dialer.readTimeout,
+		writeTimeout: dialer.writeTimeout,
+	}, nil
+}
+
+// timeoutConn sets a deadline before every read and write
+type timeoutConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// Read reads from the connection, failing if it takes longer than the read timeout
+func (conn *timeoutConn) Read(b []byte) (int, error) {
+	if conn.readTimeout > 0 {
+		if err := conn.Conn.SetReadDeadline(time.Now().Add(conn.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return conn.Conn.Read(b)
+}
+
+// Write writes to the connection, failing if it takes longer than the write timeout
+func (conn *timeoutConn) Write(b []byte) (int, error) {
+	if conn.writeTimeout > 0 {
+		if err := conn.Conn.SetWriteDeadline(time.Now().Add(conn.writeTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return conn.Conn.Write(b)
+}
+
+// quoteConnValue quotes a value of a libpq connection string if it's empty or has spaces, quotes
+// or backslashes
+func quoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\r\f\v'\\") {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + replacer.Replace(value) + "'"
+}
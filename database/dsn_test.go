@@ -0,0 +1,115 @@
+package database
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConnectionString_Default(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	config := ServiceConfig{
+		DBUsername: "user",
+		DBPassword: "it's secret",
+		DBName:     "db",
+	}
+
+	// when
+	dsn, err := connectionString(config, "localhost", 5432)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(`host=localhost port=5432 user=user password='it\'s secret' dbname=db sslmode=disable`, dsn)
+}
+
+func Test_ConnectionString_All_Options(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	connTimeout := 1500 * time.Millisecond
+	statementTimeout := 30 * time.Second
+	lockTimeout := 5 * time.Second
+	idleTimeout := time.Minute
+	config := ServiceConfig{
+		DBUsername:                      "user",
+		DBPassword:                      "pass",
+		DBName:                          "db",
+		ConnTimeout:                     &connTimeout,
+		SSLMode:                         SSLModeVerifyFull,
+		SSLRootCert:                     "/certs/root.pem",
+		SSLCert:                         "/certs/client.pem",
+		SSLKey:                          "/certs/client.key",
+		ApplicationName:                 "my service",
+		SearchPath:                      []string{"tenant", "public"},
+		StatementTimeout:                &statementTimeout,
+		LockTimeout:                     &lockTimeout,
+		IdleInTransactionSessionTimeout: &idleTimeout,
+	}
+
+	// when
+	dsn, err := connectionString(config, "db.flat.mx", 5433)
+
+	// then
+	ass.Nil(err)
+	ass.Equal("host=db.flat.mx port=5433 user=user password=pass dbname=db sslmode=verify-full "+
+		"sslrootcert=/certs/root.pem sslcert=/certs/client.pem sslkey=/certs/client.key connect_timeout=2 "+
+		`application_name='my service' search_path="tenant","public" statement_timeout=30000 `+
+		"lock_timeout=5000 idle_in_transaction_session_timeout=60000", dsn)
+}
+
+func Test_ConnectionString_Invalid(t *testing.T) {
+	ass := assert.New(t)
+	negative := -time.Second
+
+	_, err := connectionString(ServiceConfig{SSLMode: "prefer"}, "localhost", 5432)
+	ass.EqualError(err, `unsupported sslmode: "prefer"`)
+
+	_, err = connectionString(ServiceConfig{SSLRootCert: "/certs/root.pem"}, "localhost", 5432)
+	ass.EqualError(err, "ssl certificates were given but sslmode is disable")
+
+	_, err = connectionString(ServiceConfig{LockTimeout: &negative}, "localhost", 5432)
+	ass.EqualError(err, "invalid lock_timeout: -1s")
+}
+
+func Test_NewService_Invalid_ReadTimeout(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	readTimeout := time.Duration(0)
+
+	// when
+	service, err := NewService(ServiceConfig{ConnReadTimeout: &readTimeout})
+
+	// then
+	ass.Nil(service)
+	ass.EqualError(err, "invalid ConnReadTimeout: 0s")
+}
+
+func Test_TimeoutConn_Read_Deadline(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	ass.Nil(err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			// never writes
+			defer conn.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+	dialer := &timeoutDialer{readTimeout: 50 * time.Millisecond}
+
+	// when
+	conn, err := dialer.Dial("tcp", listener.Addr().String())
+	ass.Nil(err)
+	defer conn.Close()
+	_, err = conn.Read(make([]byte, 1))
+
+	// then
+	netErr, ok := err.(net.Error)
+	ass.True(ok)
+	ass.True(netErr.Timeout())
+}
@@ -0,0 +1,1045 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database/converter"
+)
+
+const (
+	// FakeTxActive is the state of a fake transaction that didn't end
+	FakeTxActive = "active"
+	// FakeTxCommitted is the state of a committed fake transaction
+	FakeTxCommitted = "committed"
+	// FakeTxRolledBack is the state of a rolled back fake transaction
+	FakeTxRolledBack = "rolled_back"
+)
+
+var (
+	// ErrFakeUnmatched is wrapped by the errors returned by a Fake for the queries that no rule matches
+	ErrFakeUnmatched = errors.New("fake_unmatched")
+
+	errFakeQueryRow = errors.New("QueryRow is not supported by Fake, use Select")
+)
+
+type (
+	// Fake is an in-memory Database for tests. Unlike Mock, the queries are matched by rules: the query
+	// with QueryEquals (ignoring whitespace), QueryMatches or AnyQuery, the params one by one with
+	// literal values, AnyParam or ParamWhere, and the whole call with Where. The rules answer with their
+	// scripted responses, in order, and the calls no rule matches with the default of the operation.
+	// When there's no default the call fails with an error wrapping ErrFakeUnmatched that explains why
+	// each rule didn't match. Every call is recorded, and Begin, Commit and Rollback keep the nesting
+	// level of the DBContext like the service does.
+	Fake struct {
+		mu            sync.Mutex
+		useSavepoints bool
+		rules         []*FakeRule
+		defaults      map[string]fakeResponse
+		calls         []FakeCall
+		unmatched     []error
+		transactions  []*FakeTransaction
+		shutdown      bool
+	}
+
+	// FakeOption is a function for NewFake, it's used to configure the fake
+	FakeOption func(*Fake)
+
+	// FakeCall is a call received by a Fake
+	FakeCall struct {
+		// Method is the name of the Database method called, e.g. SelectUniqueValue or Commit
+		Method string
+		// Operation is QueryOperationSelect or QueryOperationExecute for the calls that run a query
+		Operation string
+		Query     string
+		Params    []interface{}
+		ForUpdate bool
+		// TxID is the ID of the FakeTransaction of the DBContext, 0 outside a transaction
+		TxID int
+		// NestingLevel is the nesting level of the DBContext when the call was received
+		NestingLevel int
+		// Tenant is the tenant of the DBContext, see WithTenant
+		Tenant string
+	}
+
+	// FakeTransaction is a transaction begun on a Fake
+	FakeTransaction struct {
+		ID    int
+		State string
+	}
+
+	// FakeQueryMatcher matches the query of a call
+	FakeQueryMatcher struct {
+		description string
+		match       func(query string) bool
+	}
+
+	// FakeParamMatcher matches a param of a call, it can be used in WithParams instead of a value
+	FakeParamMatcher struct {
+		description string
+		match       func(param interface{}) bool
+	}
+
+	// FakeRule answers the calls of an operation it matches, see Fake
+	FakeRule struct {
+		operation   string
+		query       FakeQueryMatcher
+		params      []interface{}
+		matchParams bool
+		predicates  []fakePredicate
+		responses   []fakeResponse
+		repeat      bool
+		calls       int
+	}
+
+	fakePredicate struct {
+		description string
+		match       func(call FakeCall) bool
+	}
+
+	fakeResponse struct {
+		dbr *DBResult
+		err error
+	}
+
+	// fakeTx is the tx of the DBContexts of a Fake, it's never called
+	fakeTx struct {
+		converter.DBTxer
+		id     int
+		tenant string
+	}
+
+	// fakeConn is the connection of the DBContexts of a Fake, it's never called
+	fakeConn struct {
+		converter.DBConner
+		tenant string
+	}
+)
+
+var _ Database = (*Fake)(nil)
+
+// AnyParam matches any param
+var AnyParam = FakeParamMatcher{
+	description: "<any>",
+	match: func(param interface{}) bool {
+		return true
+	},
+}
+
+// NewFake returns a Fake without rules nor defaults
+func NewFake(opts ...FakeOption) *Fake {
+	fake := &Fake{
+		defaults: make(map[string]fakeResponse),
+	}
+	for _, opt := range opts {
+		opt(fake)
+	}
+	return fake
+}
+
+// WithFakeSavepoints makes the nested transactions of the fake behave like the ones of a service with
+// UseSavepoints: a nested Rollback only leaves the nested transaction
+func WithFakeSavepoints() FakeOption {
+	return func(fake *Fake) {
+		fake.useSavepoints = true
+	}
+}
+
+// QueryEquals matches the query equal to query, ignoring whitespace and a trailing semicolon
+func QueryEquals(query string) FakeQueryMatcher {
+	expected := compactQuery(query)
+	return FakeQueryMatcher{
+		description: fmt.Sprintf("QueryEquals(%q)", expected),
+		match: func(query string) bool {
+			return compactQuery(query) == expected
+		},
+	}
+}
+
+// QueryMatches matches the queries that contain a match of the regular expression pattern
+func QueryMatches(pattern string) FakeQueryMatcher {
+	re := regexp.MustCompile(pattern)
+	return FakeQueryMatcher{
+		description: fmt.Sprintf("QueryMatches(`%s`)", pattern),
+		match:       re.MatchString,
+	}
+}
+
+// AnyQuery matches any query
+func AnyQuery() FakeQueryMatcher {
+	return FakeQueryMatcher{
+		description: "AnyQuery()",
+		match: func(query string) bool {
+			return true
+		},
+	}
+}
+
+// ParamWhere matches the params for which match returns true, description is used in the diffs
+func ParamWhere(description string, match func(param interface{}) bool) FakeParamMatcher {
+	return FakeParamMatcher{description: description, match: match}
+}
+
+// compactQuery returns query without extra whitespace nor a trailing semicolon
+func compactQuery(query string) string {
+	query = normalizeSpaceRegexp.ReplaceAllString(query, " ")
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(query), ";"))
+}
+
+// Rules
+
+// OnSelect adds a rule for the queries run by Select and the methods built on it (SelectUniqueValue,
+// SelectStream, SelectCursor, ...)
+func (fake *Fake) OnSelect(query FakeQueryMatcher) *FakeRule {
+	return fake.addRule(QueryOperationSelect, query)
+}
+
+// OnExecute adds a rule for the queries run by Execute and the methods built on it
+// (ExecuteEnsuringOneAffectedRow, BulkInsert, Notify, the locks, ...)
+func (fake *Fake) OnExecute(query FakeQueryMatcher) *FakeRule {
+	return fake.addRule(QueryOperationExecute, query)
+}
+
+func (fake *Fake) addRule(operation string, query FakeQueryMatcher) *FakeRule {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	rule := &FakeRule{operation: operation, query: query}
+	fake.rules = append(fake.rules, rule)
+	return rule
+}
+
+// SetDefault sets the response of the calls of operation (QueryOperationSelect or QueryOperationExecute)
+// that no rule matches
+func (fake *Fake) SetDefault(operation string, dbr *DBResult, err error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.defaults[operation] = fakeResponse{dbr: dbr, err: err}
+}
+
+// WithParams makes the rule match only the calls with these params. Each one is a value, compared
+// with reflect.DeepEqual, AnyParam or a ParamWhere.
+func (rule *FakeRule) WithParams(params ...interface{}) *FakeRule {
+	rule.params = params
+	rule.matchParams = true
+	return rule
+}
+
+// Where makes the rule match only the calls for which match returns true, description is used in
+// the diffs
+func (rule *FakeRule) Where(description string, match func(call FakeCall) bool) *FakeRule {
+	rule.predicates = append(rule.predicates, fakePredicate{description: description, match: match})
+	return rule
+}
+
+// Return scripts a response of the rule. Each response answers one call, in order, and the rule stops
+// matching when they run out unless Repeatedly is called. A rule without responses answers with the
+// default of its operation.
+func (rule *FakeRule) Return(dbr *DBResult) *FakeRule {
+	rule.responses = append(rule.responses, fakeResponse{dbr: dbr})
+	return rule
+}
+
+// ReturnError scripts an error response of the rule, see Return
+func (rule *FakeRule) ReturnError(err error) *FakeRule {
+	rule.responses = append(rule.responses, fakeResponse{err: err})
+	return rule
+}
+
+// Repeatedly makes the last response of the rule answer every call after the scripted ones
+func (rule *FakeRule) Repeatedly() *FakeRule {
+	rule.repeat = true
+	return rule
+}
+
+// Calls returns the amount of calls the rule answered
+func (rule *FakeRule) Calls() int {
+	return rule.calls
+}
+
+// String returns the description of the rule used in the diffs
+func (rule *FakeRule) String() string {
+	description := fmt.Sprintf("%s %s", rule.operation, rule.query.description)
+	if rule.matchParams {
+		params := make([]string, 0, len(rule.params))
+		for _, param := range rule.params {
+			params = append(params, describeFakeParam(param))
+		}
+		description += fmt.Sprintf(" WithParams(%s)", strings.Join(params, ", "))
+	}
+	for _, predicate := range rule.predicates {
+		description += fmt.Sprintf(" Where(%s)", predicate.description)
+	}
+	return description
+}
+
+// exhausted returns if the rule ran out of scripted responses
+func (rule *FakeRule) exhausted() bool {
+	return len(rule.responses) != 0 && !rule.repeat && rule.calls >= len(rule.responses)
+}
+
+// mismatch returns why the rule doesn't match call, or "" if it does
+func (rule *FakeRule) mismatch(call FakeCall) string {
+	if rule.operation != call.Operation {
+		return fmt.Sprintf("operation: want %s, got %s", rule.operation, call.Operation)
+	}
+	if !rule.query.match(call.Query) {
+		return "query doesn't match"
+	}
+	if rule.matchParams {
+		if len(rule.params) != len(call.Params) {
+			return fmt.Sprintf("params: want %d, got %d", len(rule.params), len(call.Params))
+		}
+		for i, param := range rule.params {
+			if !matchFakeParam(param, call.Params[i]) {
+				return fmt.Sprintf("param $%d: want %s, got %#v", i+1, describeFakeParam(param), call.Params[i])
+			}
+		}
+	}
+	for _, predicate := range rule.predicates {
+		if !predicate.match(call) {
+			return fmt.Sprintf("Where(%s) returned false", predicate.description)
+		}
+	}
+	if rule.exhausted() {
+		return fmt.Sprintf("no responses left, it answered %d calls", rule.calls)
+	}
+	return ""
+}
+
+// next returns the response of the rule to its next call
+func (rule *FakeRule) next() (fakeResponse, bool) {
+	defer func() {
+		rule.calls++
+	}()
+	if len(rule.responses) == 0 {
+		return fakeResponse{}, false
+	}
+	if rule.calls >= len(rule.responses) {
+		return rule.responses[len(rule.responses)-1], true
+	}
+	return rule.responses[rule.calls], true
+}
+
+func matchFakeParam(expected interface{}, param interface{}) bool {
+	if matcher, ok := expected.(FakeParamMatcher); ok {
+		return matcher.match(param)
+	}
+	return reflect.DeepEqual(expected, param)
+}
+
+func describeFakeParam(param interface{}) string {
+	if matcher, ok := param.(FakeParamMatcher); ok {
+		return matcher.description
+	}
+	return fmt.Sprintf("%#v", param)
+}
+
+// Inspection
+
+// Calls returns the calls received by the fake, in order
+func (fake *Fake) Calls() []FakeCall {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return append([]FakeCall(nil), fake.calls...)
+}
+
+// CallsTo returns the calls to method received by the fake, in order
+func (fake *Fake) CallsTo(method string) []FakeCall {
+	calls := make([]FakeCall, 0)
+	for _, call := range fake.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Transactions returns the transactions begun on the fake, in order
+func (fake *Fake) Transactions() []FakeTransaction {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	transactions := make([]FakeTransaction, 0, len(fake.transactions))
+	for _, tx := range fake.transactions {
+		transactions = append(transactions, *tx)
+	}
+	return transactions
+}
+
+// Unmatched returns the errors returned for the calls no rule nor default matched
+func (fake *Fake) Unmatched() []error {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return append([]error(nil), fake.unmatched...)
+}
+
+// FakeTestingT is the subset of testing.T used by AssertExpectations
+type FakeTestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// AssertExpectations fails the test if a call wasn't matched or a rule has scripted responses left
+func (fake *Fake) AssertExpectations(t FakeTestingT) bool {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	ok := true
+	for _, err := range fake.unmatched {
+		t.Errorf("%v", err)
+		ok = false
+	}
+	for _, rule := range fake.rules {
+		if rule.calls < len(rule.responses) {
+			t.Errorf("fake: rule %s answered %d of its %d responses", rule, rule.calls, len(rule.responses))
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Queries
+
+// query records call and answers it with the first rule that matches it or the default of its operation
+func (fake *Fake) query(dbc *DBContext, call FakeCall) (*DBResult, error) {
+	if endedAmbient(dbc) {
+		return nil, ErrAmbientTransactionEnded
+	}
+	if tenantOnPool(dbc) {
+		return nil, ErrTenantWithoutDBContext
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	call.TxID, call.NestingLevel = fakeTxState(dbc)
+	call.Tenant = fakeTenant(dbc)
+	fake.calls = append(fake.calls, call)
+
+	mismatches := make([]string, 0, len(fake.rules))
+	for i, rule := range fake.rules {
+		reason := rule.mismatch(call)
+		if reason != "" {
+			if rule.operation == call.Operation {
+				mismatches = append(mismatches, fmt.Sprintf("  rule #%d %s: %s", i+1, rule, reason))
+			}
+			continue
+		}
+
+		response, scripted := rule.next()
+		if !scripted {
+			response, scripted = fake.defaults[call.Operation]
+		}
+		if scripted {
+			return fake.respond(response)
+		}
+		mismatches = append(mismatches, fmt.Sprintf("  rule #%d %s: matched without responses nor default", i+1, rule))
+	}
+
+	if response, exists := fake.defaults[call.Operation]; exists {
+		return fake.respond(response)
+	}
+
+	err := fake.unmatchedError(call, mismatches)
+	fake.unmatched = append(fake.unmatched, err)
+	return nil, err
+}
+
+// respond returns the response, a nil result is returned as an empty one
+func (fake *Fake) respond(response fakeResponse) (*DBResult, error) {
+	if response.err != nil {
+		return nil, response.err
+	}
+	if response.dbr == nil {
+		return &DBResult{}, nil
+	}
+	return response.dbr, nil
+}
+
+func (fake *Fake) unmatchedError(call FakeCall, mismatches []string) error {
+	params := make([]string, 0, len(call.Params))
+	for _, param := range call.Params {
+		params = append(params, fmt.Sprintf("%#v", param))
+	}
+
+	message := fmt.Sprintf("%s(query: %q, params: [%s])", call.Method, compactQuery(call.Query),
+		strings.Join(params, ", "))
+	if len(mismatches) == 0 {
+		message += fmt.Sprintf("\n  no %s rules", call.Operation)
+	} else {
+		message += "\n" + strings.Join(mismatches, "\n")
+	}
+	return fmt.Errorf("%w: %s", ErrFakeUnmatched, message)
+}
+
+// record records a call that doesn't run a query
+func (fake *Fake) record(dbc *DBContext, method string) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	txID, nestingLevel := fakeTxState(dbc)
+	fake.calls = append(fake.calls, FakeCall{Method: method, TxID: txID, NestingLevel: nestingLevel,
+		Tenant: fakeTenant(dbc)})
+}
+
+// fakeTenant returns the tenant of the transaction or the connection of dbc
+func fakeTenant(dbc *DBContext) string {
+	if dbc == nil {
+		return ""
+	}
+	if tx, _ := dbc.tx.(*fakeTx); tx != nil {
+		return tx.tenant
+	}
+	if conn, _ := dbc.dbConn.(*fakeConn); conn != nil {
+		return conn.tenant
+	}
+	return ""
+}
+
+func fakeTxState(dbc *DBContext) (int, int) {
+	if dbc == nil {
+		return 0, 0
+	}
+	tx, _ := dbc.tx.(*fakeTx)
+	if tx == nil {
+		return 0, dbc.nestingLevel
+	}
+	return tx.id, dbc.nestingLevel
+}
+
+// Select answers the call with the rules of QueryOperationSelect
+func (fake *Fake) Select(dbc *DBContext, query string, forUpdate bool, params ...interface{}) (*DBResult, error) {
+	return fake.selectAs("Select", dbc, query, forUpdate, params...)
+}
+
+func (fake *Fake) selectAs(method string, dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) (*DBResult, error) {
+	return fake.query(dbc, FakeCall{
+		Method:    method,
+		Operation: QueryOperationSelect,
+		Query:     query,
+		Params:    params,
+		ForUpdate: forUpdate,
+	})
+}
+
+// SelectContext works like Select
+func (fake *Fake) SelectContext(ctx context.Context, dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) (*DBResult, error) {
+	return fake.selectAs("SelectContext", dbc.withContext(ctx), query, forUpdate, params...)
+}
+
+// SelectUniqueValue answers the call with the rules of QueryOperationSelect, like the service it fails
+// when the result has more than one row
+func (fake *Fake) SelectUniqueValue(dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) (*DBRow, error) {
+	dbr, err := fake.selectAs("SelectUniqueValue", dbc, query, forUpdate, params...)
+	return uniqueRow(dbr, err, false)
+}
+
+// SelectUniqueValueContext works like SelectUniqueValue
+func (fake *Fake) SelectUniqueValueContext(ctx context.Context, dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) (*DBRow, error) {
+	dbr, err := fake.selectAs("SelectUniqueValueContext", dbc.withContext(ctx), query, forUpdate, params...)
+	return uniqueRow(dbr, err, false)
+}
+
+// SelectUniqueValueNonEmpty answers the call with the rules of QueryOperationSelect, like the service
+// it fails when the result doesn't have exactly one row
+func (fake *Fake) SelectUniqueValueNonEmpty(dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) (*DBRow, error) {
+	dbr, err := fake.selectAs("SelectUniqueValueNonEmpty", dbc, query, forUpdate, params...)
+	return uniqueRow(dbr, err, true)
+}
+
+// SelectUniqueValueNonEmptyContext works like SelectUniqueValueNonEmpty
+func (fake *Fake) SelectUniqueValueNonEmptyContext(ctx context.Context, dbc *DBContext, query string,
+	forUpdate bool, params ...interface{}) (*DBRow, error) {
+	dbr, err := fake.selectAs("SelectUniqueValueNonEmptyContext", dbc.withContext(ctx), query, forUpdate,
+		params...)
+	return uniqueRow(dbr, err, true)
+}
+
+// uniqueRow returns the only row of dbr with the errors of SelectUniqueValue and SelectUniqueValueNonEmpty
+func uniqueRow(dbr *DBResult, err error, nonEmpty bool) (*DBRow, error) {
+	if err != nil {
+		return nil, err
+	}
+	sizeRecords := len(dbr.rows.DBRowArray)
+	if sizeRecords > 1 {
+		return nil, fmt.Errorf("unexpected records size, expected 1 but was: %d", sizeRecords)
+	}
+	if sizeRecords == 0 {
+		if nonEmpty {
+			return nil, fmt.Errorf("unable to find record")
+		}
+		return nil, nil
+	}
+	return &dbr.rows.DBRowArray[0], nil
+}
+
+// SelectOnDbLinkView answers the query with the rules of QueryOperationSelect, the dblink connection
+// is not simulated
+func (fake *Fake) SelectOnDbLinkView(dbLink *DbLink, dbc *DBContext, query string,
+	params ...interface{}) (*DBResult, error) {
+	return fake.selectAs("SelectOnDbLinkView", dbc, query, false, params...)
+}
+
+// SelectStream answers the call with the rules of QueryOperationSelect through an iterator
+func (fake *Fake) SelectStream(dbc *DBContext, query string, params ...interface{}) (RowIterator, error) {
+	return fake.selectIterator("SelectStream", dbc, query, params...)
+}
+
+// SelectStreamContext works like SelectStream
+func (fake *Fake) SelectStreamContext(ctx context.Context, dbc *DBContext, query string,
+	params ...interface{}) (RowIterator, error) {
+	return fake.selectIterator("SelectStreamContext", dbc.withContext(ctx), query, params...)
+}
+
+// SelectCursor answers the call with the rules of QueryOperationSelect through an iterator
+func (fake *Fake) SelectCursor(dbc *DBContext, query string, fetchSize int,
+	params ...interface{}) (RowIterator, error) {
+	return fake.selectIterator("SelectCursor", dbc, query, params...)
+}
+
+// SelectCursorContext works like SelectCursor
+func (fake *Fake) SelectCursorContext(ctx context.Context, dbc *DBContext, query string, fetchSize int,
+	params ...interface{}) (RowIterator, error) {
+	return fake.selectIterator("SelectCursorContext", dbc.withContext(ctx), query, params...)
+}
+
+func (fake *Fake) selectIterator(method string, dbc *DBContext, query string,
+	params ...interface{}) (RowIterator, error) {
+	dbr, err := fake.selectAs(method, dbc, query, false, params...)
+	if err != nil {
+		return nil, err
+	}
+	return newResultIterator(dbr), nil
+}
+
+// QueryRow is not supported, the *sql.Row can't be built without a database
+func (fake *Fake) QueryRow(query string, params ...interface{}) (*sql.Row, error) {
+	return nil, errFakeQueryRow
+}
+
+// QueryRowContext is not supported, the *sql.Row can't be built without a database
+func (fake *Fake) QueryRowContext(ctx context.Context, query string, params ...interface{}) (*sql.Row, error) {
+	return nil, errFakeQueryRow
+}
+
+// Execute answers the call with the rules of QueryOperationExecute
+func (fake *Fake) Execute(dbc *DBContext, query string, params ...interface{}) (*DBResult, error) {
+	return fake.executeAs("Execute", dbc, query, params...)
+}
+
+func (fake *Fake) executeAs(method string, dbc *DBContext, query string, params ...interface{}) (*DBResult, error) {
+	return fake.query(dbc, FakeCall{
+		Method:    method,
+		Operation: QueryOperationExecute,
+		Query:     query,
+		Params:    params,
+	})
+}
+
+// ExecuteContext works like Execute
+func (fake *Fake) ExecuteContext(ctx context.Context, dbc *DBContext, query string,
+	params ...interface{}) (*DBResult, error) {
+	return fake.executeAs("ExecuteContext", dbc.withContext(ctx), query, params...)
+}
+
+// ExecuteEnsuringOneAffectedRow answers the call with the rules of QueryOperationExecute, like the
+// service it fails when the result doesn't have one affected row
+func (fake *Fake) ExecuteEnsuringOneAffectedRow(dbc *DBContext, query string, params ...interface{}) error {
+	dbr, err := fake.executeAs("ExecuteEnsuringOneAffectedRow", dbc, query, params...)
+	return oneAffectedRow(dbr, err)
+}
+
+// ExecuteEnsuringOneAffectedRowContext works like ExecuteEnsuringOneAffectedRow
+func (fake *Fake) ExecuteEnsuringOneAffectedRowContext(ctx context.Context, dbc *DBContext, query string,
+	params ...interface{}) error {
+	dbr, err := fake.executeAs("ExecuteEnsuringOneAffectedRowContext", dbc.withContext(ctx), query, params...)
+	return oneAffectedRow(dbr, err)
+}
+
+func oneAffectedRow(dbr *DBResult, err error) error {
+	if err != nil {
+		return err
+	}
+	if dbr.AffectedRows() != 1 {
+		return fmt.Errorf("unable to insert or update: %d", dbr.AffectedRows())
+	}
+	return nil
+}
+
+// BulkInsert answers the INSERT ... VALUES statement of every row with the rules of QueryOperationExecute
+func (fake *Fake) BulkInsert(dbc *DBContext, table string, columns []string,
+	rows [][]interface{}) (*DBResult, error) {
+	return fake.bulkInsert("BulkInsert", dbc, table, columns, rows)
+}
+
+// BulkInsertContext works like BulkInsert
+func (fake *Fake) BulkInsertContext(ctx context.Context, dbc *DBContext, table string, columns []string,
+	rows [][]interface{}) (*DBResult, error) {
+	return fake.bulkInsert("BulkInsertContext", dbc.withContext(ctx), table, columns, rows)
+}
+
+func (fake *Fake) bulkInsert(method string, dbc *DBContext, table string, columns []string,
+	rows [][]interface{}) (*DBResult, error) {
+	if len(columns) == 0 {
+		return nil, errBulkInsertNoColumns
+	}
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("row %d has %d values but %d columns were given", i, len(row), len(columns))
+		}
+	}
+	if len(rows) == 0 {
+		return &DBResult{}, nil
+	}
+
+	query, params := bulkInsertQuery(table, columns, rows)
+	return fake.executeAs(method, dbc, query, params...)
+}
+
+// ExecuteBatch answers every statement with the rules of QueryOperationExecute, or the ones of
+// QueryOperationSelect if it has a RETURNING clause, inside a fake transaction if dbc doesn't have one
+func (fake *Fake) ExecuteBatch(dbc *DBContext, statements []Statement) ([]*DBResult, error) {
+	return executeBatch(fake, dbc, statements)
+}
+
+// ExecuteBatchContext works like ExecuteBatch
+func (fake *Fake) ExecuteBatchContext(ctx context.Context, dbc *DBContext,
+	statements []Statement) ([]*DBResult, error) {
+	return executeBatch(fake, dbc.withContext(ctx), statements)
+}
+
+// Paginate answers the Select of the page with the rules of QueryOperationSelect, the cursors are
+// signed with a random secret
+func (fake *Fake) Paginate(dbc *DBContext, query string, params []interface{},
+	request PageRequest) (*Page, error) {
+	return paginate(fake, fakePaginationSecret, dbc, query, params, request)
+}
+
+// Notify answers the pg_notify query with the rules of QueryOperationExecute
+func (fake *Fake) Notify(dbc *DBContext, channel string, payload string) error {
+	if channel == "" {
+		return errListenerChannelEmpty
+	}
+	_, err := fake.executeAs("Notify", dbc, notifyQuery, channel, payload)
+	return err
+}
+
+// NotifyContext works like Notify
+func (fake *Fake) NotifyContext(ctx context.Context, dbc *DBContext, channel string, payload string) error {
+	if channel == "" {
+		return errListenerChannelEmpty
+	}
+	_, err := fake.executeAs("NotifyContext", dbc.withContext(ctx), notifyQuery, channel, payload)
+	return err
+}
+
+// Locks, the try and unlock results are the affected rows of the answers like in the service
+
+// TryLock answers the lock query with the rules of QueryOperationExecute
+func (fake *Fake) TryLock(dbc *DBContext, key LockKey) (bool, error) {
+	if dbc == nil || dbc.dbConn == nil {
+		return false, errLockWithoutConn
+	}
+	dbr, err := fake.executeAs("TryLock", dbc, tryLockQuery, int64(key))
+	if err != nil {
+		return false, err
+	}
+	return dbr.AffectedRows() == 1, nil
+}
+
+// Lock answers the lock query with the rules of QueryOperationExecute
+func (fake *Fake) Lock(dbc *DBContext, key LockKey) error {
+	if dbc == nil || dbc.dbConn == nil {
+		return errLockWithoutConn
+	}
+	_, err := fake.executeAs("Lock", dbc, lockQuery, int64(key))
+	return err
+}
+
+// Unlock answers the unlock query with the rules of QueryOperationExecute
+func (fake *Fake) Unlock(dbc *DBContext, key LockKey) error {
+	if dbc == nil || dbc.dbConn == nil {
+		return errLockWithoutConn
+	}
+	dbr, err := fake.executeAs("Unlock", dbc, unlockQuery, int64(key))
+	if err != nil {
+		return err
+	}
+	if dbr.AffectedRows() != 1 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// TryLockXact answers the lock query with the rules of QueryOperationExecute
+func (fake *Fake) TryLockXact(dbc *DBContext, key LockKey) (bool, error) {
+	if dbc == nil || dbc.tx == nil {
+		return false, errTransactionNil
+	}
+	dbr, err := fake.executeAs("TryLockXact", dbc, tryLockXactQuery, int64(key))
+	if err != nil {
+		return false, err
+	}
+	return dbr.AffectedRows() == 1, nil
+}
+
+// LockXact answers the lock query with the rules of QueryOperationExecute
+func (fake *Fake) LockXact(dbc *DBContext, key LockKey) error {
+	if dbc == nil || dbc.tx == nil {
+		return errTransactionNil
+	}
+	_, err := fake.executeAs("LockXact", dbc, lockXactQuery, int64(key))
+	return err
+}
+
+// WithLock runs fn holding the lock on a new fake connection
+func (fake *Fake) WithLock(key LockKey, fn func(dbc *DBContext) error) error {
+	return fake.WithLockContext(context.Background(), key, fn)
+}
+
+// WithLockContext works like WithLock
+func (fake *Fake) WithLockContext(ctx context.Context, key LockKey, fn func(dbc *DBContext) error) (err error) {
+	dbc, err := fake.ConnectionContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fake.Lock(dbc, key)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		unlockErr := fake.Unlock(dbc, key)
+		if unlockErr != nil && err == nil {
+			err = fmt.Errorf("unlock %d: %w", key, unlockErr)
+		}
+		_ = fake.Close(dbc)
+	}()
+
+	return fn(dbc)
+}
+
+// Connections and transactions
+
+// Connection returns a DBContext with a fake connection
+func (fake *Fake) Connection() (*DBContext, error) {
+	return fake.ConnectionContext(context.Background())
+}
+
+// ConnectionContext returns a DBContext with a fake connection bound to ctx
+func (fake *Fake) ConnectionContext(ctx context.Context) (*DBContext, error) {
+	fake.record(nil, "Connection")
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.shutdown {
+		return nil, errServiceShutdown
+	}
+	return &DBContext{dbConn: &fakeConn{tenant: TenantFromContext(ctx)}, ctx: ctx}, nil
+}
+
+// TestConnection always succeeds
+func (fake *Fake) TestConnection(dbc *DBContext) error {
+	fake.record(dbc, "TestConnection")
+	return nil
+}
+
+// Close releases the fake connection of dbc, like the service it fails with an active transaction
+func (fake *Fake) Close(dbc *DBContext) error {
+	fake.record(dbc, "Close")
+
+	if dbc == nil {
+		return fmt.Errorf("you must send a DBContext in order to close")
+	}
+	if dbc.tx != nil {
+		return fmt.Errorf("you are closing a connection with an active transaction")
+	}
+	dbc.dbConn = nil
+	return nil
+}
+
+// Begin starts a fake transaction, or increments the nesting level of the one of dbc
+func (fake *Fake) Begin(dbc *DBContext) (*DBContext, error) {
+	return fake.BeginContext(dbc.context(), dbc)
+}
+
+// BeginContext works like Begin, without a dbc it joins the ambient transaction of ctx
+func (fake *Fake) BeginContext(ctx context.Context, dbc *DBContext) (*DBContext, error) {
+	if dbc == nil {
+		dbc = ambientDBContext(ctx)
+		if dbc == nil && DBContextFromContext(ctx) != nil {
+			return nil, ErrAmbientTransactionEnded
+		}
+	}
+	if dbc == nil || (dbc.tx == nil && dbc.dbConn == nil) {
+		newDbc, err := fake.ConnectionContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if dbc != nil {
+			*dbc = *newDbc
+		} else {
+			dbc = newDbc
+		}
+	}
+
+	if dbc.nestingLevel == 0 {
+		fake.mu.Lock()
+		tx := &fakeTx{id: len(fake.transactions) + 1, tenant: TenantFromContext(ctx)}
+		if conn, _ := dbc.dbConn.(*fakeConn); conn != nil && conn.tenant != "" {
+			tx.tenant = conn.tenant
+		}
+		fake.transactions = append(fake.transactions, &FakeTransaction{ID: tx.id, State: FakeTxActive})
+		fake.mu.Unlock()
+
+		dbc.ctx = ctx
+		dbc.tx = tx
+	}
+	dbc.nestingLevel++
+	fake.record(dbc, "Begin")
+
+	// done
+	return dbc, nil
+}
+
+// Commit ends the fake transaction of dbc when it's the outermost one, otherwise it decrements the
+// nesting level
+func (fake *Fake) Commit(dbc *DBContext) error {
+	fake.record(dbc, "Commit")
+
+	if dbc == nil {
+		return fmt.Errorf("you must send a DBContext in order to commit")
+	}
+	if dbc.nestingLevel <= 0 {
+		return fmt.Errorf("the nestingLevel must be greater than 0 in order to call Commit()")
+	}
+	if dbc.tx == nil {
+		return fmt.Errorf("the dbc.tx was not set before call Commit()")
+	}
+
+	if dbc.nestingLevel == 1 {
+		fake.endTx(dbc, FakeTxCommitted)
+	}
+	dbc.nestingLevel--
+
+	// done
+	return nil
+}
+
+// Rollback ends the fake transaction of dbc. With WithFakeSavepoints a nested transaction only
+// decrements the nesting level.
+func (fake *Fake) Rollback(dbc *DBContext) error {
+	fake.record(dbc, "Rollback")
+
+	if dbc == nil {
+		return fmt.Errorf("you must send a DBContext in order to rollback")
+	}
+	if dbc.nestingLevel == 0 {
+		return nil
+	}
+	if dbc.tx == nil {
+		return fmt.Errorf("the dbc.tx was not set before call Rollback()")
+	}
+
+	if dbc.nestingLevel > 1 && fake.useSavepoints {
+		dbc.nestingLevel--
+		return nil
+	}
+	fake.endTx(dbc, FakeTxRolledBack)
+	dbc.nestingLevel = 0
+
+	// done
+	return nil
+}
+
+// endTx sets the state of the transaction of dbc and releases its connection
+func (fake *Fake) endTx(dbc *DBContext, state string) {
+	fake.mu.Lock()
+	if tx, ok := dbc.tx.(*fakeTx); ok {
+		fake.transactions[tx.id-1].State = state
+	}
+	fake.mu.Unlock()
+
+	dbc.tx = nil
+	dbc.dbConn = nil
+}
+
+// WithTransaction runs txFn in a fake transaction, committed if it returns nil and rolled back otherwise
+func (fake *Fake) WithTransaction(txFn func(dbc *DBContext) error, opts ...TxOption) error {
+	return fake.WithTransactionContext(context.Background(), txFn, opts...)
+}
+
+// WithTransactionContext works like WithTransaction, the retry policy of opts is ignored
+func (fake *Fake) WithTransactionContext(ctx context.Context, txFn func(dbc *DBContext) error,
+	opts ...TxOption) (err error) {
+	txContext, err := fake.BeginContext(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = fake.Rollback(txContext)
+			panic(p)
+		} else if err != nil {
+			_ = fake.Rollback(txContext)
+		} else {
+			err = fake.Commit(txContext)
+		}
+	}()
+
+	err = txFn(txContext)
+	return err
+}
+
+// Pool
+
+// PoolStats returns empty stats
+func (fake *Fake) PoolStats() sql.DBStats {
+	return sql.DBStats{}
+}
+
+// PoolStatsByNode returns empty stats for the primary
+func (fake *Fake) PoolStatsByNode() map[string]sql.DBStats {
+	return map[string]sql.DBStats{primaryNodeName: {}}
+}
+
+// Ready succeeds until Shutdown is called
+func (fake *Fake) Ready(ctx context.Context) error {
+	fake.record(nil, "Ready")
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if fake.shutdown {
+		return errServiceShutdown
+	}
+	return nil
+}
+
+// Shutdown makes the fake stop handing out connections
+func (fake *Fake) Shutdown(ctx context.Context) error {
+	fake.record(nil, "Shutdown")
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.shutdown = true
+	return nil
+}
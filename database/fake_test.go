@@ -0,0 +1,181 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Fake_Matches_Query_Ignoring_Whitespace(t *testing.T) {
+	// Given
+	assertions := assert.New(t)
+	fake := database.NewFake()
+	fake.OnSelect(database.QueryEquals("SELECT id FROM users WHERE id = $1")).
+		WithParams(int64(7)).
+		Return(database.ParseMockDBResultFromJSON(`[{"id": 7}]`))
+
+	// When
+	row, err := fake.SelectUniqueValueNonEmpty(nil, `
+		SELECT id
+		  FROM users
+		 WHERE id = $1;`, false, int64(7))
+
+	// Then
+	assertions.Nil(err)
+	id, err := row.GetColumnByName("id")
+	assertions.Nil(err)
+	assertions.Equal(float64(7), id.GetRawValue())
+	assertions.True(fake.AssertExpectations(t))
+}
+
+func Test_Fake_Scripted_Responses_And_Defaults(t *testing.T) {
+	// Given
+	assertions := assert.New(t)
+	fake := database.NewFake()
+	fake.OnExecute(database.QueryMatches(`^UPDATE orders`)).
+		WithParams(database.AnyParam, database.ParamWhere("positive", func(param interface{}) bool {
+			return param.(int) > 0
+		})).
+		Return(database.ParseMockDBResultAffectedRows(1)).
+		ReturnError(errors.New("forced for test"))
+	fake.SetDefault(database.QueryOperationExecute, database.ParseMockDBResultAffectedRows(0), nil)
+
+	// When
+	err1 := fake.ExecuteEnsuringOneAffectedRow(nil, "UPDATE orders SET state = $1 WHERE id = $2", "paid", 1)
+	err2 := fake.ExecuteEnsuringOneAffectedRow(nil, "UPDATE orders SET state = $1 WHERE id = $2", "paid", 2)
+	dbr, err3 := fake.Execute(nil, "UPDATE orders SET state = $1 WHERE id = $2", "paid", 3)
+
+	// Then
+	assertions.Nil(err1)
+	assertions.EqualError(err2, "forced for test")
+	assertions.Nil(err3)
+	assertions.Equal(int64(0), dbr.AffectedRows())
+	assertions.Len(fake.CallsTo("ExecuteEnsuringOneAffectedRow"), 2)
+	assertions.Equal([]interface{}{"paid", 3}, fake.Calls()[2].Params)
+}
+
+func Test_Fake_Unmatched_Returns_Diff(t *testing.T) {
+	// Given
+	assertions := assert.New(t)
+	fake := database.NewFake()
+	fake.OnSelect(database.QueryMatches(`FROM orders`)).Return(nil)
+	fake.OnSelect(database.QueryEquals("SELECT * FROM users WHERE id = $1")).WithParams(int64(2)).Return(nil)
+	fake.OnSelect(database.AnyQuery()).Where("for update", func(call database.FakeCall) bool {
+		return call.ForUpdate
+	}).Return(nil)
+
+	// When
+	_, err := fake.Select(nil, "SELECT *  FROM users WHERE id = $1", false, 1)
+
+	// Then
+	assertions.ErrorIs(err, database.ErrFakeUnmatched)
+	assertions.EqualError(err, `fake_unmatched: Select(query: "SELECT * FROM users WHERE id = $1", params: [1])
+  rule #1 select QueryMatches(`+"`FROM orders`"+`): query doesn't match
+  rule #2 select QueryEquals("SELECT * FROM users WHERE id = $1") WithParams(2): param $1: want 2, got 1
+  rule #3 select AnyQuery() Where(for update): Where(for update) returned false`)
+	assertions.Equal([]error{err}, fake.Unmatched())
+}
+
+func Test_Fake_Transaction_Nesting(t *testing.T) {
+	// Given
+	assertions := assert.New(t)
+	fake := database.NewFake()
+	fake.SetDefault(database.QueryOperationExecute, nil, nil)
+
+	// When
+	err := fake.WithTransaction(func(dbc *database.DBContext) error {
+		_, err := fake.Execute(dbc, "DELETE FROM carts")
+		if err != nil {
+			return err
+		}
+		nested, err := fake.Begin(dbc)
+		if err != nil {
+			return err
+		}
+		_, err = fake.Execute(nested, "DELETE FROM orders")
+		if err != nil {
+			return err
+		}
+		return fake.Commit(nested)
+	})
+	rollbackErr := fake.WithTransactionContext(context.Background(), func(dbc *database.DBContext) error {
+		return errors.New("forced for test")
+	})
+
+	// Then
+	assertions.Nil(err)
+	assertions.EqualError(rollbackErr, "forced for test")
+	assertions.Equal([]database.FakeTransaction{
+		{ID: 1, State: database.FakeTxCommitted},
+		{ID: 2, State: database.FakeTxRolledBack},
+	}, fake.Transactions())
+	executes := fake.CallsTo("Execute")
+	assertions.Equal(1, executes[0].TxID)
+	assertions.Equal(1, executes[0].NestingLevel)
+	assertions.Equal(2, executes[1].NestingLevel)
+}
+
+func Test_Fake_Nested_Rollback(t *testing.T) {
+	tt := []struct {
+		Name          string
+		Opts          []database.FakeOption
+		ExpectedState string
+		CommitError   string
+	}{
+		{"Without savepoints", nil, database.FakeTxRolledBack,
+			"the nestingLevel must be greater than 0 in order to call Commit()"},
+		{"With savepoints", []database.FakeOption{database.WithFakeSavepoints()}, database.FakeTxCommitted, ""},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// Given
+			assertions := assert.New(t)
+			fake := database.NewFake(tc.Opts...)
+
+			// When
+			dbc, beginErr := fake.Begin(nil)
+			_, nestedErr := fake.Begin(dbc)
+			rollbackErr := fake.Rollback(dbc)
+			commitErr := fake.Commit(dbc)
+
+			// Then
+			assertions.Nil(beginErr)
+			assertions.Nil(nestedErr)
+			assertions.Nil(rollbackErr)
+			if tc.CommitError == "" {
+				assertions.Nil(commitErr)
+			} else {
+				assertions.EqualError(commitErr, tc.CommitError)
+			}
+			assertions.Equal([]database.FakeTransaction{{ID: 1, State: tc.ExpectedState}}, fake.Transactions())
+		})
+	}
+}
+
+func Test_Fake_ExecuteBatch(t *testing.T) {
+	// Given
+	assertions := assert.New(t)
+	fake := database.NewFake()
+	fake.OnExecute(database.QueryMatches(`^UPDATE`)).Return(database.ParseMockDBResultAffectedRows(2))
+	fake.OnSelect(database.QueryMatches(`RETURNING id$`)).Return(database.ParseMockDBResultFromJSON(`[{"id": 1}]`))
+
+	// When
+	results, err := fake.ExecuteBatch(nil, []database.Statement{
+		{Query: "UPDATE carts SET closed = true"},
+		{Query: "INSERT INTO orders (cart_id) VALUES ($1) RETURNING id", Params: []interface{}{1}},
+		{Query: "DELETE FROM carts"},
+	})
+
+	// Then
+	var batchErr *database.BatchError
+	assertions.ErrorAs(err, &batchErr)
+	assertions.Equal(2, batchErr.Index)
+	assertions.ErrorIs(err, database.ErrFakeUnmatched)
+	assertions.Len(results, 2)
+	assertions.Equal(int64(1), results[1].AffectedRows())
+	assertions.Equal([]database.FakeTransaction{{ID: 1, State: database.FakeTxRolledBack}}, fake.Transactions())
+}
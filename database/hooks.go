@@ -0,0 +1,252 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/libs/go/logger"
+	"github.com/FlatDigital/core-go-toolkit/v2/godog"
+)
+
+const (
+	// QueryOperationSelect is the operation of the queries run by Select
+	QueryOperationSelect = "select"
+	// QueryOperationExecute is the operation of the queries run by Execute
+	QueryOperationExecute = "execute"
+)
+
+var (
+	// normalizeCommentRegexp matches line and block comments
+	normalizeCommentRegexp = regexp.MustCompile(`--[^\n]*|/\*[\s\S]*?\*/`)
+	// normalizeStringRegexp matches string literals
+	normalizeStringRegexp = regexp.MustCompile(`(?:[eE])?'(?:[^']|'')*'`)
+	// normalizeNumberRegexp matches numeric literals that are not positional params
+	normalizeNumberRegexp = regexp.MustCompile(`(^|[^$\w.])-?\d+(?:\.\d+)?`)
+	// normalizeInListRegexp matches IN lists of placeholders
+	normalizeInListRegexp = regexp.MustCompile(`(?i)\bIN\s*\(\s*(?:\?|\$\d+)(?:\s*,\s*(?:\?|\$\d+))*\s*\)`)
+	// normalizeSpaceRegexp matches runs of whitespace
+	normalizeSpaceRegexp = regexp.MustCompile(`\s+`)
+)
+
+type (
+	// QueryHook is called before and after every query run by the service: Select, Execute,
+	// QueryRow, SelectStream and the COPY of BulkInsert. A SelectStream finishes when its iterator
+	// is closed.
+	QueryHook interface {
+		// BeforeQuery is called before the query runs, the returned ctx is the one given to AfterQuery
+		BeforeQuery(ctx context.Context, event *QueryEvent) context.Context
+		// AfterQuery is called after the query runs, with the Duration, Rows and Err of the event set
+		AfterQuery(ctx context.Context, event *QueryEvent)
+	}
+
+	// QueryEvent describes a query run by the service
+	QueryEvent struct {
+		// Operation is QueryOperationSelect or QueryOperationExecute
+		Operation string
+		// Query is the normalized query, without literals, comments or extra whitespace
+		Query       string
+		ParamsCount int
+		InTx        bool
+		// Tenant is the tenant of the connection or transaction, see WithTenant
+		Tenant   string
+		Start    time.Time
+		Duration time.Duration
+		// Rows are the rows returned by a select or affected by an execute
+		Rows int64
+		Err  error
+	}
+
+	// queryRun is a query being observed by the hooks of the service
+	queryRun struct {
+		hooks []QueryHook
+		ctxs  []context.Context
+		event *QueryEvent
+	}
+
+	// metricsHook records the count and duration of the queries
+	metricsHook struct {
+		prefix string
+	}
+
+	// slowQueryHook logs the queries slower than threshold
+	slowQueryHook struct {
+		threshold time.Duration
+		logger    *logger.Logger
+	}
+
+	// traceHook creates a span for every query
+	traceHook struct {
+		service string
+	}
+)
+
+// startQuery calls BeforeQuery on the hooks, it returns nil if there are none
+func (service *service) startQuery(dbc *DBContext, operation string, query string, params []interface{}) *queryRun {
+	if len(service.hooks) == 0 {
+		return nil
+	}
+
+	run := &queryRun{
+		hooks: service.hooks,
+		ctxs:  make([]context.Context, len(service.hooks)),
+		event: &QueryEvent{
+			Operation:   operation,
+			Query:       normalizeQuery(query),
+			ParamsCount: len(params),
+			InTx:        dbc != nil && dbc.tx != nil,
+			Tenant:      service.tenantOf(dbc),
+		},
+	}
+	ctx := dbc.context()
+	for i, hook := range run.hooks {
+		run.ctxs[i] = hook.BeforeQuery(ctx, run.event)
+	}
+	run.event.Start = time.Now()
+
+	return run
+}
+
+// finish sets the result of the query and calls AfterQuery on the hooks
+func (run *queryRun) finish(dbResult *DBResult, err error) {
+	if run == nil {
+		return
+	}
+
+	var rows int64
+	if dbResult != nil {
+		if run.event.Operation == QueryOperationSelect {
+			rows = int64(len(dbResult.GetRows()))
+		} else {
+			rows = dbResult.AffectedRows()
+		}
+	}
+	run.finishRows(rows, err)
+}
+
+// finishRows sets the rows and error of the query and calls AfterQuery on the hooks
+func (run *queryRun) finishRows(rows int64, err error) {
+	if run == nil {
+		return
+	}
+
+	run.event.Duration = time.Since(run.event.Start)
+	run.event.Rows = rows
+	run.event.Err = err
+	for i, hook := range run.hooks {
+		hook.AfterQuery(run.ctxs[i], run.event)
+	}
+}
+
+// normalizeQuery returns the fingerprint of a query: literals are replaced by ?, IN lists are
+// collapsed and comments and extra whitespace are removed
+func normalizeQuery(query string) string {
+	query = normalizeCommentRegexp.ReplaceAllString(query, " ")
+	query = normalizeStringRegexp.ReplaceAllString(query, "?")
+	query = normalizeNumberRegexp.ReplaceAllString(query, "${1}?")
+	query = normalizeInListRegexp.ReplaceAllString(query, "IN (?)")
+	query = normalizeSpaceRegexp.ReplaceAllString(query, " ")
+	return strings.TrimSuffix(strings.TrimSpace(query), ";")
+}
+
+// NewMetricsQueryHook returns a hook that records the count of queries and their duration in
+// milliseconds through godog, as application.<prefix>.db.query.count and .duration
+func NewMetricsQueryHook(prefix string) QueryHook {
+	return &metricsHook{prefix: prefix}
+}
+
+// BeforeQuery implements QueryHook
+func (hook *metricsHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery implements QueryHook
+func (hook *metricsHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	status := "ok"
+	if event.Err != nil {
+		status = "error"
+	}
+	tags := new(godog.Tags).
+		Add("operation", event.Operation).
+		Add("in_tx", strconv.FormatBool(event.InTx)).
+		Add("status", status)
+	if event.Tenant != "" {
+		tags = tags.Add("tenant", event.Tenant)
+	}
+
+	godog.RecordSimpleMetric(fmt.Sprintf("application.%s.db.query.count", hook.prefix), 1, tags.ToArray()...)
+	godog.RecordCompoundMetric(fmt.Sprintf("application.%s.db.query.duration", hook.prefix),
+		float64(event.Duration)/float64(time.Millisecond), tags.ToArray()...)
+}
+
+// NewSlowQueryHook returns a hook that logs a warning for every query that takes longer than threshold
+func NewSlowQueryHook(threshold time.Duration) QueryHook {
+	return &slowQueryHook{
+		threshold: threshold,
+		logger:    logger.LoggerWithName(nil, "database"),
+	}
+}
+
+// BeforeQuery implements QueryHook
+func (hook *slowQueryHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	return ctx
+}
+
+// AfterQuery implements QueryHook
+func (hook *slowQueryHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	if event.Duration < hook.threshold {
+		return
+	}
+
+	attrs := logger.Attrs{
+		"operation":    event.Operation,
+		"duration_ms":  event.Duration.Milliseconds(),
+		"params_count": event.ParamsCount,
+		"rows":         event.Rows,
+		"in_tx":        event.InTx,
+		logger.UnstructuredLogKeyPrefix + "_query": event.Query,
+	}
+	if event.Err != nil {
+		attrs["error"] = event.Err.Error()
+	}
+	hook.logger.Warning("slow_query", attrs)
+}
+
+// NewTraceQueryHook returns a hook that creates a dd-trace span for every query, child of the span
+// in the ctx of the DBContext if there is one
+func NewTraceQueryHook(serviceName string) QueryHook {
+	return &traceHook{service: serviceName}
+}
+
+// BeforeQuery implements QueryHook
+func (hook *traceHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	opts := []tracer.StartSpanOption{
+		tracer.ResourceName(event.Query),
+		tracer.SpanType(ext.SpanTypeSQL),
+		tracer.Tag(ext.DBType, "postgres"),
+		tracer.Tag("db.operation", event.Operation),
+		tracer.Tag("db.in_tx", event.InTx),
+		tracer.Tag("db.params_count", event.ParamsCount),
+	}
+	if hook.service != "" {
+		opts = append(opts, tracer.ServiceName(hook.service))
+	}
+	_, ctx = tracer.StartSpanFromContext(ctx, "postgres.query", opts...)
+	return ctx
+}
+
+// AfterQuery implements QueryHook
+func (hook *traceHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok {
+		return
+	}
+	span.SetTag("db.rows", event.Rows)
+	span.Finish(tracer.WithError(event.Err))
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+)
+
+// recordingHook records the events it receives
+type recordingHook struct {
+	before []QueryEvent
+	after  []QueryEvent
+}
+
+func (hook *recordingHook) BeforeQuery(ctx context.Context, event *QueryEvent) context.Context {
+	hook.before = append(hook.before, *event)
+	return ctx
+}
+
+func (hook *recordingHook) AfterQuery(ctx context.Context, event *QueryEvent) {
+	hook.after = append(hook.after, *event)
+}
+
+func Test_NormalizeQuery(t *testing.T) {
+	ass := assert.New(t)
+
+	ass.Equal("SELECT * FROM users WHERE id = $1 AND email = ? AND age > ?",
+		normalizeQuery("SELECT *\n  FROM users -- the users\n WHERE id = $1 AND email = 'a''b@flat.mx' AND age > 18;"))
+	ass.Equal("SELECT id FROM t2 WHERE id IN (?) AND amount = ?",
+		normalizeQuery("/* report */ SELECT id FROM t2 WHERE id IN ($1, $2, $3) AND amount = -1.5"))
+}
+
+func Test_Execute_Calls_Hooks(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	hook := &recordingHook{}
+	service.hooks = []QueryHook{hook}
+	params := []interface{}{"test@flat.mx"}
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+
+	// when
+	sqlMock.PatchPrepare(insertStmt, stmtMock, nil)
+	stmtMock.PatchExec(params, resultMock, nil)
+	stmtMock.PatchClose(nil)
+	resultMock.PatchRowsAffected(1, nil)
+	_, err := service.Execute(nil, insertStmt, params...)
+
+	// then
+	ass.Nil(err)
+	ass.Len(hook.before, 1)
+	ass.Len(hook.after, 1)
+	ass.Equal(QueryOperationExecute, hook.after[0].Operation)
+	ass.Equal(1, hook.after[0].ParamsCount)
+	ass.Equal(int64(1), hook.after[0].Rows)
+	ass.False(hook.after[0].InTx)
+	ass.Nil(hook.after[0].Err)
+}
+
+func Test_Select_Calls_Hooks_With_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	hook := &recordingHook{}
+	service.hooks = []QueryHook{hook}
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{tx: txMock, ctx: ctx, nestingLevel: 1}
+	queryErr := errors.New("relation does not exist")
+
+	// when
+	txMock.PatchPrepareContext(ctx, "SELECT * FROM missing", nil, queryErr)
+	_, err := service.Select(dbc, "SELECT * FROM missing", false)
+
+	// then
+	ass.Equal(queryErr, err)
+	ass.Len(hook.after, 1)
+	ass.Equal(QueryOperationSelect, hook.after[0].Operation)
+	ass.True(hook.after[0].InTx)
+	ass.Equal(queryErr, hook.after[0].Err)
+}
+
+func Test_QueryRowContext_Calls_Hooks(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	hook := &recordingHook{}
+	service.hooks = []QueryHook{hook}
+	ctx := context.Background()
+	queryErr := errors.New("relation does not exist")
+
+	// when
+	sqlMock.PatchQueryRowContext(ctx, "SELECT id FROM missing WHERE id = $1", []interface{}{1}, nil, queryErr)
+	_, err := service.QueryRowContext(ctx, "SELECT id FROM missing WHERE id = $1", 1)
+
+	// then
+	ass.Equal(queryErr, err)
+	ass.Len(hook.before, 1)
+	ass.Len(hook.after, 1)
+	ass.Equal(QueryOperationSelect, hook.after[0].Operation)
+	ass.Equal(1, hook.after[0].ParamsCount)
+	ass.Equal(queryErr, hook.after[0].Err)
+}
+
+func Test_SelectStream_Calls_Hooks_On_Close(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	hook := &recordingHook{}
+	service.hooks = []QueryHook{hook}
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{tx: txMock, ctx: ctx, nestingLevel: 1}
+	stmtMock := newDBStmtMock()
+	rowsMock := newDBRowsMock()
+	columns := []string{"columnA"}
+
+	// when
+	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchNext(true)
+	rowsMock.PatchScan(newScanDest(columns), nil)
+	rowsMock.PatchNext(true)
+	rowsMock.PatchScan(newScanDest(columns), nil)
+	rowsMock.PatchClose(nil)
+	stmtMock.PatchQueryContext(ctx, nil, rowsMock, nil)
+	txMock.PatchPrepareContext(ctx, selectStmt2, stmtMock, nil)
+	iterator, err := service.SelectStream(dbc, selectStmt2)
+	ass.Nil(err)
+	iterator.Next()
+	iterator.Next()
+	finishedBeforeClose := len(hook.after)
+	closeErr := iterator.Close()
+	_ = iterator.Close()
+
+	// then
+	ass.Nil(closeErr)
+	ass.Equal(0, finishedBeforeClose)
+	ass.Len(hook.before, 1)
+	ass.Len(hook.after, 1)
+	ass.Equal(QueryOperationSelect, hook.after[0].Operation)
+	ass.Equal(int64(2), hook.after[0].Rows)
+	ass.True(hook.after[0].InTx)
+	ass.Nil(hook.after[0].Err)
+}
+
+func Test_BulkInsert_Copy_Calls_Hooks(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.bulkCopyThreshold = 2
+	hook := &recordingHook{}
+	service.hooks = []QueryHook{hook}
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	dbc := &DBContext{tx: txMock, ctx: ctx, nestingLevel: 1}
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+	rows := [][]interface{}{{1, "a@flat.mx"}, {2, "b@flat.mx"}}
+
+	// when
+	txMock.PatchPrepareContext(ctx, bulkCopyStmt, stmtMock, nil)
+	for _, row := range rows {
+		stmtMock.PatchExecContext(ctx, row, nil, nil)
+	}
+	stmtMock.PatchExecContext(ctx, nil, resultMock, nil)
+	stmtMock.PatchClose(nil)
+	resultMock.PatchRowsAffected(2, nil)
+	_, err := service.BulkInsert(dbc, "public.users", []string{"id", "email"}, rows)
+
+	// then
+	ass.Nil(err)
+	ass.Len(hook.before, 1)
+	ass.Len(hook.after, 1)
+	ass.Equal(QueryOperationExecute, hook.after[0].Operation)
+	ass.Equal(bulkCopyStmt, hook.after[0].Query)
+	ass.Equal(int64(2), hook.after[0].Rows)
+	ass.True(hook.after[0].InTx)
+}
+
+func Test_TraceQueryHook(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	mt := mocktracer.Start()
+	defer mt.Stop()
+	hook := NewTraceQueryHook("db-service")
+	event := &QueryEvent{Operation: QueryOperationSelect, Query: "SELECT ?", Rows: 2}
+
+	// when
+	ctx := hook.BeforeQuery(context.Background(), event)
+	hook.AfterQuery(ctx, event)
+
+	// then
+	spans := mt.FinishedSpans()
+	ass.Len(spans, 1)
+	ass.Equal("postgres.query", spans[0].OperationName())
+	ass.Equal("SELECT ?", spans[0].Tag("resource.name"))
+	ass.Equal("db-service", spans[0].Tag("service.name"))
+	ass.Equal(int64(2), spans[0].Tag("db.rows"))
+}
+
+func Test_SlowQueryHook_Under_Threshold(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	hook := NewSlowQueryHook(time.Second).(*slowQueryHook)
+	event := &QueryEvent{Duration: time.Millisecond}
+
+	// when
+	ctx := hook.BeforeQuery(context.Background(), event)
+
+	// then
+	ass.NotPanics(func() { hook.AfterQuery(ctx, event) })
+	ass.Equal(time.Second, hook.threshold)
+}
@@ -0,0 +1,214 @@
+// Package jobs is a durable queue of background jobs stored in Postgres, for the servers that run
+// with the worker role. A Queue enqueues the jobs and a Worker claims and runs them with its
+// handlers. A claimed job is leased for the visibility timeout of the worker; if the worker dies
+// the lease expires and the job is claimed again, so handlers must be idempotent.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+	"github.com/lib/pq"
+)
+
+const (
+	// DefaultTable is the table where the jobs are stored
+	DefaultTable = "jobs"
+
+	// StatePending is the state of the jobs waiting to run, including the ones waiting for a retry
+	StatePending = "pending"
+	// StateRunning is the state of the jobs claimed by a worker
+	StateRunning = "running"
+	// StateDone is the state of the jobs that finished successfully
+	StateDone = "done"
+	// StateDead is the state of the jobs that failed every attempt, they are never run again
+	StateDead = "dead"
+)
+
+var (
+	// ErrDuplicate is returned by Enqueue when a pending or running job has the same unique key
+	ErrDuplicate = errors.New("jobs_duplicate")
+)
+
+type (
+	// Queue stores the jobs in a table
+	Queue struct {
+		db    database.Database
+		table string
+	}
+
+	// Option configures a Queue
+	Option func(queue *Queue)
+
+	// EnqueueOption configures a job given to Enqueue
+	EnqueueOption func(config *enqueueConfig)
+
+	// Job is a job claimed from the queue
+	Job struct {
+		ID        int64     `db:"id"`
+		Kind      string    `db:"kind"`
+		Payload   []byte    `db:"payload"`
+		Priority  int       `db:"priority"`
+		UniqueKey *string   `db:"unique_key"`
+		Attempts  int       `db:"attempts"`
+		RunAt     time.Time `db:"run_at"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+
+	// enqueueConfig holds the options of a job given to Enqueue
+	enqueueConfig struct {
+		runAt     *time.Time
+		priority  int
+		uniqueKey *string
+	}
+)
+
+// WithTable sets the table where the jobs are stored, it can be qualified with its schema
+func WithTable(table string) Option {
+	return func(queue *Queue) {
+		queue.table = table
+	}
+}
+
+// WithRunAt sets when the job runs, by default as soon as possible
+func WithRunAt(runAt time.Time) EnqueueOption {
+	return func(config *enqueueConfig) {
+		config.runAt = &runAt
+	}
+}
+
+// WithPriority sets the priority of the job, the ones with higher priority are claimed first. It's 0 by default.
+func WithPriority(priority int) EnqueueOption {
+	return func(config *enqueueConfig) {
+		config.priority = priority
+	}
+}
+
+// WithUniqueKey makes Enqueue fail with ErrDuplicate while a pending or running job has the same key
+func WithUniqueKey(key string) EnqueueOption {
+	return func(config *enqueueConfig) {
+		config.uniqueKey = &key
+	}
+}
+
+// New returns a Queue that stores its jobs with db
+func New(db database.Database, opts ...Option) *Queue {
+	queue := &Queue{
+		db:    db,
+		table: DefaultTable,
+	}
+	for _, opt := range opts {
+		opt(queue)
+	}
+	return queue
+}
+
+// CreateTable creates the jobs table and its indexes if they don't exist
+func (queue *Queue) CreateTable(dbc *database.DBContext) error {
+	table := database.QuoteTable(queue.table)
+	_, err := queue.db.Execute(dbc, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id BIGSERIAL PRIMARY KEY, "+
+		"kind TEXT NOT NULL, payload BYTEA, priority INT NOT NULL DEFAULT 0, unique_key TEXT, "+
+		"state TEXT NOT NULL DEFAULT 'pending', attempts INT NOT NULL DEFAULT 0, "+
+		"run_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), locked_until TIMESTAMPTZ, last_error TEXT, "+
+		"created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), finished_at TIMESTAMPTZ)", table))
+	if err != nil {
+		return err
+	}
+
+	_, err = queue.db.Execute(dbc, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s "+
+		"(priority DESC, run_at, id) WHERE state IN ('pending', 'running')",
+		pq.QuoteIdentifier(indexName(queue.table, "ready")), table))
+	if err != nil {
+		return err
+	}
+
+	_, err = queue.db.Execute(dbc, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s "+
+		"(unique_key) WHERE state IN ('pending', 'running')",
+		pq.QuoteIdentifier(indexName(queue.table, "unique_key")), table))
+	return err
+}
+
+// Enqueue stores a job of the given kind and returns its id. With a dbc it's stored in its
+// transaction, so the job only exists if the transaction commits.
+func (queue *Queue) Enqueue(dbc *database.DBContext, kind string, payload []byte,
+	opts ...EnqueueOption) (int64, error) {
+	config := enqueueConfig{}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	var runAt, uniqueKey interface{}
+	if config.runAt != nil {
+		runAt = *config.runAt
+	}
+	if config.uniqueKey != nil {
+		uniqueKey = *config.uniqueKey
+	}
+
+	dbr, err := queue.db.Select(dbc, fmt.Sprintf("INSERT INTO %s (kind, payload, priority, unique_key, run_at) "+
+		"VALUES ($1, $2, $3, $4, COALESCE($5::TIMESTAMPTZ, NOW())) "+
+		"ON CONFLICT (unique_key) WHERE state IN ('pending', 'running') DO NOTHING RETURNING id",
+		database.QuoteTable(queue.table)), false, kind, payload, config.priority, uniqueKey, runAt)
+	if err != nil {
+		return 0, err
+	}
+
+	// Nothing is returned when the unique key is taken
+	rows := dbr.GetRows()
+	if len(rows) == 0 {
+		return 0, ErrDuplicate
+	}
+	return rows[0].GetInt64ByNameRequired("id")
+}
+
+// claim leases up to limit jobs of the given kinds until the visibility timeout. The jobs whose
+// lease expired are claimed again.
+func (queue *Queue) claim(ctx context.Context, kinds []string, limit int,
+	visibilityTimeout time.Duration) ([]Job, error) {
+	table := database.QuoteTable(queue.table)
+	dbr, err := queue.db.SelectContext(ctx, nil, fmt.Sprintf("UPDATE %s SET state = 'running', attempts = attempts + 1, "+
+		"locked_until = NOW() + $3 * INTERVAL '1 millisecond' WHERE id IN (SELECT id FROM %s "+
+		"WHERE kind = ANY($2) AND ((state = 'pending' AND run_at <= NOW()) OR "+
+		"(state = 'running' AND locked_until <= NOW())) "+
+		"ORDER BY priority DESC, run_at, id LIMIT $1 FOR UPDATE SKIP LOCKED) "+
+		"RETURNING id, kind, payload, priority, unique_key, attempts, run_at, created_at", table, table),
+		false, limit, pq.StringArray(kinds), visibilityTimeout.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	return database.ScanRowsInto[Job](dbr.GetRows())
+}
+
+// complete marks the job as done, unless its lease expired and another worker claimed it
+func (queue *Queue) complete(job Job) error {
+	_, err := queue.db.Execute(nil, fmt.Sprintf("UPDATE %s SET state = 'done', finished_at = NOW(), "+
+		"locked_until = NULL, last_error = NULL WHERE id = $1 AND attempts = $2", database.QuoteTable(queue.table)),
+		job.ID, job.Attempts)
+	return err
+}
+
+// retry makes the job pending again after the backoff
+func (queue *Queue) retry(job Job, backoff time.Duration, cause error) error {
+	_, err := queue.db.Execute(nil, fmt.Sprintf("UPDATE %s SET state = 'pending', "+
+		"run_at = NOW() + $3 * INTERVAL '1 millisecond', locked_until = NULL, last_error = $4 "+
+		"WHERE id = $1 AND attempts = $2", database.QuoteTable(queue.table)),
+		job.ID, job.Attempts, backoff.Milliseconds(), cause.Error())
+	return err
+}
+
+// kill moves the job to the dead-letter state
+func (queue *Queue) kill(job Job, cause error) error {
+	_, err := queue.db.Execute(nil, fmt.Sprintf("UPDATE %s SET state = 'dead', finished_at = NOW(), "+
+		"locked_until = NULL, last_error = $3 WHERE id = $1 AND attempts = $2", database.QuoteTable(queue.table)),
+		job.ID, job.Attempts, cause.Error())
+	return err
+}
+
+// indexName returns the name of an index of the table
+func indexName(table string, suffix string) string {
+	return strings.ReplaceAll(table, ".", "_") + "_" + suffix
+}
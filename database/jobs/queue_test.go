@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+)
+
+const (
+	insertStmt string = `INSERT INTO "jobs" (kind, payload, priority, unique_key, run_at) ` +
+		`VALUES ($1, $2, $3, $4, COALESCE($5::TIMESTAMPTZ, NOW())) ` +
+		`ON CONFLICT (unique_key) WHERE state IN ('pending', 'running') DO NOTHING RETURNING id`
+	claimStmt string = `UPDATE "jobs" SET state = 'running', attempts = attempts + 1, ` +
+		`locked_until = NOW() + $3 * INTERVAL '1 millisecond' WHERE id IN (SELECT id FROM "jobs" ` +
+		`WHERE kind = ANY($2) AND ((state = 'pending' AND run_at <= NOW()) OR ` +
+		`(state = 'running' AND locked_until <= NOW())) ` +
+		`ORDER BY priority DESC, run_at, id LIMIT $1 FOR UPDATE SKIP LOCKED) ` +
+		`RETURNING id, kind, payload, priority, unique_key, attempts, run_at, created_at`
+)
+
+func Test_Queue_Enqueue(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	queue := New(fake)
+	fake.OnSelect(database.QueryEquals(insertStmt)).
+		WithParams("emails.send", []byte(`{"to":"a@b.c"}`), 0, nil, nil).
+		Return(database.ParseMockDBResultFromArrRowsMap([]map[string]interface{}{{"id": int64(7)}}))
+
+	// when
+	id, err := queue.Enqueue(nil, "emails.send", []byte(`{"to":"a@b.c"}`))
+
+	// then
+	ass.Nil(err)
+	ass.Equal(int64(7), id)
+	ass.True(fake.AssertExpectations(t))
+}
+
+func Test_Queue_Enqueue_With_Options(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	queue := New(fake)
+	runAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fake.OnSelect(database.QueryEquals(insertStmt)).
+		WithParams("reports.build", []byte(nil), 5, "report-2024-05", runAt).
+		Return(database.ParseMockDBResultFromArrRowsMap([]map[string]interface{}{{"id": int64(8)}}))
+
+	// when
+	var id int64
+	err := fake.WithTransaction(func(dbc *database.DBContext) (err error) {
+		id, err = queue.Enqueue(dbc, "reports.build", nil, WithRunAt(runAt), WithPriority(5),
+			WithUniqueKey("report-2024-05"))
+		return err
+	})
+
+	// then
+	ass.Nil(err)
+	ass.Equal(int64(8), id)
+	ass.Equal(1, fake.CallsTo("Select")[0].TxID)
+	ass.True(fake.AssertExpectations(t))
+}
+
+func Test_Queue_Enqueue_Duplicate(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	queue := New(fake)
+	fake.OnSelect(database.QueryEquals(insertStmt)).
+		Return(database.ParseMockDBResultFromArrRowsMap([]map[string]interface{}{}))
+
+	// when
+	_, err := queue.Enqueue(nil, "reports.build", nil, WithUniqueKey("report-2024-05"))
+
+	// then
+	ass.Equal(ErrDuplicate, err)
+}
+
+func Test_Queue_Claim(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	queue := New(fake)
+	fake.OnSelect(database.QueryEquals(claimStmt)).
+		WithParams(2, pq.StringArray{"emails.send"}, int64(30000)).
+		Return(claimedJobs(map[int64]int{1: 1}))
+
+	// when
+	jobs, err := queue.claim(context.Background(), []string{"emails.send"}, 2, 30*time.Second)
+
+	// then
+	ass.Nil(err)
+	ass.Len(jobs, 1)
+	ass.Equal(int64(1), jobs[0].ID)
+	ass.Equal("emails.send", jobs[0].Kind)
+	ass.Equal([]byte(`{"id":1}`), jobs[0].Payload)
+	ass.Equal(1, jobs[0].Attempts)
+	ass.Nil(jobs[0].UniqueKey)
+	ass.True(fake.AssertExpectations(t))
+}
+
+func Test_Queue_CreateTable(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	queue := New(fake, WithTable("background.jobs"))
+	fake.OnExecute(database.QueryMatches(`^CREATE TABLE IF NOT EXISTS "background"\."jobs" \(`)).Return(nil)
+	fake.OnExecute(database.QueryEquals(`CREATE INDEX IF NOT EXISTS "background_jobs_ready" ON "background"."jobs" ` +
+		`(priority DESC, run_at, id) WHERE state IN ('pending', 'running')`)).Return(nil)
+	fake.OnExecute(database.QueryEquals(`CREATE UNIQUE INDEX IF NOT EXISTS "background_jobs_unique_key" ` +
+		`ON "background"."jobs" (unique_key) WHERE state IN ('pending', 'running')`)).Return(nil)
+
+	// when
+	err := queue.CreateTable(nil)
+
+	// then
+	ass.Nil(err)
+	ass.True(fake.AssertExpectations(t))
+}
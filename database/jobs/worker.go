@@ -0,0 +1,311 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/flat"
+	"github.com/FlatDigital/core-go-toolkit/v2/core/libs/go/logger"
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+	"github.com/FlatDigital/core-go-toolkit/v2/godog"
+)
+
+const (
+	// DefaultConcurrency is how many jobs a Worker runs at the same time
+	DefaultConcurrency = 10
+	// DefaultPollInterval is how often a Worker looks for jobs when the queue is empty
+	DefaultPollInterval = time.Second
+	// DefaultVisibilityTimeout is how long a claimed job is leased to a Worker
+	DefaultVisibilityTimeout = 5 * time.Minute
+)
+
+var (
+	// DefaultRetryPolicy is how a Worker retries the jobs that fail, after the retries the jobs
+	// move to StateDead
+	DefaultRetryPolicy = database.RetryPolicy{
+		MaxRetries:     5,
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     time.Hour,
+		Multiplier:     2,
+	}
+
+	errLeaseExpired = errors.New("the visibility timeout expired on every attempt")
+)
+
+type (
+	// Handler runs a job. The job is retried if it returns an error or panics. ctx is cancelled
+	// when the visibility timeout expires or the Worker is stopped.
+	Handler func(ctx *flat.Context, job Job) error
+
+	// Worker claims the jobs of its handlers and runs them. Several workers can run at the same
+	// time, every job is claimed by only one of them.
+	Worker struct {
+		queue             *Queue
+		handlers          map[string]Handler
+		kinds             []string
+		concurrency       int
+		pollInterval      time.Duration
+		visibilityTimeout time.Duration
+		retryPolicy       database.RetryPolicy
+		metricPrefix      string
+
+		startOnce sync.Once
+		stopOnce  sync.Once
+		stop      chan struct{}
+		done      chan struct{}
+		cancel    context.CancelFunc
+	}
+
+	// WorkerOption configures a Worker
+	WorkerOption func(worker *Worker)
+)
+
+// WithConcurrency sets how many jobs run at the same time
+func WithConcurrency(concurrency int) WorkerOption {
+	return func(worker *Worker) {
+		worker.concurrency = concurrency
+	}
+}
+
+// WithPollInterval sets how often the queue is polled while there are free slots. A slot that
+// gets free polls it right away.
+func WithPollInterval(interval time.Duration) WorkerOption {
+	return func(worker *Worker) {
+		worker.pollInterval = interval
+	}
+}
+
+// WithVisibilityTimeout sets how long a claimed job is leased. If it doesn't finish by then its
+// ctx is cancelled and the job can be claimed again.
+func WithVisibilityTimeout(timeout time.Duration) WorkerOption {
+	return func(worker *Worker) {
+		worker.visibilityTimeout = timeout
+	}
+}
+
+// WithRetryPolicy sets the backoff between the attempts of a job and how many times it's retried
+// before it moves to StateDead
+func WithRetryPolicy(policy database.RetryPolicy) WorkerOption {
+	return func(worker *Worker) {
+		worker.retryPolicy = policy
+	}
+}
+
+// WithMetricPrefix sets the prefix of the metrics, by default the APPLICATION environment variable
+func WithMetricPrefix(prefix string) WorkerOption {
+	return func(worker *Worker) {
+		worker.metricPrefix = prefix
+	}
+}
+
+// NewWorker returns a Worker that runs the jobs of queue
+func NewWorker(queue *Queue, opts ...WorkerOption) *Worker {
+	worker := &Worker{
+		queue:             queue,
+		handlers:          map[string]Handler{},
+		concurrency:       DefaultConcurrency,
+		pollInterval:      DefaultPollInterval,
+		visibilityTimeout: DefaultVisibilityTimeout,
+		retryPolicy:       DefaultRetryPolicy,
+		metricPrefix:      os.Getenv("APPLICATION"),
+		stop:              make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(worker)
+	}
+	if worker.concurrency <= 0 {
+		worker.concurrency = DefaultConcurrency
+	}
+	if worker.visibilityTimeout <= 0 {
+		worker.visibilityTimeout = DefaultVisibilityTimeout
+	}
+	return worker
+}
+
+// Handle registers the handler of the jobs of kind, only the registered kinds are claimed. It
+// must be called before Start.
+func (worker *Worker) Handle(kind string, handler Handler) {
+	if _, exists := worker.handlers[kind]; !exists {
+		worker.kinds = append(worker.kinds, kind)
+	}
+	worker.handlers[kind] = handler
+}
+
+// Start claims and runs jobs in background until Stop is called
+func (worker *Worker) Start() {
+	worker.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		worker.cancel = cancel
+		go worker.run(ctx)
+	})
+}
+
+// Stop stops claiming jobs and waits for the running ones. If ctx is done first, the ctx of the
+// running jobs is cancelled and ctx.Err() is returned once they return.
+func (worker *Worker) Stop(ctx context.Context) error {
+	// A worker that never started has nothing to wait for
+	worker.startOnce.Do(func() {
+		close(worker.done)
+	})
+	worker.stopOnce.Do(func() {
+		close(worker.stop)
+	})
+
+	select {
+	case <-worker.done:
+		return nil
+	case <-ctx.Done():
+		if worker.cancel != nil {
+			worker.cancel()
+		}
+		<-worker.done
+		return ctx.Err()
+	}
+}
+
+// run claims jobs for the free slots until stop is closed, then waits for the running jobs
+func (worker *Worker) run(ctx context.Context) {
+	defer close(worker.done)
+
+	var running sync.WaitGroup
+	defer running.Wait()
+	slots := make(chan struct{}, worker.concurrency)
+	freed := make(chan struct{}, 1)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-worker.stop:
+			return
+		case <-timer.C:
+		case <-freed:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+
+		if free := worker.concurrency - len(slots); free > 0 {
+			jobs, err := worker.queue.claim(ctx, worker.kinds, free, worker.visibilityTimeout)
+			if err != nil {
+				worker.recordMetric("claim_error", 1)
+			}
+			for _, job := range jobs {
+				slots <- struct{}{}
+				running.Add(1)
+				go func(job Job) {
+					defer running.Done()
+					worker.process(ctx, job)
+					<-slots
+					select {
+					case freed <- struct{}{}:
+					default:
+					}
+				}(job)
+			}
+		}
+		timer.Reset(worker.pollInterval)
+	}
+}
+
+// RunOnce claims as many jobs as the concurrency allows and runs them, returning when all of them
+// finished. It returns how many jobs were claimed.
+func (worker *Worker) RunOnce(ctx context.Context) (int, error) {
+	jobs, err := worker.queue.claim(ctx, worker.kinds, worker.concurrency, worker.visibilityTimeout)
+	if err != nil {
+		return 0, err
+	}
+
+	var running sync.WaitGroup
+	for _, job := range jobs {
+		running.Add(1)
+		go func(job Job) {
+			defer running.Done()
+			worker.process(ctx, job)
+		}(job)
+	}
+	running.Wait()
+
+	// done
+	return len(jobs), nil
+}
+
+// process runs the job and records if it's done, has to be retried or is dead
+func (worker *Worker) process(ctx context.Context, job Job) {
+	start := time.Now()
+	worker.recordDuration("wait", start.Sub(job.RunAt), job.Kind)
+
+	// A job whose lease expired on every attempt is not run again
+	err := errLeaseExpired
+	if job.Attempts <= worker.retryPolicy.MaxRetries+1 {
+		err = worker.runHandler(ctx, job)
+	}
+
+	status := StateDone
+	var finishErr error
+	switch {
+	case err == nil:
+		finishErr = worker.queue.complete(job)
+	case job.Attempts <= worker.retryPolicy.MaxRetries:
+		status = StatePending
+		finishErr = worker.queue.retry(job, worker.retryPolicy.Backoff(job.Attempts-1), err)
+	default:
+		status = StateDead
+		finishErr = worker.queue.kill(job, err)
+	}
+	if finishErr != nil {
+		worker.recordMetric("finish_error", 1, "kind", job.Kind)
+	}
+
+	worker.recordMetric("processed", 1, "kind", job.Kind, "status", status)
+	worker.recordDuration("duration", time.Since(start), job.Kind, "status", status)
+}
+
+// runHandler runs the handler of the job with a flat.Context that is cancelled when the lease expires
+func (worker *Worker) runHandler(ctx context.Context, job Job) (err error) {
+	jobCtx, cancel := context.WithTimeout(ctx, worker.visibilityTimeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job %d panicked: %v", job.ID, r)
+		}
+	}()
+
+	requestID := fmt.Sprintf("job-%d-%d", job.ID, job.Attempts)
+	fctx := &flat.Context{
+		RequestID: requestID,
+		Log: &logger.Logger{
+			Attributes: logger.Attrs{"request_id": requestID, "job_id": job.ID, "job_kind": job.Kind},
+		},
+		Ctx: jobCtx,
+	}
+	return worker.handlers[job.Kind](fctx, job)
+}
+
+// recordMetric records a count metric of the jobs with the given tag keys and values
+func (worker *Worker) recordMetric(name string, value float64, tagPairs ...string) {
+	godog.RecordSimpleMetric(fmt.Sprintf("application.%s.jobs.%s", worker.metricPrefix, name), value,
+		worker.tags(tagPairs...)...)
+}
+
+// recordDuration records a duration metric of the jobs of kind in milliseconds
+func (worker *Worker) recordDuration(name string, duration time.Duration, kind string, tagPairs ...string) {
+	godog.RecordCompoundMetric(fmt.Sprintf("application.%s.jobs.%s", worker.metricPrefix, name),
+		float64(duration)/float64(time.Millisecond), worker.tags(append([]string{"kind", kind}, tagPairs...)...)...)
+}
+
+// tags returns the tags of a metric with the table and the given tag keys and values
+func (worker *Worker) tags(tagPairs ...string) []string {
+	tags := new(godog.Tags).
+		Add("table", worker.queue.table)
+	for i := 0; i+1 < len(tagPairs); i += 2 {
+		tags.Add(tagPairs[i], tagPairs[i+1])
+	}
+	return tags.ToArray()
+}
@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/flat"
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+)
+
+const (
+	completeStmt string = `UPDATE "jobs" SET state = 'done', finished_at = NOW(), locked_until = NULL, ` +
+		`last_error = NULL WHERE id = $1 AND attempts = $2`
+	retryStmt string = `UPDATE "jobs" SET state = 'pending', run_at = NOW() + $3 * INTERVAL '1 millisecond', ` +
+		`locked_until = NULL, last_error = $4 WHERE id = $1 AND attempts = $2`
+	killStmt string = `UPDATE "jobs" SET state = 'dead', finished_at = NOW(), locked_until = NULL, ` +
+		`last_error = $3 WHERE id = $1 AND attempts = $2`
+)
+
+// claimedJobs returns the claimed rows of the jobs with the given ids and attempts
+func claimedJobs(attempts map[int64]int) *database.DBResult {
+	ids := make([]int64, 0, len(attempts))
+	for id := range attempts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	rows := make([]map[string]interface{}, 0, len(attempts))
+	for _, id := range ids {
+		rows = append(rows, map[string]interface{}{
+			"id":         id,
+			"kind":       "emails.send",
+			"payload":    []byte(`{"id":` + strconv.FormatInt(id, 10) + `}`),
+			"priority":   int64(0),
+			"unique_key": nil,
+			"attempts":   int64(attempts[id]),
+			"run_at":     time.Now().Add(-time.Second),
+			"created_at": time.Now().Add(-time.Minute),
+		})
+	}
+	return database.ParseMockDBResultFromArrRowsMap(rows)
+}
+
+func Test_Worker_RunOnce(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	worker := NewWorker(New(fake), WithConcurrency(4),
+		WithRetryPolicy(database.RetryPolicy{MaxRetries: 2, InitialBackoff: time.Second, Multiplier: 2}))
+	var mu sync.Mutex
+	var ran []int64
+	worker.Handle("emails.send", func(ctx *flat.Context, job Job) error {
+		mu.Lock()
+		ran = append(ran, job.ID)
+		mu.Unlock()
+		if ctx.RequestID == "" || ctx.Ctx == nil {
+			return errors.New("missing context")
+		}
+		if job.ID == 1 {
+			return nil
+		}
+		return errors.New("smtp unavailable")
+	})
+	fake.OnSelect(database.QueryEquals(claimStmt)).Return(claimedJobs(map[int64]int{1: 1, 2: 1, 3: 3, 4: 4}))
+	fake.OnExecute(database.QueryEquals(completeStmt)).WithParams(int64(1), 1).Return(nil)
+	fake.OnExecute(database.QueryEquals(retryStmt)).WithParams(int64(2), 1,
+		database.ParamWhere("backoff between 0.5s and 1s", func(param interface{}) bool {
+			return param.(int64) >= 500 && param.(int64) <= 1000
+		}), "smtp unavailable").Return(nil)
+	fake.OnExecute(database.QueryEquals(killStmt)).WithParams(int64(3), 3, "smtp unavailable").Return(nil)
+	// the lease of the job expired on every attempt, so it's not run again
+	fake.OnExecute(database.QueryEquals(killStmt)).
+		WithParams(int64(4), 4, "the visibility timeout expired on every attempt").Return(nil)
+
+	// when
+	claimed, err := worker.RunOnce(context.Background())
+
+	// then
+	ass.Nil(err)
+	ass.Equal(4, claimed)
+	ass.ElementsMatch([]int64{1, 2, 3}, ran)
+	ass.True(fake.AssertExpectations(t))
+}
+
+func Test_Worker_RunOnce_Panic(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	worker := NewWorker(New(fake))
+	worker.Handle("emails.send", func(ctx *flat.Context, job Job) error {
+		panic("nil template")
+	})
+	fake.OnSelect(database.QueryEquals(claimStmt)).Return(claimedJobs(map[int64]int{1: 1}))
+	fake.OnExecute(database.QueryEquals(retryStmt)).
+		WithParams(int64(1), 1, database.AnyParam, "job 1 panicked: nil template").Return(nil)
+
+	// when
+	claimed, err := worker.RunOnce(context.Background())
+
+	// then
+	ass.Nil(err)
+	ass.Equal(1, claimed)
+	ass.True(fake.AssertExpectations(t))
+}
+
+func Test_Worker_RunOnce_Claim_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	worker := NewWorker(New(fake))
+	fake.OnSelect(database.QueryEquals(claimStmt)).ReturnError(errors.New("connection refused"))
+
+	// when
+	claimed, err := worker.RunOnce(context.Background())
+
+	// then
+	ass.EqualError(err, "connection refused")
+	ass.Equal(0, claimed)
+}
+
+func Test_Worker_Start_Stop(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	worker := NewWorker(New(fake), WithConcurrency(2), WithPollInterval(time.Hour))
+	release := make(chan struct{})
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	worker.Handle("emails.send", func(ctx *flat.Context, job Job) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	fake.OnSelect(database.QueryEquals(claimStmt)).Return(claimedJobs(map[int64]int{1: 1, 2: 1}))
+	fake.OnSelect(database.QueryEquals(claimStmt)).Return(claimedJobs(map[int64]int{})).Repeatedly()
+	fake.SetDefault(database.QueryOperationExecute, nil, nil)
+
+	// when
+	worker.Start()
+	ass.Eventually(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return running == 2
+	}, time.Second, time.Millisecond)
+	// every slot is taken, so nothing else is claimed
+	claimsWhileFull := len(fake.CallsTo("SelectContext"))
+	stopped := make(chan error)
+	go func() {
+		stopped <- worker.Stop(context.Background())
+	}()
+	close(release)
+	err := <-stopped
+
+	// then
+	ass.Nil(err)
+	ass.Equal(1, claimsWhileFull)
+	ass.Equal(2, fake.CallsTo("SelectContext")[0].Params[0])
+	ass.Equal(2, maxRunning)
+	ass.Len(fake.CallsTo("Execute"), 2)
+	ass.Nil(NewWorker(New(fake)).Stop(context.Background()))
+}
+
+func Test_Worker_Stop_Timeout(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	worker := NewWorker(New(fake), WithPollInterval(time.Hour))
+	started := make(chan struct{})
+	worker.Handle("emails.send", func(ctx *flat.Context, job Job) error {
+		close(started)
+		<-ctx.Ctx.Done()
+		return ctx.Ctx.Err()
+	})
+	fake.OnSelect(database.QueryEquals(claimStmt)).Return(claimedJobs(map[int64]int{1: 1}))
+	fake.OnSelect(database.QueryEquals(claimStmt)).Return(claimedJobs(map[int64]int{})).Repeatedly()
+	retryRule := fake.OnExecute(database.QueryEquals(retryStmt)).
+		WithParams(int64(1), 1, database.AnyParam, "context canceled").Return(nil)
+
+	// when
+	worker.Start()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := worker.Stop(ctx)
+
+	// then
+	ass.Equal(context.DeadlineExceeded, err)
+	ass.Equal(1, retryRule.Calls())
+}
@@ -0,0 +1,328 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/godog"
+)
+
+const (
+	// notifyQuery sends a notification, pg_notify is used instead of NOTIFY so the channel and the
+	// payload can be params
+	notifyQuery = "SELECT pg_notify($1, $2)"
+
+	// default values of the listener
+	defaultListenerMinReconnectInterval = 100 * time.Millisecond
+	defaultListenerMaxReconnectInterval = 30 * time.Second
+	defaultListenerPingInterval         = 90 * time.Second
+	defaultListenerBufferSize           = 64
+)
+
+var (
+	errListenerChannelEmpty = errors.New("listener_channel_empty")
+)
+
+type (
+	// Notification is a notification received by a Listener
+	Notification struct {
+		Channel string
+		Payload string
+		// PID is the process ID of the backend that sent the notification
+		PID int
+	}
+
+	// ListenerOption configures a Listener
+	ListenerOption func(*listenerConfig)
+
+	// listenerConfig holds the settings of a Listener
+	listenerConfig struct {
+		minReconnectInterval time.Duration
+		maxReconnectInterval time.Duration
+		pingInterval         time.Duration
+		bufferSize           int
+		handler              func(Notification)
+		onReconnect          func()
+	}
+
+	// pqListener is the subset of *pq.Listener used by Listener
+	pqListener interface {
+		NotificationChannel() <-chan *pq.Notification
+		Listen(channel string) error
+		Unlisten(channel string) error
+		Ping() error
+		Close() error
+	}
+
+	// Listener receives the notifications sent with NOTIFY (or Notify) to the channels it subscribed
+	// to. It uses a dedicated connection, outside the pool of the service, that is re-established with
+	// an exponential backoff when it's lost. The subscriptions are restored after every reconnection.
+	Listener struct {
+		listener            pqListener
+		config              listenerConfig
+		datadogMetricPrefix string
+		notifications       chan Notification
+		closing             chan struct{}
+		done                chan struct{}
+		closeOnce           sync.Once
+	}
+)
+
+// WithListenerReconnectInterval sets the backoff used to re-establish a lost connection: the first
+// attempt waits min, and every failed attempt doubles the wait up to max.
+// By default it's 100ms to 30s.
+func WithListenerReconnectInterval(min, max time.Duration) ListenerOption {
+	return func(c *listenerConfig) {
+		c.minReconnectInterval = min
+		c.maxReconnectInterval = max
+	}
+}
+
+// WithListenerPingInterval sets how often the connection is pinged while there are no notifications,
+// so a dead connection is detected and re-established. By default it's 90s.
+func WithListenerPingInterval(interval time.Duration) ListenerOption {
+	return func(c *listenerConfig) {
+		c.pingInterval = interval
+	}
+}
+
+// WithListenerBufferSize sets the size of the channel returned by Notifications, 64 by default.
+// The connection stops reading while the channel is full.
+func WithListenerBufferSize(size int) ListenerOption {
+	return func(c *listenerConfig) {
+		c.bufferSize = size
+	}
+}
+
+// WithListenerHandler delivers the notifications calling handler instead of through the channel
+// returned by Notifications. The handler is called from a single goroutine, one notification at a
+// time, so a slow handler delays the following notifications.
+func WithListenerHandler(handler func(Notification)) ListenerOption {
+	return func(c *listenerConfig) {
+		c.handler = handler
+	}
+}
+
+// WithListenerReconnectHandler sets a function called every time the connection is re-established.
+// The notifications sent while the connection was down are lost, so it's the place to catch up on
+// the changes that may have been missed.
+func WithListenerReconnectHandler(onReconnect func()) ListenerOption {
+	return func(c *listenerConfig) {
+		c.onReconnect = onReconnect
+	}
+}
+
+// NewListener returns a Listener connected to the database of config. Only the connection settings
+// are used: ConnReadTimeout and ConnWriteTimeout are ignored because the connection is idle while
+// it waits for notifications.
+func NewListener(config ServiceConfig, opts ...ListenerOption) (*Listener, error) {
+	if config.DBPort == 0 {
+		config.DBPort = defaultDbPort
+	}
+	dsn, err := connectionString(config, config.DBHost, config.DBPort)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := pq.NewConnector(dsn); err != nil {
+		return nil, err
+	}
+
+	listenerConfig := newListenerConfig(opts)
+	if listenerConfig.minReconnectInterval <= 0 ||
+		listenerConfig.maxReconnectInterval < listenerConfig.minReconnectInterval {
+		return nil, fmt.Errorf("invalid listener reconnect interval: %s to %s",
+			listenerConfig.minReconnectInterval, listenerConfig.maxReconnectInterval)
+	}
+
+	metricPrefix := config.DatadogMetricPrefix
+	if metricPrefix == "" {
+		metricPrefix = os.Getenv("APPLICATION")
+	}
+
+	listener := &Listener{
+		config:              listenerConfig,
+		datadogMetricPrefix: metricPrefix,
+	}
+	listener.listener = pq.NewListener(dsn, listenerConfig.minReconnectInterval,
+		listenerConfig.maxReconnectInterval, listener.recordEvent)
+	listener.start()
+
+	// done
+	return listener, nil
+}
+
+// newListenerConfig returns the default settings with the options applied
+func newListenerConfig(opts []ListenerOption) listenerConfig {
+	config := listenerConfig{
+		minReconnectInterval: defaultListenerMinReconnectInterval,
+		maxReconnectInterval: defaultListenerMaxReconnectInterval,
+		pingInterval:         defaultListenerPingInterval,
+		bufferSize:           defaultListenerBufferSize,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.pingInterval <= 0 {
+		config.pingInterval = defaultListenerPingInterval
+	}
+	if config.bufferSize < 0 {
+		config.bufferSize = 0
+	}
+	return config
+}
+
+// start begins delivering the notifications of the connection
+func (listener *Listener) start() {
+	listener.notifications = make(chan Notification, listener.config.bufferSize)
+	listener.closing = make(chan struct{})
+	listener.done = make(chan struct{})
+	go listener.deliver()
+}
+
+// Subscribe starts listening to the channels. The names are case sensitive and subscribing to a
+// channel twice is not an error. It blocks while the connection is being re-established.
+func (listener *Listener) Subscribe(channels ...string) error {
+	for _, channel := range channels {
+		if channel == "" {
+			return errListenerChannelEmpty
+		}
+		err := listener.listener.Listen(channel)
+		if err != nil && err != pq.ErrChannelAlreadyOpen {
+			return fmt.Errorf("listen %s: %w", channel, err)
+		}
+	}
+
+	// done
+	return nil
+}
+
+// Unsubscribe stops listening to the channels, unsubscribing from a channel that was not subscribed
+// is not an error
+func (listener *Listener) Unsubscribe(channels ...string) error {
+	for _, channel := range channels {
+		err := listener.listener.Unlisten(channel)
+		if err != nil && err != pq.ErrChannelNotOpen {
+			return fmt.Errorf("unlisten %s: %w", channel, err)
+		}
+	}
+
+	// done
+	return nil
+}
+
+// Notifications returns the channel the notifications are delivered to. It's closed when the
+// Listener is closed, and it receives nothing if the Listener has a handler.
+func (listener *Listener) Notifications() <-chan Notification {
+	return listener.notifications
+}
+
+// Close closes the connection and stops the delivery of notifications. It's safe to call it more
+// than once.
+func (listener *Listener) Close() error {
+	var err error
+	listener.closeOnce.Do(func() {
+		close(listener.closing)
+		err = listener.listener.Close()
+		<-listener.done
+	})
+	return err
+}
+
+// deliver forwards the notifications of the connection until it's closed, pinging the connection
+// when no notification arrives for a while
+func (listener *Listener) deliver() {
+	defer close(listener.done)
+	defer close(listener.notifications)
+
+	source := listener.listener.NotificationChannel()
+	ticker := time.NewTicker(listener.config.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case notification, ok := <-source:
+			if !ok {
+				return
+			}
+			ticker.Reset(listener.config.pingInterval)
+
+			// a nil notification is sent after the connection is re-established
+			if notification == nil {
+				if listener.config.onReconnect != nil {
+					listener.config.onReconnect()
+				}
+				continue
+			}
+
+			n := Notification{
+				Channel: notification.Channel,
+				Payload: notification.Extra,
+				PID:     notification.BePid,
+			}
+			if listener.config.handler != nil {
+				listener.config.handler(n)
+				continue
+			}
+			select {
+			case listener.notifications <- n:
+			case <-listener.closing:
+				// nobody is reading, discard the rest so the connection can finish
+				for range source {
+				}
+				return
+			}
+
+		case <-ticker.C:
+			// the answer to the ping is read by the same connection that delivers the
+			// notifications, so it can't block this loop
+			go func() {
+				_ = listener.listener.Ping()
+			}()
+		}
+	}
+}
+
+// recordEvent records a metric for every change in the state of the connection
+func (listener *Listener) recordEvent(event pq.ListenerEventType, err error) {
+	var name string
+	switch event {
+	case pq.ListenerEventConnected:
+		name = "connected"
+	case pq.ListenerEventDisconnected:
+		name = "disconnected"
+	case pq.ListenerEventReconnected:
+		name = "reconnected"
+	case pq.ListenerEventConnectionAttemptFailed:
+		name = "connection_attempt_failed"
+	default:
+		return
+	}
+
+	tags := new(godog.Tags).Add("event", name)
+	if postgresError, ok := err.(*pq.Error); ok && postgresError != nil {
+		tags = tags.Add("error", string(postgresError.Code))
+	}
+	godog.RecordSimpleMetric(fmt.Sprintf("application.%s.db.service.listener", listener.datadogMetricPrefix),
+		1, tags.ToArray()...)
+}
+
+// Notify sends a notification to the channel through Execute, so when dbc has a transaction it's
+// only delivered if the transaction commits
+func (service *service) Notify(dbc *DBContext, channel string, payload string) error {
+	if channel == "" {
+		return errListenerChannelEmpty
+	}
+	_, err := service.Execute(dbc, notifyQuery, channel, payload)
+	return err
+}
+
+// NotifyContext is like Notify but runs with the given ctx
+func (service *service) NotifyContext(ctx context.Context, dbc *DBContext, channel string, payload string) error {
+	return service.Notify(dbc.withContext(ctx), channel, payload)
+}
@@ -0,0 +1,180 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePQListener is a pqListener whose notifications are sent by the test
+type fakePQListener struct {
+	notify   chan *pq.Notification
+	channels map[string]bool
+	listen   error
+}
+
+func newFakePQListener() *fakePQListener {
+	return &fakePQListener{
+		notify:   make(chan *pq.Notification, 8),
+		channels: map[string]bool{},
+	}
+}
+
+func (fake *fakePQListener) NotificationChannel() <-chan *pq.Notification {
+	return fake.notify
+}
+
+func (fake *fakePQListener) Listen(channel string) error {
+	if fake.listen != nil {
+		return fake.listen
+	}
+	if fake.channels[channel] {
+		return pq.ErrChannelAlreadyOpen
+	}
+	fake.channels[channel] = true
+	return nil
+}
+
+func (fake *fakePQListener) Unlisten(channel string) error {
+	if !fake.channels[channel] {
+		return pq.ErrChannelNotOpen
+	}
+	delete(fake.channels, channel)
+	return nil
+}
+
+func (fake *fakePQListener) Ping() error {
+	return nil
+}
+
+func (fake *fakePQListener) Close() error {
+	close(fake.notify)
+	return nil
+}
+
+func newTestListener(fake *fakePQListener, opts ...ListenerOption) *Listener {
+	listener := &Listener{
+		listener: fake,
+		config:   newListenerConfig(opts),
+	}
+	listener.start()
+	return listener
+}
+
+func Test_Listener_Delivers_Through_Channel(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := newFakePQListener()
+	listener := newTestListener(fake)
+
+	// when
+	err := listener.Subscribe("user_created", "user_created")
+	fake.notify <- &pq.Notification{Channel: "user_created", Extra: "42", BePid: 7}
+	notification := <-listener.Notifications()
+	closeErr := listener.Close()
+
+	// then
+	ass.Nil(err)
+	ass.Nil(closeErr)
+	ass.True(fake.channels["user_created"])
+	ass.Equal(Notification{Channel: "user_created", Payload: "42", PID: 7}, notification)
+	_, open := <-listener.Notifications()
+	ass.False(open)
+	ass.Nil(listener.Close())
+}
+
+func Test_Listener_Delivers_Through_Handler(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := newFakePQListener()
+	received := make(chan Notification, 1)
+	reconnected := make(chan struct{}, 1)
+	listener := newTestListener(fake,
+		WithListenerHandler(func(n Notification) { received <- n }),
+		WithListenerReconnectHandler(func() { reconnected <- struct{}{} }))
+
+	// when
+	fake.notify <- nil
+	fake.notify <- &pq.Notification{Channel: "orders", Extra: "paid"}
+
+	// then
+	select {
+	case <-reconnected:
+	case <-time.After(time.Second):
+		ass.Fail("reconnect handler not called")
+	}
+	ass.Equal(Notification{Channel: "orders", Payload: "paid"}, <-received)
+	ass.Nil(listener.Close())
+}
+
+func Test_Listener_Close_Without_Reader(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := newFakePQListener()
+	listener := newTestListener(fake, WithListenerBufferSize(0))
+
+	// when
+	fake.notify <- &pq.Notification{Channel: "orders"}
+	fake.notify <- &pq.Notification{Channel: "orders"}
+
+	// then
+	ass.Nil(listener.Close())
+}
+
+func Test_Listener_Subscribe_Errors(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := newFakePQListener()
+	listener := newTestListener(fake)
+	defer listener.Close()
+
+	// when
+	emptyErr := listener.Subscribe("")
+	fake.listen = errors.New("connection refused")
+	listenErr := listener.Subscribe("orders")
+	unlistenErr := listener.Unsubscribe("orders")
+
+	// then
+	ass.Equal(errListenerChannelEmpty, emptyErr)
+	ass.EqualError(listenErr, "listen orders: connection refused")
+	ass.Nil(unlistenErr)
+}
+
+func Test_NewListener_Invalid_Config(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	// when
+	_, sslErr := NewListener(ServiceConfig{DBHost: "localhost", SSLMode: "sometimes"})
+	_, intervalErr := NewListener(ServiceConfig{DBHost: "localhost"},
+		WithListenerReconnectInterval(time.Second, time.Millisecond))
+
+	// then
+	ass.NotNil(sslErr)
+	ass.EqualError(intervalErr, "invalid listener reconnect interval: 1s to 1ms")
+}
+
+func Test_Notify_Uses_Execute(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	params := []interface{}{"orders", `{"id":1}`}
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+
+	// when
+	sqlMock.PatchPrepare(notifyQuery, stmtMock, nil)
+	stmtMock.PatchExec(params, resultMock, nil)
+	stmtMock.PatchClose(nil)
+	resultMock.PatchRowsAffected(1, nil)
+	err := service.Notify(nil, "orders", `{"id":1}`)
+	emptyErr := service.Notify(nil, "", "")
+
+	// then
+	ass.Nil(err)
+	ass.Equal(errListenerChannelEmpty, emptyErr)
+	sqlMock.AssertExpectations(t)
+}
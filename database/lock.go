@@ -0,0 +1,220 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database/converter"
+)
+
+const (
+	// The try and unlock queries return a row only when they succeed, so the result is read from the
+	// affected rows of an Execute
+	lockQuery        = "SELECT pg_advisory_lock($1)"
+	tryLockQuery     = "SELECT 1 WHERE pg_try_advisory_lock($1)"
+	unlockQuery      = "SELECT 1 WHERE pg_advisory_unlock($1)"
+	lockXactQuery    = "SELECT pg_advisory_xact_lock($1)"
+	tryLockXactQuery = "SELECT 1 WHERE pg_try_advisory_xact_lock($1)"
+)
+
+var (
+	errLockWithoutConn = errors.New("lock_without_conn")
+
+	// ErrLockNotHeld is returned by Unlock when the session doesn't hold the lock
+	ErrLockNotHeld = errors.New("lock_not_held")
+)
+
+// LockKey is the key of an advisory lock. Integer keys can be used directly, and StringLockKey
+// derives one from a name.
+type LockKey int64
+
+// StringLockKey returns the key of the advisory lock named name, the FNV-1a hash of the name
+func StringLockKey(name string) LockKey {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(name))
+	return LockKey(hash.Sum64())
+}
+
+// TryLock acquires the session advisory lock key on the connection of dbc without waiting. It
+// returns false if another session holds it. dbc must come from Connection or ConnectionContext,
+// and the lock is held until Unlock. Closing a connection that holds locks discards it instead of
+// returning it to the pool, so its session ends and the locks are released.
+func (service *service) TryLock(dbc *DBContext, key LockKey) (bool, error) {
+	affectedRows, err := service.executeOnConn(dbc, "try_lock", tryLockQuery, int64(key))
+	if err != nil {
+		return false, err
+	}
+	if affectedRows != 1 {
+		return false, nil
+	}
+	service.addHeldLocks(dbc.dbConn, 1)
+	return true, nil
+}
+
+// Lock acquires the session advisory lock key on the connection of dbc, waiting until it's released
+// by other sessions or the ctx of dbc is done. dbc must come from Connection or ConnectionContext.
+// The lock is reentrant: it must be unlocked as many times as it was locked. See TryLock for what
+// happens when the connection is closed holding it.
+func (service *service) Lock(dbc *DBContext, key LockKey) error {
+	if _, err := service.executeOnConn(dbc, "lock", lockQuery, int64(key)); err != nil {
+		return err
+	}
+	service.addHeldLocks(dbc.dbConn, 1)
+	return nil
+}
+
+// Unlock releases the session advisory lock key on the connection of dbc. It returns ErrLockNotHeld
+// if the session doesn't hold it.
+func (service *service) Unlock(dbc *DBContext, key LockKey) error {
+	affectedRows, err := service.executeOnConn(dbc, "unlock", unlockQuery, int64(key))
+	if err != nil {
+		return err
+	}
+	if affectedRows != 1 {
+		return ErrLockNotHeld
+	}
+	service.addHeldLocks(dbc.dbConn, -1)
+	return nil
+}
+
+// TryLockXact acquires the transaction advisory lock key without waiting, it returns false if another
+// session holds it. The lock is released when the transaction of dbc ends.
+func (service *service) TryLockXact(dbc *DBContext, key LockKey) (bool, error) {
+	if dbc == nil || dbc.tx == nil {
+		return false, errTransactionNil
+	}
+
+	dbr, err := service.Execute(dbc, tryLockXactQuery, int64(key))
+	if err != nil {
+		return false, err
+	}
+	return dbr.AffectedRows() == 1, nil
+}
+
+// LockXact acquires the transaction advisory lock key, waiting until it's released by other sessions.
+// The lock is released when the transaction of dbc ends.
+func (service *service) LockXact(dbc *DBContext, key LockKey) error {
+	if dbc == nil || dbc.tx == nil {
+		return errTransactionNil
+	}
+
+	_, err := service.Execute(dbc, lockXactQuery, int64(key))
+	return err
+}
+
+// WithLock runs fn holding the session advisory lock key on a dedicated connection, which fn
+// receives. The lock is released and the connection closed when fn returns. fn must not close the
+// connection (Commit and Rollback close it): the lock would be released before fn returns, and
+// WithLock returns an error.
+func (service *service) WithLock(key LockKey, fn func(dbc *DBContext) error) error {
+	return service.WithLockContext(context.Background(), key, fn)
+}
+
+// WithLockContext is like WithLock, waiting for the lock until ctx is done
+func (service *service) WithLockContext(ctx context.Context, key LockKey, fn func(dbc *DBContext) error) (err error) {
+	dbc, err := service.ConnectionContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = service.Lock(dbc, key)
+	if err != nil {
+		service.discardConn(dbc)
+		return err
+	}
+
+	defer func() {
+		if dbc.dbConn == nil {
+			// fn closed the connection, which released the lock
+			if err == nil {
+				err = fmt.Errorf("unlock %d: %w", key, errLockWithoutConn)
+			}
+			return
+		}
+		unlockErr := service.Unlock(dbc, key)
+		if unlockErr != nil {
+			// the session could still hold the lock, so it can't go back to the pool
+			service.discardConn(dbc)
+			if err == nil {
+				err = fmt.Errorf("unlock %d: %w", key, unlockErr)
+			}
+			return
+		}
+		_ = service.Close(dbc)
+	}()
+
+	return fn(dbc)
+}
+
+// executeOnConn executes query on the connection of dbc, so it runs in its session, and returns the
+// affected rows
+func (service *service) executeOnConn(dbc *DBContext, operation string, query string,
+	params ...interface{}) (int64, error) {
+	if dbc == nil || dbc.dbConn == nil {
+		return 0, errLockWithoutConn
+	}
+
+	run := service.startQuery(dbc, QueryOperationExecute, query, params)
+	var affectedRows int64
+	result, err := dbc.dbConn.ExecContext(dbc.context(), query, params...)
+	if err == nil {
+		affectedRows, err = result.RowsAffected()
+	}
+	if err != nil {
+		run.finish(nil, err)
+		service.logMetric(logError, operation, "dbc.dbConn.ExecContext(ctx, query, params...)", err)
+		return 0, err
+	}
+	run.finish(&DBResult{affectedRows: affectedRows}, nil)
+
+	// done
+	return affectedRows, nil
+}
+
+// discardConn closes the connection of dbc without returning it to the pool, so the server ends its
+// session and releases its locks
+func (service *service) discardConn(dbc *DBContext) {
+	if dbc == nil || dbc.dbConn == nil {
+		return
+	}
+	service.forgetHeldLocks(dbc.dbConn)
+	err := dbc.dbConn.Raw(func(driverConn interface{}) error {
+		return driver.ErrBadConn
+	})
+	if err != nil && err != driver.ErrBadConn {
+		service.logMetric(logError, "discard_conn", "dbc.dbConn.Raw(func)", err)
+	}
+	dbc.dbConn = nil
+}
+
+// heldLocks returns how many session advisory locks the connection holds, counting reentrant ones
+func (service *service) heldLocks(conn converter.DBConner) int {
+	if service.sessionLocks == nil || conn == nil {
+		return 0
+	}
+	held, _ := service.sessionLocks.Load(conn)
+	count, _ := held.(int)
+	return count
+}
+
+// addHeldLocks adds delta to the session advisory locks held by the connection
+func (service *service) addHeldLocks(conn converter.DBConner, delta int) {
+	if service.sessionLocks == nil || conn == nil {
+		return
+	}
+	if count := service.heldLocks(conn) + delta; count > 0 {
+		service.sessionLocks.Store(conn, count)
+	} else {
+		service.sessionLocks.Delete(conn)
+	}
+}
+
+// forgetHeldLocks forgets the session advisory locks of a discarded connection
+func (service *service) forgetHeldLocks(conn converter.DBConner) {
+	if service.sessionLocks != nil {
+		service.sessionLocks.Delete(conn)
+	}
+}
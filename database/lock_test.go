@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StringLockKey(t *testing.T) {
+	ass := assert.New(t)
+
+	ass.Equal(StringLockKey("billing-cron"), StringLockKey("billing-cron"))
+	ass.NotEqual(StringLockKey("billing-cron"), StringLockKey("billing-cron-2"))
+}
+
+func Test_TryLock(t *testing.T) {
+	tt := []struct {
+		Name         string
+		AffectedRows int64
+		Locked       bool
+	}{
+		{"Acquired", 1, true},
+		{"Held by another session", 0, false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// given
+			ass := assert.New(t)
+			service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+			ctx := context.Background()
+			connMock := newDBConnMock()
+			resultMock := newDBResultMock()
+			dbc := &DBContext{dbConn: connMock, ctx: ctx}
+
+			// when
+			connMock.PatchExecContext(ctx, tryLockQuery, []interface{}{int64(42)}, resultMock, nil)
+			resultMock.PatchRowsAffected(tc.AffectedRows, nil)
+			locked, err := service.TryLock(dbc, 42)
+
+			// then
+			ass.Nil(err)
+			ass.Equal(tc.Locked, locked)
+			connMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_Lock_Without_Connection(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+
+	// when
+	lockErr := service.Lock(nil, 1)
+	_, tryErr := service.TryLock(&DBContext{tx: newDBTxMock()}, 1)
+	xactErr := service.LockXact(&DBContext{}, 1)
+
+	// then
+	ass.Equal(errLockWithoutConn, lockErr)
+	ass.Equal(errLockWithoutConn, tryErr)
+	ass.Equal(errTransactionNil, xactErr)
+}
+
+func Test_Unlock_Not_Held(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx := context.Background()
+	connMock := newDBConnMock()
+	resultMock := newDBResultMock()
+	dbc := &DBContext{dbConn: connMock, ctx: ctx}
+
+	// when
+	connMock.PatchExecContext(ctx, unlockQuery, []interface{}{int64(42)}, resultMock, nil)
+	resultMock.PatchRowsAffected(0, nil)
+	err := service.Unlock(dbc, 42)
+
+	// then
+	ass.Equal(ErrLockNotHeld, err)
+}
+
+func Test_TryLockXact(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx := context.Background()
+	txMock := newDBTxMock()
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+	dbc := &DBContext{tx: txMock, ctx: ctx, nestingLevel: 1}
+	params := []interface{}{int64(StringLockKey("billing-cron"))}
+
+	// when
+	txMock.PatchPrepareContext(ctx, tryLockXactQuery, stmtMock, nil)
+	stmtMock.PatchExecContext(ctx, params, resultMock, nil)
+	resultMock.PatchRowsAffected(1, nil)
+	locked, err := service.TryLockXact(dbc, StringLockKey("billing-cron"))
+
+	// then
+	ass.Nil(err)
+	ass.True(locked)
+	txMock.AssertExpectations(t)
+}
+
+func Test_WithLock(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx := context.Background()
+	connMock := newDBConnMock()
+	lockResult := newDBResultMock()
+	unlockResult := newDBResultMock()
+	params := []interface{}{int64(7)}
+
+	// when
+	sqlMock.PatchConn(ctx, connMock, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	connMock.PatchExecContext(ctx, lockQuery, params, lockResult, nil)
+	lockResult.PatchRowsAffected(1, nil)
+	connMock.PatchExecContext(ctx, unlockQuery, params, unlockResult, nil)
+	unlockResult.PatchRowsAffected(1, nil)
+	connMock.PatchClose(nil)
+	called := false
+	err := service.WithLock(7, func(dbc *DBContext) error {
+		called = true
+		return nil
+	})
+
+	// then
+	ass.Nil(err)
+	ass.True(called)
+	connMock.AssertExpectations(t)
+}
+
+func Test_WithLock_Unlock_Error_Discards_Connection(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx := context.Background()
+	connMock := newDBConnMock()
+	lockResult := newDBResultMock()
+	params := []interface{}{int64(7)}
+	unlockErr := errors.New("connection reset by peer")
+
+	// when
+	sqlMock.PatchConn(ctx, connMock, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	connMock.PatchExecContext(ctx, lockQuery, params, lockResult, nil)
+	lockResult.PatchRowsAffected(1, nil)
+	connMock.PatchExecContext(ctx, unlockQuery, params, nil, unlockErr)
+	connMock.PatchRaw(driver.ErrBadConn)
+	err := service.WithLock(7, func(dbc *DBContext) error {
+		return nil
+	})
+
+	// then
+	ass.ErrorIs(err, unlockErr)
+	connMock.AssertExpectations(t)
+	connMock.AssertNotCalled(t, "Close")
+}
+
+func Test_Close_Holding_Lock_Discards_Connection(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.sessionLocks = &sync.Map{}
+	ctx := context.Background()
+	connMock := newDBConnMock()
+	dbc := &DBContext{dbConn: connMock, ctx: ctx}
+	lockResult := newDBResultMock()
+
+	// when
+	connMock.PatchExecContext(ctx, lockQuery, []interface{}{int64(7)}, lockResult, nil)
+	lockResult.PatchRowsAffected(1, nil)
+	connMock.PatchRaw(driver.ErrBadConn)
+	lockErr := service.Lock(dbc, 7)
+	err := service.Close(dbc)
+
+	// then
+	ass.Nil(lockErr)
+	ass.Nil(err)
+	ass.Nil(dbc.dbConn)
+	ass.Equal(0, service.heldLocks(connMock))
+	connMock.AssertExpectations(t)
+	connMock.AssertNotCalled(t, "Close")
+}
+
+func Test_WithLock_Fn_Closes_Connection(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.sessionLocks = &sync.Map{}
+	ctx := context.Background()
+	connMock := newDBConnMock()
+	lockResult := newDBResultMock()
+
+	// when
+	sqlMock.PatchConn(ctx, connMock, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	connMock.PatchExecContext(ctx, lockQuery, []interface{}{int64(7)}, lockResult, nil)
+	lockResult.PatchRowsAffected(1, nil)
+	connMock.PatchRaw(driver.ErrBadConn)
+	err := service.WithLock(7, func(dbc *DBContext) error {
+		// like a Commit of a transaction begun with dbc
+		return service.Close(dbc)
+	})
+
+	// then
+	ass.ErrorIs(err, errLockWithoutConn)
+	connMock.AssertExpectations(t)
+	connMock.AssertNotCalled(t, "Close")
+}
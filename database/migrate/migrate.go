@@ -0,0 +1,358 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+)
+
+const (
+	// DefaultTable is the table where the applied versions are recorded
+	DefaultTable = "schema_migrations"
+)
+
+type (
+	// Migrator applies and reverts the migrations of a fs.FS
+	Migrator struct {
+		db         database.Database
+		migrations []Migration
+		table      string
+		lockID     int64
+	}
+
+	// Option configures a Migrator
+	Option func(migrator *Migrator)
+
+	// MigrationStatus is the state of a migration in the database
+	MigrationStatus struct {
+		Version   int64      `json:"version"`
+		Name      string     `json:"name"`
+		Applied   bool       `json:"applied"`
+		AppliedOn *time.Time `json:"applied_on,omitempty"`
+	}
+
+	// appliedMigration is a row of the migrations table
+	appliedMigration struct {
+		Version   int64     `db:"version"`
+		Name      string    `db:"name"`
+		AppliedOn time.Time `db:"applied_on"`
+	}
+
+	// tableExists is the row of the query that checks if the migrations table exists
+	tableExists struct {
+		Exists bool `db:"exists"`
+	}
+
+	// stepFn runs one step of a command with the applied migrations, it returns false when there
+	// is nothing left to do
+	stepFn func(dbc *database.DBContext, applied map[int64]appliedMigration) (bool, error)
+)
+
+// WithTable sets the table where the applied versions are recorded, it can be qualified with its schema
+func WithTable(table string) Option {
+	return func(migrator *Migrator) {
+		migrator.table = table
+	}
+}
+
+// WithLockID sets the key of the advisory lock taken while migrating. By default it's derived
+// from the table name.
+func WithLockID(lockID int64) Option {
+	return func(migrator *Migrator) {
+		migrator.lockID = lockID
+	}
+}
+
+// New returns a Migrator for the migrations at the root of fsys, named <version>_<name>.up.sql and
+// <version>_<name>.down.sql. fsys can be an embed.FS.
+func New(db database.Database, fsys fs.FS, opts ...Option) (*Migrator, error) {
+	migrations, err := readMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator := &Migrator{
+		db:         db,
+		migrations: migrations,
+		table:      DefaultTable,
+	}
+	for _, opt := range opts {
+		opt(migrator)
+	}
+	if migrator.lockID == 0 {
+		migrator.lockID = int64(database.StringLockKey(migrator.table))
+	}
+
+	// done
+	return migrator, nil
+}
+
+// Migrations returns the migrations read, sorted by version
+func (migrator *Migrator) Migrations() []Migration {
+	return migrator.migrations
+}
+
+// Up applies every pending migration
+func (migrator *Migrator) Up() error {
+	return migrator.run(func(dbc *database.DBContext, applied map[int64]appliedMigration) (bool, error) {
+		migration := migrator.nextPending(applied, -1)
+		if migration == nil {
+			return false, nil
+		}
+		return true, migrator.apply(dbc, migration)
+	})
+}
+
+// Down reverts the last n applied migrations
+func (migrator *Migrator) Down(n int) error {
+	reverted := 0
+	return migrator.run(func(dbc *database.DBContext, applied map[int64]appliedMigration) (bool, error) {
+		if reverted >= n {
+			return false, nil
+		}
+		version, ok := lastApplied(applied, 0)
+		if !ok {
+			return false, nil
+		}
+		reverted++
+		return true, migrator.revert(dbc, version)
+	})
+}
+
+// To applies or reverts migrations until version is the last one applied. Version 0 reverts all of them.
+func (migrator *Migrator) To(version int64) error {
+	if version != 0 && migrator.find(version) == nil {
+		return fmt.Errorf("migration %d not found", version)
+	}
+
+	return migrator.run(func(dbc *database.DBContext, applied map[int64]appliedMigration) (bool, error) {
+		if last, ok := lastApplied(applied, version); ok {
+			return true, migrator.revert(dbc, last)
+		}
+		migration := migrator.nextPending(applied, version)
+		if migration == nil {
+			return false, nil
+		}
+		return true, migrator.apply(dbc, migration)
+	})
+}
+
+// Status returns every migration, known or applied, sorted by version. It only reads, without
+// taking the lock or creating the migrations table: if the table doesn't exist nothing is applied.
+func (migrator *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := migrator.readApplied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrator.migrations))
+	for _, migration := range migrator.migrations {
+		status := MigrationStatus{
+			Version: migration.Version,
+			Name:    migration.Name,
+		}
+		if row, ok := applied[migration.Version]; ok {
+			appliedOn := row.AppliedOn
+			status.Applied = true
+			status.AppliedOn = &appliedOn
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Applied migrations whose files are gone
+	for _, row := range applied {
+		appliedOn := row.AppliedOn
+		statuses = append(statuses, MigrationStatus{
+			Version:   row.Version,
+			Name:      row.Name,
+			Applied:   true,
+			AppliedOn: &appliedOn,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	// done
+	return statuses, nil
+}
+
+// run runs steps until one returns false. Each step runs in its own transaction holding the
+// advisory lock, so other instances migrating at the same time wait and then see its changes.
+func (migrator *Migrator) run(step stepFn) error {
+	for {
+		more := false
+		err := migrator.db.WithTransaction(func(dbc *database.DBContext) (err error) {
+			applied, err := migrator.lock(dbc)
+			if err != nil {
+				return err
+			}
+			more, err = step(dbc, applied)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// lock takes the advisory lock, creates the migrations table if needed and returns the applied migrations
+func (migrator *Migrator) lock(dbc *database.DBContext) (map[int64]appliedMigration, error) {
+	_, err := migrator.db.Execute(dbc, "SELECT pg_advisory_xact_lock($1)", migrator.lockID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = migrator.db.Execute(dbc, migrator.createTableQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.SelectInto[appliedMigration](migrator.db, dbc, migrator.appliedQuery(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	// done
+	return appliedByVersion(rows), nil
+}
+
+// readApplied returns the applied migrations without the lock. A missing migrations table means
+// nothing is applied. It reads from the primary, a replica may not have the last changes yet.
+func (migrator *Migrator) readApplied() (map[int64]appliedMigration, error) {
+	ctx := database.WithPrimary(context.Background())
+	dbr, err := migrator.db.SelectContext(ctx, nil, "SELECT to_regclass($1) IS NOT NULL AS exists", false,
+		database.QuoteTable(migrator.table))
+	if err != nil {
+		return nil, err
+	}
+	tables, err := database.ScanRowsInto[tableExists](dbr.GetRows())
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 || !tables[0].Exists {
+		return map[int64]appliedMigration{}, nil
+	}
+
+	dbr, err = migrator.db.SelectContext(ctx, nil, migrator.appliedQuery(), false)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := database.ScanRowsInto[appliedMigration](dbr.GetRows())
+	if err != nil {
+		return nil, err
+	}
+
+	// done
+	return appliedByVersion(rows), nil
+}
+
+// appliedQuery returns the query of the applied migrations
+func (migrator *Migrator) appliedQuery() string {
+	return fmt.Sprintf("SELECT version, name, applied_on FROM %s", database.QuoteTable(migrator.table))
+}
+
+// appliedByVersion indexes the applied migrations by version
+func appliedByVersion(rows []appliedMigration) map[int64]appliedMigration {
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied
+}
+
+// apply runs the up statements of migration and records its version
+func (migrator *Migrator) apply(dbc *database.DBContext, migration *Migration) error {
+	err := migrator.execute(dbc, migration.Version, migration.Up)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.db.Execute(dbc,
+		fmt.Sprintf("INSERT INTO %s (version, name) VALUES ($1, $2)", database.QuoteTable(migrator.table)),
+		migration.Version, migration.Name)
+	return err
+}
+
+// revert runs the down statements of the migration with version and deletes its record
+func (migrator *Migrator) revert(dbc *database.DBContext, version int64) error {
+	migration := migrator.find(version)
+	if migration == nil {
+		return fmt.Errorf("migration %d is applied but its files were not found", version)
+	}
+	if migration.Down == "" {
+		return fmt.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+	}
+
+	err := migrator.execute(dbc, migration.Version, migration.Down)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.db.Execute(dbc,
+		fmt.Sprintf("DELETE FROM %s WHERE version = $1", database.QuoteTable(migrator.table)), migration.Version)
+	return err
+}
+
+// execute runs every statement of a migration script
+func (migrator *Migrator) execute(dbc *database.DBContext, version int64, script string) error {
+	for _, statement := range splitStatements(script) {
+		_, err := migrator.db.Execute(dbc, statement)
+		if err != nil {
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+	}
+	return nil
+}
+
+// nextPending returns the first migration not applied, up to version (-1 means no limit)
+func (migrator *Migrator) nextPending(applied map[int64]appliedMigration, version int64) *Migration {
+	for i := range migrator.migrations {
+		migration := &migrator.migrations[i]
+		if version >= 0 && migration.Version > version {
+			return nil
+		}
+		if _, ok := applied[migration.Version]; !ok {
+			return migration
+		}
+	}
+	return nil
+}
+
+// find returns the migration with version or nil
+func (migrator *Migrator) find(version int64) *Migration {
+	for i := range migrator.migrations {
+		if migrator.migrations[i].Version == version {
+			return &migrator.migrations[i]
+		}
+	}
+	return nil
+}
+
+// createTableQuery returns the statement that creates the migrations table
+func (migrator *Migrator) createTableQuery() string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY, name TEXT NOT NULL, "+
+		"applied_on TIMESTAMPTZ NOT NULL DEFAULT NOW())", database.QuoteTable(migrator.table))
+}
+
+// lastApplied returns the highest applied version greater than above
+func lastApplied(applied map[int64]appliedMigration, above int64) (int64, bool) {
+	found := false
+	var last int64
+	for version := range applied {
+		if version > above && (!found || version > last) {
+			last = version
+			found = true
+		}
+	}
+	return last, found
+}
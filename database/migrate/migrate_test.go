@@ -0,0 +1,216 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+)
+
+const (
+	lockStmt        string = "SELECT pg_advisory_xact_lock($1)"
+	createTableStmt string = `CREATE TABLE IF NOT EXISTS "schema_migrations" (version BIGINT PRIMARY KEY, ` +
+		`name TEXT NOT NULL, applied_on TIMESTAMPTZ NOT NULL DEFAULT NOW())`
+	appliedStmt string = `SELECT version, name, applied_on FROM "schema_migrations"`
+	insertStmt  string = `INSERT INTO "schema_migrations" (version, name) VALUES ($1, $2)`
+	deleteStmt  string = `DELETE FROM "schema_migrations" WHERE version = $1`
+	existsStmt  string = "SELECT to_regclass($1) IS NOT NULL AS exists"
+)
+
+func Test_Migrator_Up(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	dbMock := database.NewMock()
+	migrator := newTestMigrator(t, dbMock)
+	dbc := &database.DBContext{}
+
+	// when
+	// first step applies 2, the only pending one
+	patchStep(dbMock, dbc, migrator.lockID,
+		`[{"version": 1, "name": "create_users", "applied_on": "2026-01-02T03:04:05Z"}]`)
+	dbMock.PatchExecute(dbc, "ALTER TABLE users ADD email TEXT", nil, &database.DBResult{}, nil)
+	dbMock.PatchExecute(dbc, "CREATE INDEX users_email ON users (email)", nil, &database.DBResult{}, nil)
+	dbMock.PatchExecute(dbc, insertStmt, []interface{}{int64(2), "add_email"}, &database.DBResult{}, nil)
+	dbMock.PatchCommit(dbc, nil)
+	// second step finds nothing pending
+	patchStep(dbMock, dbc, migrator.lockID,
+		`[{"version": 1, "name": "create_users", "applied_on": "2026-01-02T03:04:05Z"},
+		{"version": 2, "name": "add_email", "applied_on": "2026-01-02T03:04:06Z"}]`)
+	dbMock.PatchCommit(dbc, nil)
+	err := migrator.Up()
+
+	// then
+	ass.Nil(err)
+}
+
+func Test_Migrator_Up_Failed_Statement(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	dbMock := database.NewMock()
+	migrator := newTestMigrator(t, dbMock)
+	dbc := &database.DBContext{}
+	execErr := errors.New("column already exists")
+
+	// when
+	patchStep(dbMock, dbc, migrator.lockID,
+		`[{"version": 1, "name": "create_users", "applied_on": "2026-01-02T03:04:05Z"}]`)
+	dbMock.PatchExecute(dbc, "ALTER TABLE users ADD email TEXT", nil, nil, execErr)
+	dbMock.PatchRollback(dbc, nil)
+	err := migrator.Up()
+
+	// then
+	ass.EqualError(err, "migration 2 failed: column already exists")
+	ass.ErrorIs(err, execErr)
+}
+
+func Test_Migrator_Down(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	dbMock := database.NewMock()
+	migrator := newTestMigrator(t, dbMock)
+	dbc := &database.DBContext{}
+
+	// when
+	patchStep(dbMock, dbc, migrator.lockID,
+		`[{"version": 1, "name": "create_users", "applied_on": "2026-01-02T03:04:05Z"}]`)
+	dbMock.PatchExecute(dbc, "DROP TABLE users", nil, &database.DBResult{}, nil)
+	dbMock.PatchExecute(dbc, deleteStmt, []interface{}{int64(1)}, &database.DBResult{}, nil)
+	dbMock.PatchCommit(dbc, nil)
+	patchStep(dbMock, dbc, migrator.lockID, `[]`)
+	dbMock.PatchCommit(dbc, nil)
+	err := migrator.Down(1)
+
+	// then
+	ass.Nil(err)
+}
+
+func Test_Migrator_Down_Without_Down_File(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	dbMock := database.NewMock()
+	migrator := newTestMigrator(t, dbMock)
+	dbc := &database.DBContext{}
+
+	// when
+	patchStep(dbMock, dbc, migrator.lockID,
+		`[{"version": 1, "name": "create_users", "applied_on": "2026-01-02T03:04:05Z"},
+		{"version": 2, "name": "add_email", "applied_on": "2026-01-02T03:04:06Z"}]`)
+	dbMock.PatchRollback(dbc, nil)
+	err := migrator.Down(1)
+
+	// then
+	ass.EqualError(err, "migration 2_add_email has no down file")
+}
+
+func Test_Migrator_To_Unknown_Version(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	migrator := newTestMigrator(t, database.NewMock())
+
+	// when
+	err := migrator.To(3)
+
+	// then
+	ass.EqualError(err, "migration 3 not found")
+}
+
+func Test_Migrator_To_Reverts_Newer(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	dbMock := database.NewMock()
+	migrator := newTestMigrator(t, dbMock)
+	dbc := &database.DBContext{}
+
+	// when
+	patchStep(dbMock, dbc, migrator.lockID,
+		`[{"version": 1, "name": "create_users", "applied_on": "2026-01-02T03:04:05Z"}]`)
+	dbMock.PatchExecute(dbc, "DROP TABLE users", nil, &database.DBResult{}, nil)
+	dbMock.PatchExecute(dbc, deleteStmt, []interface{}{int64(1)}, &database.DBResult{}, nil)
+	dbMock.PatchCommit(dbc, nil)
+	patchStep(dbMock, dbc, migrator.lockID, `[]`)
+	dbMock.PatchCommit(dbc, nil)
+	err := migrator.To(0)
+
+	// then
+	ass.Nil(err)
+}
+
+func Test_Migrator_Status(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	dbMock := database.NewMock()
+	migrator := newTestMigrator(t, dbMock)
+
+	// when
+	dbMock.PatchSelect(nil, existsStmt, false, []interface{}{`"schema_migrations"`},
+		database.ParseMockDBResultFromJSON(`[{"exists": true}]`), nil)
+	dbMock.PatchSelect(nil, appliedStmt, false, nil, database.ParseMockDBResultFromJSON(
+		`[{"version": 1, "name": "create_users", "applied_on": "2026-01-02T03:04:05Z"},
+		{"version": 7, "name": "removed", "applied_on": "2026-01-02T03:04:06Z"}]`), nil)
+	statuses, err := migrator.Status()
+
+	// then
+	ass.Nil(err)
+	ass.Len(statuses, 3)
+	ass.Equal(int64(1), statuses[0].Version)
+	ass.True(statuses[0].Applied)
+	ass.Equal("2026-01-02T03:04:05Z", statuses[0].AppliedOn.UTC().Format("2006-01-02T15:04:05Z"))
+	ass.Equal(MigrationStatus{Version: 2, Name: "add_email"}, statuses[1])
+	ass.Equal("removed", statuses[2].Name)
+	ass.True(statuses[2].Applied)
+}
+
+func Test_Migrator_Status_Without_Table(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	dbMock := database.NewMock()
+	migrator := newTestMigrator(t, dbMock)
+
+	// when
+	dbMock.PatchSelect(nil, existsStmt, false, []interface{}{`"schema_migrations"`},
+		database.ParseMockDBResultFromJSON(`[{"exists": false}]`), nil)
+	statuses, err := migrator.Status()
+
+	// then
+	ass.Nil(err)
+	ass.Equal([]MigrationStatus{{Version: 1, Name: "create_users"}, {Version: 2, Name: "add_email"}}, statuses)
+}
+
+func Test_New_Options(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	// when
+	migrator, err := New(database.NewMock(), fstest.MapFS{}, WithTable("ops.migrations"), WithLockID(42))
+
+	// then
+	ass.Nil(err)
+	ass.Equal("ops.migrations", migrator.table)
+	ass.Equal(int64(42), migrator.lockID)
+	ass.Empty(migrator.Migrations())
+	ass.Equal(`"ops"."migrations"`, database.QuoteTable(migrator.table))
+}
+
+func newTestMigrator(t *testing.T, db database.Database) *Migrator {
+	fsys := fstest.MapFS{
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id BIGINT);")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"0002_add_email.up.sql": {
+			Data: []byte("ALTER TABLE users ADD email TEXT;\nCREATE INDEX users_email ON users (email);"),
+		},
+	}
+	migrator, err := New(db, fsys)
+	assert.Nil(t, err)
+	return migrator
+}
+
+// patchStep patches the begin of a step: the lock, the table creation and the applied migrations
+func patchStep(dbMock *database.Mock, dbc *database.DBContext, lockID int64, applied string) {
+	dbMock.PatchBegin(nil, dbc, nil)
+	dbMock.PatchExecute(dbc, lockStmt, []interface{}{lockID}, &database.DBResult{}, nil)
+	dbMock.PatchExecute(dbc, createTableStmt, nil, &database.DBResult{}, nil)
+	dbMock.PatchSelect(dbc, appliedStmt, false, nil, database.ParseMockDBResultFromJSON(applied), nil)
+}
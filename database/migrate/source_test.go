@@ -0,0 +1,60 @@
+package migrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReadMigrations(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fsys := fstest.MapFS{
+		"0002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD email TEXT;")},
+		"0001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id BIGINT);")},
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+		"README.md":                  {Data: []byte("not a migration")},
+	}
+
+	// when
+	migrations, err := readMigrations(fsys)
+
+	// then
+	ass.Nil(err)
+	ass.Equal([]Migration{
+		{Version: 1, Name: "create_users", Up: "CREATE TABLE users (id BIGINT);", Down: "DROP TABLE users;"},
+		{Version: 2, Name: "add_email", Up: "ALTER TABLE users ADD email TEXT;"},
+	}, migrations)
+}
+
+func Test_ReadMigrations_Different_Names(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fsys := fstest.MapFS{
+		"0001_create_users.up.sql":    {Data: []byte("CREATE TABLE users (id BIGINT);")},
+		"0001_create_people.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+
+	// when
+	migrations, err := readMigrations(fsys)
+
+	// then
+	ass.Nil(migrations)
+	ass.EqualError(err, "migration 1 has files with different names: create_people and create_users")
+}
+
+func Test_ReadMigrations_Without_Up(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fsys := fstest.MapFS{
+		"0001_create_users.down.sql": {Data: []byte("DROP TABLE users;")},
+	}
+
+	// when
+	migrations, err := readMigrations(fsys)
+
+	// then
+	ass.Nil(migrations)
+	ass.EqualError(err, "migration 1_create_users has no up file")
+}
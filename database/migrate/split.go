@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	// dollarTagRegexp matches the opening tag of a dollar-quoted string, e.g. $$ or $body$
+	dollarTagRegexp = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+)
+
+// splitStatements splits a SQL script into its statements, because a prepared statement can only
+// hold one. Semicolons inside strings, quoted identifiers, comments and dollar-quoted bodies
+// (e.g. functions) don't split.
+func splitStatements(script string) []string {
+	statements := make([]string, 0)
+	var current strings.Builder
+	// hasCode is false while the current statement only has whitespace and comments
+	hasCode := false
+
+	flush := func() {
+		if hasCode {
+			statements = append(statements, strings.TrimSpace(current.String()))
+		}
+		current.Reset()
+		hasCode = false
+	}
+
+	for i := 0; i < len(script); {
+		rest := script[i:]
+		switch {
+		case rest[0] == ';':
+			flush()
+			i++
+			continue
+		case strings.HasPrefix(rest, "--"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			current.WriteString(rest[:end])
+			i += end
+			continue
+		case strings.HasPrefix(rest, "/*"):
+			end := blockCommentEnd(rest)
+			current.WriteString(rest[:end])
+			i += end
+			continue
+		case rest[0] == '\'' || rest[0] == '"':
+			hasCode = true
+			end := quotedEnd(rest, rest[0])
+			current.WriteString(rest[:end])
+			i += end
+			continue
+		case rest[0] == '$':
+			if tag := dollarTagRegexp.FindString(rest); tag != "" {
+				hasCode = true
+				end := strings.Index(rest[len(tag):], tag)
+				if end < 0 {
+					end = len(rest)
+				} else {
+					end += 2 * len(tag)
+				}
+				current.WriteString(rest[:end])
+				i += end
+				continue
+			}
+		}
+		if !unicode.IsSpace(rune(rest[0])) {
+			hasCode = true
+		}
+		current.WriteByte(rest[0])
+		i++
+	}
+	flush()
+
+	return statements
+}
+
+// quotedEnd returns the position after the closing quote, a doubled quote is an escaped one
+func quotedEnd(text string, quote byte) int {
+	for i := 1; i < len(text); i++ {
+		if text[i] != quote {
+			continue
+		}
+		if i+1 < len(text) && text[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(text)
+}
+
+// blockCommentEnd returns the position after the end of a block comment, which can be nested
+func blockCommentEnd(text string) int {
+	depth := 0
+	for i := 0; i < len(text)-1; i++ {
+		switch text[i : i+2] {
+		case "/*":
+			depth++
+			i++
+		case "*/":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(text)
+}
@@ -0,0 +1,44 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SplitStatements(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	script := `-- users table
+CREATE TABLE users (id BIGINT, email TEXT DEFAULT 'a;b');
+/* a /* nested; */ comment; */
+INSERT INTO "odd;name" VALUES (1, 'it''s; fine');
+CREATE FUNCTION touch() RETURNS trigger AS $body$
+BEGIN
+	NEW.updated_at = NOW();
+	RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+-- trailing comment;
+`
+
+	// when
+	statements := splitStatements(script)
+
+	// then
+	ass.Len(statements, 3)
+	ass.Equal("-- users table\nCREATE TABLE users (id BIGINT, email TEXT DEFAULT 'a;b')", statements[0])
+	ass.Equal("/* a /* nested; */ comment; */\nINSERT INTO \"odd;name\" VALUES (1, 'it''s; fine')", statements[1])
+	ass.Contains(statements[2], "RETURN NEW;\nEND;\n$body$ LANGUAGE plpgsql")
+}
+
+func Test_SplitStatements_Empty(t *testing.T) {
+	ass := assert.New(t)
+	ass.Empty(splitStatements(""))
+	ass.Empty(splitStatements(" ;\n-- only a comment;\n/* and another */"))
+}
+
+func Test_SplitStatements_Positional_Param_Is_Not_Dollar_Quote(t *testing.T) {
+	ass := assert.New(t)
+	ass.Equal([]string{"SELECT $1", "SELECT $2"}, splitStatements("SELECT $1; SELECT $2"))
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
@@ -18,6 +19,9 @@ type Mock struct {
 	patchSelectUniqueValueNonEmptyMap     map[hash][]outputForSelectUniqueValueNonEmpty
 	patchExecuteMap                       map[hash][]outputForExecute
 	patchExecuteEnsuringOneAffectedRowMap map[hash][]outputForExecuteEnsuringOneAffectedRow
+	patchBulkInsertMap                    map[hash][]outputForBulkInsert
+	patchReadyOutputs                     []error
+	patchShutdownOutputs                  []error
 }
 
 //
@@ -51,6 +55,7 @@ func ParseMockDBResultFromJSON(jsonDBR string) *DBResult {
 // ParseMockDBResultFromArrRowsMap parse a mocked dbresult from an array of maps
 func ParseMockDBResultFromArrRowsMap(arrRowsMap []map[string]interface{}) *DBResult {
 	rows := make(DBRowArray, 0)
+	allColumns := make(DBColumns)
 	// iterate over rows
 	for _, item := range arrRowsMap {
 		columns := make(DBColumns)
@@ -61,20 +66,19 @@ func ParseMockDBResultFromArrRowsMap(arrRowsMap []map[string]interface{}) *DBRes
 				field: value,
 			}
 			columns[key] = column
+			allColumns[key] = column
 		}
 
 		// add row
-		row := DBRow{
-			columns: columns,
-		}
-		rows = append(rows, row)
+		rows = append(rows, *NewRow(columns))
 	}
 
-	// mocked dbresult
+	// mocked dbresult, the columns are ordered by name
 	dbr := DBResult{
 		rows: DBRows{
 			DBRowArray: rows,
 		},
+		columns: newColumnInfos(sortedColumnNames(allColumns), nil, nil),
 	}
 
 	// done
@@ -93,6 +97,7 @@ func NewMock() *Mock {
 	patchSelectUniqueValueNonEmptyMap := make(map[hash][]outputForSelectUniqueValueNonEmpty)
 	patchExecuteMap := make(map[hash][]outputForExecute)
 	patchExecuteEnsuringOneAffectedRowMap := make(map[hash][]outputForExecuteEnsuringOneAffectedRow)
+	patchBulkInsertMap := make(map[hash][]outputForBulkInsert)
 	databaseMock := &Mock{
 		patchBeginMap:                         patchBeginMap,
 		patchCommitMap:                        patchCommitMap,
@@ -102,6 +107,7 @@ func NewMock() *Mock {
 		patchSelectUniqueValueNonEmptyMap:     patchSelectUniqueValueNonEmptyMap,
 		patchExecuteMap:                       patchExecuteMap,
 		patchExecuteEnsuringOneAffectedRowMap: patchExecuteEnsuringOneAffectedRowMap,
+		patchBulkInsertMap:                    patchBulkInsertMap,
 	}
 
 	// done
@@ -192,6 +198,18 @@ type outputForExecuteEnsuringOneAffectedRow struct {
 	err error
 }
 
+type inputForBulkInsert struct {
+	DBC     *DBContext
+	Table   string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+type outputForBulkInsert struct {
+	dbr *DBResult
+	err error
+}
+
 type hash [16]byte
 
 func toHash(input interface{}) hash {
@@ -402,8 +420,8 @@ func (mock *Mock) Rollback(dbc *DBContext) error {
 	return nil
 }
 
-// WithTransaction mock for WithTransaction function
-func (mock *Mock) WithTransaction(txFn func(dbc *DBContext) error) (err error) {
+// WithTransaction mock for WithTransaction function. The opts are ignored, the transaction is never retried.
+func (mock *Mock) WithTransaction(txFn func(dbc *DBContext) error, opts ...TxOption) (err error) {
 	txContext, err := mock.Begin(nil)
 	if err != nil {
 		return err
@@ -640,3 +658,406 @@ func (mock *Mock) ExecuteEnsuringOneAffectedRow(dbc *DBContext, query string,
 	// done
 	return nil
 }
+
+// Context variants
+
+// The ctx is not part of the input matched by the mock, so the Context variants share the
+// patches with their non-context counterparts.
+
+// PatchBeginContext patch for BeginContext function
+func (mock *Mock) PatchBeginContext(ctx context.Context, inputDBC *DBContext, outputDBC *DBContext, outputError error) {
+	mock.PatchBegin(inputDBC, outputDBC, outputError)
+}
+
+// BeginContext mock for BeginContext function
+func (mock *Mock) BeginContext(ctx context.Context, inDbc *DBContext) (*DBContext, error) {
+	return mock.Begin(inDbc)
+}
+
+// PatchWithTransactionContext patch for WithTransactionContext function
+func (mock *Mock) PatchWithTransactionContext(ctx context.Context, txFn func(dbc *DBContext) error,
+	outputError error) {
+	panic("To patch Database.WithTransactionContext patch Database.Begin, Database.Rollback and Database.Commit")
+}
+
+// WithTransactionContext mock for WithTransactionContext function
+func (mock *Mock) WithTransactionContext(ctx context.Context, txFn func(dbc *DBContext) error,
+	opts ...TxOption) error {
+	return mock.WithTransaction(txFn, opts...)
+}
+
+// PatchSelectContext patch for SelectContext function
+func (mock *Mock) PatchSelectContext(ctx context.Context, inputDBC *DBContext, inputQuery string,
+	inputForUpdate bool, inputArrParams []interface{}, outputDBResult *DBResult, outputError error) {
+	mock.PatchSelect(inputDBC, inputQuery, inputForUpdate, inputArrParams, outputDBResult, outputError)
+}
+
+// SelectContext mock for SelectContext function
+func (mock *Mock) SelectContext(ctx context.Context, dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) (*DBResult, error) {
+	return mock.Select(dbc, query, forUpdate, params...)
+}
+
+// PatchSelectUniqueValueContext patch for SelectUniqueValueContext function
+func (mock *Mock) PatchSelectUniqueValueContext(ctx context.Context, inputDBC *DBContext, inputQuery string,
+	inputForUpdate bool, inputArrParams []interface{}, outputDBRow *DBRow, outputError error) {
+	mock.PatchSelectUniqueValue(inputDBC, inputQuery, inputForUpdate, inputArrParams, outputDBRow, outputError)
+}
+
+// SelectUniqueValueContext mock for SelectUniqueValueContext function
+func (mock *Mock) SelectUniqueValueContext(ctx context.Context, dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) (*DBRow, error) {
+	return mock.SelectUniqueValue(dbc, query, forUpdate, params...)
+}
+
+// PatchSelectUniqueValueNonEmptyContext patch for SelectUniqueValueNonEmptyContext function
+func (mock *Mock) PatchSelectUniqueValueNonEmptyContext(ctx context.Context, inputDBC *DBContext,
+	inputQuery string, inputForUpdate bool, inputArrParams []interface{}, outputDBRow *DBRow, outputError error) {
+	mock.PatchSelectUniqueValueNonEmpty(inputDBC, inputQuery, inputForUpdate, inputArrParams, outputDBRow,
+		outputError)
+}
+
+// SelectUniqueValueNonEmptyContext mock for SelectUniqueValueNonEmptyContext function
+func (mock *Mock) SelectUniqueValueNonEmptyContext(ctx context.Context, dbc *DBContext, query string,
+	forUpdate bool, params ...interface{}) (*DBRow, error) {
+	return mock.SelectUniqueValueNonEmpty(dbc, query, forUpdate, params...)
+}
+
+// PatchExecuteContext patch for ExecuteContext function
+func (mock *Mock) PatchExecuteContext(ctx context.Context, inputDBC *DBContext, inputQuery string,
+	inputArrParams []interface{}, outputDBResult *DBResult, outputError error) {
+	mock.PatchExecute(inputDBC, inputQuery, inputArrParams, outputDBResult, outputError)
+}
+
+// ExecuteContext mock for ExecuteContext function
+func (mock *Mock) ExecuteContext(ctx context.Context, dbc *DBContext, query string,
+	params ...interface{}) (*DBResult, error) {
+	return mock.Execute(dbc, query, params...)
+}
+
+// PatchExecuteEnsuringOneAffectedRowContext patch for ExecuteEnsuringOneAffectedRowContext function
+func (mock *Mock) PatchExecuteEnsuringOneAffectedRowContext(ctx context.Context, inputDBC *DBContext,
+	inputQuery string, inputArrParams []interface{}, outputError error) {
+	mock.PatchExecuteEnsuringOneAffectedRow(inputDBC, inputQuery, inputArrParams, outputError)
+}
+
+// ExecuteEnsuringOneAffectedRowContext mock for ExecuteEnsuringOneAffectedRowContext function
+func (mock *Mock) ExecuteEnsuringOneAffectedRowContext(ctx context.Context, dbc *DBContext, query string,
+	params ...interface{}) error {
+	return mock.ExecuteEnsuringOneAffectedRow(dbc, query, params...)
+}
+
+// Streaming
+
+// The rows of SelectStream and SelectCursor are patched as a Select without forUpdate, and are
+// returned through an iterator over the patched result.
+
+// PatchSelectStream patch for SelectStream function
+func (mock *Mock) PatchSelectStream(inputDBC *DBContext, inputQuery string, inputArrParams []interface{},
+	outputDBResult *DBResult, outputError error) {
+	mock.PatchSelect(inputDBC, inputQuery, false, inputArrParams, outputDBResult, outputError)
+}
+
+// SelectStream mock for SelectStream function
+func (mock *Mock) SelectStream(dbc *DBContext, query string, params ...interface{}) (RowIterator, error) {
+	dbr, err := mock.Select(dbc, query, false, params...)
+	if err != nil {
+		return nil, err
+	}
+	return newResultIterator(dbr), nil
+}
+
+// PatchSelectStreamContext patch for SelectStreamContext function
+func (mock *Mock) PatchSelectStreamContext(ctx context.Context, inputDBC *DBContext, inputQuery string,
+	inputArrParams []interface{}, outputDBResult *DBResult, outputError error) {
+	mock.PatchSelectStream(inputDBC, inputQuery, inputArrParams, outputDBResult, outputError)
+}
+
+// SelectStreamContext mock for SelectStreamContext function
+func (mock *Mock) SelectStreamContext(ctx context.Context, dbc *DBContext, query string,
+	params ...interface{}) (RowIterator, error) {
+	return mock.SelectStream(dbc, query, params...)
+}
+
+// PatchSelectCursor patch for SelectCursor function, the fetchSize is not matched
+func (mock *Mock) PatchSelectCursor(inputDBC *DBContext, inputQuery string, inputArrParams []interface{},
+	outputDBResult *DBResult, outputError error) {
+	mock.PatchSelect(inputDBC, inputQuery, false, inputArrParams, outputDBResult, outputError)
+}
+
+// SelectCursor mock for SelectCursor function
+func (mock *Mock) SelectCursor(dbc *DBContext, query string, fetchSize int,
+	params ...interface{}) (RowIterator, error) {
+	return mock.SelectStream(dbc, query, params...)
+}
+
+// PatchSelectCursorContext patch for SelectCursorContext function
+func (mock *Mock) PatchSelectCursorContext(ctx context.Context, inputDBC *DBContext, inputQuery string,
+	inputArrParams []interface{}, outputDBResult *DBResult, outputError error) {
+	mock.PatchSelectCursor(inputDBC, inputQuery, inputArrParams, outputDBResult, outputError)
+}
+
+// SelectCursorContext mock for SelectCursorContext function
+func (mock *Mock) SelectCursorContext(ctx context.Context, dbc *DBContext, query string, fetchSize int,
+	params ...interface{}) (RowIterator, error) {
+	return mock.SelectCursor(dbc, query, fetchSize, params...)
+}
+
+// BulkInsert
+
+// PatchBulkInsert patch for BulkInsert function
+func (mock *Mock) PatchBulkInsert(inputDBC *DBContext, inputTable string, inputColumns []string,
+	inputRows [][]interface{}, outputDBResult *DBResult, outputError error) {
+	input := getInputForBulkInsert(inputDBC, inputTable, inputColumns, inputRows)
+	inputHash := toHash(input)
+	output := getOutputForBulkInsert(outputDBResult, outputError)
+
+	if _, exists := mock.patchBulkInsertMap[inputHash]; !exists {
+		arrOutputForBulkInsert := make([]outputForBulkInsert, 0)
+		mock.patchBulkInsertMap[inputHash] = arrOutputForBulkInsert
+	}
+	mock.patchBulkInsertMap[inputHash] = append(mock.patchBulkInsertMap[inputHash], output)
+}
+
+func getInputForBulkInsert(dbc *DBContext, table string, columns []string, rows [][]interface{}) inputForBulkInsert {
+	return inputForBulkInsert{
+		DBC:     dbc,
+		Table:   table,
+		Columns: columns,
+		Rows:    rows,
+	}
+}
+
+func getOutputForBulkInsert(dbr *DBResult, err error) outputForBulkInsert {
+	return outputForBulkInsert{
+		dbr: dbr,
+		err: err,
+	}
+}
+
+// BulkInsert mock for BulkInsert function
+func (mock *Mock) BulkInsert(dbc *DBContext, table string, columns []string,
+	rows [][]interface{}) (*DBResult, error) {
+	input := getInputForBulkInsert(dbc, table, columns, rows)
+	inputHash := toHash(input)
+	arrOutputForBulkInsert, exists := mock.patchBulkInsertMap[inputHash]
+	if !exists || len(arrOutputForBulkInsert) == 0 {
+		panic(fmt.Sprintf("Mock not available for Database.BulkInsert(dbc: %v, table: %s, columns: %v, rows: %v)",
+			dbc, table, columns, rows))
+	}
+
+	output := arrOutputForBulkInsert[0]
+	arrOutputForBulkInsert = arrOutputForBulkInsert[1:]
+	mock.patchBulkInsertMap[inputHash] = arrOutputForBulkInsert
+
+	if output.err != nil {
+		return nil, output.err
+	}
+
+	// done
+	return output.dbr, nil
+}
+
+// PatchBulkInsertContext patch for BulkInsertContext function
+func (mock *Mock) PatchBulkInsertContext(ctx context.Context, inputDBC *DBContext, inputTable string,
+	inputColumns []string, inputRows [][]interface{}, outputDBResult *DBResult, outputError error) {
+	mock.PatchBulkInsert(inputDBC, inputTable, inputColumns, inputRows, outputDBResult, outputError)
+}
+
+// BulkInsertContext mock for BulkInsertContext function
+func (mock *Mock) BulkInsertContext(ctx context.Context, dbc *DBContext, table string, columns []string,
+	rows [][]interface{}) (*DBResult, error) {
+	return mock.BulkInsert(dbc, table, columns, rows)
+}
+
+// ExecuteBatch
+
+// The statements of a batch are patched one by one with PatchExecute, or with PatchSelect without
+// forUpdate the ones with a RETURNING clause. The implicit transaction is not patched.
+
+// ExecuteBatch mock for ExecuteBatch function
+func (mock *Mock) ExecuteBatch(dbc *DBContext, statements []Statement) ([]*DBResult, error) {
+	return runBatch(mock, dbc, statements)
+}
+
+// ExecuteBatchContext mock for ExecuteBatchContext function
+func (mock *Mock) ExecuteBatchContext(ctx context.Context, dbc *DBContext,
+	statements []Statement) ([]*DBResult, error) {
+	return mock.ExecuteBatch(dbc, statements)
+}
+
+// Paginate
+
+// The page is patched as a Select without forUpdate of the query built by Paginate, which wraps the
+// query and appends the params of the cursor and the limit. The cursors are signed with a random secret.
+
+// Paginate mock for Paginate function
+func (mock *Mock) Paginate(dbc *DBContext, query string, params []interface{},
+	request PageRequest) (*Page, error) {
+	return paginate(mock, fakePaginationSecret, dbc, query, params, request)
+}
+
+// Notify
+
+// Notifications are patched as an Execute of pg_notify with the channel and the payload as params.
+
+// PatchNotify patch for Notify function
+func (mock *Mock) PatchNotify(inputDBC *DBContext, inputChannel string, inputPayload string, outputError error) {
+	mock.PatchExecute(inputDBC, notifyQuery, []interface{}{inputChannel, inputPayload},
+		ParseMockDBResultAffectedRows(1), outputError)
+}
+
+// Notify mock for Notify function
+func (mock *Mock) Notify(dbc *DBContext, channel string, payload string) error {
+	_, err := mock.Execute(dbc, notifyQuery, channel, payload)
+	return err
+}
+
+// PatchNotifyContext patch for NotifyContext function
+func (mock *Mock) PatchNotifyContext(ctx context.Context, inputDBC *DBContext, inputChannel string,
+	inputPayload string, outputError error) {
+	mock.PatchNotify(inputDBC, inputChannel, inputPayload, outputError)
+}
+
+// NotifyContext mock for NotifyContext function
+func (mock *Mock) NotifyContext(ctx context.Context, dbc *DBContext, channel string, payload string) error {
+	return mock.Notify(dbc, channel, payload)
+}
+
+// Advisory locks
+
+// The advisory locks are patched as an Execute of their query with the key as param. A lock that
+// is acquired affects one row.
+
+// lockAffectedRows returns the affected rows of an Execute that acquires a lock or not
+func lockAffectedRows(locked bool) int64 {
+	if locked {
+		return 1
+	}
+	return 0
+}
+
+// PatchTryLock patch for TryLock function
+func (mock *Mock) PatchTryLock(inputDBC *DBContext, inputKey LockKey, outputLocked bool, outputError error) {
+	mock.PatchExecute(inputDBC, tryLockQuery, []interface{}{int64(inputKey)},
+		ParseMockDBResultAffectedRows(lockAffectedRows(outputLocked)), outputError)
+}
+
+// TryLock mock for TryLock function
+func (mock *Mock) TryLock(dbc *DBContext, key LockKey) (bool, error) {
+	dbr, err := mock.Execute(dbc, tryLockQuery, int64(key))
+	if err != nil {
+		return false, err
+	}
+	return dbr.AffectedRows() == 1, nil
+}
+
+// PatchLock patch for Lock function
+func (mock *Mock) PatchLock(inputDBC *DBContext, inputKey LockKey, outputError error) {
+	mock.PatchExecute(inputDBC, lockQuery, []interface{}{int64(inputKey)},
+		ParseMockDBResultAffectedRows(1), outputError)
+}
+
+// Lock mock for Lock function
+func (mock *Mock) Lock(dbc *DBContext, key LockKey) error {
+	_, err := mock.Execute(dbc, lockQuery, int64(key))
+	return err
+}
+
+// PatchUnlock patch for Unlock function
+func (mock *Mock) PatchUnlock(inputDBC *DBContext, inputKey LockKey, outputError error) {
+	mock.PatchExecute(inputDBC, unlockQuery, []interface{}{int64(inputKey)},
+		ParseMockDBResultAffectedRows(1), outputError)
+}
+
+// Unlock mock for Unlock function
+func (mock *Mock) Unlock(dbc *DBContext, key LockKey) error {
+	_, err := mock.Execute(dbc, unlockQuery, int64(key))
+	return err
+}
+
+// PatchTryLockXact patch for TryLockXact function
+func (mock *Mock) PatchTryLockXact(inputDBC *DBContext, inputKey LockKey, outputLocked bool, outputError error) {
+	mock.PatchExecute(inputDBC, tryLockXactQuery, []interface{}{int64(inputKey)},
+		ParseMockDBResultAffectedRows(lockAffectedRows(outputLocked)), outputError)
+}
+
+// TryLockXact mock for TryLockXact function
+func (mock *Mock) TryLockXact(dbc *DBContext, key LockKey) (bool, error) {
+	dbr, err := mock.Execute(dbc, tryLockXactQuery, int64(key))
+	if err != nil {
+		return false, err
+	}
+	return dbr.AffectedRows() == 1, nil
+}
+
+// PatchLockXact patch for LockXact function
+func (mock *Mock) PatchLockXact(inputDBC *DBContext, inputKey LockKey, outputError error) {
+	mock.PatchExecute(inputDBC, lockXactQuery, []interface{}{int64(inputKey)},
+		ParseMockDBResultAffectedRows(1), outputError)
+}
+
+// LockXact mock for LockXact function
+func (mock *Mock) LockXact(dbc *DBContext, key LockKey) error {
+	_, err := mock.Execute(dbc, lockXactQuery, int64(key))
+	return err
+}
+
+// WithLock mock for WithLock function, it needs Lock and Unlock to be patched
+func (mock *Mock) WithLock(key LockKey, fn func(dbc *DBContext) error) error {
+	dbc := &DBContext{}
+	err := mock.Lock(dbc, key)
+	if err != nil {
+		return err
+	}
+
+	err = fn(dbc)
+	unlockErr := mock.Unlock(dbc, key)
+	if err == nil && unlockErr != nil {
+		err = fmt.Errorf("unlock %d: %w", key, unlockErr)
+	}
+	return err
+}
+
+// WithLockContext mock for WithLockContext function, it needs Lock and Unlock to be patched
+func (mock *Mock) WithLockContext(ctx context.Context, key LockKey, fn func(dbc *DBContext) error) error {
+	return mock.WithLock(key, fn)
+}
+
+// Lifecycle
+
+// PatchReady patch for Ready function
+func (mock *Mock) PatchReady(outputError error) {
+	mock.patchReadyOutputs = append(mock.patchReadyOutputs, outputError)
+}
+
+// Ready mock for Ready function
+func (mock *Mock) Ready(ctx context.Context) error {
+	if len(mock.patchReadyOutputs) == 0 {
+		panic("Mock not available for Database.Ready()")
+	}
+
+	output := mock.patchReadyOutputs[0]
+	mock.patchReadyOutputs = mock.patchReadyOutputs[1:]
+
+	// done
+	return output
+}
+
+// PatchShutdown patch for Shutdown function
+func (mock *Mock) PatchShutdown(outputError error) {
+	mock.patchShutdownOutputs = append(mock.patchShutdownOutputs, outputError)
+}
+
+// Shutdown mock for Shutdown function
+func (mock *Mock) Shutdown(ctx context.Context) error {
+	if len(mock.patchShutdownOutputs) == 0 {
+		panic("Mock not available for Database.Shutdown()")
+	}
+
+	output := mock.patchShutdownOutputs[0]
+	mock.patchShutdownOutputs = mock.patchShutdownOutputs[1:]
+
+	// done
+	return output
+}
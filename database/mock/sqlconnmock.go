@@ -36,9 +36,18 @@ func (mock *SQLConnMock) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql
 	panic("TODO: Implement mock for sql.conn.BeginTx")
 }
 
+// PatchExecContext patches the funcion ExecContext
+func (mock *SQLConnMock) PatchExecContext(ctx context.Context, query string, args []interface{},
+	outputResult sql.Result, outputErr error) {
+	mock.On("ExecContext", ctx, query, args).Return(outputResult, outputErr).Once()
+}
+
 // ExecContext mocks the real implementation of ExecContext for the database/sql/conn
 func (mock *SQLConnMock) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	panic("TODO: Implement mock for sql.conn.ExecContext")
+	mockArgs := mock.Called(ctx, query, args)
+	result, _ := mockArgs.Get(0).(sql.Result)
+	err, _ := mockArgs.Get(1).(error)
+	return result, err
 }
 
 // PingContext mocks the real implementation of PingContext for the database/sql/conn
@@ -51,9 +60,18 @@ func (mock *SQLConnMock) PrepareContext(ctx context.Context, query string) (*sql
 	panic("TODO: Implement mock for sql.conn.PrepareContext")
 }
 
+// PatchQueryContext patches the funcion QueryContext
+func (mock *SQLConnMock) PatchQueryContext(ctx context.Context, query string, args []interface{},
+	outputRows *sql.Rows, outputErr error) {
+	mock.On("QueryContext", ctx, query, args).Return(outputRows, outputErr).Once()
+}
+
 // QueryContext mocks the real implementation of QueryContext for the database/sql/conn
 func (mock *SQLConnMock) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
-	panic("TODO: Implement mock for sql.conn.QueryContext")
+	mockArgs := mock.Called(ctx, query, args)
+	rows, _ := mockArgs.Get(0).(*sql.Rows)
+	err, _ := mockArgs.Get(1).(error)
+	return rows, err
 }
 
 // QueryRowContext mocks the real implementation of QueryRowContext for the database/sql/conn
@@ -61,7 +79,14 @@ func (mock *SQLConnMock) QueryRowContext(ctx context.Context, query string, args
 	panic("TODO: Implement mock for sql.conn.QueryRowContext")
 }
 
+// PatchRaw patches the funcion Raw, f is not called
+func (mock *SQLConnMock) PatchRaw(outputErr error) {
+	mock.On("Raw").Return(outputErr).Once()
+}
+
 // Raw mocks the real implementation of Raw for the database/sql/conn
 func (mock *SQLConnMock) Raw(f func(driverConn interface{}) error) (err error) {
-	panic("TODO: Implement mock for sql.conn.Raw")
+	args := mock.Called()
+	err, _ = args.Get(0).(error)
+	return err
 }
@@ -143,3 +143,35 @@ func Test_Conn_PatchRaw_Panic(t *testing.T) {
 		mock.Raw(nil)
 	})
 }
+
+func Test_Conn_PatchExecContext_Success(t *testing.T) {
+	// given
+	assert := assert.New(t)
+
+	mock := sqlmock.NewConnMockService()
+	resultMock := sqlmock.NewResultMockService()
+	ctx := context.Background()
+	args := []interface{}{int64(1)}
+
+	// when
+	mock.PatchExecContext(ctx, "SELECT pg_advisory_lock($1)", args, resultMock, nil)
+	result, err := mock.ExecContext(ctx, "SELECT pg_advisory_lock($1)", args...)
+
+	// then
+	assert.Nil(err)
+	assert.Equal(resultMock, result)
+}
+
+func Test_Conn_PatchRaw_Success(t *testing.T) {
+	// given
+	assert := assert.New(t)
+
+	mock := sqlmock.NewConnMockService()
+
+	// when
+	mock.PatchRaw(nil)
+	err := mock.Raw(nil)
+
+	// then
+	assert.Nil(err)
+}
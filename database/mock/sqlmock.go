@@ -158,9 +158,18 @@ func (mock *SQLMock) QueryRow(query string, args ...interface{}) (*sql.Row, erro
 	panic("TODO: Implement mock for sql.db.QueryRow")
 }
 
+// PatchQueryRowContext patches the funcion QueryRowContext
+func (mock *SQLMock) PatchQueryRowContext(ctx context.Context, query string, args []interface{},
+	row *sql.Row, outputErr error) {
+	mock.On("QueryRowContext", ctx, query, args).Return(row, outputErr).Once()
+}
+
 // QueryRowContext mocks the real implementation of QueryRowContext for the database/sql
 func (mock *SQLMock) QueryRowContext(ctx context.Context, query string, args ...interface{}) (*sql.Row, error) {
-	panic("TODO: Implement mock for sql.db.QueryRowContext")
+	argsMock := mock.Called(ctx, query, args)
+	row, _ := argsMock.Get(0).(*sql.Row)
+	err, _ := argsMock.Get(1).(error)
+	return row, err
 }
 
 // SetConnMaxLifetime mocks the real implementation of SetConnMaxLifetime for the database/sql
@@ -67,14 +67,29 @@ func (mock *SQLRowsMock) Scan(dest ...interface{}) error {
 	return err
 }
 
+// PatchColumnTypes patches the funcion ColumnTypes
+func (mock *SQLRowsMock) PatchColumnTypes(colTypes []*sql.ColumnType, outputErr error) {
+	mock.On("ColumnTypes").Return(colTypes, outputErr).Once()
+}
+
 // ColumnTypes mocks the real implementation of ColumnTypes for the database/sql/rows
 func (mock *SQLRowsMock) ColumnTypes() ([]*sql.ColumnType, error) {
-	panic("TODO: Implement mock for sql.rows.ColumnTypes")
+	args := mock.Called()
+	colTypes, _ := args.Get(0).([]*sql.ColumnType)
+	err, _ := args.Get(1).(error)
+	return colTypes, err
+}
+
+// PatchErr patches the funcion Err
+func (mock *SQLRowsMock) PatchErr(outputErr error) {
+	mock.On("Err").Return(outputErr).Once()
 }
 
 // Err mocks the real implementation of Err for the database/sql/rows
 func (mock *SQLRowsMock) Err() error {
-	panic("TODO: Implement mock for sql.rows.Err")
+	args := mock.Called()
+	err, _ := args.Get(0).(error)
+	return err
 }
 
 // NextResultSet mocks the real implementation of NextResultSet for the database/sql/rows
@@ -1,6 +1,7 @@
 package sqlmock_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -136,6 +137,20 @@ func Test_Rows_PatchColumnTypes_Panic(t *testing.T) {
 	})
 }
 
+func Test_Rows_PatchErr_Success(t *testing.T) {
+	// given
+	assert := assert.New(t)
+
+	mock := sqlmock.NewRowsMockService()
+
+	// when
+	mock.PatchErr(errors.New("rows error"))
+	err := mock.Err()
+
+	// then
+	assert.EqualError(err, "rows error")
+}
+
 func Test_Rows_PatchErr_Panic(t *testing.T) {
 	// given
 	assert := assert.New(t)
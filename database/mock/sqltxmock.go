@@ -64,9 +64,18 @@ func (mock *SQLTxMock) Exec(query string, args ...interface{}) (sql.Result, erro
 	panic("TODO: Implement mock for sql.tx.Exec")
 }
 
+// PatchExecContext patches the funcion ExecContext
+func (mock *SQLTxMock) PatchExecContext(ctx context.Context, query string, args []interface{},
+	result sql.Result, outputErr error) {
+	mock.On("ExecContext", ctx, query, args).Return(result, outputErr).Once()
+}
+
 // ExecContext mocks the real implementation of ExecContext for the database/sql/tx
 func (mock *SQLTxMock) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
-	panic("TODO: Implement mock for sql.tx.ExecContext")
+	argsMock := mock.Called(ctx, query, args)
+	result, _ := argsMock.Get(0).(sql.Result)
+	err, _ := argsMock.Get(1).(error)
+	return result, err
 }
 
 // Prepare mocks the real implementation of Prepare for the database/sql/tx
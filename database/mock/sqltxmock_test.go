@@ -112,6 +112,23 @@ func Test_Tx_PatchExec_Panic(t *testing.T) {
 	})
 }
 
+func Test_Tx_PatchExecContext_Success(t *testing.T) {
+	// given
+	assert := assert.New(t)
+
+	mock := sqlmock.NewTxMockService()
+	result := sqlmock.NewResultMockService()
+	ctx := context.Background()
+
+	// when
+	mock.PatchExecContext(ctx, "SAVEPOINT sp_1", nil, result, nil)
+	out, err := mock.ExecContext(ctx, "SAVEPOINT sp_1")
+
+	// then
+	assert.NotNil(out)
+	assert.Nil(err)
+}
+
 func Test_Tx_PatchExecContext_Panic(t *testing.T) {
 	// given
 	assert := assert.New(t)
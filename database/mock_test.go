@@ -1,6 +1,7 @@
 package database_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"testing"
@@ -681,9 +682,180 @@ func Test_Mock_ExecuteEnsuringOneAffectedRow_ReturnsTwoRows_ForcedForTest_WithEr
 
 //
 
+func Test_Mock_Database_SelectContext_SharesPatchWithSelect(t *testing.T) {
+	// Given
+	assertions, mockService := buildMockDependencies(t)
+	ctx := context.Background()
+
+	// When
+	dbc := &database.DBContext{}
+	params := []interface{}{}
+	mockedDBR := database.ParseMockDBResultFromJSON(`[{"one":1}]`)
+	mockService.PatchSelectContext(ctx, dbc, selectStmt, false, params, mockedDBR, nil)
+
+	dbr, err := mockService.SelectContext(ctx, dbc, selectStmt, false, params...)
+
+	// Then
+	assertions.Nil(err)
+	assertions.Len(dbr.GetRows(), 1)
+	assertions.Panics(func() { mockService.Select(dbc, selectStmt, false, params...) })
+}
+
+func Test_Mock_Database_ExecuteContextWithErrorMocked_ShouldProcess_WithError(t *testing.T) {
+	// Given
+	assertions, mockService := buildMockDependencies(t)
+	ctx := context.Background()
+
+	// When
+	dbc := &database.DBContext{}
+	params := []interface{}{1, 2}
+	mockedError := errors.New("test error")
+	mockService.PatchExecuteContext(ctx, dbc, updateStmt, params, nil, mockedError)
+
+	dbr, err := mockService.ExecuteContext(ctx, dbc, updateStmt, params...)
+
+	// Then
+	assertions.Nil(dbr)
+	assertions.EqualError(err, mockedError.Error())
+}
+
+func Test_Mock_Database_WithTransactionContext_ShouldCommit(t *testing.T) {
+	// Given
+	assertions, mockService := buildMockDependencies(t)
+	ctx := context.Background()
+
+	// When
+	dbc := &database.DBContext{}
+	mockService.PatchBeginContext(ctx, nil, dbc, nil)
+	mockService.PatchCommit(dbc, nil)
+
+	err := mockService.WithTransactionContext(ctx, func(dbc *database.DBContext) error { return nil })
+
+	// Then
+	assertions.Nil(err)
+}
+
+//
+
 func buildMockDependencies(t *testing.T) (*assert.Assertions, *database.Mock) {
 	assertions := assert.New(t)
 	service := database.NewMock()
 
 	return assertions, service
 }
+
+func Test_Mock_Database_SelectStream_ShouldIterateMockedRows(t *testing.T) {
+	// Given
+	assertions, mockService := buildMockDependencies(t)
+
+	// When
+	dbc := &database.DBContext{}
+	params := []interface{}{1}
+	mockedDBR := database.ParseMockDBResultFromJSON(`[{"one":1},{"one":2}]`)
+	mockService.PatchSelectStream(dbc, selectStmt, params, mockedDBR, nil)
+
+	iterator, err := mockService.SelectStream(dbc, selectStmt, params...)
+	assertions.Nil(err)
+	values := make([]float64, 0)
+	for iterator.Next() {
+		value, _ := iterator.Row().GetFloat64ByNameRequired("one")
+		values = append(values, value)
+	}
+
+	// Then
+	assertions.Nil(iterator.Err())
+	assertions.Nil(iterator.Close())
+	assertions.Equal([]float64{1, 2}, values)
+}
+
+func Test_Mock_Database_SelectCursorWithErrorMocked_ShouldProcess_WithError(t *testing.T) {
+	// Given
+	assertions, mockService := buildMockDependencies(t)
+
+	// When
+	dbc := &database.DBContext{}
+	params := []interface{}{}
+	mockedError := errors.New("test error")
+	mockService.PatchSelectCursor(dbc, selectStmt, params, nil, mockedError)
+
+	iterator, err := mockService.SelectCursor(dbc, selectStmt, 100, params...)
+
+	// Then
+	assertions.Nil(iterator)
+	assertions.EqualError(err, mockedError.Error())
+}
+
+func Test_Mock_Database_BulkInsert_ShouldReturnMockedResult(t *testing.T) {
+	// Given
+	assertions, mockService := buildMockDependencies(t)
+
+	// When
+	dbc := &database.DBContext{}
+	columns := []string{"one", "two"}
+	rows := [][]interface{}{{1, "a"}, {2, "b"}}
+	mockService.PatchBulkInsert(dbc, "test", columns, rows, database.ParseMockDBResultAffectedRows(2), nil)
+
+	dbr, err := mockService.BulkInsert(dbc, "test", columns, rows)
+
+	// Then
+	assertions.Nil(err)
+	assertions.Equal(int64(2), dbr.AffectedRows())
+	assertions.Panics(func() { mockService.BulkInsert(dbc, "test", columns, rows) })
+}
+
+func Test_Mock_Database_Notify_ShouldReturnMockedError(t *testing.T) {
+	// Given
+	assertions, mockService := buildMockDependencies(t)
+
+	// When
+	dbc := &database.DBContext{}
+	mockService.PatchNotify(dbc, "orders", "1", nil)
+	mockService.PatchNotify(dbc, "orders", "2", errors.New("forced for test"))
+
+	err1 := mockService.Notify(dbc, "orders", "1")
+	err2 := mockService.Notify(dbc, "orders", "2")
+
+	// Then
+	assertions.Nil(err1)
+	assertions.EqualError(err2, "forced for test")
+	assertions.Panics(func() { mockService.Notify(dbc, "orders", "1") })
+}
+
+func Test_Mock_Database_WithLock_ShouldLockAndUnlock(t *testing.T) {
+	// Given
+	assertions, mockService := buildMockDependencies(t)
+
+	// When
+	dbc := &database.DBContext{}
+	key := database.StringLockKey("billing-cron")
+	mockService.PatchLock(dbc, key, nil)
+	mockService.PatchUnlock(dbc, key, nil)
+	mockService.PatchTryLock(dbc, key, false, nil)
+
+	err := mockService.WithLock(key, func(dbc *database.DBContext) error { return nil })
+	locked, tryErr := mockService.TryLock(dbc, key)
+
+	// Then
+	assertions.Nil(err)
+	assertions.Nil(tryErr)
+	assertions.False(locked)
+	assertions.Panics(func() { mockService.Unlock(dbc, key) })
+}
+
+func Test_Mock_Database_Shutdown_ShouldReturnMockedError(t *testing.T) {
+	// Given
+	assertions, mockService := buildMockDependencies(t)
+	ctx := context.Background()
+
+	// When
+	mockService.PatchReady(nil)
+	mockService.PatchShutdown(errors.New("forced for test"))
+
+	readyErr := mockService.Ready(ctx)
+	shutdownErr := mockService.Shutdown(ctx)
+
+	// Then
+	assertions.Nil(readyErr)
+	assertions.EqualError(shutdownErr, "forced for test")
+	assertions.Panics(func() { mockService.Ready(ctx) })
+}
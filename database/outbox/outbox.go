@@ -0,0 +1,113 @@
+// Package outbox publishes events reliably together with the writes of a transaction. Enqueue
+// inserts the event into the outbox table in the transaction of the caller, so it's only
+// published if the transaction commits, and a Relay publishes the pending events afterwards.
+// Delivery is at least once: an event can be published again if the relay fails to record it
+// as sent before its lease expires, so consumers must be idempotent.
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+	"github.com/lib/pq"
+)
+
+const (
+	// DefaultTable is the table where the events are stored
+	DefaultTable = "outbox"
+)
+
+var (
+	// ErrNoTransaction is returned by Enqueue when the DBContext has no active transaction
+	ErrNoTransaction = errors.New("outbox_no_transaction")
+)
+
+type (
+	// Outbox stores the events to publish in a table
+	Outbox struct {
+		db    database.Database
+		table string
+	}
+
+	// Option configures an Outbox
+	Option func(box *Outbox)
+
+	// Event is an event stored in the outbox
+	Event struct {
+		ID        int64             `db:"id"`
+		Topic     string            `db:"topic"`
+		Payload   []byte            `db:"payload"`
+		Headers   map[string]string `db:"headers"`
+		Attempts  int               `db:"attempts"`
+		CreatedAt time.Time         `db:"created_at"`
+	}
+)
+
+// WithTable sets the table where the events are stored, it can be qualified with its schema
+func WithTable(table string) Option {
+	return func(box *Outbox) {
+		box.table = table
+	}
+}
+
+// New returns an Outbox that stores its events with db
+func New(db database.Database, opts ...Option) *Outbox {
+	box := &Outbox{
+		db:    db,
+		table: DefaultTable,
+	}
+	for _, opt := range opts {
+		opt(box)
+	}
+	return box
+}
+
+// CreateTable creates the outbox table and its index if they don't exist
+func (box *Outbox) CreateTable(dbc *database.DBContext) error {
+	table := database.QuoteTable(box.table)
+	_, err := box.db.Execute(dbc, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id BIGSERIAL PRIMARY KEY, "+
+		"topic TEXT NOT NULL, payload BYTEA NOT NULL, headers JSONB NOT NULL DEFAULT '{}', "+
+		"created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), attempts INT NOT NULL DEFAULT 0, "+
+		"next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), last_error TEXT, sent_at TIMESTAMPTZ, "+
+		"failed_at TIMESTAMPTZ)", table))
+	if err != nil {
+		return err
+	}
+
+	_, err = box.db.Execute(dbc, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (next_attempt_at) "+
+		"WHERE sent_at IS NULL AND failed_at IS NULL", pq.QuoteIdentifier(indexName(box.table)), table))
+	return err
+}
+
+// Enqueue stores the event in the transaction of dbc and returns its id. It's published by a
+// Relay once the transaction commits, and discarded if it's rolled back.
+func (box *Outbox) Enqueue(dbc *database.DBContext, topic string, payload []byte,
+	headers map[string]string) (int64, error) {
+	if !dbc.InTransaction() {
+		return 0, ErrNoTransaction
+	}
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	encodedHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return 0, err
+	}
+
+	row, err := box.db.SelectUniqueValueNonEmpty(dbc,
+		fmt.Sprintf("INSERT INTO %s (topic, payload, headers) VALUES ($1, $2, $3) RETURNING id",
+			database.QuoteTable(box.table)), false, topic, payload, string(encodedHeaders))
+	if err != nil {
+		return 0, err
+	}
+	return row.GetInt64ByNameRequired("id")
+}
+
+// indexName returns the name of the index of the pending events of the table
+func indexName(table string) string {
+	return strings.ReplaceAll(table, ".", "_") + "_pending"
+}
@@ -0,0 +1,70 @@
+package outbox
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+)
+
+const (
+	insertStmt string = `INSERT INTO "outbox" (topic, payload, headers) VALUES ($1, $2, $3) RETURNING id`
+)
+
+func Test_Outbox_Enqueue(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	box := New(fake)
+	fake.OnSelect(database.QueryEquals(insertStmt)).
+		WithParams("orders.created", []byte(`{"id":7}`), `{"X-Tenant":"acme"}`).
+		Return(database.ParseMockDBResultFromArrRowsMap([]map[string]interface{}{{"id": int64(12)}}))
+
+	// when
+	var id int64
+	err := fake.WithTransaction(func(dbc *database.DBContext) (err error) {
+		id, err = box.Enqueue(dbc, "orders.created", []byte(`{"id":7}`), map[string]string{"X-Tenant": "acme"})
+		return err
+	})
+
+	// then
+	ass.Nil(err)
+	ass.Equal(int64(12), id)
+	ass.Equal(1, fake.CallsTo("SelectUniqueValueNonEmpty")[0].TxID)
+	ass.True(fake.AssertExpectations(t))
+}
+
+func Test_Outbox_Enqueue_Without_Transaction(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	box := New(fake)
+	dbc, _ := fake.Connection()
+
+	// when
+	_, nilErr := box.Enqueue(nil, "orders.created", nil, nil)
+	_, connErr := box.Enqueue(dbc, "orders.created", nil, nil)
+
+	// then
+	ass.Equal(ErrNoTransaction, nilErr)
+	ass.Equal(ErrNoTransaction, connErr)
+	ass.Empty(fake.CallsTo("SelectUniqueValueNonEmpty"))
+}
+
+func Test_Outbox_CreateTable(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	box := New(fake, WithTable("events.outbox"))
+	fake.OnExecute(database.QueryMatches(`^CREATE TABLE IF NOT EXISTS "events"\."outbox" \(`)).Return(nil)
+	fake.OnExecute(database.QueryEquals(`CREATE INDEX IF NOT EXISTS "events_outbox_pending" ON "events"."outbox" ` +
+		`(next_attempt_at) WHERE sent_at IS NULL AND failed_at IS NULL`)).Return(nil)
+
+	// when
+	err := box.CreateTable(nil)
+
+	// then
+	ass.Nil(err)
+	ass.True(fake.AssertExpectations(t))
+}
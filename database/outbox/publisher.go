@@ -0,0 +1,75 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/flat"
+	"github.com/FlatDigital/core-go-toolkit/v2/rest"
+)
+
+const (
+	// EventIDHeader is the header with the id of the event sent by RestPublisher, so the consumer
+	// can discard the events it already received
+	EventIDHeader = "X-Outbox-Event-Id"
+)
+
+type (
+	// Publisher delivers the events of the outbox to their destination
+	Publisher interface {
+		Publish(ctx context.Context, event Event) error
+	}
+
+	// PublisherFunc is a function that implements Publisher
+	PublisherFunc func(ctx context.Context, event Event) error
+
+	// RestPublisher publishes the events with a POST of their payload
+	RestPublisher struct {
+		client rest.Rest
+		url    func(event Event) string
+	}
+)
+
+// Publish implements Publisher
+func (fn PublisherFunc) Publish(ctx context.Context, event Event) error {
+	return fn(ctx, event)
+}
+
+// NewRestPublisher returns a Publisher that POSTs the payload of every event to the url returned
+// for it, with the headers of the event and EventIDHeader. Responses other than 2xx are failures.
+// If the client implements rest.ContextRest, as the one of rest.NewRestyService does, the request
+// is aborted when the ctx of Publish is done.
+func NewRestPublisher(client rest.Rest, url func(event Event) string) *RestPublisher {
+	return &RestPublisher{
+		client: client,
+		url:    url,
+	}
+}
+
+// Publish implements Publisher
+func (publisher *RestPublisher) Publish(ctx context.Context, event Event) error {
+	headers := http.Header{}
+	for key, value := range event.Headers {
+		headers.Set(key, value)
+	}
+	headers.Set(EventIDHeader, strconv.FormatInt(event.ID, 10))
+
+	url := publisher.url(event)
+	fctx := &flat.Context{Ctx: ctx}
+	post := publisher.client.MakePostRequest
+	if client, ok := publisher.client.(rest.ContextRest); ok {
+		post = client.MakePostRequestWithContext
+	}
+	statusCode, _, _, err := post(fctx, url, event.Payload, headers)
+	if err != nil {
+		return err
+	}
+	if statusCode < http.StatusOK || statusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("publish event %d to %s: status %d", event.ID, url, statusCode)
+	}
+
+	// done
+	return nil
+}
@@ -0,0 +1,75 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/flat"
+	"github.com/FlatDigital/core-go-toolkit/v2/rest"
+)
+
+func Test_RestPublisher_Publish(t *testing.T) {
+	tt := []struct {
+		Name          string
+		StatusCode    int
+		ExpectedError string
+	}{
+		{"Accepted", http.StatusAccepted, ""},
+		{"Server error", http.StatusInternalServerError,
+			"publish event 7 to http://orders/events/orders.created: status 500"},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// given
+			ass := assert.New(t)
+			ctx := context.Background()
+			client := rest.NewMock()
+			publisher := NewRestPublisher(client, func(event Event) string {
+				return "http://orders/events/" + event.Topic
+			})
+			event := Event{ID: 7, Topic: "orders.created", Payload: []byte(`{"id":7}`),
+				Headers: map[string]string{"Content-Type": "application/json"}}
+			headers := http.Header{}
+			headers.Set("Content-Type", "application/json")
+			headers.Set(EventIDHeader, "7")
+
+			// when
+			client.PatchMakePostRequest(&flat.Context{Ctx: ctx}, "http://orders/events/orders.created",
+				event.Payload, headers, tc.StatusCode, nil, nil, nil)
+			err := publisher.Publish(ctx, event)
+
+			// then
+			if tc.ExpectedError == "" {
+				ass.Nil(err)
+			} else {
+				ass.EqualError(err, tc.ExpectedError)
+			}
+		})
+	}
+}
+
+func Test_RestPublisher_Publish_Cancelled(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	publisher := NewRestPublisher(rest.NewRestyService("test"), func(event Event) string {
+		return server.URL
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// when
+	cancel()
+	err := publisher.Publish(ctx, Event{ID: 7, Topic: "orders.created", Payload: []byte(`{"id":7}`)})
+
+	// then
+	ass.True(errors.Is(err, context.Canceled))
+}
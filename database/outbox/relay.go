@@ -0,0 +1,281 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+	"github.com/FlatDigital/core-go-toolkit/v2/godog"
+)
+
+const (
+	// DefaultBatchSize is how many events a Relay claims at once
+	DefaultBatchSize = 100
+	// DefaultPollInterval is how often a Relay looks for pending events
+	DefaultPollInterval = time.Second
+	// DefaultVisibilityTimeout is how long a claimed batch is leased to a Relay
+	DefaultVisibilityTimeout = time.Minute
+)
+
+var (
+	// DefaultRetryPolicy is how a Relay retries the events it fails to publish, after the retries
+	// the events are marked as failed and never published
+	DefaultRetryPolicy = database.RetryPolicy{
+		MaxRetries:     10,
+		InitialBackoff: time.Second,
+		MaxBackoff:     10 * time.Minute,
+		Multiplier:     2,
+	}
+)
+
+type (
+	// Relay publishes the pending events of an Outbox. Several relays can run at the same time,
+	// every event is claimed by only one of them.
+	Relay struct {
+		outbox            *Outbox
+		publisher         Publisher
+		batchSize         int
+		pollInterval      time.Duration
+		visibilityTimeout time.Duration
+		retryPolicy       database.RetryPolicy
+		metricPrefix      string
+
+		startOnce sync.Once
+		stopOnce  sync.Once
+		stop      chan struct{}
+		done      chan struct{}
+		cancel    context.CancelFunc
+	}
+
+	// RelayOption configures a Relay
+	RelayOption func(relay *Relay)
+)
+
+// WithBatchSize sets how many events are claimed at once
+func WithBatchSize(size int) RelayOption {
+	return func(relay *Relay) {
+		relay.batchSize = size
+	}
+}
+
+// WithPollInterval sets how often the pending events are polled. A full batch is followed by the
+// next one without waiting.
+func WithPollInterval(interval time.Duration) RelayOption {
+	return func(relay *Relay) {
+		relay.pollInterval = interval
+	}
+}
+
+// WithVisibilityTimeout sets how long a claimed batch is leased. The events not published by then
+// are left to be claimed again.
+func WithVisibilityTimeout(timeout time.Duration) RelayOption {
+	return func(relay *Relay) {
+		relay.visibilityTimeout = timeout
+	}
+}
+
+// WithRetryPolicy sets the backoff between the attempts to publish an event and how many times
+// it's retried before it's marked as failed
+func WithRetryPolicy(policy database.RetryPolicy) RelayOption {
+	return func(relay *Relay) {
+		relay.retryPolicy = policy
+	}
+}
+
+// WithMetricPrefix sets the prefix of the metrics, by default the APPLICATION environment variable
+func WithMetricPrefix(prefix string) RelayOption {
+	return func(relay *Relay) {
+		relay.metricPrefix = prefix
+	}
+}
+
+// NewRelay returns a Relay that publishes the events of outbox with publisher
+func NewRelay(outbox *Outbox, publisher Publisher, opts ...RelayOption) *Relay {
+	relay := &Relay{
+		outbox:            outbox,
+		publisher:         publisher,
+		batchSize:         DefaultBatchSize,
+		pollInterval:      DefaultPollInterval,
+		visibilityTimeout: DefaultVisibilityTimeout,
+		retryPolicy:       DefaultRetryPolicy,
+		metricPrefix:      os.Getenv("APPLICATION"),
+		stop:              make(chan struct{}),
+		done:              make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(relay)
+	}
+	if relay.batchSize <= 0 {
+		relay.batchSize = DefaultBatchSize
+	}
+	if relay.visibilityTimeout <= 0 {
+		relay.visibilityTimeout = DefaultVisibilityTimeout
+	}
+	return relay
+}
+
+// Start polls and publishes the pending events in background until Stop is called
+func (relay *Relay) Start() {
+	relay.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		relay.cancel = cancel
+		go relay.run(ctx)
+	})
+}
+
+// Stop stops polling and waits for the batch being published. If ctx is done first, the batch is
+// cancelled and ctx.Err() is returned.
+func (relay *Relay) Stop(ctx context.Context) error {
+	// A relay that never started has nothing to wait for
+	relay.startOnce.Do(func() {
+		close(relay.done)
+	})
+	relay.stopOnce.Do(func() {
+		close(relay.stop)
+	})
+
+	select {
+	case <-relay.done:
+		return nil
+	case <-ctx.Done():
+		if relay.cancel != nil {
+			relay.cancel()
+		}
+		<-relay.done
+		return ctx.Err()
+	}
+}
+
+// run polls until stop is closed
+func (relay *Relay) run(ctx context.Context) {
+	defer close(relay.done)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-relay.stop:
+			return
+		case <-timer.C:
+		}
+
+		wait := relay.pollInterval
+		claimed, err := relay.RunOnce(ctx)
+		if err != nil {
+			relay.recordMetric("relay.error", 1)
+		} else if claimed == relay.batchSize {
+			wait = 0
+		}
+		timer.Reset(wait)
+	}
+}
+
+// RunOnce claims a batch of pending events, publishes them and records the result of each one.
+// The batch is leased for the visibility timeout when it's claimed, so no transaction nor lock is
+// held while the events are published. It returns how many events were claimed.
+func (relay *Relay) RunOnce(ctx context.Context) (int, error) {
+	events, err := relay.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// The events not published before the lease expires are claimed again
+	ctx, cancel := context.WithTimeout(ctx, relay.visibilityTimeout)
+	defer cancel()
+	for _, event := range events {
+		if ctx.Err() != nil {
+			return len(events), ctx.Err()
+		}
+		if err := relay.publish(ctx, event); err != nil {
+			return len(events), err
+		}
+	}
+
+	// done
+	return len(events), nil
+}
+
+// claim leases up to a batch of pending events until the visibility timeout
+func (relay *Relay) claim(ctx context.Context) ([]Event, error) {
+	table := database.QuoteTable(relay.outbox.table)
+	dbr, err := relay.outbox.db.SelectContext(ctx, nil, fmt.Sprintf("UPDATE %s "+
+		"SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond' WHERE id IN (SELECT id FROM %s "+
+		"WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW() "+
+		"ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED) "+
+		"RETURNING id, topic, payload, headers, attempts, created_at", table, table),
+		false, relay.batchSize, relay.visibilityTimeout.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	events, err := database.ScanRowsInto[Event](dbr.GetRows())
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING doesn't keep the order of the subquery
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+// publish publishes the event and records if it was sent, has to be retried or failed. The result
+// is recorded even if ctx is done meanwhile, so a sent event isn't published again.
+func (relay *Relay) publish(ctx context.Context, event Event) error {
+	table := database.QuoteTable(relay.outbox.table)
+	publishErr := relay.publisher.Publish(ctx, event)
+	if publishErr == nil {
+		relay.recordMetric("published", 1, "topic", event.Topic)
+		relay.recordLag(event)
+		_, err := relay.outbox.db.Execute(nil, fmt.Sprintf(
+			"UPDATE %s SET sent_at = NOW(), attempts = attempts + 1, last_error = NULL WHERE id = $1", table),
+			event.ID)
+		return err
+	}
+
+	// The event is retried with a backoff, or marked as failed when it has no retries left
+	if event.Attempts >= relay.retryPolicy.MaxRetries {
+		relay.recordMetric("failed", 1, "topic", event.Topic, "dead", "true")
+		_, err := relay.outbox.db.Execute(nil, fmt.Sprintf(
+			"UPDATE %s SET failed_at = NOW(), attempts = attempts + 1, last_error = $2 WHERE id = $1", table),
+			event.ID, publishErr.Error())
+		return err
+	}
+
+	relay.recordMetric("failed", 1, "topic", event.Topic, "dead", "false")
+	backoff := relay.retryPolicy.Backoff(event.Attempts)
+	_, err := relay.outbox.db.Execute(nil, fmt.Sprintf(
+		"UPDATE %s SET next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond', attempts = attempts + 1, "+
+			"last_error = $2 WHERE id = $1", table),
+		event.ID, publishErr.Error(), backoff.Milliseconds())
+	return err
+}
+
+// recordMetric records a count metric of the outbox with the given tag keys and values
+func (relay *Relay) recordMetric(name string, value float64, tagPairs ...string) {
+	tags := new(godog.Tags).
+		Add("table", relay.outbox.table)
+	for i := 0; i+1 < len(tagPairs); i += 2 {
+		tags.Add(tagPairs[i], tagPairs[i+1])
+	}
+
+	godog.RecordSimpleMetric(fmt.Sprintf("application.%s.outbox.%s", relay.metricPrefix, name), value,
+		tags.ToArray()...)
+}
+
+// recordLag records how long the event waited in the outbox until it was published
+func (relay *Relay) recordLag(event Event) {
+	tags := new(godog.Tags).
+		Add("table", relay.outbox.table).
+		Add("topic", event.Topic).
+		Add("attempts", strconv.Itoa(event.Attempts+1)).
+		ToArray()
+
+	godog.RecordCompoundMetric(fmt.Sprintf("application.%s.outbox.lag", relay.metricPrefix),
+		float64(time.Since(event.CreatedAt))/float64(time.Millisecond), tags...)
+}
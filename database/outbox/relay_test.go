@@ -0,0 +1,150 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+)
+
+const (
+	claimStmt string = `UPDATE "outbox" SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond' ` +
+		`WHERE id IN (SELECT id FROM "outbox" WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW() ` +
+		`ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED) RETURNING id, topic, payload, headers, attempts, created_at`
+	sentStmt  string = `UPDATE "outbox" SET sent_at = NOW(), attempts = attempts + 1, last_error = NULL WHERE id = $1`
+	retryStmt string = `UPDATE "outbox" SET next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond', ` +
+		`attempts = attempts + 1, last_error = $2 WHERE id = $1`
+	deadStmt string = `UPDATE "outbox" SET failed_at = NOW(), attempts = attempts + 1, last_error = $2 WHERE id = $1`
+)
+
+// pendingEvents returns the claimed rows of the events with the given ids and attempts
+func pendingEvents(attempts map[int64]int) *database.DBResult {
+	rows := make([]map[string]interface{}, 0, len(attempts))
+	for id := int64(len(attempts)); id >= 1; id-- {
+		rows = append(rows, map[string]interface{}{
+			"id":         id,
+			"topic":      "orders.created",
+			"payload":    []byte(`{}`),
+			"headers":    []byte(`{"X-Tenant":"acme"}`),
+			"attempts":   int64(attempts[id]),
+			"created_at": time.Now().Add(-time.Second),
+		})
+	}
+	return database.ParseMockDBResultFromArrRowsMap(rows)
+}
+
+func Test_Relay_RunOnce(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	publishErr := errors.New("connection refused")
+	var published []Event
+	relay := NewRelay(New(fake), PublisherFunc(func(ctx context.Context, event Event) error {
+		published = append(published, event)
+		if event.ID == 1 {
+			return nil
+		}
+		return publishErr
+	}), WithBatchSize(10), WithRetryPolicy(database.RetryPolicy{MaxRetries: 3, InitialBackoff: time.Second, Multiplier: 2}))
+	fake.OnSelect(database.QueryEquals(claimStmt)).WithParams(10, DefaultVisibilityTimeout.Milliseconds()).
+		Return(pendingEvents(map[int64]int{1: 0, 2: 1, 3: 3}))
+	fake.OnExecute(database.QueryEquals(sentStmt)).WithParams(int64(1)).Return(nil)
+	fake.OnExecute(database.QueryEquals(retryStmt)).WithParams(int64(2), "connection refused",
+		database.ParamWhere("backoff between 1s and 2s", func(param interface{}) bool {
+			return param.(int64) >= 1000 && param.(int64) <= 2000
+		})).Return(nil)
+	fake.OnExecute(database.QueryEquals(deadStmt)).WithParams(int64(3), "connection refused").Return(nil)
+
+	// when
+	claimed, err := relay.RunOnce(context.Background())
+
+	// then
+	ass.Nil(err)
+	ass.Equal(3, claimed)
+	ass.Len(published, 3)
+	ass.Equal([]int64{1, 2, 3}, []int64{published[0].ID, published[1].ID, published[2].ID})
+	ass.Equal(map[string]string{"X-Tenant": "acme"}, published[0].Headers)
+	ass.True(fake.AssertExpectations(t))
+	// the batch is claimed and every result recorded in its own statement, without a transaction
+	ass.Empty(fake.Transactions())
+	ass.Len(fake.CallsTo("Execute"), 3)
+}
+
+func Test_Relay_RunOnce_Record_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	relay := NewRelay(New(fake), PublisherFunc(func(ctx context.Context, event Event) error {
+		return nil
+	}))
+	fake.OnSelect(database.QueryEquals(claimStmt)).Return(pendingEvents(map[int64]int{1: 0, 2: 0}))
+	fake.OnExecute(database.QueryEquals(sentStmt)).ReturnError(errors.New("connection reset by peer"))
+
+	// when
+	claimed, err := relay.RunOnce(context.Background())
+
+	// then
+	ass.Equal(2, claimed)
+	ass.EqualError(err, "connection reset by peer")
+	// the second event is left leased, to be claimed again
+	ass.Len(fake.CallsTo("Execute"), 1)
+}
+
+func Test_Relay_RunOnce_Visibility_Timeout(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	published := 0
+	relay := NewRelay(New(fake), PublisherFunc(func(ctx context.Context, event Event) error {
+		published++
+		<-ctx.Done()
+		return ctx.Err()
+	}), WithVisibilityTimeout(10*time.Millisecond))
+	fake.OnSelect(database.QueryEquals(claimStmt)).WithParams(DefaultBatchSize, int64(10)).
+		Return(pendingEvents(map[int64]int{1: 0, 2: 0}))
+	fake.OnExecute(database.QueryEquals(retryStmt)).Return(nil)
+
+	// when
+	claimed, err := relay.RunOnce(context.Background())
+
+	// then
+	ass.Equal(2, claimed)
+	ass.ErrorIs(err, context.DeadlineExceeded)
+	ass.Equal(1, published)
+	ass.True(fake.AssertExpectations(t))
+}
+
+func Test_Relay_Start_Stop(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	var mu sync.Mutex
+	published := 0
+	relay := NewRelay(New(fake), PublisherFunc(func(ctx context.Context, event Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		published++
+		return nil
+	}), WithBatchSize(1), WithPollInterval(time.Hour))
+	// a full batch is followed by the next one without waiting for the poll interval
+	fake.OnSelect(database.QueryEquals(claimStmt)).Return(pendingEvents(map[int64]int{1: 0}))
+	fake.OnSelect(database.QueryEquals(claimStmt)).Return(pendingEvents(map[int64]int{}))
+	fake.SetDefault(database.QueryOperationExecute, nil, nil)
+
+	// when
+	relay.Start()
+	ass.Eventually(func() bool {
+		return len(fake.CallsTo("SelectContext")) == 2
+	}, time.Second, time.Millisecond)
+	err := relay.Stop(context.Background())
+
+	// then
+	ass.Nil(err)
+	ass.Equal(1, published)
+	ass.Nil(NewRelay(New(fake), nil).Stop(context.Background()))
+}
@@ -0,0 +1,454 @@
+package database
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// PageModeOffset paginates with LIMIT and OFFSET
+	PageModeOffset PageMode = "offset"
+	// PageModeKeyset paginates from the sort keys of the last row of the previous page
+	PageModeKeyset PageMode = "keyset"
+
+	// DefaultPageLimit is the limit of a PageRequest without one
+	DefaultPageLimit = 20
+
+	// pageTotalColumn is the column of the COUNT(*) OVER() total, removed from the rows
+	pageTotalColumn = "_page_total"
+)
+
+var (
+	// ErrInvalidCursor is returned by Paginate when the cursor was modified, wasn't issued for the
+	// query or was signed with another secret
+	ErrInvalidCursor = errors.New("invalid_cursor")
+
+	errKeysetWithoutOrder = errors.New("keyset_pagination_without_order_by")
+
+	errPaginationSecretRequired = errors.New("pagination_secret_required")
+
+	// fakePaginationSecret signs the cursors of the Fake and the Mock, which have no ServiceConfig
+	fakePaginationSecret = newPaginationSecret()
+)
+
+type (
+	// PageMode is the kind of pagination of a PageRequest
+	PageMode string
+
+	// SortKey is a column of the ORDER BY of a page
+	SortKey struct {
+		// Column is the name of the column in the rows of the query. It's quoted as an identifier, so
+		// it must be the exact name of the column and not an expression.
+		Column string
+		Desc   bool
+	}
+
+	// PageRequest is the page to return from Paginate
+	PageRequest struct {
+		// Mode is PageModeOffset if empty
+		Mode PageMode
+		// Limit is the amount of rows of the page, DefaultPageLimit if it's not positive
+		Limit int
+		// Offset is the amount of rows skipped in PageModeOffset, when there's no Cursor
+		Offset int
+		// OrderBy sorts the rows. In PageModeKeyset it's required, the columns must not be NULL and
+		// the last one must be unique (e.g. the id). In PageModeOffset the ORDER BY of the query is
+		// used if it's empty.
+		OrderBy []SortKey
+		// Cursor is the NextCursor or PrevCursor of the previous page, empty for the first page
+		Cursor string
+		// WithTotal adds the amount of rows of the query to the page, with a COUNT(*) OVER()
+		WithTotal bool
+	}
+
+	// PageInfo describes a page and how to get the next and the previous ones
+	PageInfo struct {
+		Limit int `json:"limit"`
+		// Total is only set if the request was WithTotal and the page has rows or is the first one
+		Total      *int64 `json:"total,omitempty"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		PrevCursor string `json:"prev_cursor,omitempty"`
+	}
+
+	// Page is a page returned by Paginate, it can be the response of a list endpoint as is
+	Page struct {
+		Rows []map[string]interface{} `json:"rows"`
+		PageInfo
+
+		dbRows []DBRow
+	}
+
+	// PageOf is a page returned by PaginateInto
+	PageOf[T any] struct {
+		Items []T `json:"items"`
+		PageInfo
+	}
+
+	// pageCursor is the signed content of a cursor token
+	pageCursor struct {
+		// Query is the fingerprint of the query and the order the cursor was issued for
+		Query    uint64        `json:"q"`
+		Offset   int           `json:"o,omitempty"`
+		Keys     []interface{} `json:"k,omitempty"`
+		Backward bool          `json:"b,omitempty"`
+	}
+)
+
+// newPaginationSecret returns a random secret, the cursors signed with it are only valid in this process
+func newPaginationSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("cannot generate pagination secret: %v", err))
+	}
+	return secret
+}
+
+// DBRows returns the rows of the page
+func (page *Page) DBRows() []DBRow {
+	return page.dbRows
+}
+
+// Paginate runs query, with its params, and returns the page of its rows described by request. The
+// query is wrapped in a subquery, so it must not have LIMIT nor OFFSET, and in PageModeKeyset it must
+// not have ORDER BY either.
+//
+// The cursors of the page are opaque tokens, signed with the PaginationSecret of the config so they
+// can't be modified, and only valid for the same query and order. It fails if the config has no
+// PaginationSecret.
+func (service *service) Paginate(dbc *DBContext, query string, params []interface{},
+	request PageRequest) (*Page, error) {
+	return paginate(service, service.paginationSecret, dbc, query, params, request)
+}
+
+// PaginateInto works like Paginate and scans every row of the page into a T struct, like SelectInto
+func PaginateInto[T any](db Database, dbc *DBContext, query string, params []interface{},
+	request PageRequest) (*PageOf[T], error) {
+	page, err := db.Paginate(dbc, query, params, request)
+	if err != nil {
+		return nil, err
+	}
+	items, err := ScanRowsInto[T](page.dbRows)
+	if err != nil {
+		return nil, err
+	}
+	return &PageOf[T]{Items: items, PageInfo: page.PageInfo}, nil
+}
+
+// paginate runs Paginate on db, signing the cursors with secret
+func paginate(db Database, secret []byte, dbc *DBContext, query string, params []interface{},
+	request PageRequest) (*Page, error) {
+	if len(secret) == 0 {
+		return nil, errPaginationSecretRequired
+	}
+	if request.Limit <= 0 {
+		request.Limit = DefaultPageLimit
+	}
+	if request.Mode == "" {
+		request.Mode = PageModeOffset
+	}
+	if request.Mode == PageModeKeyset && len(request.OrderBy) == 0 {
+		return nil, errKeysetWithoutOrder
+	}
+	fingerprint := pageFingerprint(query, params, request)
+
+	// Read the cursor
+	cursor := pageCursor{Query: fingerprint, Offset: request.Offset}
+	if request.Cursor != "" {
+		var err error
+		cursor, err = decodeCursor(secret, request.Cursor)
+		if err != nil || cursor.Query != fingerprint || (request.Mode == PageModeKeyset &&
+			cursor.Keys != nil && len(cursor.Keys) != len(request.OrderBy)) {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	// Fetch one more row to know if there is another page
+	pageQuery, pageParams := buildPageQuery(query, params, request, cursor)
+	dbr, err := db.Select(dbc, pageQuery, false, pageParams...)
+	if err != nil {
+		return nil, err
+	}
+	rows := dbr.GetRows()
+	hasMore := len(rows) > request.Limit
+	if hasMore {
+		rows = rows[:request.Limit]
+	}
+	if cursor.Backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := &Page{
+		Rows:     make([]map[string]interface{}, 0, len(rows)),
+		PageInfo: PageInfo{Limit: request.Limit},
+		dbRows:   make([]DBRow, 0, len(rows)),
+	}
+
+	// Total and rows
+	for i := range rows {
+		row, total := splitPageTotal(&rows[i])
+		if request.WithTotal && total != nil {
+			page.Total = total
+		}
+		page.dbRows = append(page.dbRows, row)
+		page.Rows = append(page.Rows, rowMap(&row))
+	}
+	if request.WithTotal && page.Total == nil && cursor.Offset == 0 && cursor.Keys == nil {
+		page.Total = new(int64)
+	}
+
+	// Cursors
+	if request.Mode == PageModeKeyset {
+		err = page.setKeysetCursors(secret, fingerprint, request, cursor, hasMore)
+	} else {
+		err = page.setOffsetCursors(secret, fingerprint, request, cursor, hasMore)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// done
+	return page, nil
+}
+
+// buildPageQuery wraps query to return the page of cursor, with one more row
+func buildPageQuery(query string, params []interface{}, request PageRequest,
+	cursor pageCursor) (string, []interface{}) {
+	pageParams := append([]interface{}{}, params...)
+	source := "(" + strings.TrimSuffix(strings.TrimSpace(query), ";") + ") AS page_query"
+	if request.WithTotal {
+		source = fmt.Sprintf("(SELECT *, COUNT(*) OVER() AS %s FROM %s) AS page_query", pageTotalColumn, source)
+	}
+
+	var sql strings.Builder
+	sql.WriteString("SELECT * FROM " + source)
+
+	// The keys of the cursor
+	if request.Mode == PageModeKeyset && cursor.Keys != nil {
+		disjunction := make([]string, 0, len(request.OrderBy))
+		for i, key := range request.OrderBy {
+			conjunction := make([]string, 0, i+1)
+			for _, previous := range request.OrderBy[:i] {
+				pageParams = append(pageParams, cursor.Keys[len(conjunction)])
+				conjunction = append(conjunction, fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(previous.Column),
+					len(pageParams)))
+			}
+			operator := ">"
+			if key.Desc != cursor.Backward {
+				operator = "<"
+			}
+			pageParams = append(pageParams, cursor.Keys[i])
+			conjunction = append(conjunction, fmt.Sprintf("%s %s $%d", pq.QuoteIdentifier(key.Column), operator,
+				len(pageParams)))
+			disjunction = append(disjunction, "("+strings.Join(conjunction, " AND ")+")")
+		}
+		sql.WriteString(" WHERE " + strings.Join(disjunction, " OR "))
+	}
+
+	// The order, inverted when going backward
+	if len(request.OrderBy) != 0 {
+		order := make([]string, 0, len(request.OrderBy))
+		for _, key := range request.OrderBy {
+			direction := "ASC"
+			if key.Desc != cursor.Backward {
+				direction = "DESC"
+			}
+			order = append(order, pq.QuoteIdentifier(key.Column)+" "+direction)
+		}
+		sql.WriteString(" ORDER BY " + strings.Join(order, ", "))
+	}
+
+	pageParams = append(pageParams, request.Limit+1)
+	fmt.Fprintf(&sql, " LIMIT $%d", len(pageParams))
+	if request.Mode == PageModeOffset && cursor.Offset > 0 {
+		pageParams = append(pageParams, cursor.Offset)
+		fmt.Fprintf(&sql, " OFFSET $%d", len(pageParams))
+	}
+
+	// done
+	return sql.String(), pageParams
+}
+
+// setOffsetCursors sets the cursors of the pages before and after the one of cursor
+func (page *Page) setOffsetCursors(secret []byte, fingerprint uint64, request PageRequest, cursor pageCursor,
+	hasMore bool) (err error) {
+	if hasMore {
+		next := pageCursor{Query: fingerprint, Offset: cursor.Offset + request.Limit}
+		if page.NextCursor, err = encodeCursor(secret, next); err != nil {
+			return err
+		}
+	}
+	if cursor.Offset > 0 {
+		prev := pageCursor{Query: fingerprint, Offset: cursor.Offset - request.Limit}
+		if prev.Offset < 0 {
+			prev.Offset = 0
+		}
+		if page.PrevCursor, err = encodeCursor(secret, prev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setKeysetCursors sets the cursors of the pages before and after the one of cursor, from the keys of
+// its first and last rows
+func (page *Page) setKeysetCursors(secret []byte, fingerprint uint64, request PageRequest, cursor pageCursor,
+	hasMore bool) (err error) {
+	if len(page.dbRows) == 0 {
+		return nil
+	}
+	hasNext := hasMore
+	hasPrev := cursor.Keys != nil
+	if cursor.Backward {
+		hasNext, hasPrev = true, hasMore
+	}
+
+	if hasNext {
+		keys, err := sortKeys(&page.dbRows[len(page.dbRows)-1], request.OrderBy)
+		if err != nil {
+			return err
+		}
+		if page.NextCursor, err = encodeCursor(secret, pageCursor{Query: fingerprint, Keys: keys}); err != nil {
+			return err
+		}
+	}
+	if hasPrev {
+		keys, err := sortKeys(&page.dbRows[0], request.OrderBy)
+		if err != nil {
+			return err
+		}
+		prev := pageCursor{Query: fingerprint, Keys: keys, Backward: true}
+		if page.PrevCursor, err = encodeCursor(secret, prev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortKeys returns the values of the sort keys of row, as they are sent back as params
+func sortKeys(row *DBRow, orderBy []SortKey) ([]interface{}, error) {
+	keys := make([]interface{}, 0, len(orderBy))
+	for _, key := range orderBy {
+		column, err := row.GetColumnByName(key.Column)
+		if err != nil {
+			return nil, err
+		}
+		value := column.GetRawValue()
+		if value == nil {
+			return nil, fmt.Errorf("sort key '%s' is NULL", key.Column)
+		}
+		if buffer, ok := value.([]byte); ok {
+			value = string(buffer)
+		}
+		keys = append(keys, value)
+	}
+	return keys, nil
+}
+
+// splitPageTotal returns the row without the total column, and the total if the row had it
+func splitPageTotal(row *DBRow) (DBRow, *int64) {
+	column, err := row.GetColumnByName(pageTotalColumn)
+	if err != nil {
+		return *row, nil
+	}
+	total, _ := int64Value(column)
+
+	ordered := make([]DBColumn, 0, len(row.ordered))
+	names := make([]string, 0, len(row.ordered))
+	columns := make(DBColumns, len(row.columns))
+	for _, column := range row.ordered {
+		if column.name == pageTotalColumn {
+			continue
+		}
+		ordered = append(ordered, column)
+		names = append(names, column.name)
+		columns[column.name] = column
+	}
+	return DBRow{columns: columns, ordered: ordered, duplicates: duplicateColumns(names)}, total
+}
+
+// rowMap returns the columns of row by name, with the []byte values as strings
+func rowMap(row *DBRow) map[string]interface{} {
+	values := make(map[string]interface{}, len(row.ordered))
+	for _, column := range row.ordered {
+		value := column.GetRawValue()
+		if buffer, ok := value.([]byte); ok {
+			value = string(buffer)
+		}
+		values[column.name] = value
+	}
+	return values
+}
+
+// pageFingerprint returns the fingerprint of the query, its params and the order of the request, so
+// a cursor is only valid for them and can't be replayed with other filter values
+func pageFingerprint(query string, params []interface{}, request PageRequest) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(request.Mode))
+	_, _ = hash.Write([]byte(normalizeSpaceRegexp.ReplaceAllString(strings.TrimSpace(query), " ")))
+	for _, key := range request.OrderBy {
+		_, _ = fmt.Fprintf(hash, "|%s %t", key.Column, key.Desc)
+	}
+	for _, param := range params {
+		// JSON is canonical for the values of the params, e.g. int and int64 encode the same
+		encoded, err := json.Marshal(param)
+		if err != nil {
+			encoded = []byte(fmt.Sprintf("%T:%v", param, param))
+		}
+		_, _ = fmt.Fprintf(hash, "#%s", encoded)
+	}
+	return hash.Sum64()
+}
+
+// encodeCursor returns the token of cursor: its JSON and its HMAC-SHA256, both base64url encoded
+func encodeCursor(secret []byte, cursor pageCursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// decodeCursor returns the cursor of token, ErrInvalidCursor if its signature doesn't match
+func decodeCursor(secret []byte, token string) (pageCursor, error) {
+	encodedPayload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return pageCursor{}, ErrInvalidCursor
+	}
+
+	// The numbers are kept as json.Number, so big integers are sent back as they were
+	var cursor pageCursor
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil {
+		return pageCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
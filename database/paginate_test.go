@@ -0,0 +1,205 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	pageBaseQuery = "SELECT id, title FROM properties WHERE state = $1"
+)
+
+func Test_BuildPageQuery_Offset(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	request := PageRequest{Mode: PageModeOffset, Limit: 10, WithTotal: true,
+		OrderBy: []SortKey{{Column: "title"}}}
+
+	// when
+	query, params := buildPageQuery(pageBaseQuery+";", []interface{}{"published"}, request, pageCursor{Offset: 20})
+
+	// then
+	ass.Equal("SELECT * FROM (SELECT *, COUNT(*) OVER() AS _page_total FROM (SELECT id, title FROM properties "+
+		"WHERE state = $1) AS page_query) AS page_query ORDER BY \"title\" ASC LIMIT $2 OFFSET $3", query)
+	ass.Equal([]interface{}{"published", 11, 20}, params)
+}
+
+func Test_BuildPageQuery_Keyset(t *testing.T) {
+	tt := []struct {
+		Name          string
+		Backward      bool
+		ExpectedQuery string
+	}{
+		{"Forward", false, "SELECT * FROM (" + pageBaseQuery + ") AS page_query " +
+			`WHERE ("created_at" < $2) OR ("created_at" = $3 AND "id" > $4) ORDER BY "created_at" DESC, "id" ASC LIMIT $5`},
+		{"Backward", true, "SELECT * FROM (" + pageBaseQuery + ") AS page_query " +
+			`WHERE ("created_at" > $2) OR ("created_at" = $3 AND "id" < $4) ORDER BY "created_at" ASC, "id" DESC LIMIT $5`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// given
+			ass := assert.New(t)
+			request := PageRequest{Mode: PageModeKeyset, Limit: 5,
+				OrderBy: []SortKey{{Column: "created_at", Desc: true}, {Column: "id"}}}
+			cursor := pageCursor{Keys: []interface{}{"2024-05-01", 7}, Backward: tc.Backward}
+
+			// when
+			query, params := buildPageQuery(pageBaseQuery, []interface{}{"published"}, request, cursor)
+
+			// then
+			ass.Equal(tc.ExpectedQuery, query)
+			ass.Equal([]interface{}{"published", "2024-05-01", "2024-05-01", 7, 6}, params)
+		})
+	}
+}
+
+func Test_BuildPageQuery_Quotes_Sort_Columns(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	request := PageRequest{Mode: PageModeKeyset, Limit: 5,
+		OrderBy: []SortKey{{Column: `id; DROP TABLE "users"`}}}
+
+	// when
+	query, _ := buildPageQuery(pageBaseQuery, []interface{}{"published"}, request, pageCursor{Keys: []interface{}{7}})
+
+	// then
+	ass.Equal("SELECT * FROM ("+pageBaseQuery+`) AS page_query WHERE ("id; DROP TABLE ""users""" > $2) `+
+		`ORDER BY "id; DROP TABLE ""users""" ASC LIMIT $3`, query)
+}
+
+func Test_Paginate_Offset(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := NewFake()
+	request := PageRequest{Limit: 2, WithTotal: true}
+	fake.OnSelect(QueryMatches(`LIMIT \$2$`)).WithParams("published", 3).
+		Return(ParseMockDBResultFromJSON(`[{"id": 1, "_page_total": 5}, {"id": 2, "_page_total": 5},
+			{"id": 3, "_page_total": 5}]`))
+	fake.OnSelect(QueryMatches(`LIMIT \$2 OFFSET \$3$`)).WithParams("published", 3, 2).
+		Return(ParseMockDBResultFromJSON(`[{"id": 3, "_page_total": 5}]`))
+
+	// when
+	first, firstErr := fake.Paginate(nil, pageBaseQuery, []interface{}{"published"}, request)
+	request.Cursor = first.NextCursor
+	second, secondErr := fake.Paginate(nil, pageBaseQuery, []interface{}{"published"}, request)
+
+	// then
+	ass.Nil(firstErr)
+	ass.Equal(int64(5), *first.Total)
+	ass.Equal([]map[string]interface{}{{"id": float64(1)}, {"id": float64(2)}}, first.Rows)
+	ass.NotEmpty(first.NextCursor)
+	ass.Empty(first.PrevCursor)
+	ass.Nil(secondErr)
+	ass.Len(second.Rows, 1)
+	ass.Empty(second.NextCursor)
+	ass.NotEmpty(second.PrevCursor)
+	ass.True(fake.AssertExpectations(t))
+}
+
+func Test_Paginate_Keyset(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := NewFake()
+	request := PageRequest{Mode: PageModeKeyset, Limit: 2, OrderBy: []SortKey{{Column: "id"}}}
+	fake.OnSelect(QueryMatches(`ORDER BY "id" ASC LIMIT \$1$`)).
+		Return(ParseMockDBResultFromJSON(`[{"id": 1}, {"id": 2}, {"id": 3}]`))
+	fake.OnSelect(QueryMatches(`WHERE \("id" > \$1\) ORDER BY "id" ASC LIMIT \$2$`)).WithParams(json.Number("2"), 3).
+		Return(ParseMockDBResultFromJSON(`[{"id": 3}, {"id": 4}]`))
+	fake.OnSelect(QueryMatches(`WHERE \("id" < \$1\) ORDER BY "id" DESC LIMIT \$2$`)).WithParams(json.Number("3"), 3).
+		Return(ParseMockDBResultFromJSON(`[{"id": 2}, {"id": 1}]`))
+
+	// when
+	first, _ := fake.Paginate(nil, "SELECT id FROM users", nil, request)
+	request.Cursor = first.NextCursor
+	second, secondErr := fake.Paginate(nil, "SELECT id FROM users", nil, request)
+	request.Cursor = second.PrevCursor
+	back, backErr := fake.Paginate(nil, "SELECT id FROM users", nil, request)
+
+	// then
+	ass.Nil(secondErr)
+	ass.Equal([]map[string]interface{}{{"id": float64(3)}, {"id": float64(4)}}, second.Rows)
+	ass.Empty(second.NextCursor)
+	ass.Nil(backErr)
+	ass.Equal([]map[string]interface{}{{"id": float64(1)}, {"id": float64(2)}}, back.Rows)
+	ass.NotEmpty(back.NextCursor)
+	ass.Empty(back.PrevCursor)
+	ass.True(fake.AssertExpectations(t))
+}
+
+func Test_Paginate_Invalid_Cursor(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := NewFake()
+	fake.SetDefault(QueryOperationSelect, ParseMockDBResultFromJSON(`[{"id": 1}, {"id": 2}]`), nil)
+	request := PageRequest{Mode: PageModeKeyset, Limit: 1, OrderBy: []SortKey{{Column: "id"}}}
+	first, err := fake.Paginate(nil, "SELECT id FROM users", nil, request)
+	ass.Nil(err)
+	payload, signature, _ := strings.Cut(first.NextCursor, ".")
+
+	// when
+	request.Cursor = payload + "." + signature[1:]
+	_, tamperedErr := fake.Paginate(nil, "SELECT id FROM users", nil, request)
+	request.Cursor = first.NextCursor
+	_, otherQueryErr := fake.Paginate(nil, "SELECT id FROM owners", nil, request)
+	_, otherParamsErr := fake.Paginate(nil, "SELECT id FROM users", []interface{}{"other_tenant"}, request)
+	_, otherSecretErr := paginate(fake, []byte("other"), nil, "SELECT id FROM users", nil, request)
+	_, noOrderErr := fake.Paginate(nil, "SELECT id FROM users", nil, PageRequest{Mode: PageModeKeyset})
+
+	// then
+	ass.Equal(ErrInvalidCursor, tamperedErr)
+	ass.Equal(ErrInvalidCursor, otherQueryErr)
+	ass.Equal(ErrInvalidCursor, otherParamsErr)
+	ass.Equal(ErrInvalidCursor, otherSecretErr)
+	ass.Equal(errKeysetWithoutOrder, noOrderErr)
+}
+
+func Test_PageFingerprint_Params(t *testing.T) {
+	ass := assert.New(t)
+	request := PageRequest{Mode: PageModeKeyset, OrderBy: []SortKey{{Column: "id"}}}
+	query := "SELECT id FROM orders WHERE tenant_id = $1"
+
+	ass.Equal(pageFingerprint(query, []interface{}{7}, request), pageFingerprint(query, []interface{}{int64(7)}, request))
+	ass.NotEqual(pageFingerprint(query, []interface{}{7}, request), pageFingerprint(query, []interface{}{8}, request))
+	ass.NotEqual(pageFingerprint(query, []interface{}{"a", "b"}, request),
+		pageFingerprint(query, []interface{}{"a#\"b"}, request))
+}
+
+func Test_Paginate_Without_Secret(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+
+	// when
+	page, err := service.Paginate(nil, "SELECT id FROM users", nil, PageRequest{})
+
+	// then
+	ass.Nil(page)
+	ass.Equal(errPaginationSecretRequired, err)
+}
+
+func Test_PaginateInto(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	type property struct {
+		ID    int64  `db:"id"`
+		Title string `db:"title"`
+	}
+	fake := NewFake()
+	fake.SetDefault(QueryOperationSelect, ParseMockDBResultFromJSON(`[{"id": 1, "title": "Loft", "_page_total": 1}]`),
+		nil)
+
+	// when
+	page, err := PaginateInto[property](fake, nil, pageBaseQuery, []interface{}{"published"},
+		PageRequest{WithTotal: true})
+	body, marshalErr := json.Marshal(page)
+
+	// then
+	ass.Nil(err)
+	ass.Equal([]property{{ID: 1, Title: "Loft"}}, page.Items)
+	ass.Nil(marshalErr)
+	ass.JSONEq(`{"items": [{"ID": 1, "Title": "Loft"}], "limit": 20, "total": 1}`, string(body))
+}
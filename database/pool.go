@@ -1,7 +1,197 @@
 package database
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/godog"
+)
+
+const (
+	// shutdownPollInterval is how often Shutdown checks if the in-flight queries finished
+	shutdownPollInterval = 50 * time.Millisecond
+)
+
+var (
+	errServiceShutdown = errors.New("service_shutdown")
+)
+
+// lifecycle tracks the background goroutines of the service and its shutdown. A nil lifecycle is
+// never shut down.
+type lifecycle struct {
+	shuttingDown int32
+	stop         chan struct{}
+	workers      sync.WaitGroup
+	stopOnce     sync.Once
+}
+
+// newLifecycle returns the lifecycle of a running service
+func newLifecycle() *lifecycle {
+	return &lifecycle{stop: make(chan struct{})}
+}
+
+// isShuttingDown returns if Shutdown was called
+func (lc *lifecycle) isShuttingDown() bool {
+	return lc != nil && atomic.LoadInt32(&lc.shuttingDown) == 1
+}
+
+// run starts fn in a goroutine that Shutdown waits for, stop is closed when it must return
+func (lc *lifecycle) run(fn func(stop <-chan struct{})) {
+	lc.workers.Add(1)
+	go func() {
+		defer lc.workers.Done()
+		fn(lc.stop)
+	}()
+}
+
+// stopWorkers signals the background goroutines to return and waits for them
+func (lc *lifecycle) stopWorkers() {
+	lc.stopOnce.Do(func() {
+		close(lc.stop)
+	})
+	lc.workers.Wait()
+}
 
 func (service *service) PoolStats() sql.DBStats {
 	return service.db.Stats()
 }
+
+// PoolStatsByNode returns the pool stats of the primary and of every read replica, keyed by
+// "primary" and the host:port of each replica
+func (service *service) PoolStatsByNode() map[string]sql.DBStats {
+	stats := map[string]sql.DBStats{
+		primaryNodeName: service.db.Stats(),
+	}
+	if service.replicas != nil {
+		for _, node := range service.replicas.nodes {
+			stats[node.name] = node.db.Stats()
+		}
+	}
+	return stats
+}
+
+// reportPoolStats records the pool gauges of every node each interval until stop is closed.
+// wait_count and wait_duration are the ones of the last interval.
+func (service *service) reportPoolStats(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := make(map[string]sql.DBStats)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for node, stats := range service.PoolStatsByNode() {
+				service.recordPoolStats(node, stats, previous[node])
+				previous[node] = stats
+			}
+		}
+	}
+}
+
+// recordPoolStats records the gauges of the pool of a node, previous are its stats of the last report
+func (service *service) recordPoolStats(node string, stats sql.DBStats, previous sql.DBStats) {
+	tags := new(godog.Tags).Add("node", node).ToArray()
+	metric := func(name string) string {
+		return fmt.Sprintf("application.%s.db.pool.%s", service.datadogMetricPrefix, name)
+	}
+
+	godog.RecordCompoundMetric(metric("open"), float64(stats.OpenConnections), tags...)
+	godog.RecordCompoundMetric(metric("in_use"), float64(stats.InUse), tags...)
+	godog.RecordCompoundMetric(metric("idle"), float64(stats.Idle), tags...)
+	godog.RecordCompoundMetric(metric("wait_count"), float64(stats.WaitCount-previous.WaitCount), tags...)
+	godog.RecordCompoundMetric(metric("wait_duration"),
+		float64(stats.WaitDuration-previous.WaitDuration)/float64(time.Millisecond), tags...)
+}
+
+// checkAccepting returns an error if the service is shutting down and dbc would start new work.
+// Queries of transactions and connections already open are still accepted so they can finish.
+// It also fails if dbc would run on the pool while its ambient transaction already ended, or
+// without the search_path of the tenant of its ctx.
+func (service *service) checkAccepting(dbc *DBContext) error {
+	if endedAmbient(dbc) {
+		return ErrAmbientTransactionEnded
+	}
+	if tenantOnPool(dbc) {
+		return ErrTenantWithoutDBContext
+	}
+	if !service.lifecycle.isShuttingDown() {
+		return nil
+	}
+	if dbc != nil && (dbc.tx != nil || dbc.dbConn != nil) {
+		return nil
+	}
+	return errServiceShutdown
+}
+
+// Ready returns nil if the service accepts queries and the primary answers a ping within ctx. It's
+// meant to be the readiness check of the application.
+func (service *service) Ready(ctx context.Context) error {
+	if service.lifecycle.isShuttingDown() {
+		return errServiceShutdown
+	}
+	return service.db.PingContext(ctx)
+}
+
+// Shutdown stops accepting new queries, transactions and connections, waits until the ones in flight
+// finish and closes the pools. Queries of the transactions and connections already open are accepted
+// while draining. If ctx is done before the pools are drained, they are closed anyway and the error
+// of ctx is returned.
+func (service *service) Shutdown(ctx context.Context) error {
+	if service.lifecycle == nil {
+		service.lifecycle = newLifecycle()
+	}
+	atomic.StoreInt32(&service.lifecycle.shuttingDown, 1)
+	service.lifecycle.stopWorkers()
+
+	// Wait for the connections in use
+	drainErr := service.drain(ctx)
+	if drainErr != nil {
+		service.logMetric(logError, "shutdown", "service.drain(ctx)", drainErr)
+	}
+
+	// Close the pools
+	err := service.db.Close()
+	if service.replicas != nil {
+		for _, node := range service.replicas.nodes {
+			if nodeErr := node.db.Close(); nodeErr != nil && err == nil {
+				err = nodeErr
+			}
+		}
+	}
+	if err != nil {
+		service.logMetric(logError, "shutdown", "db.Close()", err)
+		return err
+	}
+
+	// done
+	return drainErr
+}
+
+// drain waits until no connection of any pool is in use or ctx is done
+func (service *service) drain(ctx context.Context) error {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		inUse := 0
+		for _, stats := range service.PoolStatsByNode() {
+			inUse += stats.InUse
+		}
+		if inUse == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
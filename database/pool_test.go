@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 	"time"
@@ -28,3 +29,87 @@ func Test_PoolStats(t *testing.T) {
 	// then
 	ass.NotNil(stats)
 }
+
+func Test_Shutdown_Drains_In_Flight_Queries(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.lifecycle = newLifecycle()
+	ctx := context.Background()
+
+	// when
+	sqlMock.PatchStats(sql.DBStats{InUse: 1})
+	sqlMock.PatchStats(sql.DBStats{InUse: 0})
+	sqlMock.PatchClose(nil)
+	err := service.Shutdown(ctx)
+	_, selectErr := service.Select(nil, "SELECT 1", false)
+	_, connErr := service.ConnectionContext(ctx)
+	readyErr := service.Ready(ctx)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(errServiceShutdown, selectErr)
+	ass.Equal(errServiceShutdown, connErr)
+	ass.Equal(errServiceShutdown, readyErr)
+	sqlMock.AssertExpectations(t)
+}
+
+func Test_Shutdown_Timeout(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// when
+	sqlMock.PatchStats(sql.DBStats{InUse: 2})
+	sqlMock.PatchClose(nil)
+	err := service.Shutdown(ctx)
+
+	// then
+	ass.Equal(context.Canceled, err)
+	sqlMock.AssertExpectations(t)
+}
+
+func Test_Shutdown_Stops_Workers(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.lifecycle = newLifecycle()
+	service.lifecycle.run(func(stop <-chan struct{}) {
+		service.reportPoolStats(time.Hour, stop)
+	})
+	service.lifecycle.run(func(stop <-chan struct{}) {
+		service.watchReplicas(time.Hour, stop)
+	})
+
+	// when
+	sqlMock.PatchStats(sql.DBStats{})
+	sqlMock.PatchClose(nil)
+	done := make(chan error)
+	go func() {
+		done <- service.Shutdown(context.Background())
+	}()
+
+	// then
+	select {
+	case err := <-done:
+		ass.Nil(err)
+	case <-time.After(time.Second):
+		ass.Fail("workers not stopped")
+	}
+}
+
+func Test_Ready(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	ctx := context.Background()
+
+	// when
+	sqlMock.PatchPingContext(ctx, nil)
+	err := service.Ready(ctx)
+
+	// then
+	ass.Nil(err)
+}
@@ -0,0 +1,41 @@
+package query
+
+// DeleteBuilder builds a DELETE statement
+type DeleteBuilder struct {
+	table      string
+	conditions []Condition
+	returning  []string
+}
+
+// Delete starts a DELETE from table
+func Delete(table string) *DeleteBuilder {
+	return &DeleteBuilder{table: table}
+}
+
+// Where adds conditions to the WHERE clause, all of them must be true. Without conditions every row
+// is deleted.
+func (builder *DeleteBuilder) Where(conditions ...Condition) *DeleteBuilder {
+	builder.conditions = append(builder.conditions, conditions...)
+	return builder
+}
+
+// Returning sets the columns returned for the deleted rows, run it with Fetch
+func (builder *DeleteBuilder) Returning(columns ...string) *DeleteBuilder {
+	builder.returning = columns
+	return builder
+}
+
+// Build returns the statement and its params
+func (builder *DeleteBuilder) Build() (string, []interface{}, error) {
+	if builder.table == "" {
+		return "", nil, errNoTable
+	}
+
+	writer := &sqlWriter{}
+	writer.write("DELETE FROM " + builder.table)
+	writer.where(builder.conditions)
+	writer.returning(builder.returning)
+
+	// done
+	return writer.build()
+}
@@ -0,0 +1,20 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Delete_Build(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	// when
+	sql, params, err := Delete("sessions").Where(Lt("expires_at", "2024-01-01")).Returning("id", "user_id").Build()
+
+	// then
+	ass.Nil(err)
+	ass.Equal("DELETE FROM sessions WHERE expires_at < $1 RETURNING id, user_id", sql)
+	ass.Equal([]interface{}{"2024-01-01"}, params)
+}
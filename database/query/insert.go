@@ -0,0 +1,176 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	errInsertNoColumns  = errors.New("query_insert_no_columns")
+	errInsertNoValues   = errors.New("query_insert_no_values")
+	errConflictNoTarget = errors.New("query_insert_conflict_no_target")
+)
+
+type (
+	// InsertBuilder builds an INSERT statement
+	InsertBuilder struct {
+		table      string
+		columns    []string
+		rows       [][]interface{}
+		onConflict *conflictClause
+		returning  []string
+	}
+
+	// conflictClause is the ON CONFLICT clause of an INSERT
+	conflictClause struct {
+		target    string
+		doNothing bool
+		sets      []assignment
+	}
+
+	// assignment is a column = expression of an UPDATE or an ON CONFLICT DO UPDATE
+	assignment struct {
+		column string
+		value  Condition
+	}
+)
+
+// Insert starts an INSERT into table
+func Insert(table string) *InsertBuilder {
+	return &InsertBuilder{table: table}
+}
+
+// Columns sets the columns of the inserted rows
+func (builder *InsertBuilder) Columns(columns ...string) *InsertBuilder {
+	builder.columns = columns
+	return builder
+}
+
+// Values adds a row with a value for each of the columns
+func (builder *InsertBuilder) Values(values ...interface{}) *InsertBuilder {
+	builder.rows = append(builder.rows, values)
+	return builder
+}
+
+// OnConflict starts the ON CONFLICT clause of a unique violation on the columns, follow it with
+// DoNothing, DoUpdate or DoUpdateSet. Without columns it has no target, which only works with DoNothing.
+func (builder *InsertBuilder) OnConflict(columns ...string) *InsertBuilder {
+	builder.onConflict = &conflictClause{}
+	if len(columns) != 0 {
+		builder.onConflict.target = "(" + strings.Join(columns, ", ") + ")"
+	}
+	return builder
+}
+
+// OnConflictConstraint starts the ON CONFLICT clause of a violation of the constraint
+func (builder *InsertBuilder) OnConflictConstraint(constraint string) *InsertBuilder {
+	builder.onConflict = &conflictClause{target: "ON CONSTRAINT " + constraint}
+	return builder
+}
+
+// DoNothing skips the conflicting rows
+func (builder *InsertBuilder) DoNothing() *InsertBuilder {
+	builder.conflict().doNothing = true
+	return builder
+}
+
+// DoUpdate updates the columns of the conflicting rows with the values that were being inserted.
+// It needs the target of OnConflict or OnConflictConstraint.
+func (builder *InsertBuilder) DoUpdate(columns ...string) *InsertBuilder {
+	conflict := builder.conflict()
+	for _, column := range columns {
+		excluded := Expr("EXCLUDED." + escapePlaceholders(column))
+		conflict.sets = append(conflict.sets, assignment{column: column, value: excluded})
+	}
+	return builder
+}
+
+// DoUpdateSet updates column of the conflicting rows with value. It needs the target of OnConflict
+// or OnConflictConstraint.
+func (builder *InsertBuilder) DoUpdateSet(column string, value interface{}) *InsertBuilder {
+	conflict := builder.conflict()
+	conflict.sets = append(conflict.sets, assignment{column: column, value: Expr("?", value)})
+	return builder
+}
+
+// Returning sets the columns returned for the inserted rows, run it with Fetch
+func (builder *InsertBuilder) Returning(columns ...string) *InsertBuilder {
+	builder.returning = columns
+	return builder
+}
+
+// conflict returns the ON CONFLICT clause, without target if OnConflict wasn't called
+func (builder *InsertBuilder) conflict() *conflictClause {
+	if builder.onConflict == nil {
+		builder.onConflict = &conflictClause{}
+	}
+	return builder.onConflict
+}
+
+// Build returns the statement and its params
+func (builder *InsertBuilder) Build() (string, []interface{}, error) {
+	if builder.table == "" {
+		return "", nil, errNoTable
+	}
+	if len(builder.columns) == 0 {
+		return "", nil, errInsertNoColumns
+	}
+	if len(builder.rows) == 0 {
+		return "", nil, errInsertNoValues
+	}
+
+	writer := &sqlWriter{}
+	writer.write("INSERT INTO " + builder.table + " (" + strings.Join(builder.columns, ", ") + ") VALUES ")
+	for i, row := range builder.rows {
+		if len(row) != len(builder.columns) {
+			return "", nil, fmt.Errorf("row %d has %d values but %d columns were given", i, len(row),
+				len(builder.columns))
+		}
+		if i > 0 {
+			writer.write(", ")
+		}
+		writer.write("(")
+		for j, value := range row {
+			if j > 0 {
+				writer.write(", ")
+			}
+			writer.param(value)
+		}
+		writer.write(")")
+	}
+
+	if conflict := builder.onConflict; conflict != nil {
+		writer.write(" ON CONFLICT")
+		if conflict.target != "" {
+			writer.write(" " + conflict.target)
+		}
+		if conflict.doNothing || len(conflict.sets) == 0 {
+			writer.write(" DO NOTHING")
+		} else if conflict.target == "" {
+			return "", nil, errConflictNoTarget
+		} else {
+			writer.write(" DO UPDATE SET ")
+			writer.assignments(conflict.sets)
+		}
+	}
+	writer.returning(builder.returning)
+
+	// done
+	return writer.build()
+}
+
+// assignments writes the column = value list of the assignments
+func (writer *sqlWriter) assignments(assignments []assignment) {
+	for i, set := range assignments {
+		if set.value.err != nil {
+			writer.fail(set.value.err)
+			continue
+		}
+		if i > 0 {
+			writer.write(", ")
+		}
+		writer.write(set.column + " = ")
+		writer.expr(set.value.sql, set.value.params)
+	}
+}
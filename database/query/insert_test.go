@@ -0,0 +1,89 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Insert_Build(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	builder := Insert("users").
+		Columns("email", "name").
+		Values("a@flat.mx", "Ana").
+		Values("b@flat.mx", "Beto").
+		Returning("id")
+
+	// when
+	sql, params, err := builder.Build()
+
+	// then
+	ass.Nil(err)
+	ass.Equal("INSERT INTO users (email, name) VALUES ($1, $2), ($3, $4) RETURNING id", sql)
+	ass.Equal([]interface{}{"a@flat.mx", "Ana", "b@flat.mx", "Beto"}, params)
+}
+
+func Test_Insert_Build_Upsert(t *testing.T) {
+	tt := []struct {
+		Name        string
+		Builder     *InsertBuilder
+		ExpectedSQL string
+	}{
+		{
+			"Do nothing",
+			Insert("users").Columns("email").Values("a@flat.mx").OnConflict("email").DoNothing(),
+			"INSERT INTO users (email) VALUES ($1) ON CONFLICT (email) DO NOTHING",
+		},
+		{
+			"Do nothing without target",
+			Insert("users").Columns("email").Values("a@flat.mx").OnConflict().DoNothing(),
+			"INSERT INTO users (email) VALUES ($1) ON CONFLICT DO NOTHING",
+		},
+		{
+			"Do update",
+			Insert("users").Columns("email", "name").Values("a@flat.mx", "Ana").
+				OnConflict("email").DoUpdate("name").DoUpdateSet("updated_by", "sync"),
+			"INSERT INTO users (email, name) VALUES ($1, $2) ON CONFLICT (email) DO UPDATE SET " +
+				"name = EXCLUDED.name, updated_by = $3",
+		},
+		{
+			"Constraint",
+			Insert("users").Columns("email").Values("a@flat.mx").OnConflictConstraint("users_email_key").
+				DoUpdate("email"),
+			"INSERT INTO users (email) VALUES ($1) ON CONFLICT ON CONSTRAINT users_email_key DO UPDATE SET " +
+				"email = EXCLUDED.email",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ass := assert.New(t)
+			sql, _, err := tc.Builder.Build()
+
+			ass.Nil(err)
+			ass.Equal(tc.ExpectedSQL, sql)
+		})
+	}
+}
+
+func Test_Insert_Build_Errors(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	// when
+	_, _, noColumnsErr := Insert("users").Values(1).Build()
+	_, _, noValuesErr := Insert("users").Columns("id").Build()
+	_, _, rowErr := Insert("users").Columns("id", "email").Values(1, "a@flat.mx").Values(2).Build()
+	_, _, doUpdateErr := Insert("users").Columns("id", "email").Values(1, "a@flat.mx").DoUpdate("email").Build()
+	_, _, doUpdateSetErr := Insert("users").Columns("id").Values(1).DoUpdateSet("visits", 1).Build()
+	_, _, noTargetErr := Insert("users").Columns("id").Values(1).OnConflict().DoUpdate("id").Build()
+
+	// then
+	ass.Equal(errInsertNoColumns, noColumnsErr)
+	ass.Equal(errInsertNoValues, noValuesErr)
+	ass.EqualError(rowErr, "row 1 has 1 values but 2 columns were given")
+	ass.Equal(errConflictNoTarget, doUpdateErr)
+	ass.Equal(errConflictNoTarget, doUpdateSetErr)
+	ass.Equal(errConflictNoTarget, noTargetErr)
+}
@@ -0,0 +1,286 @@
+// Package query builds the SQL of the common CRUD statements for database.Database. Values are always
+// sent as $n params, while table, column and ORDER BY expressions are written as given, so they must
+// never come from user input.
+//
+//	q := query.Select("id", "email").From("users").
+//		Where(query.Eq("active", true), query.Or(query.Like("email", "%@flat.mx"), query.IsNull("deleted_at"))).
+//		OrderBy("id DESC").Limit(20)
+//	dbr, err := query.Fetch(db, dbc, q)
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+)
+
+var (
+	errNoTable = errors.New("query_no_table")
+)
+
+type (
+	// Builder builds a statement and its params
+	Builder interface {
+		// Build returns the statement, with $n placeholders, and its params
+		Build() (string, []interface{}, error)
+	}
+
+	// Condition is a boolean expression of a WHERE clause. Its SQL uses ? as placeholder of its params,
+	// renumbered as $n when the statement is built, and ?? for a literal ?.
+	Condition struct {
+		sql    string
+		params []interface{}
+		err    error
+	}
+
+	// sqlWriter writes a statement numbering its params
+	sqlWriter struct {
+		sql    strings.Builder
+		params []interface{}
+		err    error
+	}
+)
+
+// Fetch builds the statement and runs it with Select, use it for SELECT statements and the ones with
+// RETURNING. The locking clause is part of the statement, see SelectBuilder.ForUpdate.
+func Fetch(db database.Database, dbc *database.DBContext, builder Builder) (*database.DBResult, error) {
+	sql, params, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	return db.Select(dbc, sql, false, params...)
+}
+
+// Exec builds the statement and runs it with Execute
+func Exec(db database.Database, dbc *database.DBContext, builder Builder) (*database.DBResult, error) {
+	sql, params, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	return db.Execute(dbc, sql, params...)
+}
+
+// Statement builds the statement as a database.Statement for ExecuteBatch
+func Statement(builder Builder) (database.Statement, error) {
+	sql, params, err := builder.Build()
+	if err != nil {
+		return database.Statement{}, err
+	}
+	return database.Statement{Query: sql, Params: params}, nil
+}
+
+// Expr returns a condition from sql, which uses ? as placeholder of each of the params and ?? for a
+// literal ?, e.g. Expr("created_at > now() - ? * interval '1 day'", days)
+func Expr(sql string, params ...interface{}) Condition {
+	if placeholders := countPlaceholders(sql); placeholders != len(params) {
+		return Condition{err: fmt.Errorf("expression %q has %d placeholders but %d params were given",
+			sql, placeholders, len(params))}
+	}
+	return Condition{sql: sql, params: params}
+}
+
+// Eq returns column = value, or column IS NULL if value is nil
+func Eq(column string, value interface{}) Condition {
+	if value == nil {
+		return IsNull(column)
+	}
+	return compare(column, "=", value)
+}
+
+// NotEq returns column <> value, or column IS NOT NULL if value is nil
+func NotEq(column string, value interface{}) Condition {
+	if value == nil {
+		return IsNotNull(column)
+	}
+	return compare(column, "<>", value)
+}
+
+// Gt returns column > value
+func Gt(column string, value interface{}) Condition {
+	return compare(column, ">", value)
+}
+
+// Gte returns column >= value
+func Gte(column string, value interface{}) Condition {
+	return compare(column, ">=", value)
+}
+
+// Lt returns column < value
+func Lt(column string, value interface{}) Condition {
+	return compare(column, "<", value)
+}
+
+// Lte returns column <= value
+func Lte(column string, value interface{}) Condition {
+	return compare(column, "<=", value)
+}
+
+// Like returns column LIKE pattern
+func Like(column string, pattern string) Condition {
+	return compare(column, "LIKE", pattern)
+}
+
+// ILike returns column ILIKE pattern
+func ILike(column string, pattern string) Condition {
+	return compare(column, "ILIKE", pattern)
+}
+
+// In returns column IN (values...), or FALSE if there are no values
+func In(column string, values ...interface{}) Condition {
+	if len(values) == 0 {
+		return Condition{sql: "FALSE"}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	return Condition{sql: fmt.Sprintf("%s IN (%s)", escapePlaceholders(column), placeholders), params: values}
+}
+
+// IsNull returns column IS NULL
+func IsNull(column string) Condition {
+	return Condition{sql: escapePlaceholders(column) + " IS NULL"}
+}
+
+// IsNotNull returns column IS NOT NULL
+func IsNotNull(column string) Condition {
+	return Condition{sql: escapePlaceholders(column) + " IS NOT NULL"}
+}
+
+// And returns the conjunction of the conditions, TRUE if there are none
+func And(conditions ...Condition) Condition {
+	return join("AND", "TRUE", conditions)
+}
+
+// Or returns the disjunction of the conditions, FALSE if there are none
+func Or(conditions ...Condition) Condition {
+	return join("OR", "FALSE", conditions)
+}
+
+// Not returns the negation of the condition
+func Not(condition Condition) Condition {
+	if condition.err != nil {
+		return condition
+	}
+	return Condition{sql: "NOT (" + condition.sql + ")", params: condition.params}
+}
+
+// compare returns column operator value, the column is written as given even if it has a ?, e.g. a
+// jsonb operator
+func compare(column string, operator string, value interface{}) Condition {
+	return Condition{sql: fmt.Sprintf("%s %s ?", escapePlaceholders(column), operator), params: []interface{}{value}}
+}
+
+// join joins the conditions with operator, each one between parentheses if there is more than one
+func join(operator string, empty string, conditions []Condition) Condition {
+	switch len(conditions) {
+	case 0:
+		return Condition{sql: empty}
+	case 1:
+		return conditions[0]
+	}
+
+	parts := make([]string, 0, len(conditions))
+	params := make([]interface{}, 0)
+	for _, condition := range conditions {
+		if condition.err != nil {
+			return condition
+		}
+		parts = append(parts, "("+condition.sql+")")
+		params = append(params, condition.params...)
+	}
+	return Condition{sql: strings.Join(parts, " "+operator+" "), params: params}
+}
+
+// countPlaceholders returns the amount of ? of sql that are not escaped as ??
+func countPlaceholders(sql string) int {
+	count := 0
+	for i := 0; i < len(sql); i++ {
+		if sql[i] != '?' {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == '?' {
+			i++
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// escapePlaceholders escapes every ? of sql as ??, so it's written as given
+func escapePlaceholders(sql string) string {
+	return strings.ReplaceAll(sql, "?", "??")
+}
+
+// write writes s as is
+func (writer *sqlWriter) write(s string) {
+	writer.sql.WriteString(s)
+}
+
+// param writes the placeholder of value
+func (writer *sqlWriter) param(value interface{}) {
+	writer.params = append(writer.params, value)
+	fmt.Fprintf(&writer.sql, "$%d", len(writer.params))
+}
+
+// expr writes sql replacing each ? with the placeholder of the next param and each ?? with a ?. It
+// fails if sql doesn't have a placeholder for each param.
+func (writer *sqlWriter) expr(sql string, params []interface{}) {
+	if placeholders := countPlaceholders(sql); placeholders != len(params) {
+		writer.fail(fmt.Errorf("expression %q has %d placeholders but %d params were given",
+			sql, placeholders, len(params)))
+		return
+	}
+
+	next := 0
+	for i := 0; i < len(sql); i++ {
+		if sql[i] != '?' {
+			writer.sql.WriteByte(sql[i])
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == '?' {
+			writer.sql.WriteByte('?')
+			i++
+			continue
+		}
+		writer.param(params[next])
+		next++
+	}
+}
+
+// where writes the WHERE clause of the conditions, if there are any
+func (writer *sqlWriter) where(conditions []Condition) {
+	if len(conditions) == 0 {
+		return
+	}
+	condition := And(conditions...)
+	if condition.err != nil {
+		writer.fail(condition.err)
+		return
+	}
+	writer.write(" WHERE ")
+	writer.expr(condition.sql, condition.params)
+}
+
+// returning writes the RETURNING clause of the columns, if there are any
+func (writer *sqlWriter) returning(columns []string) {
+	if len(columns) == 0 {
+		return
+	}
+	writer.write(" RETURNING " + strings.Join(columns, ", "))
+}
+
+// fail keeps the first error of the statement
+func (writer *sqlWriter) fail(err error) {
+	if writer.err == nil {
+		writer.err = err
+	}
+}
+
+// build returns the statement, its params and the first error
+func (writer *sqlWriter) build() (string, []interface{}, error) {
+	if writer.err != nil {
+		return "", nil, writer.err
+	}
+	return writer.sql.String(), writer.params, nil
+}
@@ -0,0 +1,94 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Conditions(t *testing.T) {
+	tt := []struct {
+		Name           string
+		Condition      Condition
+		ExpectedSQL    string
+		ExpectedParams []interface{}
+	}{
+		{"Eq", Eq("id", 1), " WHERE id = $1", []interface{}{1}},
+		{"Eq nil", Eq("deleted_at", nil), " WHERE deleted_at IS NULL", nil},
+		{"NotEq nil", NotEq("deleted_at", nil), " WHERE deleted_at IS NOT NULL", nil},
+		{"In", In("state", "paid", "sent"), " WHERE state IN ($1, $2)", []interface{}{"paid", "sent"}},
+		{"In empty", In("state"), " WHERE FALSE", nil},
+		{"Or", Or(Gt("price", 10), ILike("title", "%loft%")), " WHERE (price > $1) OR (title ILIKE $2)",
+			[]interface{}{10, "%loft%"}},
+		{"Not", Not(And(Gte("rooms", 2), Lte("rooms", 4))), " WHERE NOT ((rooms >= $1) AND (rooms <= $2))",
+			[]interface{}{2, 4}},
+		{"Expr", Expr("data ?? 'tags' AND created_at > now() - ? * interval '1 day'", 7),
+			" WHERE data ? 'tags' AND created_at > now() - $1 * interval '1 day'", []interface{}{7}},
+		{"Column with ?", Eq("(data ? 'vip')", true), " WHERE (data ? 'vip') = $1", []interface{}{true}},
+		{"In column with ?", In("data ?| array['vip']", true), " WHERE data ?| array['vip'] IN ($1)",
+			[]interface{}{true}},
+		{"IsNull column with ??", IsNull("data ?? 'vip'"), " WHERE data ?? 'vip' IS NULL", nil},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			ass := assert.New(t)
+			writer := &sqlWriter{}
+			writer.where([]Condition{tc.Condition})
+			sql, params, err := writer.build()
+
+			ass.Nil(err)
+			ass.Equal(tc.ExpectedSQL, sql)
+			ass.Equal(tc.ExpectedParams, params)
+		})
+	}
+}
+
+func Test_Expr_Params_Mismatch(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	// when
+	_, _, err := Select().From("users").Where(Eq("active", true), Expr("id = ? OR id = ?", 1)).Build()
+
+	// then
+	ass.EqualError(err, `expression "id = ? OR id = ?" has 2 placeholders but 1 params were given`)
+}
+
+func Test_Condition_Params_Mismatch(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	condition := Condition{sql: "id = ? OR id = ?", params: []interface{}{1}}
+
+	// when
+	_, _, err := Select().From("users").Where(condition).Build()
+
+	// then
+	ass.EqualError(err, `expression "id = ? OR id = ?" has 2 placeholders but 1 params were given`)
+}
+
+func Test_Fetch_And_Exec(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := database.NewFake()
+	fake.OnSelect(database.QueryEquals("SELECT id FROM users WHERE email = $1 LIMIT $2")).
+		WithParams("a@flat.mx", int64(1)).
+		Return(database.ParseMockDBResultFromJSON(`[{"id": 1}]`))
+	fake.OnExecute(database.QueryEquals("DELETE FROM sessions WHERE user_id = $1")).
+		WithParams(1).
+		Return(database.ParseMockDBResultAffectedRows(3))
+
+	// when
+	dbr, fetchErr := Fetch(fake, nil, Select("id").From("users").Where(Eq("email", "a@flat.mx")).Limit(1))
+	result, execErr := Exec(fake, nil, Delete("sessions").Where(Eq("user_id", 1)))
+	_, buildErr := Exec(fake, nil, Update("users"))
+
+	// then
+	ass.Nil(fetchErr)
+	ass.Len(dbr.GetRows(), 1)
+	ass.Nil(execErr)
+	ass.Equal(int64(3), result.AffectedRows())
+	ass.Equal(errUpdateNoColumns, buildErr)
+	ass.True(fake.AssertExpectations(t))
+}
@@ -0,0 +1,116 @@
+package query
+
+import (
+	"strings"
+)
+
+// SelectBuilder builds a SELECT statement
+type SelectBuilder struct {
+	columns    []string
+	table      string
+	joins      []Condition
+	conditions []Condition
+	orderBy    []string
+	limit      *int64
+	offset     *int64
+	forUpdate  bool
+	skipLocked bool
+}
+
+// Select starts a SELECT of the columns, all of them if none is given
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+// From sets the table of the statement, it can have an alias, e.g. "users u"
+func (builder *SelectBuilder) From(table string) *SelectBuilder {
+	builder.table = table
+	return builder
+}
+
+// Join adds a join clause, which uses ? as placeholder of its params, e.g.
+// Join("LEFT JOIN orders o ON o.user_id = u.id AND o.state = ?", "paid")
+func (builder *SelectBuilder) Join(clause string, params ...interface{}) *SelectBuilder {
+	builder.joins = append(builder.joins, Expr(clause, params...))
+	return builder
+}
+
+// Where adds conditions to the WHERE clause, all of them must be true
+func (builder *SelectBuilder) Where(conditions ...Condition) *SelectBuilder {
+	builder.conditions = append(builder.conditions, conditions...)
+	return builder
+}
+
+// OrderBy adds expressions to the ORDER BY clause, e.g. "created_at DESC"
+func (builder *SelectBuilder) OrderBy(expressions ...string) *SelectBuilder {
+	builder.orderBy = append(builder.orderBy, expressions...)
+	return builder
+}
+
+// Limit sets the LIMIT of the statement
+func (builder *SelectBuilder) Limit(limit int64) *SelectBuilder {
+	builder.limit = &limit
+	return builder
+}
+
+// Offset sets the OFFSET of the statement
+func (builder *SelectBuilder) Offset(offset int64) *SelectBuilder {
+	builder.offset = &offset
+	return builder
+}
+
+// ForUpdate locks the selected rows until the end of the transaction
+func (builder *SelectBuilder) ForUpdate() *SelectBuilder {
+	builder.forUpdate = true
+	return builder
+}
+
+// SkipLocked locks the selected rows like ForUpdate, skipping the ones locked by other transactions
+func (builder *SelectBuilder) SkipLocked() *SelectBuilder {
+	builder.forUpdate = true
+	builder.skipLocked = true
+	return builder
+}
+
+// Build returns the statement and its params
+func (builder *SelectBuilder) Build() (string, []interface{}, error) {
+	if builder.table == "" {
+		return "", nil, errNoTable
+	}
+
+	writer := &sqlWriter{}
+	columns := "*"
+	if len(builder.columns) != 0 {
+		columns = strings.Join(builder.columns, ", ")
+	}
+	writer.write("SELECT " + columns + " FROM " + builder.table)
+	for _, join := range builder.joins {
+		if join.err != nil {
+			writer.fail(join.err)
+			continue
+		}
+		writer.write(" ")
+		writer.expr(join.sql, join.params)
+	}
+	writer.where(builder.conditions)
+	if len(builder.orderBy) != 0 {
+		writer.write(" ORDER BY " + strings.Join(builder.orderBy, ", "))
+	}
+	if builder.limit != nil {
+		writer.write(" LIMIT ")
+		writer.param(*builder.limit)
+	}
+	if builder.offset != nil {
+		writer.write(" OFFSET ")
+		writer.param(*builder.offset)
+	}
+	if builder.forUpdate {
+		writer.write(" FOR UPDATE")
+	}
+	if builder.skipLocked {
+		writer.write(" SKIP LOCKED")
+	}
+
+	// done
+	return writer.build()
+}
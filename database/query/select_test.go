@@ -0,0 +1,45 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Select_Build(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	builder := Select("p.id", "o.name").
+		From("properties p").
+		Join("JOIN owners o ON o.id = p.owner_id AND o.country = ?", "MX").
+		Where(Eq("p.state", "published"), Or(Lt("p.price", 100), IsNull("p.price"))).
+		OrderBy("p.created_at DESC", "p.id").
+		Limit(20).
+		Offset(40).
+		SkipLocked()
+
+	// when
+	sql, params, err := builder.Build()
+
+	// then
+	ass.Nil(err)
+	ass.Equal("SELECT p.id, o.name FROM properties p JOIN owners o ON o.id = p.owner_id AND o.country = $1 "+
+		"WHERE (p.state = $2) AND ((p.price < $3) OR (p.price IS NULL)) ORDER BY p.created_at DESC, p.id "+
+		"LIMIT $4 OFFSET $5 FOR UPDATE SKIP LOCKED", sql)
+	ass.Equal([]interface{}{"MX", "published", 100, int64(20), int64(40)}, params)
+}
+
+func Test_Select_Build_Defaults(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	// when
+	sql, params, err := Select().From("users").ForUpdate().Build()
+	_, _, noTableErr := Select("id").Build()
+
+	// then
+	ass.Nil(err)
+	ass.Equal("SELECT * FROM users FOR UPDATE", sql)
+	ass.Empty(params)
+	ass.Equal(errNoTable, noTableErr)
+}
@@ -0,0 +1,67 @@
+package query
+
+import (
+	"errors"
+)
+
+var (
+	errUpdateNoColumns = errors.New("query_update_no_columns")
+)
+
+// UpdateBuilder builds an UPDATE statement
+type UpdateBuilder struct {
+	table      string
+	sets       []assignment
+	conditions []Condition
+	returning  []string
+}
+
+// Update starts an UPDATE of table
+func Update(table string) *UpdateBuilder {
+	return &UpdateBuilder{table: table}
+}
+
+// Set sets column to value
+func (builder *UpdateBuilder) Set(column string, value interface{}) *UpdateBuilder {
+	builder.sets = append(builder.sets, assignment{column: column, value: Expr("?", value)})
+	return builder
+}
+
+// SetExpr sets column to the expression, which uses ? as placeholder of its params, e.g.
+// SetExpr("retries", "retries + ?", 1)
+func (builder *UpdateBuilder) SetExpr(column string, expression string, params ...interface{}) *UpdateBuilder {
+	builder.sets = append(builder.sets, assignment{column: column, value: Expr(expression, params...)})
+	return builder
+}
+
+// Where adds conditions to the WHERE clause, all of them must be true. Without conditions every row
+// is updated.
+func (builder *UpdateBuilder) Where(conditions ...Condition) *UpdateBuilder {
+	builder.conditions = append(builder.conditions, conditions...)
+	return builder
+}
+
+// Returning sets the columns returned for the updated rows, run it with Fetch
+func (builder *UpdateBuilder) Returning(columns ...string) *UpdateBuilder {
+	builder.returning = columns
+	return builder
+}
+
+// Build returns the statement and its params
+func (builder *UpdateBuilder) Build() (string, []interface{}, error) {
+	if builder.table == "" {
+		return "", nil, errNoTable
+	}
+	if len(builder.sets) == 0 {
+		return "", nil, errUpdateNoColumns
+	}
+
+	writer := &sqlWriter{}
+	writer.write("UPDATE " + builder.table + " SET ")
+	writer.assignments(builder.sets)
+	writer.where(builder.conditions)
+	writer.returning(builder.returning)
+
+	// done
+	return writer.build()
+}
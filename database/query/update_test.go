@@ -0,0 +1,32 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Update_Build(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	builder := Update("jobs").
+		Set("state", "failed").
+		SetExpr("attempts", "attempts + ?", 1).
+		Where(Eq("id", int64(9)), Eq("state", "running")).
+		Returning("attempts")
+
+	// when
+	sql, params, err := builder.Build()
+
+	// then
+	ass.Nil(err)
+	ass.Equal("UPDATE jobs SET state = $1, attempts = attempts + $2 WHERE (id = $3) AND (state = $4) "+
+		"RETURNING attempts", sql)
+	ass.Equal([]interface{}{"failed", 1, int64(9), "running"}, params)
+}
+
+func Test_Update_Build_Without_Columns(t *testing.T) {
+	ass := assert.New(t)
+	_, _, err := Update("jobs").Where(Eq("id", 1)).Build()
+	ass.Equal(errUpdateNoColumns, err)
+}
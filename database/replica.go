@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database/converter"
+)
+
+const (
+	// RoundRobin sends each read to the next healthy replica
+	RoundRobin ReplicaBalancer = "round_robin"
+	// LeastConnections sends each read to the healthy replica with less connections in use
+	LeastConnections ReplicaBalancer = "least_connections"
+
+	// defaultReplicaHealthCheckInterval is how often the replicas are tested if no interval is configured
+	defaultReplicaHealthCheckInterval = 5 * time.Second
+
+	// primaryNodeName is the name of the primary in the per node stats
+	primaryNodeName = "primary"
+)
+
+var (
+	// writeQueryRegexp matches the queries that can't run in a replica even without forUpdate
+	writeQueryRegexp = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|RETURNING|FOR\s+(KEY\s+)?SHARE)\b`)
+	// readQueryRegexp matches the start of the queries that can run in a replica
+	readQueryRegexp = regexp.MustCompile(`(?i)^\(*\s*(SELECT|WITH|VALUES)\b`)
+	// sideEffectQueryRegexp matches the calls to the functions that write, lock or depend on the
+	// session, which can't run in a replica even inside a SELECT
+	sideEffectQueryRegexp = regexp.MustCompile(`(?i)\b(nextval|setval|currval|lastval|pg_(try_)?advisory_\w+|` +
+		`pg_notify|set_config|txid_current|pg_current_xact_id|pg_cancel_backend|pg_terminate_backend|` +
+		`lo_\w+|dblink_exec)\s*\(`)
+)
+
+// primaryKey is the key of the flag that sends the reads of a context.Context to the primary
+type primaryKey struct{}
+
+type (
+	// ReplicaConfig is a read replica of the primary. It uses the credentials, database name
+	// and pool settings of the primary.
+	ReplicaConfig struct {
+		DBHost string
+		DBPort int
+	}
+
+	// ReplicaBalancer is the strategy used to choose the replica of each read
+	ReplicaBalancer string
+
+	// replicaNode is a read replica and its health
+	replicaNode struct {
+		name    string
+		db      converter.DBer
+		healthy int32
+		stmts   *stmtCache
+	}
+
+	// replicaSet holds the read replicas of the service
+	replicaSet struct {
+		nodes    []*replicaNode
+		balancer ReplicaBalancer
+		next     uint64
+	}
+)
+
+// newReplicaNode returns a node that is considered healthy until a health check fails
+func newReplicaNode(name string, db converter.DBer) *replicaNode {
+	return &replicaNode{
+		name:    name,
+		db:      db,
+		healthy: 1,
+	}
+}
+
+// isHealthy returns if the node can receive reads
+func (node *replicaNode) isHealthy() bool {
+	return atomic.LoadInt32(&node.healthy) == 1
+}
+
+// pick returns the replica for the next read, or nil if there is no healthy replica
+func (replicas *replicaSet) pick() *replicaNode {
+	healthy := make([]*replicaNode, 0, len(replicas.nodes))
+	for _, node := range replicas.nodes {
+		if node.isHealthy() {
+			healthy = append(healthy, node)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if replicas.balancer == LeastConnections {
+		chosen := healthy[0]
+		inUse := chosen.db.Stats().InUse
+		for _, node := range healthy[1:] {
+			if nodeInUse := node.db.Stats().InUse; nodeInUse < inUse {
+				chosen, inUse = node, nodeInUse
+			}
+		}
+		return chosen
+	}
+
+	next := atomic.AddUint64(&replicas.next, 1) - 1
+	return healthy[next%uint64(len(healthy))]
+}
+
+// WithPrimary returns a copy of ctx whose selects run in the primary instead of a replica, e.g.
+// to read a previous write or to call functions with side effects that aren't detected
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// isPrimaryContext returns if the reads of ctx must run in the primary
+func isPrimaryContext(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// isReadOnlyQuery returns if the query can be sent to a replica
+func isReadOnlyQuery(query string) bool {
+	query = strings.TrimSpace(query)
+	return readQueryRegexp.MatchString(query) && !writeQueryRegexp.MatchString(query) &&
+		!sideEffectQueryRegexp.MatchString(query)
+}
+
+// readDB returns where a select must run. Selects outside a transaction or connection, without
+// forUpdate, that don't write or call functions with side effects and whose ctx wasn't marked
+// with WithPrimary go to a healthy replica, everything else goes to the primary.
+func (service *service) readDB(dbc *DBContext, query string, forUpdate bool) converter.DBer {
+	if service.replicas == nil || forUpdate {
+		return service.db
+	}
+	if dbc != nil && (dbc.tx != nil || dbc.dbConn != nil) {
+		return service.db
+	}
+	if isPrimaryContext(dbc.context()) {
+		return service.db
+	}
+	if !isReadOnlyQuery(query) {
+		return service.db
+	}
+
+	node := service.replicas.pick()
+	if node == nil {
+		service.logMetric(logError, "read_replica", "no healthy replica, using primary", nil)
+		return service.db
+	}
+	return node.db
+}
+
+// checkReplicas tests every replica, ejecting the ones that fail and bringing back the ones that recovered
+func (service *service) checkReplicas(timeout time.Duration) {
+	for _, node := range service.replicas.nodes {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := node.db.PingContext(ctx)
+		cancel()
+
+		if err != nil {
+			if atomic.CompareAndSwapInt32(&node.healthy, 1, 0) {
+				service.logMetric(logError, "read_replica", "eject "+node.name, err)
+			}
+			continue
+		}
+		if atomic.CompareAndSwapInt32(&node.healthy, 0, 1) {
+			service.logMetric(logSuccess, "read_replica", "restore "+node.name, nil)
+		}
+	}
+}
+
+// watchReplicas checks the replicas every interval until stop is closed
+func (service *service) watchReplicas(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			service.checkReplicas(interval)
+		}
+	}
+}
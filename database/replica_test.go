@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	sqlmock "github.com/FlatDigital/core-go-toolkit/v2/database/mock"
+)
+
+func newMockServiceWithReplicas(balancer ReplicaBalancer, replicas int) (service, *sqlmock.SQLMock,
+	[]*sqlmock.SQLMock) {
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	replicaMocks := make([]*sqlmock.SQLMock, 0, replicas)
+	service.replicas = &replicaSet{balancer: balancer}
+	for i := 0; i < replicas; i++ {
+		replicaMock := sqlmock.NewMockService()
+		replicaMocks = append(replicaMocks, replicaMock)
+		service.replicas.nodes = append(service.replicas.nodes, newReplicaNode(string(rune('a'+i)), replicaMock))
+	}
+	return service, sqlMock, replicaMocks
+}
+
+func patchEmptySelect(sqlMock *sqlmock.SQLMock, query string, params []interface{}) {
+	stmtMock := newDBStmtMock()
+	rowsMock := newDBRowsMock()
+	rowsMock.PatchColumns([]string{"columnA"}, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
+	rowsMock.PatchNext(false)
+	rowsMock.PatchClose(nil)
+	stmtMock.PatchQuery(params, rowsMock, nil)
+	stmtMock.PatchClose(nil)
+	sqlMock.PatchPrepare(query, stmtMock, nil)
+}
+
+func Test_Select_Replica_RoundRobin(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock, replicaMocks := newMockServiceWithReplicas(RoundRobin, 2)
+	params := []interface{}{3}
+
+	// when
+	patchEmptySelect(replicaMocks[0], selectStmt2, params)
+	patchEmptySelect(replicaMocks[1], selectStmt2, params)
+	patchEmptySelect(replicaMocks[0], selectStmt2, params)
+	for i := 0; i < 3; i++ {
+		_, err := service.Select(nil, selectStmt2, false, params...)
+		ass.Nil(err)
+	}
+
+	// then
+	replicaMocks[0].AssertExpectations(t)
+	replicaMocks[1].AssertExpectations(t)
+	sqlMock.AssertExpectations(t)
+}
+
+func Test_Select_Replica_LeastConnections(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _, replicaMocks := newMockServiceWithReplicas(LeastConnections, 2)
+	params := []interface{}{3}
+
+	// when
+	replicaMocks[0].PatchStats(sql.DBStats{InUse: 5})
+	replicaMocks[1].PatchStats(sql.DBStats{InUse: 2})
+	patchEmptySelect(replicaMocks[1], selectStmt2, params)
+	_, err := service.Select(nil, selectStmt2, false, params...)
+
+	// then
+	ass.Nil(err)
+	replicaMocks[1].AssertExpectations(t)
+}
+
+func Test_Select_Replica_Primary_Routing(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock, replicaMocks := newMockServiceWithReplicas(RoundRobin, 1)
+	params := []interface{}{3}
+	insertQuery := "INSERT INTO test (email) VALUES ($1) RETURNING id"
+
+	// when
+	patchEmptySelect(sqlMock, selectStmt, params)
+	_, errForUpdate := service.Select(nil, selectStmt2, true, params...)
+	patchEmptySelect(sqlMock, insertQuery, params)
+	_, errInsert := service.Select(nil, insertQuery, false, params...)
+
+	// then
+	ass.Nil(errForUpdate)
+	ass.Nil(errInsert)
+	sqlMock.AssertExpectations(t)
+	replicaMocks[0].AssertNotCalled(t, "Prepare", selectStmt2)
+}
+
+func Test_Select_Replica_WithPrimary(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock, replicaMocks := newMockServiceWithReplicas(RoundRobin, 1)
+	ctx := WithPrimary(context.Background())
+	stmtMock := newDBStmtMock()
+	rowsMock := newDBRowsMock()
+
+	// when
+	rowsMock.PatchColumns([]string{"columnA"}, nil)
+	rowsMock.PatchColumnTypes(nil, nil)
+	rowsMock.PatchNext(false)
+	rowsMock.PatchClose(nil)
+	stmtMock.PatchQueryContext(ctx, nil, rowsMock, nil)
+	stmtMock.PatchClose(nil)
+	sqlMock.PatchPrepareContext(ctx, selectStmt2, stmtMock, nil)
+	_, err := service.SelectContext(ctx, nil, selectStmt2, false)
+
+	// then
+	ass.Nil(err)
+	sqlMock.AssertExpectations(t)
+	replicaMocks[0].AssertNotCalled(t, "PrepareContext", ctx, selectStmt2)
+}
+
+func Test_Select_Replica_Ejected(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock, replicaMocks := newMockServiceWithReplicas(RoundRobin, 2)
+	params := []interface{}{3}
+
+	// when
+	replicaMocks[0].On("PingContext", mock.Anything).Return(errors.New("connection refused")).Once()
+	replicaMocks[1].On("PingContext", mock.Anything).Return(errors.New("connection refused")).Once()
+	service.checkReplicas(time.Second)
+	patchEmptySelect(sqlMock, selectStmt2, params)
+	_, errEjected := service.Select(nil, selectStmt2, false, params...)
+
+	replicaMocks[0].On("PingContext", mock.Anything).Return(nil).Once()
+	replicaMocks[1].On("PingContext", mock.Anything).Return(errors.New("connection refused")).Once()
+	service.checkReplicas(time.Second)
+	patchEmptySelect(replicaMocks[0], selectStmt2, params)
+	_, errRestored := service.Select(nil, selectStmt2, false, params...)
+
+	// then
+	ass.Nil(errEjected)
+	ass.Nil(errRestored)
+	ass.True(service.replicas.nodes[0].isHealthy())
+	ass.False(service.replicas.nodes[1].isHealthy())
+	sqlMock.AssertExpectations(t)
+	replicaMocks[0].AssertExpectations(t)
+}
+
+func Test_PoolStatsByNode(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock, replicaMocks := newMockServiceWithReplicas(RoundRobin, 1)
+
+	// when
+	sqlMock.PatchStats(sql.DBStats{OpenConnections: 4})
+	replicaMocks[0].PatchStats(sql.DBStats{OpenConnections: 2})
+	stats := service.PoolStatsByNode()
+
+	// then
+	ass.Equal(4, stats["primary"].OpenConnections)
+	ass.Equal(2, stats["a"].OpenConnections)
+}
+
+func Test_IsReadOnlyQuery(t *testing.T) {
+	ass := assert.New(t)
+
+	ass.True(isReadOnlyQuery("SELECT * FROM test"))
+	ass.True(isReadOnlyQuery("  with t AS (SELECT 1) SELECT * FROM t"))
+	ass.True(isReadOnlyQuery("(SELECT 1) UNION (SELECT 2)"))
+	ass.False(isReadOnlyQuery("SELECT * FROM test FOR UPDATE"))
+	ass.False(isReadOnlyQuery("SELECT * FROM test FOR SHARE"))
+	ass.False(isReadOnlyQuery("WITH d AS (DELETE FROM test RETURNING id) SELECT * FROM d"))
+	ass.False(isReadOnlyQuery("INSERT INTO test (id) VALUES (1) RETURNING id"))
+	ass.False(isReadOnlyQuery("UPDATE test SET id = 1"))
+	ass.False(isReadOnlyQuery("SELECT nextval('orders_id_seq')"))
+	ass.False(isReadOnlyQuery("SELECT pg_advisory_lock($1)"))
+	ass.False(isReadOnlyQuery("SELECT 1 WHERE pg_try_advisory_lock($1)"))
+	ass.False(isReadOnlyQuery("SELECT PG_NOTIFY('orders', $1)"))
+	ass.True(isReadOnlyQuery("SELECT next_value FROM sequences"))
+}
@@ -1,9 +1,36 @@
 package database
 
+import (
+	"database/sql"
+	"sort"
+)
+
 // DBResult it's a database result struct
 type DBResult struct {
 	affectedRows int64
 	rows         DBRows
+	columns      []DBColumnInfo
+}
+
+// DBColumnInfo describes a column of a result
+type DBColumnInfo struct {
+	Name string `json:"name"`
+	// DatabaseTypeName is the postgres type in upper case, e.g. INT8, VARCHAR, NUMERIC or _TEXT for text[].
+	// It's empty if the driver doesn't report it.
+	DatabaseTypeName string `json:"database_type_name"`
+	// Nullable is only meaningful if NullableKnown, the postgres driver doesn't report it
+	Nullable      bool `json:"nullable"`
+	NullableKnown bool `json:"nullable_known"`
+	// Length is the length of variable length types, e.g. 255 for VARCHAR(255)
+	Length    int64 `json:"length"`
+	HasLength bool  `json:"has_length"`
+	// Precision and Scale are the ones of decimal types, e.g. 10 and 2 for NUMERIC(10,2)
+	Precision         int64 `json:"precision"`
+	Scale             int64 `json:"scale"`
+	HasPrecisionScale bool  `json:"has_precision_scale"`
+	// Duplicate is true if another column of the result has the same name. Only the last of them is
+	// read by name, the others can be read by index.
+	Duplicate bool `json:"duplicate"`
 }
 
 //
@@ -17,3 +44,54 @@ func (dbr *DBResult) AffectedRows() int64 {
 func (dbr *DBResult) GetRows() []DBRow {
 	return dbr.rows.DBRowArray
 }
+
+// Columns returns the columns of the resultset in the order of the query
+func (dbr *DBResult) Columns() []DBColumnInfo {
+	return dbr.columns
+}
+
+// duplicateColumns returns the names shared by more than one column, or nil if there are none
+func duplicateColumns(cols []string) map[string]struct{} {
+	var duplicates map[string]struct{}
+	seen := make(map[string]struct{}, len(cols))
+	for _, name := range cols {
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			continue
+		}
+		if duplicates == nil {
+			duplicates = make(map[string]struct{})
+		}
+		duplicates[name] = struct{}{}
+	}
+	return duplicates
+}
+
+// newColumnInfos describes the columns of a result. colTypes can be nil, then only the names are set.
+func newColumnInfos(cols []string, colTypes []*sql.ColumnType, duplicates map[string]struct{}) []DBColumnInfo {
+	infos := make([]DBColumnInfo, len(cols))
+	for i, name := range cols {
+		infos[i].Name = name
+		_, infos[i].Duplicate = duplicates[name]
+		if i >= len(colTypes) || colTypes[i] == nil {
+			continue
+		}
+
+		colType := colTypes[i]
+		infos[i].DatabaseTypeName = colType.DatabaseTypeName()
+		infos[i].Nullable, infos[i].NullableKnown = colType.Nullable()
+		infos[i].Length, infos[i].HasLength = colType.Length()
+		infos[i].Precision, infos[i].Scale, infos[i].HasPrecisionScale = colType.DecimalSize()
+	}
+	return infos
+}
+
+// sortedColumnNames returns the names of the columns sorted, it's the order of the rows built from a map
+func sortedColumnNames(columns DBColumns) []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
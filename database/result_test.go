@@ -0,0 +1,206 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// columnTypesDriver is a driver whose queries return no rows and the columns of columnTypesRows,
+// the only way to build *sql.ColumnType values
+type columnTypesDriver struct{}
+
+type columnTypesConn struct{}
+
+type columnTypesStmt struct{}
+
+type columnTypesRows struct{}
+
+func init() {
+	sql.Register("column_types_test", columnTypesDriver{})
+}
+
+func (columnTypesDriver) Open(name string) (driver.Conn, error) { return columnTypesConn{}, nil }
+
+func (columnTypesConn) Prepare(query string) (driver.Stmt, error) { return columnTypesStmt{}, nil }
+func (columnTypesConn) Close() error                              { return nil }
+func (columnTypesConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func (columnTypesStmt) Close() error  { return nil }
+func (columnTypesStmt) NumInput() int { return -1 }
+func (columnTypesStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (columnTypesStmt) Query(args []driver.Value) (driver.Rows, error) { return columnTypesRows{}, nil }
+
+func (columnTypesRows) Columns() []string              { return []string{"id", "title", "price", "id"} }
+func (columnTypesRows) Close() error                   { return nil }
+func (columnTypesRows) Next(dest []driver.Value) error { return io.EOF }
+
+func (columnTypesRows) ColumnTypeDatabaseTypeName(index int) string {
+	return []string{"INT8", "VARCHAR", "NUMERIC", "UUID"}[index]
+}
+
+func (columnTypesRows) ColumnTypeLength(index int) (int64, bool) {
+	if index == 1 {
+		return 255, true
+	}
+	return 0, false
+}
+
+func (columnTypesRows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	if index == 2 {
+		return 10, 2, true
+	}
+	return 0, 0, false
+}
+
+func (columnTypesRows) ColumnTypeNullable(index int) (bool, bool) {
+	return index != 0, true
+}
+
+// queryColumnTypes returns the column types of the columnTypesDriver
+func queryColumnTypes(t *testing.T) []*sql.ColumnType {
+	db, err := sql.Open("column_types_test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return colTypes
+}
+
+// queryDriverRows returns the rows of a query of the columnTypesDriver, to be returned by the
+// mocks that give *sql.Rows
+func queryDriverRows(t *testing.T) *sql.Rows {
+	db, err := sql.Open("column_types_test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func Test_Select_Keeps_Columns_In_Order(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	query := "SELECT p.id, p.title, p.price, o.id FROM properties p JOIN owners o ON o.id = p.owner_id WHERE p.id = $1"
+	stmtMock := newDBStmtMock()
+	rowsMock := newDBRowsMock()
+	cols := []string{"id", "title", "price", "id"}
+
+	// when
+	sqlMock.PatchPrepare(query, stmtMock, nil)
+	stmtMock.PatchQuery([]interface{}{1}, rowsMock, nil)
+	stmtMock.PatchClose(nil)
+	rowsMock.PatchColumns(cols, nil)
+	rowsMock.PatchColumnTypes(queryColumnTypes(t), nil)
+	rowsMock.PatchNext(true)
+	rowsMock.On("Scan", mock.Anything).Run(func(args mock.Arguments) {
+		values := []interface{}{int64(7), "Casa", nil, "owner-uuid"}
+		for i, dest := range args.Get(0).([]interface{}) {
+			*dest.(*interface{}) = values[i]
+		}
+	}).Return(nil).Once()
+	rowsMock.PatchNext(false)
+	rowsMock.PatchClose(nil)
+	dbResult, err := service.Select(nil, query, false, 1)
+
+	// then
+	ass.Nil(err)
+	ass.Equal([]DBColumnInfo{
+		{Name: "id", DatabaseTypeName: "INT8", NullableKnown: true, Duplicate: true},
+		{Name: "title", DatabaseTypeName: "VARCHAR", Nullable: true, NullableKnown: true, Length: 255, HasLength: true},
+		{Name: "price", DatabaseTypeName: "NUMERIC", Nullable: true, NullableKnown: true, Precision: 10, Scale: 2,
+			HasPrecisionScale: true},
+		{Name: "id", DatabaseTypeName: "UUID", Nullable: true, NullableKnown: true, Duplicate: true},
+	}, dbResult.Columns())
+
+	row := dbResult.GetRows()[0]
+	ass.Equal(4, row.ColumnCount())
+	propertyID, err := row.GetColumnByIndex(0)
+	ass.Nil(err)
+	ass.Equal(int64(7), propertyID.GetRawValue())
+	ownerID, err := row.GetColumnByIndex(3)
+	ass.Nil(err)
+	ass.Equal("id", ownerID.GetColumnName())
+	// the last column with the name is read by name
+	byName, err := row.GetColumnByName("id")
+	ass.Nil(err)
+	ass.Equal("owner-uuid", byName.GetRawValue())
+	_, err = row.GetColumnByIndex(4)
+	ass.EqualError(err, "column index 4 out of range, the row has 4 columns")
+	title, err := row.GetColumnByName("title")
+	ass.Nil(err)
+	ass.Equal("title", title.GetColumnName())
+}
+
+func Test_Mocked_DBResult_Columns_Are_Sorted(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	// when
+	dbResult := ParseMockDBResultFromJSON(`[{"b": 1, "a": "x"}, {"c": true}]`)
+
+	// then
+	ass.Equal([]DBColumnInfo{{Name: "a"}, {Name: "b"}, {Name: "c"}}, dbResult.Columns())
+	first, err := dbResult.GetRows()[0].GetColumnByIndex(0)
+	ass.Nil(err)
+	ass.Equal("a", first.GetColumnName())
+	ass.Equal(2, dbResult.GetRows()[0].ColumnCount())
+}
+
+func Test_ScanRowInto_Ambiguous_Column(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	type owner struct {
+		ID int64 `db:"id"`
+	}
+	row := DBRow{
+		columns:    DBColumns{"id": {name: "id", field: int64(1)}},
+		ordered:    []DBColumn{{name: "id", field: int64(1)}, {name: "id", field: int64(2)}},
+		duplicates: duplicateColumns([]string{"id", "id"}),
+	}
+
+	// when
+	result, err := ScanRowInto[owner](&row)
+
+	// then
+	ass.Nil(result)
+	ass.EqualError(err, "'id' ambiguous column, more than one column has it")
+}
+
+func Test_ScanRowInto_Ambiguous_Columns_Sorted(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	type owner struct {
+		ID    int64  `db:"id"`
+		Title string `db:"title"`
+	}
+	row := DBRow{duplicates: duplicateColumns([]string{"title", "id", "title", "id"})}
+
+	// when
+	_, err := ScanRowInto[owner](&row)
+
+	// then
+	ass.EqualError(err, "'id', 'title' ambiguous column, more than one column has it")
+}
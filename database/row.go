@@ -2,12 +2,20 @@ package database
 
 import (
 	"fmt"
+	"math/big"
 	"reflect"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
 )
 
 // DBRow it's a row
 type DBRow struct {
 	columns DBColumns
+	// ordered are the columns in the order of the query, including the ones with a duplicated name
+	ordered []DBColumn
+	// duplicates are the names shared by more than one column, only the last of them is read by name
+	duplicates map[string]struct{}
 }
 
 // DBRowArray it's an array of row
@@ -20,19 +28,27 @@ type DBRows struct {
 
 //
 
-// NewRow create a new row
+// NewRow create a new row, its columns are ordered by name
 func NewRow(columns DBColumns) *DBRow {
+	ordered := make([]DBColumn, 0, len(columns))
+	for _, name := range sortedColumnNames(columns) {
+		ordered = append(ordered, columns[name])
+	}
 	return &DBRow{
 		columns: columns,
+		ordered: ordered,
 	}
 }
 
-// Equals returns if both db rows contain
+// Equals returns if both db rows contain the same columns by name. The order of the columns, and
+// the ones hidden by a duplicated name, are ignored, so the rows built with NewRow (ordered by name)
+// equal the ones of a query.
 func (dbr *DBRow) Equals(row *DBRow) bool {
 	return reflect.DeepEqual(dbr.columns, row.columns)
 }
 
-// GetColumnByName retrieves a column by it's name
+// GetColumnByName retrieves a column by it's name. If more than one column has the name, e.g. the id
+// of both tables of a join, it's the last one; the others can be retrieved by index.
 func (dbr *DBRow) GetColumnByName(name string) (*DBColumn, error) {
 	dbc, ok := dbr.columns[name]
 	if !ok {
@@ -41,6 +57,27 @@ func (dbr *DBRow) GetColumnByName(name string) (*DBColumn, error) {
 	return &dbc, nil
 }
 
+// GetColumnByIndex retrieves a column by it's position in the query, starting at 0
+func (dbr *DBRow) GetColumnByIndex(index int) (*DBColumn, error) {
+	if index < 0 || index >= len(dbr.ordered) {
+		return nil, fmt.Errorf("column index %d out of range, the row has %d columns", index, len(dbr.ordered))
+	}
+	dbc := dbr.ordered[index]
+	return &dbc, nil
+}
+
+// GetColumns returns the columns in the order of the query
+func (dbr *DBRow) GetColumns() []DBColumn {
+	columns := make([]DBColumn, len(dbr.ordered))
+	copy(columns, dbr.ordered)
+	return columns
+}
+
+// ColumnCount returns the quantity of columns of the row
+func (dbr *DBRow) ColumnCount() int {
+	return len(dbr.ordered)
+}
+
 // GetBufferByName retrieves a column by it's name
 func (dbr *DBRow) GetBufferByName(name string) ([]byte, error) {
 	dbc, err := dbr.GetColumnByName(name)
@@ -190,3 +227,174 @@ func (dbr *DBRow) GetBoolByNameRequired(name string) (bool, error) {
 	}
 	return *val, nil
 }
+
+// GetTimeByName retrieves a column by it's name
+func (dbr *DBRow) GetTimeByName(name string) (*time.Time, error) {
+	dbc, err := dbr.GetColumnByName(name)
+	if err != nil {
+		return nil, err
+	}
+	val, err := dbc.GetTime()
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetTimeByNameRequired retrieves a non-empty column by it's name
+func (dbr *DBRow) GetTimeByNameRequired(name string) (time.Time, error) {
+	val, err := dbr.GetTimeByName(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if val == nil { // Here we don't compare against zero-value
+		return time.Time{}, fmt.Errorf("'%s' required field returned empty value", name)
+	}
+	return *val, nil
+}
+
+// GetUUIDByName retrieves a column by it's name
+func (dbr *DBRow) GetUUIDByName(name string) (*uuid.UUID, error) {
+	dbc, err := dbr.GetColumnByName(name)
+	if err != nil {
+		return nil, err
+	}
+	val, err := dbc.GetUUID()
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetUUIDByNameRequired retrieves a non-empty column by it's name
+func (dbr *DBRow) GetUUIDByNameRequired(name string) (uuid.UUID, error) {
+	val, err := dbr.GetUUIDByName(name)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if val == nil { // Here we don't compare against zero-value
+		return uuid.Nil, fmt.Errorf("'%s' required field returned empty value", name)
+	}
+	return *val, nil
+}
+
+// GetDecimalByName retrieves a column by it's name
+func (dbr *DBRow) GetDecimalByName(name string) (*big.Rat, error) {
+	dbc, err := dbr.GetColumnByName(name)
+	if err != nil {
+		return nil, err
+	}
+	val, err := dbc.GetDecimal()
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetDecimalByNameRequired retrieves a non-empty column by it's name
+func (dbr *DBRow) GetDecimalByNameRequired(name string) (*big.Rat, error) {
+	val, err := dbr.GetDecimalByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil { // Here we don't compare against zero-value
+		return nil, fmt.Errorf("'%s' required field returned empty value", name)
+	}
+	return val, nil
+}
+
+// GetJSONByName decodes a column retrieved by it's name into the given pointer
+func (dbr *DBRow) GetJSONByName(name string, into interface{}) error {
+	dbc, err := dbr.GetColumnByName(name)
+	if err != nil {
+		return err
+	}
+	return dbc.GetJSON(into)
+}
+
+// GetJSONByNameRequired decodes a non-empty column retrieved by it's name into the given pointer
+func (dbr *DBRow) GetJSONByNameRequired(name string, into interface{}) error {
+	dbc, err := dbr.GetColumnByName(name)
+	if err != nil {
+		return err
+	}
+	if dbc.GetRawValue() == nil {
+		return fmt.Errorf("'%s' required field returned empty value", name)
+	}
+	return dbc.GetJSON(into)
+}
+
+// GetStringArrayByName retrieves a column by it's name
+func (dbr *DBRow) GetStringArrayByName(name string) ([]string, error) {
+	dbc, err := dbr.GetColumnByName(name)
+	if err != nil {
+		return nil, err
+	}
+	val, err := dbc.GetStringArray()
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetStringArrayByNameRequired retrieves a non-empty column by it's name
+func (dbr *DBRow) GetStringArrayByNameRequired(name string) ([]string, error) {
+	val, err := dbr.GetStringArrayByName(name)
+	if err != nil {
+		return []string{}, err
+	}
+	if len(val) == 0 {
+		return []string{}, fmt.Errorf("'%s' required field returned empty value", name)
+	}
+	return val, nil
+}
+
+// GetInt64ArrayByName retrieves a column by it's name
+func (dbr *DBRow) GetInt64ArrayByName(name string) ([]int64, error) {
+	dbc, err := dbr.GetColumnByName(name)
+	if err != nil {
+		return nil, err
+	}
+	val, err := dbc.GetInt64Array()
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetInt64ArrayByNameRequired retrieves a non-empty column by it's name
+func (dbr *DBRow) GetInt64ArrayByNameRequired(name string) ([]int64, error) {
+	val, err := dbr.GetInt64ArrayByName(name)
+	if err != nil {
+		return []int64{}, err
+	}
+	if len(val) == 0 {
+		return []int64{}, fmt.Errorf("'%s' required field returned empty value", name)
+	}
+	return val, nil
+}
+
+// GetDurationByName retrieves a column by it's name
+func (dbr *DBRow) GetDurationByName(name string) (*time.Duration, error) {
+	dbc, err := dbr.GetColumnByName(name)
+	if err != nil {
+		return nil, err
+	}
+	val, err := dbc.GetDuration()
+	if err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetDurationByNameRequired retrieves a non-empty column by it's name
+func (dbr *DBRow) GetDurationByNameRequired(name string) (time.Duration, error) {
+	val, err := dbr.GetDurationByName(name)
+	if err != nil {
+		return 0, err
+	}
+	if val == nil { // Here we don't compare against zero-value
+		return 0, fmt.Errorf("'%s' required field returned empty value", name)
+	}
+	return *val, nil
+}
@@ -2,6 +2,7 @@ package database_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/FlatDigital/core-go-toolkit/v2/database"
 	"github.com/stretchr/testify/assert"
@@ -740,3 +741,54 @@ func Test_GetBoolByNameRequired_Success(t *testing.T) {
 	ass.Nil(err)
 	ass.Equal(colValue1, resultInt)
 }
+
+func Test_GetTypedValuesByName(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	createdAt := time.Date(2023, 5, 17, 10, 30, 0, 0, time.UTC)
+
+	columns := make(database.DBColumns)
+	columns["created_at"] = *database.NewColumn("created_at", createdAt)
+	columns["id"] = *database.NewColumn("id", []byte("6ba7b810-9dad-11d1-80b4-00c04fd430c8"))
+	columns["amount"] = *database.NewColumn("amount", []byte("10.25"))
+	columns["data"] = *database.NewColumn("data", []byte(`{"tag": "a"}`))
+	columns["tags"] = *database.NewColumn("tags", []byte(`{a,b}`))
+	columns["ids"] = *database.NewColumn("ids", []byte(`{}`))
+	columns["ttl"] = *database.NewColumn("ttl", []byte("00:05:00"))
+	columns["null"] = *database.NewColumn("null", nil)
+	row := database.NewRow(columns)
+
+	// when
+	timeValue, timeErr := row.GetTimeByNameRequired("created_at")
+	uuidValue, uuidErr := row.GetUUIDByNameRequired("id")
+	decimalValue, decimalErr := row.GetDecimalByNameRequired("amount")
+	var data map[string]string
+	jsonErr := row.GetJSONByNameRequired("data", &data)
+	tags, tagsErr := row.GetStringArrayByNameRequired("tags")
+	_, idsErr := row.GetInt64ArrayByNameRequired("ids")
+	ttl, ttlErr := row.GetDurationByNameRequired("ttl")
+	nullTime, nullTimeErr := row.GetTimeByName("null")
+	_, nullDurationErr := row.GetDurationByNameRequired("null")
+	nullJSONErr := row.GetJSONByNameRequired("null", &data)
+	_, missingErr := row.GetUUIDByName("missing")
+
+	// then
+	ass.Nil(timeErr)
+	ass.Equal(createdAt, timeValue)
+	ass.Nil(uuidErr)
+	ass.Equal("6ba7b810-9dad-11d1-80b4-00c04fd430c8", uuidValue.String())
+	ass.Nil(decimalErr)
+	ass.Equal("10.25", decimalValue.FloatString(2))
+	ass.Nil(jsonErr)
+	ass.Equal(map[string]string{"tag": "a"}, data)
+	ass.Nil(tagsErr)
+	ass.Equal([]string{"a", "b"}, tags)
+	ass.EqualError(idsErr, "'ids' required field returned empty value")
+	ass.Nil(ttlErr)
+	ass.Equal(5*time.Minute, ttl)
+	ass.Nil(nullTime)
+	ass.Nil(nullTimeErr)
+	ass.EqualError(nullDurationErr, "'null' required field returned empty value")
+	ass.EqualError(nullJSONErr, "'null' required field returned empty value")
+	ass.EqualError(missingErr, "'missing' key not found")
+}
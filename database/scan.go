@@ -0,0 +1,417 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	optional "github.com/FlatDigital/core-go-toolkit/v2/core/libs/go/optional"
+)
+
+const (
+	// dbTag is the struct tag used to map a field to a column
+	dbTag = "db"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+
+	// structFieldsCache caches the column to field mapping of every scanned struct type
+	structFieldsCache sync.Map
+)
+
+// structField is a struct field mapped to a column
+type structField struct {
+	column string
+	name   string
+	index  []int
+}
+
+// SelectInto does a Select and scans every returned row into a T struct, using the `db:"column"` tags
+// of its fields
+func SelectInto[T any](db Database, dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) ([]T, error) {
+	dbResult, err := db.Select(dbc, query, forUpdate, params...)
+	if err != nil {
+		return nil, err
+	}
+	return ScanRowsInto[T](dbResult.GetRows())
+}
+
+// SelectOneInto does a Select and scans the returned row into a T struct. It returns nil if there
+// are no rows and an error if there is more than one, like SelectUniqueValue.
+func SelectOneInto[T any](db Database, dbc *DBContext, query string, forUpdate bool,
+	params ...interface{}) (*T, error) {
+	dbRow, err := db.SelectUniqueValue(dbc, query, forUpdate, params...)
+	if err != nil {
+		return nil, err
+	}
+	if dbRow == nil {
+		return nil, nil
+	}
+	return ScanRowInto[T](dbRow)
+}
+
+// ScanRowsInto scans every row into a T struct
+func ScanRowsInto[T any](rows []DBRow) ([]T, error) {
+	result := make([]T, 0, len(rows))
+	for i := range rows {
+		item, err := ScanRowInto[T](&rows[i])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *item)
+	}
+	return result, nil
+}
+
+// ScanRowInto scans a row into a T struct. Every tagged field must have its column in the row and
+// every column of the row must have a tagged field, otherwise an error naming the column is returned.
+func ScanRowInto[T any](row *DBRow) (*T, error) {
+	item := new(T)
+	value := reflect.ValueOf(item).Elem()
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unable to scan into %s, it must be a struct", value.Type())
+	}
+
+	fields := getStructFields(value.Type())
+
+	// Every column must have a field, and only one
+	if len(row.duplicates) != 0 {
+		names := make([]string, 0, len(row.duplicates))
+		for name := range row.duplicates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("'%s' ambiguous column, more than one column has it", strings.Join(names, "', '"))
+	}
+	for name := range row.columns {
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("'%s' unknown column, %s has no field tagged with it", name, value.Type())
+		}
+	}
+
+	// Every field must have a column
+	for column, field := range fields {
+		dbColumn, ok := row.columns[column]
+		if !ok {
+			return nil, fmt.Errorf("'%s' column not found for field %s.%s", column, value.Type(), field.name)
+		}
+		if err := assignColumn(&dbColumn, value.FieldByIndex(field.index), field.name); err != nil {
+			return nil, err
+		}
+	}
+
+	return item, nil
+}
+
+// getStructFields returns the tagged fields of a struct type, indexed by column
+func getStructFields(structType reflect.Type) map[string]structField {
+	if cached, ok := structFieldsCache.Load(structType); ok {
+		return cached.(map[string]structField)
+	}
+
+	fields := make(map[string]structField)
+	collectStructFields(structType, nil, fields)
+
+	structFieldsCache.Store(structType, fields)
+	return fields
+}
+
+func collectStructFields(structType reflect.Type, parentIndex []int, fields map[string]structField) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		index := append(append(make([]int, 0, len(parentIndex)+1), parentIndex...), i)
+
+		tag := strings.Split(field.Tag.Get(dbTag), ",")[0]
+		if tag == "-" {
+			continue
+		}
+
+		// Untagged embedded structs are flattened
+		if tag == "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				collectStructFields(field.Type, index, fields)
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		fields[tag] = structField{
+			column: tag,
+			name:   field.Name,
+			index:  index,
+		}
+	}
+}
+
+// assignColumn sets the value of the column into the field
+func assignColumn(dbc *DBColumn, field reflect.Value, fieldName string) error {
+	// Optional types
+	switch target := field.Addr().Interface().(type) {
+	case *optional.Int64:
+		val, err := int64Value(dbc)
+		if err != nil {
+			return err
+		}
+		target.Set, target.Valid = true, val != nil
+		if val != nil {
+			target.Value = *val
+		}
+		return nil
+	case *optional.Uint64:
+		val, err := uint64Value(dbc)
+		if err != nil {
+			return err
+		}
+		target.Set, target.Valid = true, val != nil
+		if val != nil {
+			target.Value = *val
+		}
+		return nil
+	case *optional.Float64:
+		val, err := dbc.GetFloat64()
+		if err != nil {
+			return err
+		}
+		target.Set, target.Valid = true, val != nil
+		if val != nil {
+			target.Value = *val
+		}
+		return nil
+	case *optional.String:
+		val, err := dbc.GetString()
+		if err != nil {
+			return err
+		}
+		target.Set, target.Valid = true, val != nil
+		if val != nil {
+			target.Value = *val
+		}
+		return nil
+	case *optional.Bool:
+		val, err := dbc.GetBool()
+		if err != nil {
+			return err
+		}
+		target.Set, target.Valid = true, val != nil
+		if val != nil {
+			target.Value = *val
+		}
+		return nil
+	case *optional.Date:
+		val, err := dbc.GetTime()
+		if err != nil {
+			return err
+		}
+		target.Set, target.Valid = true, val != nil
+		if val != nil {
+			target.Value = val.Format(optional.YYYYMMDD)
+		}
+		return nil
+	case *optional.DateTime:
+		val, err := dbc.GetTime()
+		if err != nil {
+			return err
+		}
+		target.Set, target.Valid = true, val != nil
+		if val != nil {
+			target.Value = *val
+		}
+		return nil
+	case *optional.StringArray:
+		val, err := dbc.GetStringArray()
+		if err != nil {
+			return err
+		}
+		target.Set, target.Valid, target.Value = true, val != nil, val
+		return nil
+	case *optional.Uint64Array:
+		val, err := dbc.GetInt64Array()
+		if err != nil {
+			return err
+		}
+		target.Set, target.Valid = true, val != nil
+		target.Value = nil
+		for _, item := range val {
+			if item < 0 {
+				return fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+			}
+			target.Value = append(target.Value, uint64(item))
+		}
+		return nil
+	case *optional.MapStringInterface:
+		target.Set, target.Valid = true, dbc.field != nil
+		if dbc.field == nil {
+			return nil
+		}
+		return jsonValue(dbc, &target.Value)
+	case sql.Scanner:
+		if err := target.Scan(dbc.field); err != nil {
+			return fmt.Errorf("'%s' invalid type for field %s: %v", dbc.name, fieldName, err)
+		}
+		return nil
+	}
+
+	// NULL values
+	if dbc.field == nil {
+		switch field.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		default:
+			return fmt.Errorf("'%s' is NULL but field %s is not nullable", dbc.name, fieldName)
+		}
+	}
+
+	// Nullable pointers
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := assignColumn(dbc, elem.Elem(), fieldName); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	if field.Type() == timeType {
+		val, err := dbc.GetTime()
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(*val))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Interface:
+		field.Set(reflect.ValueOf(dbc.field))
+	case reflect.String:
+		val, err := dbc.GetString()
+		if err != nil {
+			return err
+		}
+		field.SetString(*val)
+	case reflect.Bool:
+		val, err := dbc.GetBool()
+		if err != nil {
+			return err
+		}
+		field.SetBool(*val)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val, err := int64Value(dbc)
+		if err != nil {
+			return err
+		}
+		if field.OverflowInt(*val) {
+			return fmt.Errorf("'%s' value '%d' overflows field %s", dbc.name, *val, fieldName)
+		}
+		field.SetInt(*val)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val, err := uint64Value(dbc)
+		if err != nil {
+			return err
+		}
+		if field.OverflowUint(*val) {
+			return fmt.Errorf("'%s' value '%d' overflows field %s", dbc.name, *val, fieldName)
+		}
+		field.SetUint(*val)
+	case reflect.Float32, reflect.Float64:
+		val, err := dbc.GetFloat64()
+		if err != nil {
+			return err
+		}
+		field.SetFloat(*val)
+	case reflect.Slice:
+		switch field.Type().Elem().Kind() {
+		case reflect.Uint8:
+			val, err := dbc.GetBuffer()
+			if err != nil {
+				return err
+			}
+			field.SetBytes(val)
+		case reflect.String:
+			val, err := dbc.GetStringArray()
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(val).Convert(field.Type()))
+		case reflect.Int64:
+			val, err := dbc.GetInt64Array()
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(val).Convert(field.Type()))
+		default:
+			return jsonValue(dbc, field.Addr().Interface())
+		}
+	case reflect.Map, reflect.Struct:
+		// utils.Set, maps and structs are stored as JSON
+		return jsonValue(dbc, field.Addr().Interface())
+	default:
+		return fmt.Errorf("'%s' unsupported type %s for field %s", dbc.name, field.Type(), fieldName)
+	}
+
+	return nil
+}
+
+// int64Value returns the value of the column as an int64. Integral float64 values are accepted
+// because that is how numbers come from a mocked DBResult parsed from JSON.
+func int64Value(dbc *DBColumn) (*int64, error) {
+	if floatValue, ok := dbc.field.(float64); ok {
+		if floatValue != math.Trunc(floatValue) {
+			return nil, fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+		}
+		int64Value := int64(floatValue)
+		return &int64Value, nil
+	}
+	return dbc.GetInt64()
+}
+
+// uint64Value returns the value of the column as an uint64, accepting integral float64 values like int64Value
+func uint64Value(dbc *DBColumn) (*uint64, error) {
+	if _, ok := dbc.field.(float64); ok {
+		int64Ptr, err := int64Value(dbc)
+		if err != nil {
+			return nil, err
+		}
+		if *int64Ptr < 0 {
+			return nil, fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+		}
+		uint64Value := uint64(*int64Ptr)
+		return &uint64Value, nil
+	}
+	return dbc.GetUInt64()
+}
+
+// jsonValue decodes the JSON value of the column into the given pointer
+func jsonValue(dbc *DBColumn, into interface{}) error {
+	var data []byte
+	switch val := dbc.field.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	default:
+		// Already decoded values (e.g. from a mocked DBResult) are encoded back
+		var err error
+		data, err = json.Marshal(val)
+		if err != nil {
+			return fmt.Errorf("'%s' invalid type, value '%v'", dbc.name, dbc.field)
+		}
+	}
+
+	if err := json.Unmarshal(data, into); err != nil {
+		return fmt.Errorf("'%s' invalid JSON value: %v", dbc.name, err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	optional "github.com/FlatDigital/core-go-toolkit/v2/core/libs/go/optional"
+	"github.com/FlatDigital/core-go-toolkit/v2/database"
+	"github.com/FlatDigital/core-go-toolkit/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type scanBase struct {
+	ID int64 `db:"id"`
+}
+
+type scanEntity struct {
+	scanBase
+	Name      string                      `db:"name"`
+	Nickname  *string                     `db:"nickname"`
+	Age       uint8                       `db:"age"`
+	Score     float64                     `db:"score"`
+	Active    bool                        `db:"active"`
+	Payload   []byte                      `db:"payload"`
+	CreatedOn time.Time                   `db:"created_on"`
+	DeletedOn *time.Time                  `db:"deleted_on"`
+	Tags      []string                    `db:"tags"`
+	Labels    *utils.Set[string]          `db:"labels"`
+	Floor     optional.Int64              `db:"floor"`
+	Since     optional.Date               `db:"since"`
+	Extra     optional.MapStringInterface `db:"extra"`
+	Ignored   string                      `db:"-"`
+}
+
+func newScanRow(values map[string]interface{}) database.DBRow {
+	columns := make(database.DBColumns)
+	for name, value := range values {
+		columns[name] = *database.NewColumn(name, value)
+	}
+	return *database.NewRow(columns)
+}
+
+func newScanEntityValues() map[string]interface{} {
+	return map[string]interface{}{
+		"id":         int64(7),
+		"name":       "flat",
+		"nickname":   nil,
+		"age":        int64(30),
+		"score":      []byte("9.5"),
+		"active":     true,
+		"payload":    []byte("raw"),
+		"created_on": time.Date(2022, 3, 23, 10, 0, 0, 0, time.UTC),
+		"deleted_on": "2022-03-24T10:00:00Z",
+		"tags":       []byte(`{a,"b c"}`),
+		"labels":     []byte(`["x","y"]`),
+		"floor":      nil,
+		"since":      time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC),
+		"extra":      []byte(`{"key":"value"}`),
+	}
+}
+
+func Test_ScanRowInto_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	row := newScanRow(newScanEntityValues())
+
+	// when
+	entity, err := database.ScanRowInto[scanEntity](&row)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(int64(7), entity.ID)
+	ass.Equal("flat", entity.Name)
+	ass.Nil(entity.Nickname)
+	ass.Equal(uint8(30), entity.Age)
+	ass.Equal(9.5, entity.Score)
+	ass.True(entity.Active)
+	ass.Equal([]byte("raw"), entity.Payload)
+	ass.Equal(time.Date(2022, 3, 23, 10, 0, 0, 0, time.UTC), entity.CreatedOn)
+	ass.Equal(time.Date(2022, 3, 24, 10, 0, 0, 0, time.UTC), *entity.DeletedOn)
+	ass.Equal([]string{"a", "b c"}, entity.Tags)
+	ass.True(entity.Labels.Has("x"))
+	ass.True(entity.Labels.Has("y"))
+	ass.Equal(optional.Int64{Set: true, Valid: false}, entity.Floor)
+	ass.Equal(optional.Date{Value: "2021-01-02", Set: true, Valid: true}, entity.Since)
+	ass.Equal("value", entity.Extra.Value["key"])
+}
+
+func Test_ScanRowInto_UnknownColumn(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	values := newScanEntityValues()
+	values["unexpected"] = "value"
+	row := newScanRow(values)
+
+	// when
+	entity, err := database.ScanRowInto[scanEntity](&row)
+
+	// then
+	ass.Nil(entity)
+	ass.EqualError(err, "'unexpected' unknown column, database_test.scanEntity has no field tagged with it")
+}
+
+func Test_ScanRowInto_MissingColumn(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	values := newScanEntityValues()
+	delete(values, "name")
+	row := newScanRow(values)
+
+	// when
+	entity, err := database.ScanRowInto[scanEntity](&row)
+
+	// then
+	ass.Nil(entity)
+	ass.EqualError(err, "'name' column not found for field database_test.scanEntity.Name")
+}
+
+func Test_ScanRowInto_NullIntoNonNullable(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	values := newScanEntityValues()
+	values["name"] = nil
+	row := newScanRow(values)
+
+	// when
+	entity, err := database.ScanRowInto[scanEntity](&row)
+
+	// then
+	ass.Nil(entity)
+	ass.EqualError(err, "'name' is NULL but field Name is not nullable")
+}
+
+func Test_ScanRowInto_Overflow(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	values := newScanEntityValues()
+	values["age"] = int64(300)
+	row := newScanRow(values)
+
+	// when
+	entity, err := database.ScanRowInto[scanEntity](&row)
+
+	// then
+	ass.Nil(entity)
+	ass.EqualError(err, "'age' value '300' overflows field Age")
+}
+
+func Test_ScanRowInto_NotAStruct(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	row := newScanRow(map[string]interface{}{"id": int64(1)})
+
+	// when
+	value, err := database.ScanRowInto[int64](&row)
+
+	// then
+	ass.Nil(value)
+	ass.NotNil(err)
+}
+
+func Test_SelectInto_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	mock := database.NewMock()
+	query := "SELECT id FROM test"
+	params := []interface{}{}
+	dbr := database.ParseMockDBResultFromJSON(`[{"id":1},{"id":2}]`)
+	mock.PatchSelect(nil, query, false, params, dbr, nil)
+
+	// when
+	items, err := database.SelectInto[scanBase](mock, nil, query, false, params...)
+
+	// then
+	ass.Nil(err)
+	ass.Equal([]scanBase{{ID: 1}, {ID: 2}}, items)
+}
+
+func Test_SelectInto_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	mock := database.NewMock()
+	query := "SELECT id FROM test"
+	params := []interface{}{}
+	mock.PatchSelect(nil, query, false, params, nil, errors.New("select error"))
+
+	// when
+	items, err := database.SelectInto[scanBase](mock, nil, query, false, params...)
+
+	// then
+	ass.Nil(items)
+	ass.EqualError(err, "select error")
+}
+
+func Test_SelectOneInto_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	mock := database.NewMock()
+	query := "SELECT id FROM test WHERE id = $1"
+	params := []interface{}{1}
+	row := newScanRow(map[string]interface{}{"id": "1"})
+	mock.PatchSelectUniqueValue(nil, query, false, params, &row, nil)
+
+	// when
+	item, err := database.SelectOneInto[scanBase](mock, nil, query, false, params...)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(&scanBase{ID: 1}, item)
+}
+
+func Test_SelectOneInto_NoRows(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	mock := database.NewMock()
+	query := "SELECT id FROM test WHERE id = $1"
+	params := []interface{}{1}
+	mock.PatchSelectUniqueValue(nil, query, false, params, nil, nil)
+
+	// when
+	item, err := database.SelectOneInto[scanBase](mock, nil, query, false, params...)
+
+	// then
+	ass.Nil(err)
+	ass.Nil(item)
+}
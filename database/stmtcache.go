@@ -0,0 +1,262 @@
+package database
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database/converter"
+	"github.com/FlatDigital/core-go-toolkit/v2/godog"
+	"github.com/lib/pq"
+)
+
+const (
+	// pqFeatureNotSupported is the SQLSTATE of "cached plan must not change result type"
+	pqFeatureNotSupported pq.ErrorCode = "0A000"
+	cachedPlanMessage     string       = "cached plan must not change result type"
+
+	stmtScopeDB string = "db"
+	stmtScopeTx string = "tx"
+)
+
+type (
+	// stmtCache is a LRU cache of prepared statements keyed by query text. A statement evicted
+	// while in use is closed when its last user releases it.
+	stmtCache struct {
+		mutex   sync.Mutex
+		size    int
+		entries map[string]*list.Element
+		order   *list.List
+	}
+
+	// stmtCacheEntry is a cached statement and how many callers are using it
+	stmtCacheEntry struct {
+		query   string
+		stmt    converter.DBStmter
+		refs    int
+		evicted bool
+	}
+
+	// stmtPreparer prepares a statement when it's not in the cache
+	stmtPreparer func() (converter.DBStmter, error)
+)
+
+// newStmtCache returns a cache for size statements, or nil if size is not positive
+func newStmtCache(size int) *stmtCache {
+	if size <= 0 {
+		return nil
+	}
+	return &stmtCache{
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// acquire returns the cached statement for query, marking it as in use
+func (cache *stmtCache) acquire(query string) (*stmtCacheEntry, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, exists := cache.entries[query]
+	if !exists {
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	entry := element.Value.(*stmtCacheEntry)
+	entry.refs++
+	return entry, true
+}
+
+// add caches stmt as in use, evicting the least recently used statements if the cache is full
+func (cache *stmtCache) add(query string, stmt converter.DBStmter) *stmtCacheEntry {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	// Another caller could have prepared the same query in the meantime
+	if element, exists := cache.entries[query]; exists {
+		cache.evictLocked(element)
+	}
+
+	entry := &stmtCacheEntry{
+		query: query,
+		stmt:  stmt,
+		refs:  1,
+	}
+	cache.entries[query] = cache.order.PushFront(entry)
+
+	for cache.order.Len() > cache.size {
+		cache.evictLocked(cache.order.Back())
+	}
+	return entry
+}
+
+// release marks the statement as no longer in use by the caller
+func (cache *stmtCache) release(entry *stmtCacheEntry) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// evict removes the statement from the cache, it's closed when it's no longer in use
+func (cache *stmtCache) evict(entry *stmtCacheEntry) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if element, exists := cache.entries[entry.query]; exists && element.Value == entry {
+		cache.evictLocked(element)
+	}
+}
+
+// evictLocked removes the element from the cache, the mutex must be held
+func (cache *stmtCache) evictLocked(element *list.Element) {
+	entry := element.Value.(*stmtCacheEntry)
+	cache.order.Remove(element)
+	delete(cache.entries, entry.query)
+	entry.evicted = true
+	if entry.refs == 0 {
+		entry.stmt.Close()
+	}
+}
+
+// reset forgets every statement without closing them, used when the transaction that owns them ends
+func (cache *stmtCache) reset() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries = make(map[string]*list.Element)
+	cache.order.Init()
+}
+
+// len returns the amount of cached statements
+func (cache *stmtCache) len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.order.Len()
+}
+
+// addTxStmtCache creates the statement cache of a new transaction
+func (service *service) addTxStmtCache(tx converter.DBTxer) {
+	if cache := newStmtCache(service.stmtCacheSize); cache != nil && service.txStmts != nil {
+		service.txStmts.Store(tx, cache)
+	}
+}
+
+// txStmtCache returns the statement cache of the transaction, nil if caching is disabled
+func (service *service) txStmtCache(tx converter.DBTxer) *stmtCache {
+	if service.txStmts == nil {
+		return nil
+	}
+	cache, exists := service.txStmts.Load(tx)
+	if !exists {
+		return nil
+	}
+	return cache.(*stmtCache)
+}
+
+// removeTxStmtCache forgets the statements of a finished transaction, which are released with it
+func (service *service) removeTxStmtCache(tx converter.DBTxer) {
+	if cache := service.txStmtCache(tx); cache != nil {
+		cache.reset()
+		service.txStmts.Delete(tx)
+	}
+}
+
+// isCachedPlanError returns if the error means the prepared statement is no longer valid because
+// the schema of a table it uses changed
+func isCachedPlanError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr == nil {
+		return false
+	}
+	return pqErr.Code == pqFeatureNotSupported && strings.Contains(pqErr.Message, cachedPlanMessage)
+}
+
+// stmtCacheFor returns the statement cache of the given pool, nil if caching is disabled
+func (service *service) stmtCacheFor(db converter.DBer) *stmtCache {
+	if db == service.db {
+		return service.stmts
+	}
+	if service.replicas != nil {
+		for _, node := range service.replicas.nodes {
+			if node.db == db {
+				return node.stmts
+			}
+		}
+	}
+	return nil
+}
+
+// withStmt runs fn with the prepared statement for query. Without a cache the statement is prepared
+// and, unless it belongs to a transaction, closed after fn. With a cache it's reused, and if Postgres
+// reports that its plan is stale it's evicted and, outside a transaction, prepared again and retried once.
+func (service *service) withStmt(cache *stmtCache, scope string, query string, prepare stmtPreparer,
+	fn func(stmt converter.DBStmter) error) error {
+	if cache == nil {
+		stmt, err := prepare()
+		if err != nil {
+			return err
+		}
+		if scope != stmtScopeTx {
+			defer stmt.Close()
+		}
+		return fn(stmt)
+	}
+
+	entry, err := service.acquireStmt(cache, scope, query, prepare)
+	if err != nil {
+		return err
+	}
+	err = fn(entry.stmt)
+	cache.release(entry)
+
+	if err == nil || !isCachedPlanError(err) {
+		return err
+	}
+
+	// The plan is stale, a transaction is already aborted so it can only be retried outside of one
+	cache.evict(entry)
+	service.recordStmtCacheMetric(scope, "invalidated")
+	if scope == stmtScopeTx {
+		return err
+	}
+
+	entry, err = service.acquireStmt(cache, scope, query, prepare)
+	if err != nil {
+		return err
+	}
+	defer cache.release(entry)
+	return fn(entry.stmt)
+}
+
+// acquireStmt returns the cached statement for query, preparing and caching it on a miss
+func (service *service) acquireStmt(cache *stmtCache, scope string, query string,
+	prepare stmtPreparer) (*stmtCacheEntry, error) {
+	if entry, hit := cache.acquire(query); hit {
+		service.recordStmtCacheMetric(scope, "hit")
+		return entry, nil
+	}
+	service.recordStmtCacheMetric(scope, "miss")
+
+	stmt, err := prepare()
+	if err != nil {
+		return nil, err
+	}
+	return cache.add(query, stmt), nil
+}
+
+// recordStmtCacheMetric records a hit, miss or invalidation of the statement cache
+func (service *service) recordStmtCacheMetric(scope string, result string) {
+	tags := new(godog.Tags).
+		Add("scope", scope).
+		Add("result", result)
+	godog.RecordSimpleMetric(fmt.Sprintf("application.%s.db.service.stmt_cache", service.datadogMetricPrefix),
+		1, tags.ToArray()...)
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_StmtCache_Evicts_Least_Recently_Used(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	cache := newStmtCache(2)
+	first := newDBStmtMock()
+	second := newDBStmtMock()
+	third := newDBStmtMock()
+
+	// when
+	second.PatchClose(nil)
+	cache.release(cache.add("first", first))
+	cache.release(cache.add("second", second))
+	entry, hit := cache.acquire("first")
+	cache.release(entry)
+	cache.release(cache.add("third", third))
+
+	// then
+	ass.True(hit)
+	ass.Equal(2, cache.len())
+	_, hit = cache.acquire("second")
+	ass.False(hit)
+	second.AssertExpectations(t)
+}
+
+func Test_StmtCache_Closes_Evicted_Statement_After_Release(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	cache := newStmtCache(1)
+	first := newDBStmtMock()
+	second := newDBStmtMock()
+
+	// when
+	entry := cache.add("first", first)
+	cache.release(cache.add("second", second))
+	first.AssertNotCalled(t, "Close")
+	first.PatchClose(nil)
+	cache.release(entry)
+
+	// then
+	ass.True(entry.evicted)
+	first.AssertExpectations(t)
+}
+
+func Test_StmtCache_Disabled(t *testing.T) {
+	ass := assert.New(t)
+	ass.Nil(newStmtCache(0))
+}
+
+func Test_Execute_StmtCache_Hit(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.stmts = newStmtCache(10)
+	query := insertStmt
+	params := []interface{}{"test@flat.mx"}
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+
+	// when
+	sqlMock.PatchPrepare(query, stmtMock, nil)
+	stmtMock.PatchExec(params, resultMock, nil)
+	stmtMock.PatchExec(params, resultMock, nil)
+	resultMock.PatchRowsAffected(1, nil)
+	resultMock.PatchRowsAffected(1, nil)
+	_, errFirst := service.Execute(nil, query, params...)
+	_, errSecond := service.Execute(nil, query, params...)
+
+	// then
+	ass.Nil(errFirst)
+	ass.Nil(errSecond)
+	ass.Equal(1, service.stmts.len())
+	sqlMock.AssertExpectations(t)
+	stmtMock.AssertNotCalled(t, "Close")
+}
+
+func Test_Execute_StmtCache_Cached_Plan_Invalidated(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.stmts = newStmtCache(10)
+	query := insertStmt
+	params := []interface{}{"test@flat.mx"}
+	staleStmt := newDBStmtMock()
+	freshStmt := newDBStmtMock()
+	resultMock := newDBResultMock()
+	planErr := &pq.Error{Code: "0A000", Message: "cached plan must not change result type"}
+
+	// when
+	sqlMock.PatchPrepare(query, staleStmt, nil)
+	staleStmt.PatchExec(params, nil, planErr)
+	staleStmt.PatchClose(nil)
+	sqlMock.PatchPrepare(query, freshStmt, nil)
+	freshStmt.PatchExec(params, resultMock, nil)
+	resultMock.PatchRowsAffected(1, nil)
+	dbResult, err := service.Execute(nil, query, params...)
+
+	// then
+	ass.Nil(err)
+	ass.Equal(int64(1), dbResult.AffectedRows())
+	staleStmt.AssertExpectations(t)
+	freshStmt.AssertNotCalled(t, "Close")
+}
+
+func Test_Execute_StmtCache_Tx(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.stmtCacheSize = 10
+	service.txStmts = &sync.Map{}
+	ctx := context.Background()
+	sqlConn := newDBConnMock()
+	txMock := newDBTxMock()
+	stmtMock := newDBStmtMock()
+	resultMock := newDBResultMock()
+	params := []interface{}{"test@flat.mx"}
+
+	// when
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+	txMock.PatchPrepareContext(ctx, insertStmt, stmtMock, nil)
+	stmtMock.PatchExecContext(ctx, params, resultMock, nil)
+	stmtMock.PatchExecContext(ctx, params, resultMock, nil)
+	resultMock.PatchRowsAffected(1, nil)
+	resultMock.PatchRowsAffected(1, nil)
+	txMock.PatchCommit(nil)
+	sqlConn.PatchClose(nil)
+
+	dbc, errBegin := service.Begin(nil)
+	_, errFirst := service.Execute(dbc, insertStmt, params...)
+	_, errSecond := service.Execute(dbc, insertStmt, params...)
+	ass.Equal(1, service.txStmtCache(txMock).len())
+	errCommit := service.Commit(dbc)
+
+	// then
+	ass.Nil(errBegin)
+	ass.Nil(errFirst)
+	ass.Nil(errSecond)
+	ass.Nil(errCommit)
+	ass.Nil(service.txStmtCache(txMock))
+	txMock.AssertExpectations(t)
+}
+
+func Test_Commit_Rollback_Error_Forget_Tx_StmtCache(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.stmtCacheSize = 10
+	service.txStmts = &sync.Map{}
+	commitTx := newDBTxMock()
+	rollbackTx := newDBTxMock()
+	commitStmt := newDBStmtMock()
+	rollbackStmt := newDBStmtMock()
+	service.addTxStmtCache(commitTx)
+	service.addTxStmtCache(rollbackTx)
+	service.txStmtCache(commitTx).release(service.txStmtCache(commitTx).add(insertStmt, commitStmt))
+	service.txStmtCache(rollbackTx).release(service.txStmtCache(rollbackTx).add(insertStmt, rollbackStmt))
+
+	// when
+	commitConn := newDBConnMock()
+	rollbackConn := newDBConnMock()
+	commitTx.PatchCommit(errors.New("test_commit_err"))
+	rollbackTx.PatchRollback(errors.New("test_rollback_err"))
+	commitConn.PatchClose(nil)
+	rollbackConn.PatchClose(nil)
+	commitErr := service.Commit(&DBContext{tx: commitTx, dbConn: commitConn, nestingLevel: 1})
+	rollbackErr := service.Rollback(&DBContext{tx: rollbackTx, dbConn: rollbackConn, nestingLevel: 1})
+
+	// then
+	ass.NotNil(commitErr)
+	ass.NotNil(rollbackErr)
+	ass.Nil(service.txStmtCache(commitTx))
+	ass.Nil(service.txStmtCache(rollbackTx))
+}
+
+func Test_IsCachedPlanError(t *testing.T) {
+	ass := assert.New(t)
+
+	ass.True(isCachedPlanError(&pq.Error{Code: "0A000", Message: "cached plan must not change result type"}))
+	ass.False(isCachedPlanError(&pq.Error{Code: "0A000", Message: "feature not supported"}))
+	ass.False(isCachedPlanError(&pq.Error{Code: "40001"}))
+	ass.False(isCachedPlanError(nil))
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/database/converter"
+)
+
+const (
+	// defaultFetchSize is the amount of rows fetched per round trip by SelectCursor
+	defaultFetchSize = 1000
+)
+
+var (
+	errCursorWithoutTx = errors.New("cursor_without_trx")
+
+	// cursorSequence makes the cursor names unique inside a transaction
+	cursorSequence uint64
+)
+
+type (
+	// RowIterator iterates over the rows of a query without loading all of them in memory.
+	// It must always be closed, even when the iteration ends because of an error.
+	RowIterator interface {
+		// Next prepares the next row, it returns false when there are no more rows or an error happened
+		Next() bool
+		// Row returns the current row
+		Row() *DBRow
+		// Err returns the error, if any, that happened during the iteration
+		Err() error
+		// Close releases the resources used by the iterator. It's safe to call it more than once
+		Close() error
+	}
+
+	// rowsIterator iterates over an open result set
+	rowsIterator struct {
+		rows       converter.DBRowser
+		cols       []string
+		duplicates map[string]struct{}
+		run        *queryRun
+		read       int64
+		row        *DBRow
+		err        error
+		closed     bool
+	}
+
+	// cursorIterator iterates over a server-side cursor, fetching fetchSize rows at a time
+	cursorIterator struct {
+		service   *service
+		dbc       *DBContext
+		name      string
+		fetchSize int
+		page      DBRowArray
+		row       *DBRow
+		err       error
+		done      bool
+		closed    bool
+	}
+
+	// resultIterator iterates over a result already loaded in memory
+	resultIterator struct {
+		rows   DBRowArray
+		row    *DBRow
+		closed bool
+	}
+)
+
+// SelectStreamContext works like SelectStream, but the query is executed using the given ctx
+func (service *service) SelectStreamContext(ctx context.Context, dbc *DBContext, query string,
+	params ...interface{}) (RowIterator, error) {
+	return service.SelectStream(dbc.withContext(ctx), query, params...)
+}
+
+// SelectStream does a select in the database and returns an iterator over the results, so rows
+// are read from the connection one at a time instead of being loaded in memory. The connection
+// is held until the iterator is closed. Like Select, it runs in a replica if there is no dbc.
+func (service *service) SelectStream(dbc *DBContext, query string, params ...interface{}) (RowIterator, error) {
+	if err := service.checkAccepting(dbc); err != nil {
+		return nil, err
+	}
+	// Do the query
+	run := service.startQuery(dbc, QueryOperationSelect, query, params)
+	rows, err := service.doQuery(service.readDB(dbc, query, false), dbc, query, params...)
+	if err != nil {
+		run.finish(nil, err)
+		return nil, err
+	}
+
+	// Get columns
+	cols, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		run.finish(nil, err)
+		return nil, err
+	}
+
+	// done, the hooks finish when the iterator is closed
+	return &rowsIterator{
+		rows:       rows,
+		cols:       cols,
+		duplicates: duplicateColumns(cols),
+		run:        run,
+	}, nil
+}
+
+// SelectCursorContext works like SelectCursor, but the queries are executed using the given ctx
+func (service *service) SelectCursorContext(ctx context.Context, dbc *DBContext, query string, fetchSize int,
+	params ...interface{}) (RowIterator, error) {
+	return service.SelectCursor(dbc.withContext(ctx), query, fetchSize, params...)
+}
+
+// SelectCursor declares a server-side cursor for the query and returns an iterator that fetches
+// fetchSize rows at a time (a default is used if it's not positive). Cursors only live inside a
+// transaction, so dbc must have one, and the iterator must be closed before committing.
+func (service *service) SelectCursor(dbc *DBContext, query string, fetchSize int,
+	params ...interface{}) (RowIterator, error) {
+	if dbc == nil || dbc.tx == nil {
+		return nil, errCursorWithoutTx
+	}
+	if fetchSize <= 0 {
+		fetchSize = defaultFetchSize
+	}
+
+	// Declare the cursor
+	name := fmt.Sprintf("select_cursor_%d", atomic.AddUint64(&cursorSequence, 1))
+	_, err := service.Execute(dbc, fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", name, query), params...)
+	if err != nil {
+		return nil, err
+	}
+
+	// done
+	return &cursorIterator{
+		service:   service,
+		dbc:       dbc,
+		name:      name,
+		fetchSize: fetchSize,
+	}, nil
+}
+
+// Next prepares the next row
+func (iterator *rowsIterator) Next() bool {
+	if iterator.closed || iterator.err != nil {
+		return false
+	}
+
+	if !iterator.rows.Next() {
+		iterator.err = iterator.rows.Err()
+		iterator.Close()
+		return false
+	}
+
+	row, err := scanDBRow(iterator.rows, iterator.cols, iterator.duplicates)
+	if err != nil {
+		iterator.err = err
+		iterator.Close()
+		return false
+	}
+	iterator.row = &row
+	iterator.read++
+	return true
+}
+
+// Row returns the current row
+func (iterator *rowsIterator) Row() *DBRow {
+	return iterator.row
+}
+
+// Err returns the error that happened during the iteration
+func (iterator *rowsIterator) Err() error {
+	return iterator.err
+}
+
+// Close closes the result set
+func (iterator *rowsIterator) Close() error {
+	if iterator.closed {
+		return nil
+	}
+	iterator.closed = true
+	iterator.row = nil
+	err := iterator.rows.Close()
+	iterator.run.finishRows(iterator.read, iterator.err)
+	return err
+}
+
+// Next prepares the next row, fetching a new page from the cursor when the current one is consumed
+func (iterator *cursorIterator) Next() bool {
+	if iterator.closed || iterator.err != nil {
+		return false
+	}
+
+	if len(iterator.page) == 0 && !iterator.done {
+		fetch := fmt.Sprintf("FETCH FORWARD %d FROM %s", iterator.fetchSize, iterator.name)
+		dbr, err := iterator.service.Select(iterator.dbc, fetch, false)
+		if err != nil {
+			iterator.err = err
+			return false
+		}
+		iterator.page = dbr.rows.DBRowArray
+		iterator.done = len(iterator.page) < iterator.fetchSize
+	}
+
+	if len(iterator.page) == 0 {
+		iterator.row = nil
+		return false
+	}
+
+	iterator.row = &iterator.page[0]
+	iterator.page = iterator.page[1:]
+	return true
+}
+
+// Row returns the current row
+func (iterator *cursorIterator) Row() *DBRow {
+	return iterator.row
+}
+
+// Err returns the error that happened during the iteration
+func (iterator *cursorIterator) Err() error {
+	return iterator.err
+}
+
+// Close closes the cursor. If the transaction was aborted the cursor is already gone and the
+// error of CLOSE is returned, but there is nothing left to release.
+func (iterator *cursorIterator) Close() error {
+	if iterator.closed {
+		return nil
+	}
+	iterator.closed = true
+	iterator.row = nil
+	iterator.page = nil
+	_, err := iterator.service.Execute(iterator.dbc, fmt.Sprintf("CLOSE %s", iterator.name))
+	return err
+}
+
+// newResultIterator returns an iterator over an already loaded result
+func newResultIterator(dbr *DBResult) RowIterator {
+	iterator := &resultIterator{}
+	if dbr != nil {
+		iterator.rows = dbr.rows.DBRowArray
+	}
+	return iterator
+}
+
+// Next prepares the next row
+func (iterator *resultIterator) Next() bool {
+	if iterator.closed || len(iterator.rows) == 0 {
+		iterator.row = nil
+		return false
+	}
+	iterator.row = &iterator.rows[0]
+	iterator.rows = iterator.rows[1:]
+	return true
+}
+
+// Row returns the current row
+func (iterator *resultIterator) Row() *DBRow {
+	return iterator.row
+}
+
+// Err returns nil, the rows are already loaded
+func (iterator *resultIterator) Err() error {
+	return nil
+}
+
+// Close releases the rows
+func (iterator *resultIterator) Close() error {
+	iterator.closed = true
+	iterator.row = nil
+	iterator.rows = nil
+	return nil
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newScanDest(columns []string) []interface{} {
+	columnsAux := make([]interface{}, len(columns))
+	columnPointers := make([]interface{}, len(columns))
+	for i := range columnsAux {
+		columnPointers[i] = &columnsAux[i]
+	}
+	return columnPointers
+}
+
+func Test_SelectStream_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx := context.Background()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, _ := newMockService(config)
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:  txMock,
+		ctx: ctx,
+	}
+	query := selectStmt2
+	stmtMock := newDBStmtMock()
+	rowsMock := newDBRowsMock()
+	params := []interface{}{3}
+	columns := []string{"columnA", "columnB"}
+
+	// when
+	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchNext(true)
+	rowsMock.PatchScan(newScanDest(columns), nil)
+	rowsMock.PatchNext(true)
+	rowsMock.PatchScan(newScanDest(columns), nil)
+	rowsMock.PatchNext(false)
+	rowsMock.PatchErr(nil)
+	rowsMock.PatchClose(nil)
+	stmtMock.PatchQueryContext(ctx, params, rowsMock, nil)
+	txMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+	iterator, err := service.SelectStream(dbc, query, params...)
+	ass.Nil(err)
+
+	count := 0
+	for iterator.Next() {
+		_, err := iterator.Row().GetColumnByName("columnA")
+		ass.Nil(err)
+		count++
+	}
+
+	// then
+	ass.Nil(iterator.Err())
+	ass.Nil(iterator.Close())
+	ass.Equal(2, count)
+	rowsMock.AssertExpectations(t)
+}
+
+func Test_SelectStream_Rows_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx := context.Background()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, _ := newMockService(config)
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:  txMock,
+		ctx: ctx,
+	}
+	query := selectStmt2
+	stmtMock := newDBStmtMock()
+	rowsMock := newDBRowsMock()
+	params := []interface{}{3}
+	columns := []string{"columnA"}
+
+	// when
+	rowsMock.PatchColumns(columns, nil)
+	rowsMock.PatchNext(false)
+	rowsMock.PatchErr(errors.New("connection reset"))
+	rowsMock.PatchClose(nil)
+	stmtMock.PatchQueryContext(ctx, params, rowsMock, nil)
+	txMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+	iterator, err := service.SelectStream(dbc, query, params...)
+	ass.Nil(err)
+	next := iterator.Next()
+
+	// then
+	ass.False(next)
+	ass.Nil(iterator.Row())
+	ass.EqualError(iterator.Err(), "connection reset")
+	ass.Nil(iterator.Close())
+}
+
+func Test_SelectStream_Columns_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx := context.Background()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, _ := newMockService(config)
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:  txMock,
+		ctx: ctx,
+	}
+	query := selectStmt2
+	stmtMock := newDBStmtMock()
+	rowsMock := newDBRowsMock()
+	params := []interface{}{3}
+
+	// when
+	rowsMock.PatchColumns(nil, errors.New("columns error"))
+	rowsMock.PatchClose(nil)
+	stmtMock.PatchQueryContext(ctx, params, rowsMock, nil)
+	txMock.PatchPrepareContext(ctx, query, stmtMock, nil)
+	iterator, err := service.SelectStream(dbc, query, params...)
+
+	// then
+	ass.Nil(iterator)
+	ass.EqualError(err, "columns error")
+	rowsMock.AssertExpectations(t)
+}
+
+func Test_SelectCursor_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx := context.Background()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, _ := newMockService(config)
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:  txMock,
+		ctx: ctx,
+	}
+	query := "SELECT * FROM test WHERE id > $1"
+	params := []interface{}{3}
+	columns := []string{"columnA"}
+	cursorSequence = 0
+
+	declareStmt := newDBStmtMock()
+	declareResult := newDBResultMock()
+	firstFetchStmt := newDBStmtMock()
+	firstRows := newDBRowsMock()
+	secondFetchStmt := newDBStmtMock()
+	secondRows := newDBRowsMock()
+	closeStmt := newDBStmtMock()
+	closeResult := newDBResultMock()
+
+	// when
+	declareResult.PatchRowsAffected(0, nil)
+	declareStmt.PatchExecContext(ctx, params, declareResult, nil)
+	txMock.PatchPrepareContext(ctx, "DECLARE select_cursor_1 NO SCROLL CURSOR FOR "+query, declareStmt, nil)
+
+	firstRows.PatchColumns(columns, nil)
+	firstRows.PatchColumnTypes(nil, nil)
+	firstRows.PatchNext(true)
+	firstRows.PatchScan(newScanDest(columns), nil)
+	firstRows.PatchNext(true)
+	firstRows.PatchScan(newScanDest(columns), nil)
+	firstRows.PatchNext(false)
+	firstRows.PatchClose(nil)
+	firstFetchStmt.PatchQueryContext(ctx, nil, firstRows, nil)
+	txMock.PatchPrepareContext(ctx, "FETCH FORWARD 2 FROM select_cursor_1", firstFetchStmt, nil)
+
+	secondRows.PatchColumns(columns, nil)
+	secondRows.PatchColumnTypes(nil, nil)
+	secondRows.PatchNext(true)
+	secondRows.PatchScan(newScanDest(columns), nil)
+	secondRows.PatchNext(false)
+	secondRows.PatchClose(nil)
+	secondFetchStmt.PatchQueryContext(ctx, nil, secondRows, nil)
+	txMock.PatchPrepareContext(ctx, "FETCH FORWARD 2 FROM select_cursor_1", secondFetchStmt, nil)
+
+	closeResult.PatchRowsAffected(0, nil)
+	closeStmt.PatchExecContext(ctx, nil, closeResult, nil)
+	txMock.PatchPrepareContext(ctx, "CLOSE select_cursor_1", closeStmt, nil)
+
+	iterator, err := service.SelectCursor(dbc, query, 2, params...)
+	ass.Nil(err)
+
+	count := 0
+	for iterator.Next() {
+		ass.NotNil(iterator.Row())
+		count++
+	}
+
+	// then
+	ass.Nil(iterator.Err())
+	ass.Nil(iterator.Close())
+	ass.Nil(iterator.Close())
+	ass.Equal(3, count)
+	txMock.AssertExpectations(t)
+}
+
+func Test_SelectCursor_Without_Tx(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, _ := newMockService(config)
+
+	// when
+	iterator, err := service.SelectCursor(&DBContext{}, selectStmt2, 10)
+
+	// then
+	ass.Nil(iterator)
+	ass.Equal(errCursorWithoutTx, err)
+}
+
+func Test_SelectCursor_Fetch_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	ctx := context.Background()
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, _ := newMockService(config)
+	txMock := newDBTxMock()
+	dbc := &DBContext{
+		tx:  txMock,
+		ctx: ctx,
+	}
+	cursorSequence = 0
+
+	declareStmt := newDBStmtMock()
+	declareResult := newDBResultMock()
+	fetchErr := errors.New("fetch error")
+
+	// when
+	declareResult.PatchRowsAffected(0, nil)
+	declareStmt.PatchExecContext(ctx, nil, declareResult, nil)
+	txMock.PatchPrepareContext(ctx, "DECLARE select_cursor_1 NO SCROLL CURSOR FOR "+selectStmt2, declareStmt, nil)
+	txMock.PatchPrepareContext(ctx, "FETCH FORWARD 1000 FROM select_cursor_1", nil, fetchErr)
+
+	iterator, err := service.SelectCursor(dbc, selectStmt2, 0)
+	ass.Nil(err)
+	next := iterator.Next()
+
+	// then
+	ass.False(next)
+	ass.Equal(fetchErr, iterator.Err())
+}
@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/flat"
+	"github.com/FlatDigital/core-go-toolkit/v2/database/converter"
+	"github.com/lib/pq"
+)
+
+var (
+	errEmptyTenantSearchPath = errors.New("empty_tenant_search_path")
+
+	// ErrTenantWithoutDBContext is returned by the queries whose ctx carries a tenant but that have no
+	// DBContext to run in, since the pool would run them with its default search_path
+	ErrTenantWithoutDBContext = errors.New("tenant_without_dbcontext")
+)
+
+// tenantKey is the key of the tenant in a context.Context
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant. ConnectionContext sets the search_path of
+// the tenant in the session of the pinned connection, and resets it in Close before the connection
+// goes back to the pool. BeginContext and WithTransactionContext set it with SET LOCAL, so it only
+// lasts for the transaction. The pool doesn't know the tenant, so the queries with ctx and neither a
+// DBContext nor an ambient transaction fail with ErrTenantWithoutDBContext.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant attached to ctx or an empty string
+func TenantFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// AttachTenant attaches the tenant to the flat context
+func AttachTenant(fctx *flat.Context, tenant string) {
+	fctx.WithValue(tenantKey{}, tenant)
+}
+
+// TenantFromFlat returns the tenant attached to the flat context, or its ClientID if there is none
+func TenantFromFlat(fctx *flat.Context) string {
+	if tenant := TenantFromContext(fctx.Context()); tenant != "" {
+		return tenant
+	}
+	if fctx == nil {
+		return ""
+	}
+	return fctx.ClientID
+}
+
+// TenantContext returns the context.Context of the flat context carrying its tenant, to be used
+// with ConnectionContext, BeginContext or WithTransactionContext
+func TenantContext(fctx *flat.Context) context.Context {
+	return WithTenant(fctx.Context(), TenantFromFlat(fctx))
+}
+
+// tenantOnPool returns if dbc would run on the pool although its ctx carries a tenant
+func tenantOnPool(dbc *DBContext) bool {
+	if dbc != nil && (dbc.tx != nil || dbc.dbConn != nil) {
+		return false
+	}
+	return TenantFromContext(dbc.context()) != ""
+}
+
+// tenantOf returns the tenant of the transaction or the connection of dbc, or an empty string
+func (service *service) tenantOf(dbc *DBContext) string {
+	if dbc == nil {
+		return ""
+	}
+	if dbc.tx != nil {
+		if tenant := service.loadTenant(dbc.tx); tenant != "" {
+			return tenant
+		}
+	}
+	return service.sessionTenant(dbc.dbConn)
+}
+
+// sessionTenant returns the tenant set in the session of the connection, or an empty string
+func (service *service) sessionTenant(conn converter.DBConner) string {
+	if conn == nil {
+		return ""
+	}
+	return service.loadTenant(conn)
+}
+
+// loadTenant returns the tenant stored for the connection or transaction key
+func (service *service) loadTenant(key interface{}) string {
+	if service.tenants == nil {
+		return ""
+	}
+	tenant, _ := service.tenants.Load(key)
+	name, _ := tenant.(string)
+	return name
+}
+
+// removeTenant forgets the tenant of a closed connection or a finished transaction
+func (service *service) removeTenant(key interface{}) {
+	if service.tenants != nil && key != nil {
+		service.tenants.Delete(key)
+	}
+}
+
+// tenantSearchPath returns the SET statement of the search_path of the tenant, SET LOCAL if local
+func (service *service) tenantSearchPath(tenant string, local bool) (string, error) {
+	schemas := []string{tenant}
+	if service.tenantSchemas != nil {
+		var err error
+		schemas, err = service.tenantSchemas(tenant)
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(schemas) == 0 {
+		return "", fmt.Errorf("tenant %q: %w", tenant, errEmptyTenantSearchPath)
+	}
+
+	quoted := make([]string, len(schemas))
+	for i, schema := range schemas {
+		quoted[i] = pq.QuoteIdentifier(schema)
+	}
+	scope := "SET"
+	if local {
+		scope = "SET LOCAL"
+	}
+	return fmt.Sprintf("%s search_path TO %s", scope, strings.Join(quoted, ", ")), nil
+}
+
+// setSessionTenant sets the search_path of the tenant in the session of the connection of dbc
+func (service *service) setSessionTenant(dbc *DBContext, tenant string) error {
+	query, err := service.tenantSearchPath(tenant, false)
+	if err != nil {
+		service.logMetric(logError, "tenant", "service.tenantSearchPath(tenant, false)", err)
+		return err
+	}
+
+	if _, err = service.executeOnConn(dbc, "tenant", query); err != nil {
+		return err
+	}
+	if service.tenants != nil {
+		service.tenants.Store(dbc.dbConn, tenant)
+	}
+
+	// done
+	return nil
+}
+
+// resetSessionTenant restores the default search_path of the connection of dbc and returns true. If
+// it can't, the connection is discarded instead of going back to the pool with the search_path of
+// the tenant, and it returns false.
+func (service *service) resetSessionTenant(dbc *DBContext) bool {
+	_, err := service.executeOnConn(dbc, "tenant", "RESET search_path")
+	service.removeTenant(dbc.dbConn)
+	if err != nil {
+		service.discardConn(dbc)
+		return false
+	}
+
+	// done
+	return true
+}
+
+// setLocalTenant sets the search_path of the tenant for the transaction of dbc
+func (service *service) setLocalTenant(dbc *DBContext, tenant string) error {
+	query, err := service.tenantSearchPath(tenant, true)
+	if err != nil {
+		service.logMetric(logError, "tenant", "service.tenantSearchPath(tenant, true)", err)
+		return err
+	}
+
+	if service.tenants != nil {
+		service.tenants.Store(dbc.tx, tenant)
+	}
+	run := service.startQuery(dbc, QueryOperationExecute, query, nil)
+	if _, err = dbc.tx.ExecContext(dbc.context(), query); err != nil {
+		run.finish(nil, err)
+		service.logMetric(logError, "tenant", "dbc.tx.ExecContext(SET LOCAL search_path)", err)
+		return err
+	}
+	run.finish(&DBResult{}, nil)
+
+	// done
+	return nil
+}
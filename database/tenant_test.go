@@ -0,0 +1,375 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/flat"
+	"github.com/FlatDigital/core-go-toolkit/v2/database/converter"
+	"github.com/stretchr/testify/assert"
+)
+
+// sessionDriver is a driver that records the queries run in every connection with the search_path
+// of its session, to check in which connection a query runs
+type sessionDriver struct{}
+
+type sessionConn struct {
+	id         int
+	searchPath string
+}
+
+type sessionStmt struct {
+	conn  *sessionConn
+	query string
+}
+
+type sessionRows struct{}
+
+type sessionTx struct{}
+
+// sessionQuery is a query run by the sessionDriver
+type sessionQuery struct {
+	conn       int
+	searchPath string
+	query      string
+}
+
+var (
+	sessionMutex   sync.Mutex
+	sessionConns   int
+	sessionQueries []sessionQuery
+)
+
+func init() {
+	sql.Register("tenant_session_test", sessionDriver{})
+}
+
+func (sessionDriver) Open(name string) (driver.Conn, error) {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	sessionConns++
+	return &sessionConn{id: sessionConns}, nil
+}
+
+func (conn *sessionConn) Prepare(query string) (driver.Stmt, error) {
+	return &sessionStmt{conn: conn, query: query}, nil
+}
+func (conn *sessionConn) Close() error              { return nil }
+func (conn *sessionConn) Begin() (driver.Tx, error) { return sessionTx{}, nil }
+
+func (sessionTx) Commit() error   { return nil }
+func (sessionTx) Rollback() error { return nil }
+
+func (stmt *sessionStmt) Close() error  { return nil }
+func (stmt *sessionStmt) NumInput() int { return -1 }
+func (stmt *sessionStmt) Exec(args []driver.Value) (driver.Result, error) {
+	stmt.run()
+	return driver.RowsAffected(0), nil
+}
+func (stmt *sessionStmt) Query(args []driver.Value) (driver.Rows, error) {
+	stmt.run()
+	return sessionRows{}, nil
+}
+
+// run records the query and applies the SET and RESET of the search_path to the session
+func (stmt *sessionStmt) run() {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	switch {
+	case strings.HasPrefix(stmt.query, "SET search_path TO "):
+		stmt.conn.searchPath = strings.TrimPrefix(stmt.query, "SET search_path TO ")
+	case stmt.query == "RESET search_path":
+		stmt.conn.searchPath = ""
+	default:
+		sessionQueries = append(sessionQueries, sessionQuery{
+			conn:       stmt.conn.id,
+			searchPath: stmt.conn.searchPath,
+			query:      stmt.query,
+		})
+	}
+}
+
+// resetSessionQueries forgets the queries recorded by the sessionDriver
+func resetSessionQueries() {
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	sessionQueries = nil
+}
+
+func (sessionRows) Columns() []string              { return []string{"name"} }
+func (sessionRows) Close() error                   { return nil }
+func (sessionRows) Next(dest []driver.Value) error { return io.EOF }
+
+func Test_TenantFromFlat(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fctx := flat.CreateTestContext()
+	fctx.ClientID = "acme"
+
+	// when
+	fromClient := TenantFromFlat(fctx)
+	AttachTenant(fctx, "globex")
+	attached := TenantFromFlat(fctx)
+
+	// then
+	ass.Equal("acme", fromClient)
+	ass.Equal("globex", attached)
+	ass.Equal("globex", TenantFromContext(TenantContext(fctx)))
+	ass.Equal("", TenantFromFlat(nil))
+}
+
+func Test_ConnectionContext_Tenant_Session(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.tenants = &sync.Map{}
+	ctx := WithTenant(context.Background(), "acme")
+	connMock := newDBConnMock()
+	setResult := newDBResultMock()
+	resetResult := newDBResultMock()
+
+	// when
+	sqlMock.PatchConn(ctx, connMock, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	connMock.PatchExecContext(ctx, `SET search_path TO "acme"`, nil, setResult, nil)
+	setResult.PatchRowsAffected(0, nil)
+	connMock.PatchExecContext(ctx, "RESET search_path", nil, resetResult, nil)
+	resetResult.PatchRowsAffected(0, nil)
+	connMock.PatchClose(nil)
+	dbc, err := service.ConnectionContext(ctx)
+	tenant := service.tenantOf(dbc)
+	closeErr := service.Close(dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Equal("acme", tenant)
+	ass.Nil(closeErr)
+	ass.Equal("", service.sessionTenant(connMock))
+	connMock.AssertExpectations(t)
+}
+
+func Test_Close_Tenant_Reset_Error_Discards_Connection(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.tenants = &sync.Map{}
+	ctx := context.Background()
+	connMock := newDBConnMock()
+	dbc := &DBContext{dbConn: connMock, ctx: ctx}
+	service.tenants.Store(connMock, "acme")
+
+	// when
+	connMock.PatchExecContext(ctx, "RESET search_path", nil, nil, errors.New("connection reset by peer"))
+	connMock.PatchRaw(driver.ErrBadConn)
+	err := service.Close(dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Nil(dbc.dbConn)
+	connMock.AssertExpectations(t)
+	connMock.AssertNotCalled(t, "Close")
+}
+
+func Test_BeginContext_Tenant_Set_Local(t *testing.T) {
+	tt := []struct {
+		Name          string
+		TenantSchemas func(tenant string) ([]string, error)
+		ExpectedQuery string
+	}{
+		{"Schema named like the tenant", nil, `SET LOCAL search_path TO "acme"`},
+		{"Mapped schemas", func(tenant string) ([]string, error) {
+			return []string{"tenant_" + tenant, "public"}, nil
+		}, `SET LOCAL search_path TO "tenant_acme", "public"`},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Name, func(t *testing.T) {
+			// given
+			ass := assert.New(t)
+			service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+			service.tenantSchemas = tc.TenantSchemas
+			service.tenants = &sync.Map{}
+			ctx := WithTenant(context.Background(), "acme")
+			connMock := newDBConnMock()
+			txMock := newDBTxMock()
+			resultMock := newDBResultMock()
+
+			// when
+			sqlMock.PatchConn(ctx, connMock, nil)
+			sqlMock.PatchPingContext(ctx, nil)
+			sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+			txMock.PatchExecContext(ctx, tc.ExpectedQuery, nil, resultMock, nil)
+			dbc, err := service.BeginContext(ctx, nil)
+
+			// then
+			ass.Nil(err)
+			ass.Equal("acme", service.tenantOf(dbc))
+			ass.Equal(1, dbc.nestingLevel)
+			txMock.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_BeginContext_Tenant_Error_Rolls_Back(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, sqlMock := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.tenantSchemas = func(tenant string) ([]string, error) {
+		return nil, nil
+	}
+	ctx := WithTenant(context.Background(), "acme")
+	connMock := newDBConnMock()
+	txMock := newDBTxMock()
+
+	// when
+	sqlMock.PatchConn(ctx, connMock, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+	txMock.PatchRollback(nil)
+	connMock.PatchClose(nil)
+	dbc, err := service.BeginContext(ctx, nil)
+
+	// then
+	ass.Nil(dbc)
+	ass.ErrorIs(err, errEmptyTenantSearchPath)
+	txMock.AssertExpectations(t)
+	connMock.AssertExpectations(t)
+}
+
+func Test_Fake_Records_Tenant(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	fake := NewFake()
+	fake.SetDefault(QueryOperationExecute, nil, nil)
+
+	// when
+	err := fake.WithTransactionContext(WithTenant(context.Background(), "acme"), func(dbc *DBContext) error {
+		_, err := fake.Execute(dbc, "DELETE FROM carts")
+		return err
+	})
+
+	// then
+	ass.Nil(err)
+	ass.Equal("acme", fake.CallsTo("Execute")[0].Tenant)
+}
+
+func Test_Context_Queries_With_Tenant_Without_DBContext(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	fake := NewFake()
+	fake.SetDefault(QueryOperationSelect, nil, nil)
+	ctx := WithTenant(context.Background(), "acme")
+
+	// when
+	_, selectErr := service.SelectContext(ctx, nil, "SELECT name FROM properties", false)
+	_, executeErr := service.ExecuteContext(ctx, nil, "UPDATE properties SET name = $1", "Casa")
+	_, queryRowErr := service.QueryRowContext(ctx, "SELECT name FROM properties")
+	_, fakeErr := fake.SelectContext(ctx, nil, "SELECT name FROM properties", false)
+
+	// then
+	ass.ErrorIs(selectErr, ErrTenantWithoutDBContext)
+	ass.ErrorIs(executeErr, ErrTenantWithoutDBContext)
+	ass.ErrorIs(queryRowErr, ErrTenantWithoutDBContext)
+	ass.ErrorIs(fakeErr, ErrTenantWithoutDBContext)
+	ass.Empty(fake.Calls())
+}
+
+func Test_ConnectionContext_Tenant_Queries_Run_In_The_Connection(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	db, err := sql.Open("tenant_session_test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	service := service{db: converter.SQLToDBer(db), maxConnectionRetries: 1, tenants: &sync.Map{}}
+	ctx := WithTenant(context.Background(), "acme")
+	resetSessionQueries()
+
+	// when
+	dbc, err := service.ConnectionContext(ctx)
+	_, selectErr := service.Select(dbc, "SELECT name FROM properties", false)
+	_, executeErr := service.Execute(dbc, "UPDATE properties SET name = $1", "Casa")
+	_, poolErr := service.Select(nil, "SELECT name FROM owners", false)
+	closeErr := service.Close(dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Nil(selectErr)
+	ass.Nil(executeErr)
+	ass.Nil(poolErr)
+	ass.Nil(closeErr)
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	ass.Len(sessionQueries, 3)
+	tenantConn := sessionQueries[0].conn
+	ass.Equal(sessionQuery{conn: tenantConn, searchPath: `"acme"`, query: "SELECT name FROM properties"},
+		sessionQueries[0])
+	ass.Equal(sessionQuery{conn: tenantConn, searchPath: `"acme"`, query: "UPDATE properties SET name = $1"},
+		sessionQueries[1])
+	// the queries without the DBContext run in another connection of the pool, without the tenant
+	ass.NotEqual(tenantConn, sessionQueries[2].conn)
+	ass.Equal("", sessionQueries[2].searchPath)
+}
+
+func Test_BulkInsert_Pinned_Connection_Keeps_Tenant(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	db, err := sql.Open("tenant_session_test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	service := service{db: converter.SQLToDBer(db), maxConnectionRetries: 1, tenants: &sync.Map{}}
+	ctx := WithTenant(context.Background(), "acme")
+	resetSessionQueries()
+
+	// when
+	dbc, err := service.ConnectionContext(ctx)
+	_, bulkErr := service.BulkInsert(dbc, "properties", []string{"name"}, [][]interface{}{{"Casa"}})
+	closeErr := service.Close(dbc)
+
+	// then
+	ass.Nil(err)
+	ass.Nil(bulkErr)
+	ass.Nil(closeErr)
+	sessionMutex.Lock()
+	defer sessionMutex.Unlock()
+	// the insert runs in the session of the pinned connection, with the search_path of the tenant
+	ass.Equal([]sessionQuery{{conn: sessionQueries[0].conn, searchPath: `"acme"`,
+		query: `INSERT INTO "properties" ("name") VALUES ($1)`}}, sessionQueries)
+}
+
+func Test_Commit_Rollback_Error_Forget_Tenant(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	service, _ := newMockService(ServiceConfig{MaxConnectionRetries: 1})
+	service.tenants = &sync.Map{}
+	commitTx := newDBTxMock()
+	rollbackTx := newDBTxMock()
+	service.tenants.Store(commitTx, "acme")
+	service.tenants.Store(rollbackTx, "globex")
+
+	// when
+	commitConn := newDBConnMock()
+	rollbackConn := newDBConnMock()
+	commitTx.PatchCommit(errors.New("could not serialize access"))
+	rollbackTx.PatchRollback(errors.New("connection reset by peer"))
+	commitConn.PatchClose(nil)
+	rollbackConn.PatchClose(nil)
+	commitErr := service.Commit(&DBContext{tx: commitTx, dbConn: commitConn, nestingLevel: 1})
+	rollbackErr := service.Rollback(&DBContext{tx: rollbackTx, dbConn: rollbackConn, nestingLevel: 1})
+
+	// then
+	ass.EqualError(commitErr, "could not serialize access")
+	ass.EqualError(rollbackErr, "connection reset by peer")
+	ass.Equal("", service.loadTenant(commitTx))
+	ass.Equal("", service.loadTenant(rollbackTx))
+}
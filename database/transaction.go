@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/godog"
+	"github.com/lib/pq"
+)
+
+const (
+	// pqSerializationFailure is the SQLSTATE returned when a serializable transaction can't be committed
+	pqSerializationFailure pq.ErrorCode = "40001"
+	// pqDeadlockDetected is the SQLSTATE returned when the transaction was chosen as a deadlock victim
+	pqDeadlockDetected pq.ErrorCode = "40P01"
+)
+
+var (
+	// DefaultRetryPolicy is a sensible retry policy for WithRetry
+	DefaultRetryPolicy = RetryPolicy{
+		MaxRetries:     3,
+		InitialBackoff: 50 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+)
+
+type (
+	// TxOption is a function for WithTransaction, it's used to configure the transaction
+	TxOption func(*txConfig)
+
+	// RetryPolicy defines how many times and how often a transaction is re-run when it fails
+	// with a serialization failure (40001) or a deadlock (40P01)
+	RetryPolicy struct {
+		MaxRetries     int
+		InitialBackoff time.Duration
+		MaxBackoff     time.Duration
+		Multiplier     float64
+	}
+
+	// txConfig holds the options of a transaction
+	txConfig struct {
+		isolation   sql.IsolationLevel
+		readOnly    bool
+		retryPolicy *RetryPolicy
+	}
+)
+
+// WithIsolationLevel sets the isolation level of the transaction
+func WithIsolationLevel(level sql.IsolationLevel) TxOption {
+	return func(c *txConfig) {
+		c.isolation = level
+	}
+}
+
+// WithReadOnly makes the transaction read-only
+func WithReadOnly() TxOption {
+	return func(c *txConfig) {
+		c.readOnly = true
+	}
+}
+
+// WithRetry re-runs the whole transaction, following the given policy, when it fails with a
+// serialization failure or a deadlock. The txFn must be safe to run more than once.
+func WithRetry(policy RetryPolicy) TxOption {
+	return func(c *txConfig) {
+		c.retryPolicy = &policy
+	}
+}
+
+// newTxConfig applies the options over the default configuration
+func newTxConfig(opts ...TxOption) txConfig {
+	config := txConfig{
+		isolation: sql.LevelDefault,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return config
+}
+
+// txOptions returns the sql.TxOptions for BeginTx, nil when using the defaults
+func (c txConfig) txOptions() *sql.TxOptions {
+	if c.isolation == sql.LevelDefault && !c.readOnly {
+		return nil
+	}
+	return &sql.TxOptions{
+		Isolation: c.isolation,
+		ReadOnly:  c.readOnly,
+	}
+}
+
+// Backoff returns the time to wait before the given retry (starting at 0)
+func (policy RetryPolicy) Backoff(retry int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(policy.InitialBackoff)
+	for i := 0; i < retry; i++ {
+		delay *= multiplier
+	}
+	if policy.MaxBackoff > 0 && delay > float64(policy.MaxBackoff) {
+		delay = float64(policy.MaxBackoff)
+	}
+
+	// Half of the delay is random, so concurrent transactions don't retry at the same time
+	half := int64(delay / 2)
+	if half <= 0 {
+		return time.Duration(delay)
+	}
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// retryableErrorCode returns the SQLSTATE of the error if the transaction can be retried
+func retryableErrorCode(err error) (pq.ErrorCode, bool) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr == nil {
+		return "", false
+	}
+	if pqErr.Code == pqSerializationFailure || pqErr.Code == pqDeadlockDetected {
+		return pqErr.Code, true
+	}
+	return "", false
+}
+
+// withRetry runs the transaction and re-runs it while it fails with a retryable error
+func (service *service) withRetry(ctx context.Context, config txConfig, runTx func() error) error {
+	for retry := 0; ; retry++ {
+		err := runTx()
+		if err == nil || config.retryPolicy == nil || retry >= config.retryPolicy.MaxRetries {
+			return err
+		}
+
+		code, ok := retryableErrorCode(err)
+		if !ok {
+			return err
+		}
+
+		tags := new(godog.Tags).
+			Add("error", string(code)).
+			Add("retry", fmt.Sprint(retry+1))
+		godog.RecordSimpleMetric(fmt.Sprintf("application.%s.db.service.transaction.retry",
+			service.datadogMetricPrefix), 1, tags.ToArray()...)
+
+		// Wait before retrying, unless the ctx is done
+		timer := time.NewTimer(config.retryPolicy.Backoff(retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
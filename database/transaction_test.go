@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+
+	sqlmock "github.com/FlatDigital/core-go-toolkit/v2/database/mock"
+)
+
+func Test_WithTransaction_Options(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx := context.Background()
+	sqlConn := newDBConnMock()
+	txMock := sqlmock.NewTxMockService()
+
+	txFn := func(dbc *DBContext) error { return nil }
+
+	// when
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true}, txMock, nil)
+	txMock.PatchCommit(nil)
+	sqlConn.PatchClose(nil)
+	err := service.WithTransaction(txFn, WithIsolationLevel(sql.LevelSerializable), WithReadOnly())
+
+	// then
+	ass.Nil(err)
+}
+
+func Test_WithTransaction_Retry_Success(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx := context.Background()
+	sqlConn := newDBConnMock()
+	txMock := sqlmock.NewTxMockService()
+
+	calls := 0
+	txFn := func(dbc *DBContext) error {
+		calls++
+		if calls == 1 {
+			return &pq.Error{Code: "40001"}
+		}
+		return nil
+	}
+
+	// when
+	for i := 0; i < 2; i++ {
+		sqlMock.PatchConn(ctx, sqlConn, nil)
+		sqlMock.PatchPingContext(ctx, nil)
+		sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+		sqlConn.PatchClose(nil)
+	}
+	txMock.PatchRollback(nil)
+	txMock.PatchCommit(nil)
+	err := service.WithTransaction(txFn, WithRetry(RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond}))
+
+	// then
+	ass.Nil(err)
+	ass.Equal(2, calls)
+}
+
+func Test_WithTransaction_Retry_Commit_Error_Closes_Connection(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx := context.Background()
+	firstConn := newDBConnMock()
+	secondConn := newDBConnMock()
+	txMock := sqlmock.NewTxMockService()
+
+	calls := 0
+	txFn := func(dbc *DBContext) error {
+		calls++
+		return nil
+	}
+
+	// when
+	for _, sqlConn := range []*sqlmock.SQLConnMock{firstConn, secondConn} {
+		sqlMock.PatchConn(ctx, sqlConn, nil)
+		sqlMock.PatchPingContext(ctx, nil)
+		sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+		sqlConn.PatchClose(nil)
+	}
+	txMock.PatchCommit(&pq.Error{Code: "40001"})
+	txMock.PatchCommit(nil)
+	err := service.WithTransaction(txFn, WithRetry(RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond}))
+
+	// then
+	ass.Nil(err)
+	ass.Equal(2, calls)
+	firstConn.AssertExpectations(t)
+	secondConn.AssertExpectations(t)
+}
+
+func Test_WithTransaction_Retry_Rollback_Error(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx := context.Background()
+	sqlConn := newDBConnMock()
+	txMock := sqlmock.NewTxMockService()
+
+	calls := 0
+	txFn := func(dbc *DBContext) error {
+		calls++
+		if calls == 1 {
+			return &pq.Error{Code: "40001"}
+		}
+		return nil
+	}
+
+	// when
+	for i := 0; i < 2; i++ {
+		sqlMock.PatchConn(ctx, sqlConn, nil)
+		sqlMock.PatchPingContext(ctx, nil)
+		sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+		sqlConn.PatchClose(nil)
+	}
+	txMock.PatchRollback(errors.New("rollback error"))
+	txMock.PatchCommit(nil)
+	err := service.WithTransaction(txFn, WithRetry(RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond}))
+
+	// then
+	ass.Nil(err)
+	ass.Equal(2, calls)
+	sqlConn.AssertExpectations(t)
+}
+
+func Test_WithTransaction_Retry_Exhausted(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx := context.Background()
+	sqlConn := newDBConnMock()
+	txMock := sqlmock.NewTxMockService()
+
+	calls := 0
+	deadlockErr := &pq.Error{Code: "40P01"}
+	txFn := func(dbc *DBContext) error {
+		calls++
+		return fmt.Errorf("updating: %w", deadlockErr)
+	}
+
+	// when
+	for i := 0; i < 3; i++ {
+		sqlMock.PatchConn(ctx, sqlConn, nil)
+		sqlMock.PatchPingContext(ctx, nil)
+		sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+		txMock.PatchRollback(nil)
+		sqlConn.PatchClose(nil)
+	}
+	err := service.WithTransaction(txFn, WithRetry(RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond}))
+
+	// then
+	ass.True(errors.Is(err, deadlockErr))
+	ass.Equal(3, calls)
+}
+
+func Test_WithTransaction_Retry_Not_Retryable(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx := context.Background()
+	sqlConn := newDBConnMock()
+	txMock := sqlmock.NewTxMockService()
+
+	calls := 0
+	testErr := &pq.Error{Code: "23505"}
+	txFn := func(dbc *DBContext) error {
+		calls++
+		return testErr
+	}
+
+	// when
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+	txMock.PatchRollback(nil)
+	sqlConn.PatchClose(nil)
+	err := service.WithTransaction(txFn, WithRetry(DefaultRetryPolicy))
+
+	// then
+	ass.EqualValues(testErr, err)
+	ass.Equal(1, calls)
+}
+
+func Test_WithTransactionContext_Retry_Cancelled(t *testing.T) {
+	// given
+	ass := assert.New(t)
+
+	config := ServiceConfig{
+		MaxConnectionRetries: 1,
+	}
+	service, sqlMock := newMockService(config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sqlConn := newDBConnMock()
+	txMock := sqlmock.NewTxMockService()
+
+	calls := 0
+	testErr := &pq.Error{Code: "40001"}
+	txFn := func(dbc *DBContext) error {
+		calls++
+		cancel()
+		return testErr
+	}
+
+	// when
+	sqlMock.PatchConn(ctx, sqlConn, nil)
+	sqlMock.PatchPingContext(ctx, nil)
+	sqlMock.PatchBeginTx(ctx, nil, txMock, nil)
+	txMock.PatchRollback(nil)
+	sqlConn.PatchClose(nil)
+	err := service.WithTransactionContext(ctx, txFn, WithRetry(RetryPolicy{MaxRetries: 3, InitialBackoff: time.Hour}))
+
+	// then
+	ass.EqualValues(testErr, err)
+	ass.Equal(1, calls)
+}
+
+func Test_RetryPolicy_Backoff(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	policy := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Multiplier:     2,
+	}
+
+	// when
+	first := policy.Backoff(0)
+	second := policy.Backoff(1)
+	capped := policy.Backoff(5)
+
+	// then
+	ass.True(first >= 50*time.Millisecond && first < 100*time.Millisecond)
+	ass.True(second >= 100*time.Millisecond && second < 200*time.Millisecond)
+	ass.True(capped >= 150*time.Millisecond && capped < 300*time.Millisecond)
+}
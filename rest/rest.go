@@ -35,6 +35,13 @@ type Rest interface {
 		timeout time.Duration) (int, []byte, error)
 }
 
+// ContextRest is implemented by the Rest services that can abort a request when its context is done.
+// The requests of Rest don't use the context of the flat.Context.
+type ContextRest interface {
+	MakePostRequestWithContext(ctx *flat.Context, url string, body interface{},
+		headers http.Header) (int, []byte, http.Header, error)
+}
+
 var (
 	// The changes here will affect to all requests
 	defaultRequestConfig = RequestConfig{
@@ -108,6 +108,20 @@ func (service *restyService) MakePostRequest(ctx *flat.Context, url string, body
 	return service.evaluateResponse(url, response, MakePostRequest, start, err)
 }
 
+// MakePostRequestWithContext works like MakePostRequest, but the request is aborted when the
+// context.Context of ctx is done
+func (service *restyService) MakePostRequestWithContext(ctx *flat.Context, url string, body interface{},
+	headers http.Header) (int, []byte, http.Header, error) {
+	start := time.Now()
+	req := service.restyClient.R()
+	req.SetContext(ctx.Context())
+	req.SetHeaderMultiValues(headers)
+	req.SetBody(body)
+
+	response, err := req.Post(url)
+	return service.evaluateResponse(url, response, MakePostRequest, start, err)
+}
+
 func (service *restyService) MakePutRequest(ctx *flat.Context, url string, body interface{}, headers http.Header) (int, []byte, http.Header, error) {
 	start := time.Now()
 	req := service.restyClient.R()
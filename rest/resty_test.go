@@ -0,0 +1,52 @@
+package rest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/FlatDigital/core-go-toolkit/v2/core/flat"
+	"github.com/FlatDigital/core-go-toolkit/v2/rest"
+)
+
+func Test_MakePostRequestWithContext_Cancelled(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	service, ok := rest.NewRestyService("test").(rest.ContextRest)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// when
+	cancel()
+	_, _, _, err := service.MakePostRequestWithContext(&flat.Context{Ctx: ctx}, server.URL, []byte(`{}`), http.Header{})
+
+	// then
+	ass.True(ok)
+	ass.True(errors.Is(err, context.Canceled))
+}
+
+func Test_MakePostRequest_Ignores_Context(t *testing.T) {
+	// given
+	ass := assert.New(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	service := rest.NewRestyService("test")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// when
+	cancel()
+	statusCode, _, _, err := service.MakePostRequest(&flat.Context{Ctx: ctx}, server.URL, []byte(`{}`), http.Header{})
+
+	// then
+	ass.Nil(err)
+	ass.Equal(http.StatusCreated, statusCode)
+}